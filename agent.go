@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/renatoathaydes/go-hash/encryption"
+)
+
+// defaultAgentTimeout how long the agent keeps a key after it was last used, by default.
+const defaultAgentTimeout = 15 * time.Minute
+
+// agentSocketEnvVar environment variable with the path of the agent's socket.
+const agentSocketEnvVar = "GO_HASH_AGENT_SOCK"
+
+// agentMessage a request to, or a response from, the agent. Messages are sent as JSON, one per line.
+type agentMessage struct {
+	// Op the operation requested: get, put or lock. Empty in responses.
+	Op string `json:",omitempty"`
+	// DB the absolute path of the database the key belongs to.
+	DB    string                `json:",omitempty"`
+	Salt  []byte                `json:",omitempty"`
+	P     []byte                `json:",omitempty"`
+	KDF   *encryption.KDFParams `json:",omitempty"`
+	Error string                `json:",omitempty"`
+}
+
+// agentSocketPath returns the path of the agent's Unix socket.
+func agentSocketPath() string {
+	if path := os.Getenv(agentSocketEnvVar); len(path) > 0 {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); len(dir) > 0 {
+		return filepath.Join(dir, "go-hash-agent.sock")
+	}
+	path, err := homedir.Expand("~/.go-hash-agent.sock")
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+// ============= Agent client ============= //
+
+// agentRequest sends a request to the agent and waits for its response.
+func agentRequest(request agentMessage) (agentMessage, error) {
+	var response agentMessage
+	conn, err := net.DialTimeout("unix", agentSocketPath(), time.Second)
+	if err != nil {
+		return response, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err = json.NewEncoder(conn).Encode(request); err != nil {
+		return response, err
+	}
+	if err = json.NewDecoder(bufio.NewReader(conn)).Decode(&response); err != nil {
+		return response, err
+	}
+	if len(response.Error) > 0 {
+		return response, errors.New(response.Error)
+	}
+	return response, nil
+}
+
+// agentDatabaseID identifies a database in the agent by its absolute path.
+func agentDatabaseID(dbPath string) string {
+	if abs, err := filepath.Abs(dbPath); err == nil {
+		return abs
+	}
+	return dbPath
+}
+
+// agentGetKey asks the agent for the key of the given database.
+// Returns false if no agent is running or the agent does not hold the key.
+func agentGetKey(dbPath string) (DatabaseKey, bool) {
+	response, err := agentRequest(agentMessage{Op: "get", DB: agentDatabaseID(dbPath)})
+	if err != nil || len(response.P) == 0 || response.KDF == nil {
+		return DatabaseKey{}, false
+	}
+	return DatabaseKey{Salt: response.Salt, P: response.P, KDF: *response.KDF}, true
+}
+
+// agentPutKey gives the key of the given database to the agent, if one is running.
+func agentPutKey(dbPath string, key DatabaseKey) {
+	agentRequest(agentMessage{Op: "put", DB: agentDatabaseID(dbPath), Salt: key.Salt, P: key.P, KDF: &key.KDF})
+}
+
+// agentLock tells the agent to wipe all keys it holds.
+func agentLock() error {
+	_, err := agentRequest(agentMessage{Op: "lock"})
+	return err
+}
+
+// readDatabaseWithAgent reads the database with the key held by the agent, if possible.
+func readDatabaseWithAgent(dbPath string) (State, Meta, DatabaseKey, bool) {
+	key, ok := agentGetKey(dbPath)
+	if !ok {
+		return nil, Meta{}, DatabaseKey{}, false
+	}
+	state, meta, err := ReadDatabaseWithKey(dbPath, key)
+	if err != nil {
+		// the password was probably changed since the key was given to the agent
+		return nil, Meta{}, DatabaseKey{}, false
+	}
+	return state, meta, key, true
+}
+
+// ============= Agent server ============= //
+
+// agentKey a key held by the agent, which is wiped when its timer fires.
+type agentKey struct {
+	key   DatabaseKey
+	timer *time.Timer
+}
+
+// agent holds the keys of unlocked databases in locked memory until they have not been used for some time.
+type agent struct {
+	mutex   sync.Mutex
+	keys    map[string]*agentKey
+	timeout time.Duration
+}
+
+// get returns a copy of the key of the given database, which the caller must wipe, as the key held by the agent
+// may be wiped by its timer at any moment.
+func (a *agent) get(db string) (DatabaseKey, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	k, ok := a.keys[db]
+	if !ok {
+		return DatabaseKey{}, false
+	}
+	k.timer.Reset(a.timeout)
+	return DatabaseKey{Salt: append([]byte{}, k.key.Salt...), P: append([]byte{}, k.key.P...), KDF: k.key.KDF}, true
+}
+
+func (a *agent) put(db string, key DatabaseKey) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.remove(db)
+	// copy the key into memory which cannot be swapped to disk
+	held := DatabaseKey{Salt: append([]byte{}, key.Salt...), P: append([]byte{}, key.P...), KDF: key.KDF}
+	lockMemory(held.P)
+	a.keys[db] = &agentKey{key: held, timer: time.AfterFunc(a.timeout, func() {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		if k, ok := a.keys[db]; ok && &k.key.P[0] == &held.P[0] {
+			a.remove(db)
+		}
+	})}
+}
+
+// remove wipes the key of the given database. Must be called while holding the mutex.
+func (a *agent) remove(db string) {
+	if k, ok := a.keys[db]; ok {
+		k.timer.Stop()
+		k.key.Wipe()
+		unlockMemory(k.key.P)
+		delete(a.keys, db)
+	}
+}
+
+func (a *agent) lock() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for db := range a.keys {
+		a.remove(db)
+	}
+}
+
+func (a *agent) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	var request, response agentMessage
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&request); err != nil {
+		return
+	}
+	switch request.Op {
+	case "get":
+		if key, ok := a.get(request.DB); ok {
+			response.Salt, response.P, response.KDF = key.Salt, key.P, &key.KDF
+		}
+	case "put":
+		if len(request.DB) == 0 || len(request.P) == 0 || request.KDF == nil {
+			response.Error = "missing database or key"
+		} else {
+			a.put(request.DB, DatabaseKey{Salt: request.Salt, P: request.P, KDF: *request.KDF})
+			DatabaseKey{P: request.P}.Wipe()
+		}
+	case "lock":
+		a.lock()
+	default:
+		response.Error = "unknown operation: " + request.Op
+	}
+	json.NewEncoder(conn).Encode(response)
+	// the key sent is a copy of the one held by the agent
+	DatabaseKey{P: response.P}.Wipe()
+}
+
+// removeStaleSocket removes the Unix socket at path, left by a server which did not exit cleanly, so that a new
+// server can listen there. Nothing is removed if anything other than a socket exists at path, or if a server
+// still answers on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.New(path + " exists and is not a socket")
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return errors.New("a server is already running at " + path)
+	}
+	return os.Remove(path)
+}
+
+func runAgentSubcommand(args []string) int {
+	fs := newFlagSet("agent")
+	timeout := fs.Duration("timeout", defaultAgentTimeout, "how long keys are kept after they were last used")
+	if _, err := parseArgs(fs, args); err != nil {
+		return exitUsage
+	}
+	if *timeout <= 0 {
+		return exitCodeOf(cliError{exitUsage, "the timeout must be positive"})
+	}
+
+	path := agentSocketPath()
+	if err := removeStaleSocket(path); err != nil {
+		return exitCodeOf(err)
+	}
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return exitCodeOf(err)
+	}
+
+	a := &agent{keys: make(map[string]*agentKey), timeout: *timeout}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "go-hash agent listening at %s (timeout: %s).\n", path, timeout.String())
+	fmt.Fprintf(os.Stderr, "Hint: to use a different socket, set the %s environment variable.\n", agentSocketEnvVar)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+		go a.handle(conn)
+	}
+	a.lock()
+	os.Remove(path)
+	return exitOK
+}
+
+func runLockSubcommand(args []string) int {
+	if positional, err := parseArgs(newFlagSet("lock"), args); err != nil || len(positional) > 0 {
+		return exitUsage
+	}
+	if err := agentLock(); err != nil {
+		return exitCodeOf(errors.New("no agent is running at " + agentSocketPath()))
+	}
+	return exitOK
+}
+
+const agentSubUsage = `
+Usage:
+  go-hash agent [-timeout <duration>]
+
+Runs the go-hash agent, which keeps the keys of unlocked databases in memory so that go-hash does not ask for
+the master password every time it is started. Run it in the background, e.g. 'go-hash agent &'.
+
+Keys are derived from the master password; the master password itself is never given to the agent.
+They are wiped when they have not been used for the given duration (15m by default), when 'go-hash lock'
+is run, or when the agent exits.
+
+The agent listens on a Unix socket which only the current user can access, at $` + agentSocketEnvVar + `,
+$XDG_RUNTIME_DIR/go-hash-agent.sock or ~/.go-hash-agent.sock.
+
+Example:
+  go-hash agent -timeout 1h &
+`
+
+const lockSubUsage = `
+Usage:
+  go-hash lock
+
+Tells the go-hash agent to wipe all keys immediately.
+`
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/renatoathaydes/go-hash/encryption"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestAgent starts an agent listening on a temporary socket, returning a function which stops it.
+func startTestAgent(t *testing.T, timeout time.Duration) func() {
+	dir, err := ioutil.TempDir("", "go-hash-agent")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "agent.sock")
+	listener, err := listenPrivate(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Skip("the agent is not supported on this platform: " + err.Error())
+	}
+	os.Setenv(agentSocketEnvVar, path)
+
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	a := &agent{keys: make(map[string]*agentKey), timeout: timeout}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go a.handle(conn)
+		}
+	}()
+	return func() {
+		listener.Close()
+		os.Unsetenv(agentSocketEnvVar)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAgent(t *testing.T) {
+	stop := startTestAgent(t, time.Minute)
+	defer stop()
+
+	_, ok := agentGetKey("db")
+	require.False(t, ok)
+
+	key := DatabaseKey{Salt: []byte{1, 2, 3}, P: []byte{4, 5, 6}, KDF: encryption.KDFParams{Time: 3, Memory: 1024, Threads: 2}}
+	agentPutKey("db", key)
+	held, ok := agentGetKey("db")
+	require.True(t, ok)
+	require.Equal(t, key, held)
+	// the agent wipes the copy of the key it sends, not the key it holds
+	held, ok = agentGetKey("db")
+	require.True(t, ok)
+	require.Equal(t, key, held)
+
+	_, ok = agentGetKey("other")
+	require.False(t, ok)
+
+	require.NoError(t, agentLock())
+	_, ok = agentGetKey("db")
+	require.False(t, ok)
+}
+
+func TestAgentTimeout(t *testing.T) {
+	stop := startTestAgent(t, 200*time.Millisecond)
+	defer stop()
+
+	agentPutKey("db", DatabaseKey{Salt: []byte{1}, P: []byte{2}})
+	time.Sleep(100 * time.Millisecond)
+	_, ok := agentGetKey("db")
+	require.True(t, ok, "using the key should reset the timeout")
+	time.Sleep(150 * time.Millisecond)
+	_, ok = agentGetKey("db")
+	require.True(t, ok)
+	time.Sleep(300 * time.Millisecond)
+	_, ok = agentGetKey("db")
+	require.False(t, ok)
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-hash-socket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, removeStaleSocket(filepath.Join(dir, "missing")))
+
+	file := filepath.Join(dir, "db")
+	require.NoError(t, ioutil.WriteFile(file, []byte("data"), 0600))
+	require.EqualError(t, removeStaleSocket(file), file+" exists and is not a socket")
+	_, err = os.Lstat(file)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "server.sock")
+	listener, err := listenPrivate(path)
+	if err != nil {
+		t.Skip("Unix sockets are not supported on this platform: " + err.Error())
+	}
+	require.EqualError(t, removeStaleSocket(path), "a server is already running at "+path)
+
+	// a server which did not exit cleanly leaves its socket behind
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	_, err = os.Lstat(path)
+	require.NoError(t, err)
+	require.NoError(t, removeStaleSocket(path))
+	_, err = os.Lstat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestReadDatabaseWithAgent(t *testing.T) {
+	stop := startTestAgent(t, time.Minute)
+	defer stop()
+
+	file, err := ioutil.TempFile("", "go-hash-agent-db")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	state := State{"default": []LoginInfo{{Name: "google", Password: "secret"}}}
+	key := NewDatabaseKey("master")
+	require.NoError(t, WriteDatabaseWithKey(file.Name(), key, &state, &Meta{}))
+
+	_, _, _, ok := readDatabaseWithAgent(file.Name())
+	require.False(t, ok)
+
+	agentPutKey(file.Name(), key)
+	read, _, readKey, ok := readDatabaseWithAgent(file.Name())
+	require.True(t, ok)
+	require.Equal(t, state, read)
+	require.Equal(t, key, readKey)
+
+	// after the password changes, the old key can no longer be used
+	require.NoError(t, WriteDatabase(file.Name(), "new master", &state, &Meta{}))
+	_, _, _, ok = readDatabaseWithAgent(file.Name())
+	require.False(t, ok)
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockMemory prevents the given memory from being swapped to disk, if the system allows it.
+func lockMemory(b []byte) {
+	if len(b) > 0 {
+		syscall.Mlock(b)
+	}
+}
+
+// unlockMemory undoes lockMemory.
+func unlockMemory(b []byte) {
+	if len(b) > 0 {
+		syscall.Munlock(b)
+	}
+}
+
+// listenPrivate listens on a Unix socket which only the current user can access.
+func listenPrivate(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	oldMask := syscall.Umask(0077)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// lockMemory is not supported on Windows.
+func lockMemory(b []byte) {}
+
+// unlockMemory is not supported on Windows.
+func unlockMemory(b []byte) {}
+
+// listenPrivate is not supported on Windows, so the agent and the API's Unix socket cannot be used there.
+func listenPrivate(path string) (net.Listener, error) {
+	return nil, errors.New("Unix sockets are not supported by go-hash on Windows")
+}
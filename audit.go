@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// defaultAuditMaxAgeDays the age, in days, after which a password is reported as old by the audit.
+const defaultAuditMaxAgeDays = 365
+
+// auditIssue kind of problem found by the audit.
+type auditIssue int
+
+const (
+	weakPassword auditIssue = iota
+	reusedPassword
+	similarPassword
+	oldPassword
+	insecureURL
+	missingURL
+	missingUsername
+)
+
+// auditIssueInfo describes an auditIssue.
+type auditIssueInfo struct {
+	title string
+	// penalty how much the issue lowers the score of an entry, from 1 to maxAuditPenalty.
+	penalty int
+	hint    string
+}
+
+// maxAuditPenalty the maximum penalty an entry may receive, regardless of how many issues it has.
+const maxAuditPenalty = 10
+
+var auditIssues = map[auditIssue]auditIssueInfo{
+	weakPassword: {"Weak passwords", 10,
+		"generate a strong password with 'entry -e <name>' within the entry's group."},
+	reusedPassword: {"Reused passwords", 8,
+		"if one website is breached, all accounts sharing its password are compromised. Use a different password for each entry."},
+	similarPassword: {"Similar passwords", 5,
+		"passwords derived from each other are easily guessed once one of them is known. Generate unrelated passwords instead."},
+	oldPassword: {"Old passwords", 3,
+		"change passwords regularly, and use the 'expire' command to be reminded about it."},
+	insecureURL: {"Insecure URLs", 3,
+		"passwords sent over http:// can be intercepted. Change the URL to https:// if the website supports it."},
+	missingURL: {"Missing URLs", 1,
+		"without a URL, phishing websites are harder to spot and the 'goto' command cannot be used. Add one with 'entry -e <name>'."},
+	missingUsername: {"Missing usernames", 1,
+		"add the username with 'entry -e <name>' so it can be copied with 'cp -u <name>'."},
+}
+
+// auditFinding a problem found in an entry by the audit.
+type auditFinding struct {
+	group  string
+	name   string
+	issue  auditIssue
+	detail string
+}
+
+// auditReport the result of auditing a State.
+type auditReport struct {
+	entries  int
+	groups   int
+	findings []auditFinding
+	// score from 0 (all entries have serious issues) to 100 (no issues found).
+	score int
+}
+
+// auditState checks all entries of the State for security problems.
+// Passwords older than maxAgeDays at the given time are reported as old.
+func auditState(state *State, maxAgeDays int, now time.Time) auditReport {
+	var report auditReport
+	type auditedEntry struct {
+		group string
+		entry *LoginInfo
+	}
+	var all []auditedEntry
+	groups := make([]string, 0, len(*state))
+	for group := range *state {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		entries := (*state)[group]
+		for i := range entries {
+			all = append(all, auditedEntry{group, &entries[i]})
+		}
+	}
+	report.entries = len(all)
+	report.groups = len(groups)
+
+	add := func(e auditedEntry, issue auditIssue, detail string) {
+		report.findings = append(report.findings, auditFinding{e.group, e.entry.Name, issue, detail})
+	}
+
+	byPassword := make(map[string][]string)
+	for _, e := range all {
+		if len(e.entry.Password) > 0 {
+			byPassword[e.entry.Password] = append(byPassword[e.entry.Password], entryPath(e.group, e.entry.Name))
+		}
+	}
+
+	maxAge := time.Duration(maxAgeDays) * 24 * time.Hour
+	for i, e := range all {
+		entry := e.entry
+
+		strength := estimateStrength(entry.Password, entry.Username, entry.Name, urlHost(entry.URL))
+		if strength.isWeak() {
+			add(e, weakPassword, strength.description())
+		}
+
+		if others := byPassword[entry.Password]; len(others) > 1 {
+			add(e, reusedPassword, "same as "+strings.Join(without(others, entryPath(e.group, entry.Name)), ", "))
+		}
+
+		var similar []string
+		for j, other := range all {
+			if i != j && arePasswordsSimilar(entry.Password, other.entry.Password) {
+				similar = append(similar, entryPath(other.group, other.entry.Name))
+			}
+		}
+		if len(similar) > 0 {
+			add(e, similarPassword, "similar to "+strings.Join(similar, ", "))
+		}
+
+		if updatedAt := entry.passwordUpdatedAt(); !updatedAt.IsZero() && now.Sub(updatedAt) > maxAge {
+			add(e, oldPassword, "last changed "+describeDaysFrom(now, updatedAt))
+		}
+
+		switch u := strings.TrimSpace(entry.URL); {
+		case len(u) == 0:
+			add(e, missingURL, "")
+		case strings.HasPrefix(strings.ToLower(u), "http://"):
+			add(e, insecureURL, u)
+		}
+
+		if len(strings.TrimSpace(entry.Username)) == 0 {
+			add(e, missingUsername, "")
+		}
+	}
+
+	report.score = auditScore(report.entries, report.findings)
+	return report
+}
+
+// auditScore calculates the score of an audit, from 0 to 100.
+func auditScore(entries int, findings []auditFinding) int {
+	if entries == 0 {
+		return 100
+	}
+	penalties := make(map[string]int)
+	for _, f := range findings {
+		path := entryPath(f.group, f.name)
+		penalties[path] += auditIssues[f.issue].penalty
+		if penalties[path] > maxAuditPenalty {
+			penalties[path] = maxAuditPenalty
+		}
+	}
+	total := 0
+	for _, p := range penalties {
+		total += p
+	}
+	return 100 - (100*total+entries*maxAuditPenalty-1)/(entries*maxAuditPenalty)
+}
+
+// arePasswordsSimilar returns true if two different passwords are so similar that one could be guessed from the
+// other, e.g. 'Summer2017!' and 'Summer2018!', or 'secret' and 'Secret123'.
+func arePasswordsSimilar(a, b string) bool {
+	if a == b || len(a) < 6 || len(b) < 6 {
+		return false
+	}
+	if letters := lettersOf(a); len(letters) >= 4 && letters == lettersOf(b) {
+		return true
+	}
+	return editDistance(a, b) <= 2
+}
+
+// lettersOf returns only the letters of a password, in lower-case.
+func lettersOf(password string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, password)
+}
+
+// editDistance calculates the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// urlHost returns the host name of a URL, or the empty string if it cannot be parsed.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+func without(items []string, item string) []string {
+	var result []string
+	for _, i := range items {
+		if i != item {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// scoreDescription describes an audit score in words.
+func scoreDescription(score int) string {
+	switch {
+	case score >= 90:
+		return "excellent"
+	case score >= 75:
+		return "good"
+	case score >= 50:
+		return "fair"
+	default:
+		return "poor"
+	}
+}
+
+// String human-readable representation of the audit report, with findings grouped by issue.
+func (report auditReport) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Audited %d entries in %d groups.\n", report.entries, report.groups)
+	for issue := weakPassword; issue <= missingUsername; issue++ {
+		var findings []auditFinding
+		for _, f := range report.findings {
+			if f.issue == issue {
+				findings = append(findings, f)
+			}
+		}
+		if len(findings) == 0 {
+			continue
+		}
+		info := auditIssues[issue]
+		fmt.Fprintf(&b, "\n%s (%d):\n", info.title, len(findings))
+		for _, f := range findings {
+			fmt.Fprintf(&b, "  %-32s %s\n", entryPath(f.group, f.name), f.detail)
+		}
+		fmt.Fprintf(&b, "  Hint: %s\n", info.hint)
+	}
+	if len(report.findings) == 0 {
+		b.WriteString("\nNo issues found.\n")
+	}
+	fmt.Fprintf(&b, "\nScore: %d/100 (%s)", report.score, scoreDescription(report.score))
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func findingsOf(report auditReport, issue auditIssue) []string {
+	var result []string
+	for _, f := range report.findings {
+		if f.issue == issue {
+			result = append(result, entryPath(f.group, f.name))
+		}
+	}
+	return result
+}
+
+func TestAuditState(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	recently := now.Add(-24 * time.Hour)
+	state := State{
+		"default": []LoginInfo{
+			{Name: "good", URL: "https://good.com", Username: "joe", Password: "vX7#qLp2!Rz9wK@e", UpdatedAt: recently},
+			{Name: "weak", URL: "https://weak.com", Username: "joe", Password: "password1", UpdatedAt: recently},
+			{Name: "old", URL: "http://old.com", Username: "joe", Password: "Gq8$mT3@zW5!kN7^",
+				UpdatedAt: now.Add(-400 * 24 * time.Hour)},
+		},
+		"work": []LoginInfo{
+			{Name: "a", Password: "Hy6^pE4!cR8#uJ2s", UpdatedAt: recently},
+			{Name: "b", URL: "https://b.com", Username: "joe", Password: "Hy6^pE4!cR8#uJ2s", UpdatedAt: recently},
+			{Name: "c", URL: "https://c.com", Username: "joe", Password: "Hy6^pE4!cR8#uJ3s", UpdatedAt: recently},
+		},
+	}
+
+	report := auditState(&state, defaultAuditMaxAgeDays, now)
+
+	require.Equal(t, 6, report.entries)
+	require.Equal(t, 2, report.groups)
+	require.Equal(t, []string{"weak"}, findingsOf(report, weakPassword))
+	require.Equal(t, []string{"work/a", "work/b"}, findingsOf(report, reusedPassword))
+	require.Equal(t, []string{"work/a", "work/b", "work/c"}, findingsOf(report, similarPassword))
+	require.Equal(t, []string{"old"}, findingsOf(report, oldPassword))
+	require.Equal(t, []string{"old"}, findingsOf(report, insecureURL))
+	require.Equal(t, []string{"work/a"}, findingsOf(report, missingURL))
+	require.Equal(t, []string{"work/a"}, findingsOf(report, missingUsername))
+	require.True(t, report.score > 0 && report.score < 100, "score: %d", report.score)
+
+	require.Empty(t, findingsOf(auditState(&state, 500, now), oldPassword))
+}
+
+func TestAuditScore(t *testing.T) {
+	require.Equal(t, 100, auditScore(0, nil))
+	require.Equal(t, 100, auditScore(2, nil))
+	require.Equal(t, 50, auditScore(2, []auditFinding{{"default", "a", weakPassword, ""}}))
+	require.Equal(t, 0, auditScore(1, []auditFinding{
+		{"default", "a", weakPassword, ""},
+		{"default", "a", reusedPassword, ""},
+	}))
+	require.Equal(t, 99, auditScore(10, []auditFinding{{"default", "a", missingURL, ""}}))
+}
+
+func TestArePasswordsSimilar(t *testing.T) {
+	require.True(t, arePasswordsSimilar("Summer2017!", "Summer2018!"))
+	require.True(t, arePasswordsSimilar("secret", "Secret123"))
+	require.False(t, arePasswordsSimilar("secret", "secret"))
+	require.False(t, arePasswordsSimilar("abc", "abd"))
+	require.False(t, arePasswordsSimilar("vX7#qLp2!Rz9wK@e", "Gq8$mT3@zW5!kN7^"))
+}
+
+func TestEditDistance(t *testing.T) {
+	require.Equal(t, 0, editDistance("", ""))
+	require.Equal(t, 3, editDistance("", "abc"))
+	require.Equal(t, 3, editDistance("kitten", "sitting"))
+	require.Equal(t, 1, editDistance("ação", "acão"))
+}
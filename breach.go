@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// breachFileEnvVar environment variable with the default path of the breach database.
+const breachFileEnvVar = "GO_HASH_BREACH_FILE"
+
+// breachDatabase a local copy of the Have I Been Pwned (HIBP) Pwned Passwords list, with SHA-1 hashes.
+//
+// Two formats are supported:
+//
+// * a single file with lines of the form HASH:COUNT, ordered by hash, as downloaded from HIBP.
+// * a directory with one file per hash range, named after the first 5 characters of the hashes
+//   (e.g. 5BAA6.txt), with lines of the form SUFFIX:COUNT, as returned by the HIBP range API.
+//
+// Lookups use binary search, so even multi-gigabyte files can be searched almost instantly.
+// Where possible, single files are memory-mapped.
+type breachDatabase struct {
+	dir   string
+	file  *os.File
+	data  io.ReaderAt
+	size  int64
+	unmap func() error
+}
+
+// breachedEntry an entry whose password appears in a breach database.
+type breachedEntry struct {
+	group string
+	name  string
+	count int
+}
+
+// openBreachDatabase opens the breach database at the given path, which may be a file or a directory.
+func openBreachDatabase(path string) (*breachDatabase, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return &breachDatabase{dir: path}, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	db := &breachDatabase{file: file, data: file, size: stat.Size()}
+	if data, unmap, err := mmapFile(file, stat.Size()); err == nil {
+		db.data = bytes.NewReader(data)
+		db.unmap = unmap
+	}
+	return db, nil
+}
+
+// Close releases the resources used by the breach database.
+func (db *breachDatabase) Close() error {
+	if db.unmap != nil {
+		db.unmap()
+	}
+	if db.file != nil {
+		return db.file.Close()
+	}
+	return nil
+}
+
+// lookup returns how many times the given password appears in breaches, or 0 if it does not appear.
+func (db *breachDatabase) lookup(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if db.dir == "" {
+		return searchSortedHashes(db.data, db.size, hash)
+	}
+	file, err := os.Open(filepath.Join(db.dir, hash[:5]+".txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, errors.New("breach database is incomplete, missing range file " + hash[:5] + ".txt")
+		}
+		return 0, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return searchSortedHashes(file, stat.Size(), hash[5:])
+}
+
+// searchSortedHashes searches for a hash in data containing lines of the form HASH:COUNT, sorted by hash.
+// Returns the count of the hash, or 0 if the hash is not found.
+func searchSortedHashes(data io.ReaderAt, size int64, hash string) (int, error) {
+	// invariant: if the hash exists, its line starts within [lo, hi)
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		lineStart, line, err := readLineFrom(data, mid, size)
+		if err != nil {
+			return 0, err
+		}
+		if lineStart >= hi {
+			hi = mid
+			continue
+		}
+		sep := bytes.IndexByte(line, ':')
+		if sep < 0 {
+			return 0, errors.New("invalid breach database, unexpected line: " + string(line))
+		}
+		switch cmp := strings.Compare(strings.ToUpper(string(line[:sep])), hash); {
+		case cmp == 0:
+			count, err := strconv.Atoi(string(bytes.TrimSpace(line[sep+1:])))
+			if err != nil {
+				return 0, errors.New("invalid breach database, unexpected line: " + string(line))
+			}
+			return count, nil
+		case cmp < 0:
+			lo = lineStart + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, nil
+}
+
+// readLineFrom reads the first line which starts at or after the given offset.
+// Returns the offset of the line and its contents, without the line terminator.
+func readLineFrom(data io.ReaderAt, offset, size int64) (int64, []byte, error) {
+	const chunkSize = 128
+	var lineStart int64
+	if offset > 0 {
+		// the line starts after the first line break at or after offset - 1
+		lineStart = -1
+		for pos := offset - 1; pos < size && lineStart < 0; pos += chunkSize {
+			chunk, err := readChunk(data, pos, size, chunkSize)
+			if err != nil {
+				return 0, nil, err
+			}
+			if i := bytes.IndexByte(chunk, '\n'); i >= 0 {
+				lineStart = pos + int64(i) + 1
+			}
+		}
+		if lineStart < 0 || lineStart >= size {
+			return size, nil, nil
+		}
+	}
+	var line []byte
+	for pos := lineStart; pos < size; pos += chunkSize {
+		chunk, err := readChunk(data, pos, size, chunkSize)
+		if err != nil {
+			return 0, nil, err
+		}
+		if i := bytes.IndexByte(chunk, '\n'); i >= 0 {
+			line = append(line, chunk[:i]...)
+			break
+		}
+		line = append(line, chunk...)
+	}
+	return lineStart, bytes.TrimSuffix(line, []byte{'\r'}), nil
+}
+
+func readChunk(data io.ReaderAt, pos, size int64, chunkSize int64) ([]byte, error) {
+	if pos+chunkSize > size {
+		chunkSize = size - pos
+	}
+	chunk := make([]byte, chunkSize)
+	_, err := data.ReadAt(chunk, pos)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// findBreachedEntries looks up the passwords of all entries in the breach database.
+// The result is sorted by group and entry name.
+func findBreachedEntries(state *State, db *breachDatabase) ([]breachedEntry, error) {
+	var result []breachedEntry
+	counts := make(map[string]int)
+	for group, entries := range *state {
+		for _, e := range entries {
+			count, checked := counts[e.Password]
+			if !checked {
+				var err error
+				count, err = db.lookup(e.Password)
+				if err != nil {
+					return nil, err
+				}
+				counts[e.Password] = count
+			}
+			if count > 0 {
+				result = append(result, breachedEntry{group, e.Name, count})
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].group == result[j].group {
+			return result[i].name < result[j].name
+		}
+		return result[i].group < result[j].group
+	})
+	return result, nil
+}
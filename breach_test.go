@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func writeBreachFile(t *testing.T, passwords map[string]int) string {
+	var lines []string
+	for password, count := range passwords {
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(password), count))
+	}
+	// add many other hashes, so that the binary search has some work to do
+	for i := 0; i < 2000; i++ {
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(fmt.Sprintf("other-%d", i)), i+1))
+	}
+	sort.Strings(lines)
+	file, err := ioutil.TempFile("", "go-hash-breach")
+	require.NoError(t, err)
+	_, err = file.WriteString(strings.Join(lines, "\r\n") + "\r\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	return file.Name()
+}
+
+func TestBreachDatabaseFile(t *testing.T) {
+	path := writeBreachFile(t, map[string]int{"password": 3861493, "123456": 24230577})
+	defer os.Remove(path)
+
+	db, err := openBreachDatabase(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	for password, expected := range map[string]int{
+		"password":  3861493,
+		"123456":    24230577,
+		"other-0":   1,
+		"other-999": 1000,
+		"not there": 0,
+		"":          0,
+	} {
+		count, err := db.lookup(password)
+		require.NoError(t, err)
+		require.Equal(t, expected, count, "count of '%s'", password)
+	}
+}
+
+func TestBreachDatabaseRangeDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-hash-breach-ranges")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hash := sha1Hex("password")
+	content := "1D2DA4053E34E76F6576ED1DA63134B5E2A:2\n" + hash[5:] + ":3861493\nFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:1\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(content), 0600))
+
+	db, err := openBreachDatabase(dir)
+	require.NoError(t, err)
+	defer db.Close()
+
+	count, err := db.lookup("password")
+	require.NoError(t, err)
+	require.Equal(t, 3861493, count)
+
+	_, err = db.lookup("not there")
+	require.Error(t, err, "missing range files should be reported")
+}
+
+func TestFindBreachedEntries(t *testing.T) {
+	path := writeBreachFile(t, map[string]int{"password": 10, "qwerty": 5})
+	defer os.Remove(path)
+	db, err := openBreachDatabase(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	state := State{
+		"default": []LoginInfo{{Name: "google", Password: "password"}},
+		"work":    []LoginInfo{{Name: "vpn", Password: "a-much-better-password"}, {Name: "aws", Password: "qwerty"}},
+	}
+	breached, err := findBreachedEntries(&state, db)
+	require.NoError(t, err)
+	require.Equal(t, []breachedEntry{{"default", "google", 10}, {"work", "aws", 5}}, breached)
+}
@@ -0,0 +1,89 @@
+// Package browser reads the logins saved by Firefox and by Chromium-based browsers on Linux.
+package browser
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/renatoathaydes/go-hash/sqlite"
+)
+
+// Login a login saved by a browser.
+type Login struct {
+	// URL the origin of the site the login is for, e.g. https://example.com
+	URL string
+	// Realm the realm of HTTP authentication, if the login is not for a form.
+	Realm    string
+	Username string
+	Password string
+	Created  time.Time
+	// PasswordChanged when the password was last changed, or the zero time if unknown.
+	PasswordChanged time.Time
+}
+
+// ErrInvalidPassword returned when the primary password of a Firefox profile is wrong.
+var ErrInvalidPassword = errors.New("invalid primary password")
+
+// ErrCorrupt returned when the saved logins or the keys protecting them are damaged.
+var ErrCorrupt = errors.New("the saved logins or their keys are damaged, or in an unsupported format")
+
+// readDatabase reads a SQLite database of a browser, reporting when it may be stale because the browser
+// is running, in which case changes may not have been written to it yet.
+func readDatabase(path string) (*sqlite.Database, error) {
+	if info, err := os.Stat(path + "-wal"); err == nil && info.Size() > 0 {
+		return nil, errors.New("the database is in use, please close the browser and try again")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return sqlite.Read(file)
+}
+
+// unpad removes the PKCS#7 padding of a decrypted value.
+func unpad(b []byte, blockSize int) ([]byte, error) {
+	if len(b) == 0 || len(b)%blockSize != 0 {
+		return nil, ErrCorrupt
+	}
+	n := int(b[len(b)-1])
+	if n == 0 || n > blockSize || n > len(b) {
+		return nil, ErrCorrupt
+	}
+	for _, p := range b[len(b)-n:] {
+		if int(p) != n {
+			return nil, ErrCorrupt
+		}
+	}
+	return b[:len(b)-n], nil
+}
+
+// value conversions of SQLite values, which are zero values if the value has another type.
+
+func textValue(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return ""
+}
+
+func blobValue(v interface{}) []byte {
+	switch b := v.(type) {
+	case []byte:
+		return b
+	case string:
+		return []byte(b)
+	}
+	return nil
+}
+
+func intValue(v interface{}) int64 {
+	if i, ok := v.(int64); ok {
+		return i
+	}
+	return 0
+}
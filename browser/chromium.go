@@ -0,0 +1,107 @@
+package browser
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"errors"
+	"time"
+
+	"github.com/golang/crypto/pbkdf2"
+	"github.com/renatoathaydes/go-hash/sqlite"
+)
+
+// On Linux, Chromium encrypts passwords with AES-128-CBC. Passwords prefixed with v10 use a key derived from
+// a fixed password, which Chromium falls back to when no desktop keyring is available. Passwords prefixed with
+// v11 use a key derived from a secret stored in the desktop keyring (e.g. GNOME Keyring or KWallet).
+const (
+	fallbackPrefix = "v10"
+	keyringPrefix  = "v11"
+	fallbackSecret = "peanuts"
+	chromiumSalt   = "saltysalt"
+)
+
+// ErrInvalidKeyringSecret returned when the keyring secret given to decrypt Chromium passwords is wrong.
+var ErrInvalidKeyringSecret = errors.New("invalid keyring secret")
+
+// ChromiumLogins reads the logins saved by a Chromium-based browser in its Login Data database.
+//
+// Passwords encrypted with the fallback key are always decrypted. Passwords encrypted with a key stored in the
+// desktop keyring are decrypted only if its secret is given, otherwise those logins are skipped and counted.
+func ChromiumLogins(path, keyringSecret string) (logins []Login, skipped int, err error) {
+	db, err := readDatabase(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	table, err := db.Table("logins")
+	if err != nil {
+		return nil, 0, err
+	}
+	return chromiumLogins(table, keyringSecret)
+}
+
+func chromiumLogins(table *sqlite.Table, keyringSecret string) (logins []Login, skipped int, err error) {
+	fallbackKey := chromiumKey(fallbackSecret)
+	var keyringKey []byte
+	if len(keyringSecret) > 0 {
+		keyringKey = chromiumKey(keyringSecret)
+	}
+	for _, row := range table.Rows {
+		// sites for which the user chose to never save passwords
+		if intValue(table.Get(row, "blacklisted_by_user")) != 0 {
+			continue
+		}
+		password := blobValue(table.Get(row, "password_value"))
+		switch {
+		case bytes.HasPrefix(password, []byte(fallbackPrefix)):
+			if password, err = decryptChromiumPassword(password[len(fallbackPrefix):], fallbackKey); err != nil {
+				return nil, 0, err
+			}
+		case bytes.HasPrefix(password, []byte(keyringPrefix)):
+			if keyringKey == nil {
+				skipped++
+				continue
+			}
+			if password, err = decryptChromiumPassword(password[len(keyringPrefix):], keyringKey); err != nil {
+				return nil, 0, ErrInvalidKeyringSecret
+			}
+		}
+		logins = append(logins, Login{
+			URL:             textValue(table.Get(row, "origin_url")),
+			Username:        textValue(table.Get(row, "username_value")),
+			Password:        string(password),
+			Created:         webkitToTime(intValue(table.Get(row, "date_created"))),
+			PasswordChanged: webkitToTime(intValue(table.Get(row, "date_password_modified"))),
+		})
+	}
+	return logins, skipped, nil
+}
+
+// chromiumKey derives the key encrypting passwords from a secret.
+func chromiumKey(secret string) []byte {
+	return pbkdf2.Key([]byte(secret), []byte(chromiumSalt), 1, 16, sha1.New)
+}
+
+func decryptChromiumPassword(encrypted, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted) == 0 || len(encrypted)%aes.BlockSize != 0 {
+		return nil, ErrCorrupt
+	}
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, bytes.Repeat([]byte{' '}, aes.BlockSize)).CryptBlocks(plain, encrypted)
+	return unpad(plain, aes.BlockSize)
+}
+
+// webkitToTime converts a number of microseconds since 1601-01-01, as stored by Chromium, into a time.
+func webkitToTime(micros int64) time.Time {
+	if micros <= 0 {
+		return time.Time{}
+	}
+	// seconds between 1601-01-01 and 1970-01-01
+	const unixEpoch = 11644473600
+	return time.Unix(micros/1000000-unixEpoch, micros%1000000*int64(time.Microsecond)).UTC()
+}
@@ -0,0 +1,65 @@
+package browser
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renatoathaydes/go-hash/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func encryptChromiumPassword(prefix, secret string, password []byte) []byte {
+	block, _ := aes.NewCipher(chromiumKey(secret))
+	padding := aes.BlockSize - len(password)%aes.BlockSize
+	plain := append(append([]byte{}, password...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, bytes.Repeat([]byte{' '}, aes.BlockSize)).CryptBlocks(encrypted, plain)
+	return append([]byte(prefix), encrypted...)
+}
+
+func TestChromiumLogins(t *testing.T) {
+	created := time.Date(2018, 6, 7, 8, 9, 10, 123456000, time.UTC)
+	webkitCreated := (created.Unix()+11644473600)*1000000 + 123456
+	table := &sqlite.Table{
+		Columns: []string{"origin_url", "username_value", "password_value", "date_created", "blacklisted_by_user"},
+		Rows: []sqlite.Row{
+			{"https://mail.example.com/", "joe", encryptChromiumPassword("v10", "peanuts", []byte("s3cr3t")),
+				webkitCreated, int64(0)},
+			{"https://bank.example.com/", "joe", encryptChromiumPassword("v11", "keyring", []byte("1234")),
+				int64(0), int64(0)},
+			{"https://never.example.com/", "", []byte{}, int64(0), int64(1)},
+		},
+	}
+
+	logins, skipped, err := chromiumLogins(table, "")
+	require.NoError(t, err)
+	require.Equal(t, 1, skipped)
+	require.Equal(t, []Login{{URL: "https://mail.example.com/", Username: "joe", Password: "s3cr3t",
+		Created: created}}, logins)
+
+	logins, skipped, err = chromiumLogins(table, "keyring")
+	require.NoError(t, err)
+	require.Equal(t, 0, skipped)
+	require.Len(t, logins, 2)
+	require.Equal(t, "1234", logins[1].Password)
+
+	_, _, err = chromiumLogins(table, "wrong")
+	require.Equal(t, ErrInvalidKeyringSecret, err)
+}
+
+func TestChromiumLoginsLongPassword(t *testing.T) {
+	// decrypted passwords are used as they are, whatever their length
+	password := strings.Repeat("s3cr3t", 10)
+	table := &sqlite.Table{
+		Columns: []string{"origin_url", "username_value", "password_value"},
+		Rows: []sqlite.Row{{"https://example.com/", "joe",
+			encryptChromiumPassword("v10", "peanuts", []byte(password))}},
+	}
+	logins, _, err := chromiumLogins(table, "")
+	require.NoError(t, err)
+	require.Equal(t, password, logins[0].Password)
+}
@@ -0,0 +1,331 @@
+package browser
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/crypto/pbkdf2"
+	"github.com/renatoathaydes/go-hash/sqlite"
+)
+
+// object identifiers of the algorithms used by NSS, the library managing the keys of Firefox.
+var (
+	oidPBEWithSHA1AndTripleDES = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 5, 1, 3}
+	oidPBES2                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1            = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256          = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidTripleDESCBC            = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidAES256CBC               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// passwordCheck the value encrypted with the primary password to check it.
+const passwordCheck = "password-check"
+
+// maxPBKDF2Iterations the maximum number of PBKDF2 iterations accepted, so that a crafted profile cannot keep
+// us deriving a key for hours. NSS uses 10000.
+const maxPBKDF2Iterations = 1 << 24
+
+// pbeData data encrypted with a key derived from a password.
+type pbeData struct {
+	Algorithm  pkix.AlgorithmIdentifier
+	Ciphertext []byte
+}
+
+type sha1TripleDESParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivation pkix.AlgorithmIdentifier
+	Encryption    pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// encryptedField a field of a login, encrypted with one of the keys of the profile.
+type encryptedField struct {
+	KeyID      []byte
+	Algorithm  pkix.AlgorithmIdentifier
+	Ciphertext []byte
+}
+
+// firefoxLogin a login of the logins.json file of a Firefox profile.
+type firefoxLogin struct {
+	Hostname            string `json:"hostname"`
+	HTTPRealm           string `json:"httpRealm"`
+	EncryptedUsername   string `json:"encryptedUsername"`
+	EncryptedPassword   string `json:"encryptedPassword"`
+	TimeCreated         int64  `json:"timeCreated"`
+	TimePasswordChanged int64  `json:"timePasswordChanged"`
+}
+
+// FirefoxProfile the saved logins of a Firefox profile, and the keys protecting them.
+type FirefoxProfile struct {
+	meta    *sqlite.Table
+	private *sqlite.Table
+	logins  []firefoxLogin
+}
+
+// OpenFirefoxProfile reads the saved logins of the Firefox profile in the given directory, from its logins.json
+// and key4.db files.
+func OpenFirefoxProfile(dir string) (*FirefoxProfile, error) {
+	keyPath := filepath.Join(dir, "key4.db")
+	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+		if _, err := os.Stat(filepath.Join(dir, "key3.db")); err == nil {
+			return nil, errors.New("profiles of Firefox versions older than 58, using key3.db, are not supported")
+		}
+		return nil, errors.New("key4.db not found, please give the directory of a Firefox profile")
+	}
+	db, err := readDatabase(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	profile := &FirefoxProfile{}
+	if profile.meta, err = db.Table("metaData"); err != nil {
+		return nil, err
+	}
+	if profile.private, err = db.Table("nssPrivate"); err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "logins.json"))
+	if os.IsNotExist(err) {
+		// there is no such file until a login is saved
+		return profile, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var logins struct {
+		Logins []firefoxLogin `json:"logins"`
+	}
+	if err = json.Unmarshal(content, &logins); err != nil {
+		return nil, ErrCorrupt
+	}
+	profile.logins = logins.Logins
+	return profile, nil
+}
+
+// Logins decrypts the saved logins with the primary password, which is empty if the profile has none.
+// Returns ErrInvalidPassword if the primary password is wrong.
+func (p *FirefoxProfile) Logins(primaryPassword string) ([]Login, error) {
+	keys, err := firefoxKeys(p.meta, p.private, primaryPassword)
+	if err != nil {
+		return nil, err
+	}
+	var logins []Login
+	for _, l := range p.logins {
+		username, err := decryptField(l.EncryptedUsername, keys)
+		if err != nil {
+			return nil, err
+		}
+		password, err := decryptField(l.EncryptedPassword, keys)
+		if err != nil {
+			return nil, err
+		}
+		logins = append(logins, Login{
+			URL:             l.Hostname,
+			Realm:           l.HTTPRealm,
+			Username:        username,
+			Password:        password,
+			Created:         millisToTime(l.TimeCreated),
+			PasswordChanged: millisToTime(l.TimePasswordChanged),
+		})
+	}
+	return logins, nil
+}
+
+// firefoxKeys checks the primary password, and decrypts the keys protecting the logins with it.
+// Returns the keys by ID.
+func firefoxKeys(meta, private *sqlite.Table, primaryPassword string) (map[string][]byte, error) {
+	var globalSalt, check []byte
+	for _, row := range meta.Rows {
+		if textValue(meta.Get(row, "id")) == "password" {
+			globalSalt, check = blobValue(meta.Get(row, "item1")), blobValue(meta.Get(row, "item2"))
+		}
+	}
+	if globalSalt == nil {
+		return nil, ErrCorrupt
+	}
+	plain, err := decryptPBE(check, globalSalt, primaryPassword)
+	if err != nil || string(plain) != passwordCheck {
+		return nil, ErrInvalidPassword
+	}
+	keys := make(map[string][]byte)
+	for _, row := range private.Rows {
+		encrypted := blobValue(private.Get(row, "a11"))
+		if len(encrypted) == 0 {
+			continue
+		}
+		key, err := decryptPBE(encrypted, globalSalt, primaryPassword)
+		if err != nil {
+			return nil, err
+		}
+		keys[string(blobValue(private.Get(row, "a102")))] = key
+	}
+	return keys, nil
+}
+
+// decryptPBE decrypts data encrypted with a key derived from the primary password and the global salt.
+func decryptPBE(data, globalSalt []byte, primaryPassword string) ([]byte, error) {
+	var encrypted pbeData
+	if rest, err := asn1.Unmarshal(data, &encrypted); err != nil || len(rest) > 0 {
+		return nil, ErrCorrupt
+	}
+	hashedPassword := sha1.Sum(append(append([]byte{}, globalSalt...), primaryPassword...))
+	params := encrypted.Algorithm.Parameters.FullBytes
+
+	switch {
+	case encrypted.Algorithm.Algorithm.Equal(oidPBEWithSHA1AndTripleDES):
+		var p sha1TripleDESParams
+		if _, err := asn1.Unmarshal(params, &p); err != nil {
+			return nil, ErrCorrupt
+		}
+		key, iv := sha1TripleDESKey(hashedPassword[:], p.Salt)
+		return decryptCBC(oidTripleDESCBC, key, iv, encrypted.Ciphertext)
+	case encrypted.Algorithm.Algorithm.Equal(oidPBES2):
+		var p pbes2Params
+		var kdf pbkdf2Params
+		if _, err := asn1.Unmarshal(params, &p); err != nil || !p.KeyDerivation.Algorithm.Equal(oidPBKDF2) {
+			return nil, ErrCorrupt
+		}
+		if _, err := asn1.Unmarshal(p.KeyDerivation.Parameters.FullBytes, &kdf); err != nil ||
+			kdf.Iterations < 1 || kdf.Iterations > maxPBKDF2Iterations || kdf.KeyLength < 0 || kdf.KeyLength > 32 {
+			return nil, ErrCorrupt
+		}
+		var prf func() hash.Hash
+		switch {
+		case kdf.PRF.Algorithm == nil, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+			prf = sha1.New
+		case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+			prf = sha256.New
+		default:
+			return nil, ErrCorrupt
+		}
+		keyLength := kdf.KeyLength
+		if keyLength == 0 {
+			keyLength = 32
+		}
+		key := pbkdf2.Key(hashedPassword[:], kdf.Salt, kdf.Iterations, keyLength, prf)
+		iv, err := cipherIV(p.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		return decryptCBC(p.Encryption.Algorithm, key, iv, encrypted.Ciphertext)
+	}
+	return nil, ErrCorrupt
+}
+
+// sha1TripleDESKey derives the key and IV of the pbeWithSha1AndTripleDES-CBC algorithm, as NSS does.
+func sha1TripleDESKey(hashedPassword, salt []byte) (key, iv []byte) {
+	paddedSalt := make([]byte, 20)
+	copy(paddedSalt, salt)
+	chp := sha1.Sum(append(append([]byte{}, hashedPassword...), salt...))
+	mac := func(parts ...[]byte) []byte {
+		h := hmac.New(sha1.New, chp[:])
+		for _, p := range parts {
+			h.Write(p)
+		}
+		return h.Sum(nil)
+	}
+	k1 := mac(paddedSalt, salt)
+	k2 := mac(mac(paddedSalt), salt)
+	k := append(k1, k2...)
+	return k[:24], k[len(k)-8:]
+}
+
+// cipherIV returns the IV of the encryption algorithm.
+func cipherIV(algorithm pkix.AlgorithmIdentifier) ([]byte, error) {
+	var iv []byte
+	if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, ErrCorrupt
+	}
+	// NSS uses the DER encoding of the 14-byte IV it stores as the 16-byte AES IV
+	if len(iv) == 14 {
+		iv = algorithm.Parameters.FullBytes
+	}
+	return iv, nil
+}
+
+// decryptCBC decrypts data with 3DES or AES-256 in CBC mode, and removes its padding.
+func decryptCBC(algorithm asn1.ObjectIdentifier, key, iv, ciphertext []byte) ([]byte, error) {
+	var block cipher.Block
+	var err error
+	switch {
+	case algorithm.Equal(oidTripleDESCBC):
+		if len(key) < 24 {
+			return nil, ErrCorrupt
+		}
+		block, err = des.NewTripleDESCipher(key[:24])
+	case algorithm.Equal(oidAES256CBC):
+		if len(key) < 32 {
+			return nil, ErrCorrupt
+		}
+		block, err = aes.NewCipher(key[:32])
+	default:
+		return nil, ErrCorrupt
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return nil, ErrCorrupt
+	}
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+	return unpad(plain, block.BlockSize())
+}
+
+// decryptField decrypts a base64-encoded field of a login.
+func decryptField(value string, keys map[string][]byte) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	var field encryptedField
+	if rest, err := asn1.Unmarshal(data, &field); err != nil || len(rest) > 0 {
+		return "", ErrCorrupt
+	}
+	key, ok := keys[string(field.KeyID)]
+	if !ok {
+		return "", ErrCorrupt
+	}
+	iv, err := cipherIV(field.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	plain, err := decryptCBC(field.Algorithm.Algorithm, key, iv, field.Ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// millisToTime converts a number of milliseconds since the Unix epoch into a time.
+func millisToTime(millis int64) time.Time {
+	if millis <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(millis/1000, millis%1000*int64(time.Millisecond)).UTC()
+}
@@ -0,0 +1,161 @@
+package browser
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/golang/crypto/pbkdf2"
+	"github.com/renatoathaydes/go-hash/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	globalSalt = bytes.Repeat([]byte{1}, 20)
+	keyID      = []byte("\xf8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01")
+)
+
+func encryptCBC(block cipher.Block, iv, plain []byte) []byte {
+	padding := block.BlockSize() - len(plain)%block.BlockSize()
+	plain = append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+	return encrypted
+}
+
+func algorithm(t *testing.T, oid asn1.ObjectIdentifier, params interface{}) pkix.AlgorithmIdentifier {
+	b, err := asn1.Marshal(params)
+	require.NoError(t, err)
+	return pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.RawValue{FullBytes: b}}
+}
+
+// encryptPBES2 encrypts data as current versions of NSS do: with AES-256, using a key derived with PBKDF2.
+func encryptPBES2(t *testing.T, primaryPassword string, plain []byte) []byte {
+	hashedPassword := sha1.Sum(append(append([]byte{}, globalSalt...), primaryPassword...))
+	salt := bytes.Repeat([]byte{2}, 32)
+	key := pbkdf2.Key(hashedPassword[:], salt, 10000, 32, sha256.New)
+	iv := bytes.Repeat([]byte{3}, 14)
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	encrypted := encryptCBC(block, append([]byte{0x04, 0x0e}, iv...), plain)
+	data, err := asn1.Marshal(pbeData{
+		Algorithm: algorithm(t, oidPBES2, pbes2Params{
+			KeyDerivation: algorithm(t, oidPBKDF2, pbkdf2Params{Salt: salt, Iterations: 10000, KeyLength: 32,
+				PRF: pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue}}),
+			Encryption: algorithm(t, oidAES256CBC, iv),
+		}),
+		Ciphertext: encrypted,
+	})
+	require.NoError(t, err)
+	return data
+}
+
+// encryptSHA1TripleDES encrypts data as versions of NSS older than 3.49 do.
+func encryptSHA1TripleDES(t *testing.T, primaryPassword string, plain []byte) []byte {
+	hashedPassword := sha1.Sum(append(append([]byte{}, globalSalt...), primaryPassword...))
+	salt := bytes.Repeat([]byte{4}, 20)
+	key, iv := sha1TripleDESKey(hashedPassword[:], salt)
+	block, err := des.NewTripleDESCipher(key)
+	require.NoError(t, err)
+	data, err := asn1.Marshal(pbeData{
+		Algorithm:  algorithm(t, oidPBEWithSHA1AndTripleDES, sha1TripleDESParams{Salt: salt, Iterations: 1}),
+		Ciphertext: encryptCBC(block, iv, plain),
+	})
+	require.NoError(t, err)
+	return data
+}
+
+func encryptLoginField(t *testing.T, key []byte, value string) string {
+	var field encryptedField
+	var block cipher.Block
+	var err error
+	iv := bytes.Repeat([]byte{5}, 8)
+	if len(key) == 24 {
+		block, err = des.NewTripleDESCipher(key)
+		field.Algorithm = algorithm(t, oidTripleDESCBC, iv)
+	} else {
+		iv = bytes.Repeat([]byte{5}, 16)
+		block, err = aes.NewCipher(key)
+		field.Algorithm = algorithm(t, oidAES256CBC, iv)
+	}
+	require.NoError(t, err)
+	field.KeyID = keyID
+	field.Ciphertext = encryptCBC(block, iv, []byte(value))
+	data, err := asn1.Marshal(field)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestFirefoxLogins(t *testing.T) {
+	type encrypt func(t *testing.T, primaryPassword string, plain []byte) []byte
+	created := time.Date(2018, 6, 7, 8, 9, 10, 123000000, time.UTC)
+	for _, test := range []struct {
+		encrypt encrypt
+		key     []byte
+	}{
+		{encryptPBES2, bytes.Repeat([]byte{6}, 24)},
+		{encryptPBES2, bytes.Repeat([]byte{6}, 32)},
+		{encryptSHA1TripleDES, bytes.Repeat([]byte{6}, 24)},
+	} {
+		for _, primaryPassword := range []string{"", "primary"} {
+			profile := &FirefoxProfile{
+				meta: &sqlite.Table{Columns: []string{"id", "item1", "item2"}, Rows: []sqlite.Row{
+					{"password", globalSalt, test.encrypt(t, primaryPassword, []byte(passwordCheck))},
+				}},
+				private: &sqlite.Table{Columns: []string{"id", "a11", "a102"}, Rows: []sqlite.Row{
+					{int64(1), test.encrypt(t, primaryPassword, test.key), keyID},
+				}},
+				logins: []firefoxLogin{{
+					Hostname:            "https://mail.example.com",
+					EncryptedUsername:   encryptLoginField(t, test.key, "joe"),
+					EncryptedPassword:   encryptLoginField(t, test.key, "a password longer than a block"),
+					TimeCreated:         created.UnixNano() / int64(time.Millisecond),
+					TimePasswordChanged: created.UnixNano() / int64(time.Millisecond),
+				}, {
+					Hostname:          "https://intranet.example.com",
+					HTTPRealm:         "Intranet",
+					EncryptedUsername: encryptLoginField(t, test.key, ""),
+					EncryptedPassword: encryptLoginField(t, test.key, "1234"),
+				}},
+			}
+
+			logins, err := profile.Logins(primaryPassword)
+			require.NoError(t, err)
+			require.Equal(t, []Login{
+				{URL: "https://mail.example.com", Username: "joe", Password: "a password longer than a block",
+					Created: created, PasswordChanged: created},
+				{URL: "https://intranet.example.com", Realm: "Intranet", Password: "1234"},
+			}, logins)
+
+			_, err = profile.Logins("wrong")
+			require.Equal(t, ErrInvalidPassword, err)
+		}
+	}
+}
+
+func TestFirefoxPBES2Limits(t *testing.T) {
+	for _, params := range []pbkdf2Params{
+		{Salt: globalSalt, Iterations: maxPBKDF2Iterations + 1, KeyLength: 32},
+		{Salt: globalSalt, Iterations: 0, KeyLength: 32},
+		{Salt: globalSalt, Iterations: 10000, KeyLength: 1 << 30},
+	} {
+		data, err := asn1.Marshal(pbeData{
+			Algorithm: algorithm(t, oidPBES2, pbes2Params{
+				KeyDerivation: algorithm(t, oidPBKDF2, params),
+				Encryption:    algorithm(t, oidAES256CBC, bytes.Repeat([]byte{3}, 16)),
+			}),
+			Ciphertext: bytes.Repeat([]byte{7}, 16),
+		})
+		require.NoError(t, err)
+		_, err = decryptPBE(data, globalSalt, "")
+		require.Equal(t, ErrCorrupt, err)
+	}
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Exit codes of the non-interactive subcommands.
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+	exitAuth     = 4
+)
+
+// subcommand a command which runs non-interactively, e.g. 'go-hash get work/github'.
+type subcommand struct {
+	usage string
+	run   func(args []string) int
+}
+
+// subcommands returns the non-interactive subcommands, by name.
+func subcommands() map[string]subcommand {
+	return map[string]subcommand{
+		"get":     {getSubUsage, runGetSubcommand},
+		"ls":      {lsSubUsage, runLsSubcommand},
+		"add":     {addSubUsage, runAddSubcommand},
+		"set":     {setSubUsage, runSetSubcommand},
+		"rm":      {rmSubUsage, runRmSubcommand},
+		"gen":     {genSubUsage, runGenSubcommand},
+		"agent":   {agentSubUsage, runAgentSubcommand},
+		"lock":    {lockSubUsage, runLockSubcommand},
+		"info":    {infoSubUsage, runInfoSubcommand},
+		"serve":   {serveSubUsage, runServeSubcommand},
+		"recover": {recoverSubUsage, runRecoverSubcommand},
+	}
+}
+
+// cliError an error which causes a subcommand to exit with the given code.
+type cliError struct {
+	code    int
+	message string
+}
+
+func (e cliError) Error() string {
+	return e.message
+}
+
+// stdinReader shared by everything reading from stdin, so that buffered input is not lost.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// secretSource where a secret, such as the master password, is read from.
+type secretSource struct {
+	stdin bool
+	fd    int
+	env   string
+}
+
+// addFlags adds the flags selecting the source of a secret to the flag set, using the given name prefix.
+func (src *secretSource) addFlags(fs *flag.FlagSet, prefix, description string) {
+	fs.BoolVar(&src.stdin, prefix+"-stdin", false, "read the "+description+" from the first line of stdin")
+	fs.IntVar(&src.fd, prefix+"-fd", -1, "read the "+description+" from the given file descriptor")
+	fs.StringVar(&src.env, prefix+"-env", "", "read the "+description+" from the given environment variable")
+}
+
+func (src *secretSource) isSet() bool {
+	return src.stdin || src.fd >= 0 || len(src.env) > 0
+}
+
+// read reads the secret from its source, or returns ok = false if no source was selected.
+func (src *secretSource) read() (secret string, ok bool, err error) {
+	switch {
+	case src.stdin:
+		secret, err = readSecretLine(stdinReader)
+	case src.fd >= 0:
+		file := os.NewFile(uintptr(src.fd), "fd"+strconv.Itoa(src.fd))
+		if file == nil {
+			return "", false, errors.New("invalid file descriptor: " + strconv.Itoa(src.fd))
+		}
+		secret, err = readSecretLine(bufio.NewReader(file))
+		file.Close()
+	case len(src.env) > 0:
+		var exists bool
+		secret, exists = os.LookupEnv(src.env)
+		if !exists {
+			err = errors.New("environment variable is not set: " + src.env)
+		}
+	default:
+		return "", false, nil
+	}
+	return secret, err == nil, err
+}
+
+// readSecretLine reads a single line, without the line terminator.
+func readSecretLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return "", errors.New("unable to read secret: " + err.Error())
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// databaseOptions options used by all subcommands which open the database.
+type databaseOptions struct {
+	path     string
+	password secretSource
+}
+
+func (opts *databaseOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.path, "db", defaultDatabasePath(), "path of the database file (default: $GO_HASH_DB or ~/.go-hash)")
+	opts.password.addFlags(fs, "pass", "master password")
+}
+
+// defaultDatabasePath returns the database file used by subcommands when none is given.
+func defaultDatabasePath() string {
+	if path := os.Getenv("GO_HASH_DB"); len(path) > 0 {
+		return path
+	}
+	return getGoHashFilePath()
+}
+
+// open reads the database. If no source of the master password was selected, the key held by the go-hash agent
+// is used if possible, otherwise the master password is prompted for in the terminal, if there is one.
+func (opts *databaseOptions) open() (state State, meta Meta, key DatabaseKey, err error) {
+	if _, statErr := os.Stat(opts.path); statErr != nil {
+		return nil, Meta{}, key, cliError{exitError, "cannot open database: " + statErr.Error()}
+	}
+	password, ok, err := opts.password.read()
+	if err != nil {
+		return nil, Meta{}, key, cliError{exitUsage, err.Error()}
+	}
+	if !ok {
+		var unlocked bool
+		if state, meta, key, unlocked = readDatabaseWithAgent(opts.path); unlocked {
+			prepareState(&state)
+			return state, meta, key, nil
+		}
+		if !terminal.IsTerminal(int(syscall.Stdin)) {
+			return nil, Meta{}, key, cliError{exitUsage,
+				"no master password provided, use one of -pass-stdin, -pass-fd or -pass-env"}
+		}
+		print("Please enter your master password: ")
+		bytePassword, readErr := terminal.ReadPassword(int(syscall.Stdin))
+		println("")
+		if readErr != nil {
+			return nil, Meta{}, key, cliError{exitError, readErr.Error()}
+		}
+		password = string(bytePassword)
+	}
+	key, err = DeriveDatabaseKey(opts.path, password)
+	if err == nil {
+		state, meta, err = ReadDatabaseWithKey(opts.path, key)
+	}
+	if err != nil {
+		return nil, Meta{}, key, cliError{exitAuth, err.Error()}
+	}
+	agentPutKey(opts.path, key)
+	prepareState(&state)
+	return state, meta, key, nil
+}
+
+// runSubcommand runs the subcommand with the given name, returning the process exit code.
+func runSubcommand(name string, args []string) int {
+	cmd, exists := subcommands()[name]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Error: unknown command '%s'.\n", name)
+		return exitUsage
+	}
+	for _, arg := range args {
+		if arg == "-h" || arg == "-help" || arg == "--help" {
+			fmt.Fprint(os.Stderr, cmd.usage)
+			return exitOK
+		}
+	}
+	code := cmd.run(args)
+	if code == exitUsage {
+		fmt.Fprintf(os.Stderr, "Hint: type 'go-hash %s -help' for usage.\n", name)
+	}
+	return code
+}
+
+// newFlagSet creates a flag set which reports errors instead of exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {}
+	return fs
+}
+
+// parseArgs parses the flags of a subcommand, which may appear before or after its positional arguments,
+// and returns the positional arguments. All arguments after '--' are positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		remaining := fs.Args()
+		if parsed := args[:len(args)-len(remaining)]; len(parsed) > 0 && parsed[len(parsed)-1] == "--" {
+			return append(positional, remaining...), nil
+		}
+		if len(remaining) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, remaining[0])
+		args = remaining[1:]
+	}
+}
+
+// exitCodeOf reports an error and returns the exit code it should cause.
+func exitCodeOf(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "Error: %s.\n", err.Error())
+	if e, ok := err.(cliError); ok {
+		return e.code
+	}
+	return exitError
+}
+
+func runGetSubcommand(args []string) int {
+	var opts databaseOptions
+	fs := newFlagSet("get")
+	opts.addFlags(fs)
+	field := fs.String("field", "password", "the field to print")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		return exitCodeOf(cliError{exitUsage, "please provide the <group>/<entry> to get"})
+	}
+	state, _, _, err := opts.open()
+	if err != nil {
+		return exitCodeOf(err)
+	}
+	group, index, found := state.resolveEntry(rootGroup, positional[0])
+	if !found {
+		return exitCodeOf(cliError{exitNotFound, "entry '" + positional[0] + "' does not exist"})
+	}
+	value, err := entryField(&state[group][index], *field)
+	if err != nil {
+		return exitCodeOf(cliError{exitUsage, err.Error()})
+	}
+	fmt.Println(value)
+	return exitOK
+}
+
+// entryField returns the value of the field of an entry with the given name.
+func entryField(entry *LoginInfo, field string) (string, error) {
+	switch strings.ToLower(field) {
+	case "password":
+		return entry.Password, nil
+	case "username", "user":
+		return entry.Username, nil
+	case "url":
+		return entry.URL, nil
+	case "description", "desc":
+		return entry.Description, nil
+	case "name":
+		return entry.Name, nil
+	case "tags":
+		return strings.Join(entry.Tags, ","), nil
+	case "expiry":
+		return entry.Expiry.String(), nil
+	case "updated":
+		return entry.UpdatedAt.Format(time.RFC3339), nil
+	}
+	return "", errors.New("unknown field: " + field)
+}
+
+func runLsSubcommand(args []string) int {
+	var opts databaseOptions
+	fs := newFlagSet("ls")
+	opts.addFlags(fs)
+	recursive := fs.Bool("r", false, "also list the contents of subgroups")
+	groupsOnly := fs.Bool("g", false, "list groups instead of entries")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) > 1 {
+		return exitCodeOf(cliError{exitUsage, "too many arguments"})
+	}
+	state, _, _, err := opts.open()
+	if err != nil {
+		return exitCodeOf(err)
+	}
+	group := rootGroup
+	if len(positional) == 1 {
+		group = resolveGroupPath(rootGroup, positional[0])
+	}
+	if _, exists := state[group]; !exists {
+		return exitCodeOf(cliError{exitNotFound, "group '" + group + "' does not exist"})
+	}
+
+	if *groupsOnly {
+		for _, gr := range state.subgroups(group) {
+			if gr != group && (*recursive || parentGroup(gr) == group) {
+				fmt.Println(gr)
+			}
+		}
+		return exitOK
+	}
+
+	groups := []string{group}
+	if *recursive {
+		groups = state.subgroups(group)
+	}
+	for _, gr := range groups {
+		names := make([]string, 0, len(state[gr]))
+		for _, e := range state[gr] {
+			names = append(names, e.Name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(entryPath(gr, quoteEntryName(name)))
+		}
+	}
+	return exitOK
+}
+
+// entryOptions options of the subcommands which create or modify an entry.
+type entryOptions struct {
+	username, url, description, tags, expiry, profile string
+	generate                                          bool
+	secret                                            secretSource
+}
+
+func (opts *entryOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.username, "username", "", "the username")
+	fs.StringVar(&opts.url, "url", "", "the URL")
+	fs.StringVar(&opts.description, "description", "", "the description")
+	fs.StringVar(&opts.tags, "tags", "", "comma-separated tags")
+	fs.StringVar(&opts.expiry, "expiry", "", "when the password expires (YYYY-MM-DD, <n>d/w/m/y or none)")
+	fs.BoolVar(&opts.generate, "gen", false, "generate the password")
+	fs.StringVar(&opts.profile, "profile", defaultProfile, "the profile used to generate the password")
+	opts.secret.addFlags(fs, "secret", "entry's password")
+}
+
+// apply applies the options to the entry. Only options that were given on the command line are applied.
+func (opts *entryOptions) apply(fs *flag.FlagSet, entry *LoginInfo, meta *Meta) error {
+	var err error
+	now := time.Now()
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "username":
+			entry.Username = opts.username
+		case "url":
+			entry.URL = opts.url
+		case "description":
+			entry.Description = opts.description
+		case "tags":
+			entry.Tags = nil
+			entry.addTags(strings.FieldsFunc(opts.tags, func(r rune) bool { return r == ',' || r == ' ' }))
+		case "expiry":
+			var expiry Expiry
+			if expiry, err = parseExpiry(opts.expiry); err == nil {
+				entry.Expiry = expiry
+			}
+		}
+	})
+	if err != nil {
+		return cliError{exitUsage, err.Error()}
+	}
+
+	if opts.generate && opts.secret.isSet() {
+		return cliError{exitUsage, "the -gen option cannot be used with -secret-stdin, -secret-fd or -secret-env"}
+	}
+	if opts.generate {
+		profile, err := parseProfile(opts.profile, meta.Profiles)
+		if err != nil {
+			return cliError{exitUsage, err.Error()}
+		}
+		entry.Password = profile.generate()
+		entry.Generator = profile.String()
+		entry.PasswordUpdatedAt = now
+	} else if password, ok, err := opts.secret.read(); err != nil {
+		return cliError{exitUsage, err.Error()}
+	} else if ok {
+		if len(password) < 4 {
+			return cliError{exitUsage, "password too short, please use at least 4 characters"}
+		}
+		if strength := estimateStrength(password, entry.Name, entry.Username, entry.URL); strength.isWeak() {
+			fmt.Fprintf(os.Stderr, "Warning: the password of '%s' is %s.\n", entry.Name, strength.description())
+		}
+		entry.Password = password
+		entry.Generator = ""
+		entry.PasswordUpdatedAt = now
+	}
+	entry.UpdatedAt = now
+	return nil
+}
+
+func runAddSubcommand(args []string) int {
+	var opts databaseOptions
+	var entryOpts entryOptions
+	fs := newFlagSet("add")
+	opts.addFlags(fs)
+	entryOpts.addFlags(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		return exitCodeOf(cliError{exitUsage, "please provide the <group>/<entry> to add"})
+	}
+	if !entryOpts.generate && !entryOpts.secret.isSet() {
+		return exitCodeOf(cliError{exitUsage, "please provide the password with -secret-stdin, -secret-fd " +
+			"or -secret-env, or generate it with -gen"})
+	}
+	state, meta, key, err := opts.open()
+	if err != nil {
+		return exitCodeOf(err)
+	}
+	groupPath, name, err := parseEntryAddress(positional[0])
+	if err != nil || len(name) == 0 {
+		return exitCodeOf(cliError{exitUsage, "invalid entry: " + positional[0]})
+	}
+	group := resolveGroupPath(rootGroup, groupPath)
+	entries := state[group]
+	if _, exists := findEntryIndex(&entries, name); exists {
+		return exitCodeOf(cliError{exitError, "entry '" + positional[0] + "' already exists, use 'set' to change it"})
+	}
+	entry := LoginInfo{Name: name}
+	if err = entryOpts.apply(fs, &entry, &meta); err != nil {
+		return exitCodeOf(err)
+	}
+	state.ensureGroup(group)
+	state[group] = append(state[group], entry)
+	return exitCodeOf(WriteDatabaseWithKey(opts.path, key, &state, &meta))
+}
+
+func runSetSubcommand(args []string) int {
+	var opts databaseOptions
+	var entryOpts entryOptions
+	fs := newFlagSet("set")
+	opts.addFlags(fs)
+	entryOpts.addFlags(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		return exitCodeOf(cliError{exitUsage, "please provide the <group>/<entry> to change"})
+	}
+	state, meta, key, err := opts.open()
+	if err != nil {
+		return exitCodeOf(err)
+	}
+	group, index, found := state.resolveEntry(rootGroup, positional[0])
+	if !found {
+		return exitCodeOf(cliError{exitNotFound, "entry '" + positional[0] + "' does not exist"})
+	}
+	if err = entryOpts.apply(fs, &state[group][index], &meta); err != nil {
+		return exitCodeOf(err)
+	}
+	return exitCodeOf(WriteDatabaseWithKey(opts.path, key, &state, &meta))
+}
+
+func runRmSubcommand(args []string) int {
+	var opts databaseOptions
+	fs := newFlagSet("rm")
+	opts.addFlags(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) != 1 {
+		return exitCodeOf(cliError{exitUsage, "please provide the <group>/<entry> to remove"})
+	}
+	state, meta, key, err := opts.open()
+	if err != nil {
+		return exitCodeOf(err)
+	}
+	group, index, found := state.resolveEntry(rootGroup, positional[0])
+	if !found {
+		return exitCodeOf(cliError{exitNotFound, "entry '" + positional[0] + "' does not exist"})
+	}
+	entries := state[group]
+	state[group], _ = removeEntryFrom(&entries, entries[index].Name)
+	return exitCodeOf(WriteDatabaseWithKey(opts.path, key, &state, &meta))
+}
+
+func runGenSubcommand(args []string) int {
+	fs := newFlagSet("gen")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	profile, err := parseProfile(strings.Join(positional, " "), nil)
+	if err != nil {
+		return exitCodeOf(cliError{exitUsage, err.Error()})
+	}
+	fmt.Println(profile.generate())
+	return exitOK
+}
+
+const cliUsage = `
+Usage:
+  go-hash [<database-file>]        start an interactive session.
+  go-hash <command> [<options>]    run a single command, for use in scripts.
+
+Commands:
+  get   print a field of an entry.
+  ls    list entries or groups.
+  add   add an entry.
+  set   change an entry.
+  rm    remove an entry.
+  gen   generate a password.
+  agent run the agent, which keeps databases unlocked for some time.
+  lock  lock all databases held by the agent.
+  recover  restore a database from an emergency kit.
+  info  print information about a database file.
+  serve serve a JSON API for other programs on this computer.
+
+Type 'go-hash <command> -help' for the usage of a command.
+`
+
+const databaseOptionsUsage = `
+Database options:
+  -db <path>         the database file (default: $GO_HASH_DB, or ~/.go-hash).
+  -pass-stdin        read the master password from the first line of stdin.
+  -pass-fd <fd>      read the master password from the given file descriptor.
+  -pass-env <var>    read the master password from the given environment variable.
+
+If no master password option is given, the database is unlocked by the go-hash agent if it holds its key
+(see 'go-hash agent -help'), or else the master password is prompted for if a terminal is available.
+
+Exit codes: 0 = success, 1 = error, 2 = invalid usage, 3 = entry or group not found, 4 = incorrect master password.
+`
+
+const entryOptionsUsage = `
+Entry options:
+  -username <username>
+  -url <url>
+  -description <description>
+  -tags <tag,...>
+  -expiry <expiry>   YYYY-MM-DD, <n>d (also w, m and y) or none.
+  -gen               generate the password.
+  -profile <spec>    the password profile used by -gen (default: 'default'). Type 'help gen' in a session for details.
+  -secret-stdin      read the password from stdin (after the master password, if -pass-stdin is also used).
+  -secret-fd <fd>    read the password from the given file descriptor.
+  -secret-env <var>  read the password from the given environment variable.
+`
+
+const getSubUsage = `
+Usage:
+  go-hash get [<options>] <group>/<entry>
+
+Prints a field of an entry (by default, the password) to stdout.
+
+Options:
+  -field <field>     password, username, url, description, name, tags, expiry or updated.
+` + databaseOptionsUsage + `
+Example:
+  go-hash get work/aws/root -field username -pass-env MASTER_PASSWORD
+`
+
+const lsSubUsage = `
+Usage:
+  go-hash ls [<options>] [<group>]
+
+Lists the entries of a group (by default, the 'default' group), one <group>/<entry> per line.
+
+Options:
+  -r                 also list the entries of all subgroups.
+  -g                 list the subgroups instead of entries.
+` + databaseOptionsUsage
+
+const addSubUsage = `
+Usage:
+  go-hash add [<options>] <group>/<entry>
+
+Adds an entry. Its group is created if necessary.
+` + entryOptionsUsage + databaseOptionsUsage + `
+Example:
+  printf '%s\n%s\n' "$MASTER" "$SECRET" | go-hash add work/ci -username bot -pass-stdin -secret-stdin
+`
+
+const setSubUsage = `
+Usage:
+  go-hash set [<options>] <group>/<entry>
+
+Changes the given fields of an existing entry. The password is only changed if -gen or a -secret option is given.
+` + entryOptionsUsage + databaseOptionsUsage + `
+Example:
+  go-hash set work/ci -gen -profile alnum -pass-env MASTER_PASSWORD
+`
+
+const rmSubUsage = `
+Usage:
+  go-hash rm [<options>] <group>/<entry>
+
+Removes an entry.
+` + databaseOptionsUsage
+
+const genSubUsage = `
+Usage:
+  go-hash gen [<profile>] [<option>=<value>...]
+
+Generates a password using a built-in profile, without opening the database.
+Type 'help gen' in an interactive session for the available profiles and options.
+
+Example:
+  go-hash gen passphrase words=8
+`
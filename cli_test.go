@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// captureStdout runs the given function, returning what it printed to stdout.
+func captureStdout(t *testing.T, run func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	run()
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestParseArgs(t *testing.T) {
+	fs := newFlagSet("test")
+	field := fs.String("field", "password", "")
+	recursive := fs.Bool("r", false, "")
+	positional, err := parseArgs(fs, []string{"work/github", "-field", "username", "-r", "other"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"work/github", "other"}, positional)
+	require.Equal(t, "username", *field)
+	require.True(t, *recursive)
+
+	_, err = parseArgs(newFlagSet("test"), []string{"-unknown"})
+	require.Error(t, err)
+
+	// arguments after '--' are positional, even if they look like flags
+	*recursive = false
+	positional, err = parseArgs(fs, []string{"work/github", "--", "-a", "-r"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"work/github", "-a", "-r"}, positional)
+	require.False(t, *recursive)
+	positional, err = parseArgs(fs, []string{"-r", "--", "--"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"--"}, positional)
+}
+
+func TestSubcommands(t *testing.T) {
+	file, err := ioutil.TempFile("", "go-hash-cli")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	state := State{"default": []LoginInfo{{Name: "google", Username: "joe", Password: "secret"}}}
+	require.NoError(t, WriteDatabase(file.Name(), "master", &state, &Meta{}))
+
+	os.Setenv("GO_HASH_TEST_MASTER", "master")
+	os.Setenv("GO_HASH_TEST_SECRET", "Hy6^pE4!cR8#uJ2s")
+	defer os.Unsetenv("GO_HASH_TEST_MASTER")
+	defer os.Unsetenv("GO_HASH_TEST_SECRET")
+	db := []string{"-db", file.Name(), "-pass-env", "GO_HASH_TEST_MASTER"}
+
+	run := func(name string, args ...string) (int, string) {
+		var code int
+		out := captureStdout(t, func() {
+			code = subcommands()[name].run(append(args, db...))
+		})
+		return code, out
+	}
+
+	code, out := run("get", "google")
+	require.Equal(t, exitOK, code)
+	require.Equal(t, "secret\n", out)
+
+	code, out = run("get", "google", "-field", "username")
+	require.Equal(t, exitOK, code)
+	require.Equal(t, "joe\n", out)
+
+	code, _ = run("add", "work/aws/ci", "-username", "bot", "-tags", "ci,prod", "-secret-env", "GO_HASH_TEST_SECRET")
+	require.Equal(t, exitOK, code)
+	code, _ = run("add", "work/aws/ci", "-gen")
+	require.Equal(t, exitError, code, "entry already exists")
+
+	code, out = run("get", "work/aws/ci")
+	require.Equal(t, exitOK, code)
+	require.Equal(t, "Hy6^pE4!cR8#uJ2s\n", out)
+
+	code, out = run("ls", "-r")
+	require.Equal(t, exitOK, code)
+	require.Equal(t, "google\nwork/aws/ci\n", out)
+
+	code, out = run("ls", "-g", "-r")
+	require.Equal(t, exitOK, code)
+	require.Equal(t, "work\nwork/aws\n", out)
+
+	code, _ = run("set", "work/aws/ci", "-url", "https://ci.example.com", "-gen", "-profile", "pin")
+	require.Equal(t, exitOK, code)
+	code, out = run("get", "work/aws/ci", "-field", "url")
+	require.Equal(t, exitOK, code)
+	require.Equal(t, "https://ci.example.com\n", out)
+	code, out = run("get", "work/aws/ci")
+	require.Equal(t, exitOK, code)
+	require.Len(t, out, 7, "a 6-digit PIN should have been generated")
+	code, out = run("get", "work/aws/ci", "-field", "username")
+	require.Equal(t, "bot\n", out, "fields not given should be kept")
+
+	code, _ = run("rm", "google")
+	require.Equal(t, exitOK, code)
+	code, _ = run("get", "google")
+	require.Equal(t, exitNotFound, code)
+
+	code, _ = run("get", "work/aws/ci", "-field", "nothing")
+	require.Equal(t, exitUsage, code)
+
+	os.Setenv("GO_HASH_TEST_MASTER", "wrong")
+	code, _ = run("get", "work/aws/ci")
+	require.Equal(t, exitAuth, code)
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atotto/clipboard"
+)
+
+// errClipboardUnreadable returned by clipboard backends which can only write to the clipboard.
+var errClipboardUnreadable = errors.New("the clipboard cannot be read")
+
+// clipboardBackend a way of accessing the clipboard.
+type clipboardBackend interface {
+	name() string
+	write(content string) error
+	// read returns the content of the clipboard, or errClipboardUnreadable if the backend cannot read it.
+	read() (string, error)
+}
+
+// sensitiveClipboard a clipboard backend which can ask clipboard managers not to keep the content it copies
+// in their history.
+type sensitiveClipboard interface {
+	writeSensitive(content string) error
+}
+
+// canMarkSensitive whether the backend can mark the content it copies as sensitive. Only the Windows system
+// clipboard can: the tools used by the other backends cannot offer the hints clipboard managers look for.
+func canMarkSensitive(backend clipboardBackend) bool {
+	_, ok := backend.(sensitiveClipboard)
+	return ok
+}
+
+// defaultClipboardTimeout how long copied content is kept in the clipboard, by default.
+const defaultClipboardTimeout = time.Minute
+
+// clipboardBackendNames the backends which may be selected with the 'clipboard' setting.
+var clipboardBackendNames = []string{"auto", "system", "xclip", "xsel", "wl-copy", "tmux", "osc52", "file"}
+
+// newClipboardBackend creates the clipboard backend selected by the configuration.
+func newClipboardBackend(config Config) (clipboardBackend, error) {
+	primary := config.ClipboardSelection == "primary"
+	switch config.Clipboard {
+	case "", "auto":
+		return detectClipboardBackend(primary), nil
+	case "system":
+		return systemClipboard{}, nil
+	case "xclip":
+		return newXclipClipboard(primary), nil
+	case "xsel":
+		return newXselClipboard(primary), nil
+	case "wl-copy":
+		return newWaylandClipboard(primary), nil
+	case "tmux":
+		return newTmuxClipboard(), nil
+	case "osc52":
+		return newOsc52Clipboard(os.Stdout, os.Getenv("TMUX"), primary), nil
+	case "file":
+		if len(config.ClipboardFile) == 0 {
+			return nil, errors.New("the file clipboard requires the clipboard-file setting")
+		}
+		return fileClipboard{config.ClipboardFile}, nil
+	}
+	return nil, errors.New("unknown clipboard: " + config.Clipboard)
+}
+
+// detectClipboardBackend chooses the best clipboard backend for the current environment.
+//
+// Wayland and X11 tools are preferred when a display is available. Over SSH, the clipboard of the local
+// terminal is used via OSC 52. Within tmux, the tmux buffer is used. Otherwise, the system clipboard is used.
+func detectClipboardBackend(primary bool) clipboardBackend {
+	hasCommand := func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	}
+	switch {
+	case len(os.Getenv("WAYLAND_DISPLAY")) > 0 && hasCommand("wl-copy") && hasCommand("wl-paste"):
+		return newWaylandClipboard(primary)
+	case len(os.Getenv("DISPLAY")) > 0 && hasCommand("xclip"):
+		return newXclipClipboard(primary)
+	case len(os.Getenv("DISPLAY")) > 0 && hasCommand("xsel"):
+		return newXselClipboard(primary)
+	case len(os.Getenv("SSH_TTY")) > 0 || len(os.Getenv("SSH_CONNECTION")) > 0:
+		return newOsc52Clipboard(os.Stdout, os.Getenv("TMUX"), primary)
+	case len(os.Getenv("TMUX")) > 0 && hasCommand("tmux"):
+		return newTmuxClipboard()
+	}
+	return systemClipboard{}
+}
+
+// systemClipboard the clipboard of the operating system, accessed via github.com/atotto/clipboard.
+type systemClipboard struct{}
+
+func (systemClipboard) name() string {
+	return "system"
+}
+
+func (systemClipboard) write(content string) error {
+	return clipboard.WriteAll(content)
+}
+
+func (systemClipboard) read() (string, error) {
+	return clipboard.ReadAll()
+}
+
+// commandClipboard a clipboard accessed by running external commands, which read the content to copy from
+// stdin and print the content of the clipboard to stdout.
+type commandClipboard struct {
+	backend   string
+	copyArgs  []string
+	pasteArgs []string
+	// clearArgs the command used to clear the clipboard, if copying empty content does not work.
+	clearArgs []string
+}
+
+func newXclipClipboard(primary bool) commandClipboard {
+	selection := "clipboard"
+	if primary {
+		selection = "primary"
+	}
+	return commandClipboard{backend: "xclip",
+		copyArgs:  []string{"xclip", "-selection", selection, "-in"},
+		pasteArgs: []string{"xclip", "-selection", selection, "-out"}}
+}
+
+func newXselClipboard(primary bool) commandClipboard {
+	selection := "--clipboard"
+	if primary {
+		selection = "--primary"
+	}
+	return commandClipboard{backend: "xsel",
+		copyArgs:  []string{"xsel", selection, "--input"},
+		pasteArgs: []string{"xsel", selection, "--output"},
+		clearArgs: []string{"xsel", selection, "--clear"}}
+}
+
+func newWaylandClipboard(primary bool) commandClipboard {
+	c := commandClipboard{backend: "wl-copy",
+		copyArgs:  []string{"wl-copy"},
+		pasteArgs: []string{"wl-paste", "--no-newline"},
+		clearArgs: []string{"wl-copy", "--clear"}}
+	if primary {
+		for _, args := range []*[]string{&c.copyArgs, &c.pasteArgs, &c.clearArgs} {
+			*args = append(*args, "--primary")
+		}
+	}
+	return c
+}
+
+func newTmuxClipboard() commandClipboard {
+	return commandClipboard{backend: "tmux",
+		copyArgs:  []string{"tmux", "load-buffer", "-"},
+		pasteArgs: []string{"tmux", "save-buffer", "-"}}
+}
+
+func (c commandClipboard) name() string {
+	return c.backend
+}
+
+func (c commandClipboard) write(content string) error {
+	args := c.copyArgs
+	if len(content) == 0 && len(c.clearArgs) > 0 {
+		args = c.clearArgs
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(content)
+	return runClipboardCommand(cmd)
+}
+
+func (c commandClipboard) read() (string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(c.pasteArgs[0], c.pasteArgs[1:]...)
+	cmd.Stdout = &out
+	if err := runClipboardCommand(cmd); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// runClipboardCommand runs a clipboard command, including its error output in the error it returns, if any.
+//
+// The error output goes to a temporary file rather than a pipe: xclip and wl-copy fork a child which keeps
+// serving the clipboard, and waiting for it to close a pipe would block until the clipboard changes.
+func runClipboardCommand(cmd *exec.Cmd) error {
+	stderr, err := ioutil.TempFile("", "go-hash-clipboard")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(stderr.Name())
+	defer stderr.Close()
+	cmd.Stderr = stderr
+	if err = cmd.Run(); err != nil {
+		msg, _ := ioutil.ReadFile(stderr.Name())
+		if trimmed := strings.TrimSpace(string(msg)); len(trimmed) > 0 {
+			return fmt.Errorf("%s: %s", cmd.Args[0], trimmed)
+		}
+		return fmt.Errorf("%s: %s", cmd.Args[0], err.Error())
+	}
+	return nil
+}
+
+// osc52Clipboard sets the clipboard of the terminal with the OSC 52 escape sequence, which works over SSH
+// in terminals which support it. The clipboard cannot be read.
+type osc52Clipboard struct {
+	out io.Writer
+	// tmux whether the sequence must be passed through tmux to reach the terminal.
+	tmux    bool
+	primary bool
+}
+
+func newOsc52Clipboard(out io.Writer, tmuxEnv string, primary bool) osc52Clipboard {
+	return osc52Clipboard{out: out, tmux: len(tmuxEnv) > 0, primary: primary}
+}
+
+func (osc52Clipboard) name() string {
+	return "osc52"
+}
+
+func (c osc52Clipboard) write(content string) error {
+	_, err := io.WriteString(c.out, c.sequence(content))
+	return err
+}
+
+func (osc52Clipboard) read() (string, error) {
+	return "", errClipboardUnreadable
+}
+
+// sequence returns the escape sequence which sets the clipboard to the given content.
+func (c osc52Clipboard) sequence(content string) string {
+	selection := "c"
+	if c.primary {
+		selection = "p"
+	}
+	seq := "\x1b]52;" + selection + ";" + base64.StdEncoding.EncodeToString([]byte(content)) + "\a"
+	if c.tmux {
+		// tmux forwards sequences wrapped in a DCS passthrough, with all escape characters doubled
+		seq = "\x1bPtmux;" + strings.Replace(seq, "\x1b", "\x1b\x1b", -1) + "\x1b\\"
+	}
+	return seq
+}
+
+// fileClipboard writes the copied content to a file, or to a named pipe (FIFO) read by another program.
+// Mostly useful for testing.
+type fileClipboard struct {
+	path string
+}
+
+func (fileClipboard) name() string {
+	return "file"
+}
+
+func (c fileClipboard) write(content string) error {
+	file, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (c fileClipboard) read() (string, error) {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		// reading from a FIFO would block until another program writes to it
+		return "", errClipboardUnreadable
+	}
+	content, err := ioutil.ReadFile(c.path)
+	return string(content), err
+}
+
+var (
+	clipboardMutex sync.Mutex
+	// activeClipboard the clipboard backend used by all commands.
+	activeClipboard clipboardBackend = systemClipboard{}
+	// clipboardTimeout how long copied content is kept in the clipboard. Zero keeps it until go-hash exits.
+	clipboardTimeout = defaultClipboardTimeout
+	// clipboardSensitive whether copied content is marked as sensitive, if the backend supports it.
+	clipboardSensitive = true
+	// copiedContent the content last copied to the clipboard, if it has not been removed yet.
+	copiedContent string
+	// clipboardTimer removes copiedContent from the clipboard when it fires.
+	clipboardTimer *time.Timer
+	// clipboardClearAt when clipboardTimer fires.
+	clipboardClearAt time.Time
+)
+
+// useClipboard sets the clipboard backend used by all commands, and how it is used.
+func useClipboard(backend clipboardBackend, timeout time.Duration, sensitive bool) {
+	clipboardMutex.Lock()
+	defer clipboardMutex.Unlock()
+	activeClipboard = backend
+	clipboardTimeout = timeout
+	clipboardSensitive = sensitive
+}
+
+func currentClipboard() clipboardBackend {
+	clipboardMutex.Lock()
+	defer clipboardMutex.Unlock()
+	return activeClipboard
+}
+
+// copyToClipboard copies the content to the clipboard, removing it after the clipboard timeout.
+func copyToClipboard(content string) bool {
+	clipboardMutex.Lock()
+	backend, sensitive := activeClipboard, clipboardSensitive
+	clipboardMutex.Unlock()
+
+	var err error
+	if s, ok := backend.(sensitiveClipboard); ok && sensitive {
+		err = s.writeSensitive(content)
+	} else {
+		err = backend.write(content)
+	}
+	if err != nil {
+		fmt.Printf("Error: unable to copy! Reason: %s\n", err.Error())
+		return false
+	}
+
+	clipboardMutex.Lock()
+	defer clipboardMutex.Unlock()
+	copiedContent = content
+	if clipboardTimer != nil {
+		clipboardTimer.Stop()
+		clipboardTimer = nil
+	}
+	clipboardClearAt = time.Time{}
+	if clipboardTimeout > 0 {
+		clipboardClearAt = time.Now().Add(clipboardTimeout)
+		clipboardTimer = time.AfterFunc(clipboardTimeout, func() {
+			removeFromClipboard(content)
+		})
+	}
+	return true
+}
+
+// clearClipboard removes the content last copied to the clipboard, unless it has been replaced already.
+func clearClipboard() {
+	clipboardMutex.Lock()
+	content := copiedContent
+	clipboardMutex.Unlock()
+	if len(content) > 0 {
+		removeFromClipboard(content)
+	}
+}
+
+// removeFromClipboard clears the clipboard if it still holds the given content, which must be the content
+// last copied by go-hash. Clipboards which cannot be read are always cleared.
+//
+// The clipboard is accessed without holding the mutex, as backends run external commands which may be slow.
+func removeFromClipboard(content string) {
+	clipboardMutex.Lock()
+	if copiedContent != content {
+		// something else was copied since
+		clipboardMutex.Unlock()
+		return
+	}
+	copiedContent = ""
+	clipboardClearAt = time.Time{}
+	if clipboardTimer != nil {
+		clipboardTimer.Stop()
+		clipboardTimer = nil
+	}
+	backend := activeClipboard
+	clipboardMutex.Unlock()
+
+	c, err := backend.read()
+	if err == errClipboardUnreadable || (err == nil && c == content) {
+		clipboardMutex.Lock()
+		// unless something was copied while the clipboard was being read
+		copied := len(copiedContent) > 0
+		clipboardMutex.Unlock()
+		if !copied {
+			backend.write("")
+		}
+	}
+}
+
+// clipboardTimeLeft returns how long until the clipboard is cleared, or zero if nothing is waiting to be cleared.
+func clipboardTimeLeft() time.Duration {
+	clipboardMutex.Lock()
+	defer clipboardMutex.Unlock()
+	if clipboardClearAt.IsZero() {
+		return 0
+	}
+	if left := time.Until(clipboardClearAt); left > 0 {
+		return left
+	}
+	return 0
+}
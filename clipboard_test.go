@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClipboardBackend(t *testing.T) {
+	config := defaultConfig()
+	for _, name := range []string{"system", "xclip", "xsel", "wl-copy", "tmux", "osc52"} {
+		config.Clipboard = name
+		backend, err := newClipboardBackend(config)
+		require.NoError(t, err)
+		require.Equal(t, name, backend.name())
+	}
+
+	config.Clipboard = "file"
+	_, err := newClipboardBackend(config)
+	require.Error(t, err, "the file backend requires a file")
+
+	config.ClipboardFile = "/tmp/clipboard"
+	backend, err := newClipboardBackend(config)
+	require.NoError(t, err)
+	require.Equal(t, fileClipboard{"/tmp/clipboard"}, backend)
+}
+
+func TestCanMarkSensitive(t *testing.T) {
+	require.Equal(t, runtime.GOOS == "windows", canMarkSensitive(systemClipboard{}))
+	require.False(t, canMarkSensitive(newXclipClipboard(false)))
+	require.False(t, canMarkSensitive(newWaylandClipboard(false)))
+	require.False(t, canMarkSensitive(fileClipboard{"/tmp/clipboard"}))
+}
+
+func TestClipboardConfig(t *testing.T) {
+	path := writeConfig(t, "clipboard = wl-copy\nclipboard-selection = primary\n")
+	defer os.Remove(path)
+	config, err := loadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, "wl-copy", config.Clipboard)
+
+	backend, err := newClipboardBackend(config)
+	require.NoError(t, err)
+	require.Equal(t, []string{"wl-copy", "--primary"}, backend.(commandClipboard).copyArgs)
+
+	for _, content := range []string{"clipboard = pigeon", "clipboard-selection = secondary"} {
+		path := writeConfig(t, content)
+		_, err := loadConfig(path)
+		os.Remove(path)
+		require.Error(t, err, "config: %s", content)
+	}
+}
+
+func TestOsc52Clipboard(t *testing.T) {
+	var out bytes.Buffer
+	c := newOsc52Clipboard(&out, "", false)
+	require.NoError(t, c.write("hello"))
+	require.Equal(t, "\x1b]52;c;aGVsbG8=\a", out.String())
+
+	_, err := c.read()
+	require.Equal(t, errClipboardUnreadable, err)
+
+	out.Reset()
+	c = newOsc52Clipboard(&out, "/tmp/tmux-1000/default,1234,0", true)
+	require.NoError(t, c.write("hello"))
+	require.Equal(t, "\x1bPtmux;\x1b\x1b]52;p;aGVsbG8=\a\x1b\\", out.String())
+}
+
+func TestFileClipboard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-hash-clipboard")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := fileClipboard{filepath.Join(dir, "clipboard")}
+	content, err := c.read()
+	require.NoError(t, err)
+	require.Empty(t, content)
+
+	require.NoError(t, c.write("secret"))
+	content, err = c.read()
+	require.NoError(t, err)
+	require.Equal(t, "secret", content)
+
+	info, err := os.Stat(c.path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestRemoveFromClipboard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-hash-clipboard")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := fileClipboard{filepath.Join(dir, "clipboard")}
+	useClipboard(c, time.Minute, true)
+	defer useClipboard(systemClipboard{}, defaultClipboardTimeout, true)
+
+	require.True(t, copyToClipboard("secret"))
+	clearClipboard()
+	content, _ := c.read()
+	require.Empty(t, content)
+
+	// content copied by other programs is not removed
+	require.True(t, copyToClipboard("secret"))
+	require.NoError(t, c.write("something else"))
+	clearClipboard()
+	content, _ = c.read()
+	require.Equal(t, "something else", content)
+}
+
+func TestCommandClipboard(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test uses a POSIX shell")
+	}
+	// like xclip and wl-copy, the command forks a child which keeps running after the command exits
+	c := commandClipboard{backend: "test", copyArgs: []string{"sh", "-c", "cat > /dev/null; sleep 5 &"},
+		pasteArgs: []string{"sh", "-c", "echo 'no clipboard' >&2; exit 1"}}
+	start := time.Now()
+	require.NoError(t, c.write("secret"))
+	require.True(t, time.Since(start) < 2*time.Second, "copying waited for the forked child")
+
+	_, err := c.read()
+	require.EqualError(t, err, "sh: no clipboard")
+}
+
+func TestClipboardTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-hash-clipboard")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := fileClipboard{filepath.Join(dir, "clipboard")}
+	useClipboard(c, 100*time.Millisecond, true)
+	defer useClipboard(systemClipboard{}, defaultClipboardTimeout, true)
+
+	require.True(t, copyToClipboard("secret"))
+	left := clipboardTimeLeft()
+	require.True(t, left > 0 && left <= 100*time.Millisecond, "time left: %s", left)
+	require.Equal(t, "\033[33m[clipboard 1s]\033[0m ", clipboardIndicator())
+
+	time.Sleep(300 * time.Millisecond)
+	content, _ := c.read()
+	require.Empty(t, content)
+	require.Equal(t, time.Duration(0), clipboardTimeLeft())
+	require.Empty(t, clipboardIndicator())
+
+	// without a timeout, the content is only removed when go-hash exits
+	useClipboard(c, 0, true)
+	require.True(t, copyToClipboard("secret"))
+	require.Equal(t, time.Duration(0), clipboardTimeLeft())
+	clearClipboard()
+	content, _ = c.read()
+	require.Empty(t, content)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/atotto/clipboard"
+)
+
+const (
+	cfUnicodeText = 13
+	gmemMoveable  = 0x0002
+)
+
+// sensitiveClipboardFormats formats which, when present in the clipboard, ask Windows' clipboard history,
+// cloud clipboard and clipboard managers not to keep the content.
+var sensitiveClipboardFormats = []string{
+	"ExcludeClipboardContentFromMonitorProcessing",
+	"CanIncludeInClipboardHistory",
+	"CanUploadToCloudClipboard",
+}
+
+var (
+	user32                  = syscall.NewLazyDLL("user32.dll")
+	openClipboard           = user32.NewProc("OpenClipboard")
+	closeClipboard          = user32.NewProc("CloseClipboard")
+	emptyClipboard          = user32.NewProc("EmptyClipboard")
+	setClipboardData        = user32.NewProc("SetClipboardData")
+	registerClipboardFormat = user32.NewProc("RegisterClipboardFormatW")
+
+	kernel32      = syscall.NewLazyDLL("kernel32.dll")
+	globalAlloc   = kernel32.NewProc("GlobalAlloc")
+	globalFree    = kernel32.NewProc("GlobalFree")
+	globalLock    = kernel32.NewProc("GlobalLock")
+	globalUnlock  = kernel32.NewProc("GlobalUnlock")
+	rtlMoveMemory = kernel32.NewProc("RtlMoveMemory")
+)
+
+// writeSensitive copies the content to the Windows clipboard together with the formats which mark it as sensitive.
+func (systemClipboard) writeSensitive(content string) error {
+	if len(content) == 0 {
+		return clipboard.WriteAll(content)
+	}
+	text, err := syscall.UTF16FromString(content)
+	if err != nil {
+		return err
+	}
+
+	// the clipboard must be opened and closed by the same thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err = waitOpenClipboard(); err != nil {
+		return err
+	}
+	defer closeClipboard.Call()
+	if r, _, err := emptyClipboard.Call(); r == 0 {
+		return err
+	}
+	if err = setClipboardBytes(cfUnicodeText, uintptr(unsafe.Pointer(&text[0])), len(text)*2); err != nil {
+		return err
+	}
+	runtime.KeepAlive(text)
+	// the value 0 means 'no' for the formats which have a value
+	var no uint32
+	for _, name := range sensitiveClipboardFormats {
+		format, _, err := registerClipboardFormat.Call(uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(name))))
+		if format == 0 {
+			return err
+		}
+		if err = setClipboardBytes(format, uintptr(unsafe.Pointer(&no)), 4); err != nil {
+			return err
+		}
+	}
+	runtime.KeepAlive(&no)
+	return nil
+}
+
+// waitOpenClipboard opens the clipboard, waiting for up to a second for other programs to close it.
+func waitOpenClipboard() error {
+	var err error
+	for limit := time.Now().Add(time.Second); time.Now().Before(limit); time.Sleep(time.Millisecond) {
+		var r uintptr
+		if r, _, err = openClipboard.Call(0); r != 0 {
+			return nil
+		}
+	}
+	return err
+}
+
+// setClipboardBytes copies size bytes at the given address into global memory, and puts it in the open
+// clipboard with the given format.
+func setClipboardBytes(format, data uintptr, size int) error {
+	h, _, err := globalAlloc.Call(gmemMoveable, uintptr(size))
+	if h == 0 {
+		return err
+	}
+	p, _, err := globalLock.Call(h)
+	if p == 0 {
+		globalFree.Call(h)
+		return err
+	}
+	rtlMoveMemory.Call(p, data, uintptr(size))
+	globalUnlock.Call(h)
+	if r, _, err := setClipboardData.Call(format, h); r == 0 {
+		globalFree.Call(h)
+		return err
+	}
+	// the clipboard owns the memory now
+	return nil
+}
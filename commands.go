@@ -2,18 +2,22 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
 	"os/exec"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/renatoathaydes/go-hash/encryption"
-
-	"github.com/atotto/clipboard"
 	"github.com/chzyer/readline"
+	"github.com/mitchellh/go-homedir"
+	"github.com/renatoathaydes/go-hash/encryption"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -37,47 +41,133 @@ type helpCommand struct {
 
 type entryCommand struct {
 	entries func() []string
+	tags    func() []string
+	meta    *Meta
 }
 
 type groupCommand struct {
 	groups   func() []string
 	groupBox *stringBox
+	meta     *Meta
 }
 
 type cpCommand struct {
 	entries func() []string
+	meta    *Meta
 }
 
 type gotoCommand struct {
 	entries func() []string
+	meta    *Meta
 }
 
 type cmpCommand struct {
+	mpBox  *stringBox
+	keyBox *keyBox
+	meta   *Meta
+}
+
+type tagCommand struct {
+	entries func() []string
+	tags    func() []string
+}
+
+type expireCommand struct {
+	entries func() []string
+	groups  func() []string
+	meta    *Meta
+}
+
+type expiredCommand struct {
+	meta *Meta
+}
+
+type genCommand struct {
+	meta *Meta
+}
+
+type breachCommand struct {
 	mpBox *stringBox
 }
 
+type auditCommand struct{}
+
+type findCommand struct{}
+
+type importCommand struct {
+	groups func() []string
+}
+
+type exportCommand struct {
+	meta   *Meta
+	groups func() []string
+}
+
+type kitCommand struct {
+	dbPath string
+	keyBox *keyBox
+}
+
+type kdfCommand struct {
+	keyBox *keyBox
+}
+
+type infoCommand struct {
+	dbPath string
+	meta   *Meta
+}
+
+type lockCommand struct {
+	session *sessionLock
+}
+
 type stringBox struct {
 	value string
 }
 
+type keyBox struct {
+	value DatabaseKey
+}
+
 // ============= CLI creation ============= //
 
-func createCommands(state *State, groupBox *stringBox, masterPassBox *stringBox) map[string]command {
+func createCommands(state *State, meta *Meta, dbPath string, groupBox *stringBox, masterPassBox *stringBox,
+	dbKeyBox *keyBox) map[string]command {
 	getGroups := func() []string {
-		result := make([]string, len(*state), len(*state))
-		i := 0
+		current := groupBox.value
+		result := make([]string, 0, len(*state)+1)
+		if current != rootGroup {
+			result = append(result, "..")
+		}
 		for gr := range *state {
-			result[i] = gr
-			i++
+			if gr != current && isSubgroupOf(gr, current) {
+				result = append(result, relativeGroupPath(gr, current))
+			}
 		}
 		return result
 	}
 
 	getEntries := func() []string {
-		entries := (*state)[groupBox.value]
-		result := make([]string, len(entries), len(entries))
-		for i, e := range entries {
-			result[i] = e.Name
+		current := groupBox.value
+		var result []string
+		for _, e := range (*state)[current] {
+			result = append(result, quoteEntryName(e.Name))
+		}
+		for gr, entries := range *state {
+			if gr != current {
+				for _, e := range entries {
+					result = append(result, entryAddress(current, gr, e.Name))
+				}
+			}
+		}
+		return result
+	}
+
+	getTags := func() []string {
+		tags := state.allTags()
+		result := make([]string, 0, len(tags))
+		for tag := range tags {
+			result = append(result, tag)
 		}
 		return result
 	}
@@ -86,19 +176,64 @@ func createCommands(state *State, groupBox *stringBox, masterPassBox *stringBox)
 		"group": groupCommand{
 			groups:   getGroups,
 			groupBox: groupBox,
+			meta:     meta,
 		},
 		"entry": entryCommand{
 			entries: getEntries,
+			tags:    getTags,
+			meta:    meta,
 		},
 		"cp": cpCommand{
 			entries: getEntries,
+			meta:    meta,
 		},
 		"goto": gotoCommand{
 			entries: getEntries,
+			meta:    meta,
 		},
 		"cmp": cmpCommand{
+			mpBox:  masterPassBox,
+			keyBox: dbKeyBox,
+			meta:   meta,
+		},
+		"tag": tagCommand{
+			entries: getEntries,
+			tags:    getTags,
+		},
+		"expire": expireCommand{
+			entries: getEntries,
+			groups:  getGroups,
+			meta:    meta,
+		},
+		"expired": expiredCommand{
+			meta: meta,
+		},
+		"gen": genCommand{
+			meta: meta,
+		},
+		"breach": breachCommand{
 			mpBox: masterPassBox,
 		},
+		"audit": auditCommand{},
+		"find":  findCommand{},
+		"import": importCommand{
+			groups: getGroups,
+		},
+		"export": exportCommand{
+			meta:   meta,
+			groups: getGroups,
+		},
+		"kit": kitCommand{
+			dbPath: dbPath,
+			keyBox: dbKeyBox,
+		},
+		"kdf": kdfCommand{
+			keyBox: dbKeyBox,
+		},
+		"info": infoCommand{
+			dbPath: dbPath,
+			meta:   meta,
+		},
 	}
 
 	commands["help"] = helpCommand{
@@ -128,7 +263,7 @@ func (cmd helpCommand) help() string {
 }
 
 func (cmd entryCommand) help() string {
-	return "manages entries within the current group."
+	return "manages entries within the current group, or <group>/<entry> in any group."
 }
 
 func (cmd groupCommand) help() string {
@@ -147,6 +282,58 @@ func (cmd cmpCommand) help() string {
 	return "changes the master password."
 }
 
+func (cmd tagCommand) help() string {
+	return "manages the tags of entries within the current group."
+}
+
+func (cmd expireCommand) help() string {
+	return "sets when the password of an entry, or of all entries in a group, expires."
+}
+
+func (cmd expiredCommand) help() string {
+	return "lists all entries whose passwords have expired or will expire soon."
+}
+
+func (cmd breachCommand) help() string {
+	return "checks whether any passwords appear in a local copy of the Have I Been Pwned passwords list."
+}
+
+func (cmd auditCommand) help() string {
+	return "reports security problems found in the entries of all groups."
+}
+
+func (cmd lockCommand) help() string {
+	return "locks the session, wiping all secrets from memory until the master password is entered again."
+}
+
+func (cmd findCommand) help() string {
+	return "searches entries in all groups."
+}
+
+func (cmd importCommand) help() string {
+	return "imports entries from other password managers."
+}
+
+func (cmd exportCommand) help() string {
+	return "exports entries to JSON, CSV or KeePass files."
+}
+
+func (cmd kitCommand) help() string {
+	return "writes a printable emergency kit, to restore the database from paper."
+}
+
+func (cmd kdfCommand) help() string {
+	return "shows the parameters used to derive the database key, and tunes them to this computer."
+}
+
+func (cmd infoCommand) help() string {
+	return "prints information about the database file and its contents."
+}
+
+func (cmd genCommand) help() string {
+	return "generates a password without creating an entry, and manages password profiles."
+}
+
 // ============= Commands: Long help ============= //
 
 const helpUsage = `
@@ -175,11 +362,17 @@ Options:
   -d <name>   delete an entry.
   -e <name>   edit an entry.
   -r <name>   rename an entry.
+  -t <tag>... list the entries of all groups which have all of the given tags.
 
 Without an option or a <name> argument, the entry command simply lists all entries within the current group.
 
 Typing 'entry <name>' will either display information about the entry, or create it if the entry does not exist.
 
+Entries of other groups can be referred to by prefixing their names with the path of their group,
+e.g. 'work/aws/root'. Paths are relative to the current group, then to the 'default' group, unless they
+start with '/'. Names containing '/' or spaces may be quoted, e.g. 'work/"my bank"'.
+The same applies to all commands which take an entry <name>.
+
 Examples:
 
   # list all entries in the current group
@@ -187,6 +380,12 @@ Examples:
 
   # delete the entry called 'hello'
   entry -d hello
+
+  # show the entry called 'github' in the 'work' group
+  entry work/github
+
+  # list all entries, in any group, tagged with both 'prod' and 'aws'
+  entry -t prod aws
 `
 const groupUsage = `
 === group command usage ===
@@ -194,31 +393,45 @@ const groupUsage = `
 The group command is used to manage groups or enter a group in order to manage its entries.
 
 Usage:
-  group [-option] [<name>]
+  group [-option] [<path>]
 
 Options:
-  -c <name>   create a group.
-  -d <name>   delete a group.
-  -r <name>   rename a group.
+  -c <path>   create a group.
+  -d <path>   delete a group, including all of its subgroups.
+  -r <path>   rename or move a group, including all of its subgroups.
 
-Without an option or a <name> argument, the group command simply lists all groups in the database.
+Without an option or a <path> argument, the group command simply lists all groups in the database.
 
-Typing 'group <name>' will either enter the group (so that the 'entry' command will apply to entries
+Typing 'group <path>' will either enter the group (so that the 'entry' command will apply to entries
 within the chosen group) , or create it if it does not exist.
 
+Groups may be nested within other groups. A group path is made of group names separated by '/',
+for example 'work/aws/prod'. Paths are relative to the current group, unless they start with '/'.
+The special name '..' refers to the parent of a group, so 'group ..' enters the parent group.
+Creating a nested group automatically creates its parent groups if necessary.
+
+When renaming a group, a new name without '/' renames the group within its parent group, while a
+path moves the group (relative to the current group).
+
 After entering a group, the 'entry' command applies only to the entries within the entered group.
-Type 'exit' to exit a group.
+Type 'exit' to exit a group, going back to its parent group.
 
 A group called 'default' is used if no group is entered. This group always exists but is not
 shown in the prompt as other groups, allowing the user to manage entries without using groups
-explicitly.
+explicitly. All other groups are nested within the default group.
 
 Examples:
 
   # list all groups
   group
 
-  # delete a group called 'hello'
+  # enter (or create) the 'prod' group, nested within 'work/aws'
+  group work/aws/prod
+
+  # go back to the parent group
+  group ..
+
+  # delete a group called 'hello', including its subgroups
   group -d hello
 `
 
@@ -236,7 +449,13 @@ Options:
   -p <name>   copy the password.
 
 If an option is not provided, the username associated with the chosen entry is copied.
-Information is automatically removed from the clipboard after one minute.
+Information is automatically removed from the clipboard after one minute (see the clipboard-timeout setting),
+or when go-hash exits. The prompt shows how many seconds are left until then.
+
+Clipboard managers and clipboard histories are only asked not to keep copied content on Windows, with the
+'system' clipboard (see the clipboard-sensitive setting). On Linux and macOS, none of the clipboards (xclip, xsel,
+wl-copy, tmux, osc52 or the system clipboard) can mark content as sensitive: the tools they use can only offer
+one type of content at a time, so clipboard managers such as Klipper may keep copied passwords.
 
 Examples:
 
@@ -245,6 +464,9 @@ Examples:
 
   # copy the password associated with the 'other' entry
   cp -p other
+
+  # copy the password associated with the 'root' entry in the 'work/aws' group
+  cp -p work/aws/root
 `
 
 const gotoUsage = `
@@ -261,6 +483,7 @@ Options:
   -n <name>   do not copy the password.
 
 If the -n option is not used, the entry's password is copied to the clipboard automatically.
+The <name> may be qualified with the path of the entry's group, as in 'work/github'.
 
 Examples:
 
@@ -276,320 +499,1536 @@ The cmp command is used to change the master password.
 No options or arguments are accepted.
 `
 
-func (cmd helpCommand) longHelp() string {
-	return helpUsage
-}
+const tagUsage = `
+=== tag command usage ===
 
-func (cmd entryCommand) longHelp() string {
-	return entryUsage
-}
+The tag command is used to manage the tags of entries within the current group, or of any entry
+when its <name> is qualified with the path of its group (e.g. 'work/github').
 
-func (cmd groupCommand) longHelp() string {
-	return groupUsage
-}
+Tags are free-form labels that can be used to find related entries regardless of which group they are in.
+Tags are case-insensitive and cannot contain spaces.
 
-func (cmd cpCommand) longHelp() string {
-	return copyUsage
-}
+Usage:
+  tag [-option] [<name> [<tag>...]]
 
-func (cmd gotoCommand) longHelp() string {
-	return gotoUsage
-}
+Options:
+  -a <name> <tag>...   add the given tags to an entry.
+  -d <name> <tag>...   remove the given tags from an entry.
 
-func (cmd cmpCommand) longHelp() string {
-	return cmpUsage
-}
+Without an option or a <name> argument, the tag command lists all tags in the database, across all groups.
 
-// ============= Commands: Auto-completers ============= //
+Typing 'tag <name>' shows the tags of the given entry.
 
-func (cmd helpCommand) completer() readline.PrefixCompleterInterface {
-	commands := cmd.commands
-	commandItems := make([]readline.PrefixCompleterInterface, len(commands), len(commands))
-	i := 0
-	for name := range commands {
-		commandItems[i] = readline.PcItem(name)
-		i++
-	}
-	return readline.PcItem("help", commandItems...)
-}
+To list the entries which have certain tags, use 'entry -t <tag>...'.
 
-func commandCompleter(getValues func() []string) readline.PrefixCompleterInterface {
-	resolve := func(line string) []string {
-		return getValues()
-	}
-	return readline.PcItemDynamic(resolve)
-}
+Examples:
 
-func (cmd entryCommand) completer() readline.PrefixCompleterInterface {
-	cmp := commandCompleter(cmd.entries)
-	return readline.PcItem("entry",
-		cmp,
-		readline.PcItem("-c"),
-		readline.PcItem("-d", cmp),
-		readline.PcItem("-e", cmp),
-		readline.PcItem("-r", cmp))
-}
+  # list all tags
+  tag
 
-func (cmd groupCommand) completer() readline.PrefixCompleterInterface {
-	cmp := commandCompleter(cmd.groups)
-	return readline.PcItem("group",
-		cmp,
-		readline.PcItem("-c"),
-		readline.PcItem("-d", cmp),
-		readline.PcItem("-r", cmp))
-}
+  # tag the entry called 'hello' with 'prod' and 'aws'
+  tag -a hello prod aws
 
-func (cmd cpCommand) completer() readline.PrefixCompleterInterface {
-	cmp := commandCompleter(cmd.entries)
-	return readline.PcItem("cp",
-		cmp,
-		readline.PcItem("-u", cmp),
-		readline.PcItem("-p", cmp))
-}
+  # remove the 'aws' tag from the entry called 'hello'
+  tag -d hello aws
+`
 
-func (cmd gotoCommand) completer() readline.PrefixCompleterInterface {
-	cmp := commandCompleter(cmd.entries)
-	return readline.PcItem("goto",
-		cmp,
-		readline.PcItem("-n", cmp))
-}
+const expireUsage = `
+=== expire command usage ===
 
-func (cmd cmpCommand) completer() readline.PrefixCompleterInterface {
-	return readline.PcItem("cmp")
-}
+The expire command is used to set when passwords expire, so that they can be changed regularly.
+Entries of other groups may be referred to as <group>/<name>.
 
-// ============= Commands: run implementations ============= //
+Usage:
+  expire [-option] <name> [<expiry>]
 
-func (cmd helpCommand) run(state *State, group, args string, reader *bufio.Reader) {
-	commands := cmd.commands
-	if args == "" {
-		println("go-hash commands:\n")
-		for name, cmd := range commands {
-			fmt.Printf("  %-8s %s\n", name, cmd.help())
-		}
-		println("\nType 'exit' to exit a group or quit if you are not within a group.")
-		println("To quit from anywhere, type 'quit'.")
-	} else {
-		cmd, exists := commands[args]
-		if exists {
-			println(cmd.longHelp())
-		} else {
-			println("Error: command does not exist.")
-		}
-	}
-}
+Options:
+  -g <path> [<expiry>]   set the expiry of a group (use '.' for the current group).
 
-func (cmd entryCommand) run(state *State, group, args string, reader *bufio.Reader) {
-	var (
-		CreateEntry bool
-		DeleteEntry bool
-		RenameEntry bool
-		EditEntry   bool
-		entry       string
-	)
-	switch {
-	case strings.HasPrefix(args, "-c"):
-		CreateEntry = true
-		entry = strings.TrimSpace(args[2:])
-	case strings.HasPrefix(args, "-d"):
-		DeleteEntry = true
-		entry = strings.TrimSpace(args[2:])
-	case strings.HasPrefix(args, "-r"):
-		RenameEntry = true
-		entry = strings.TrimSpace(args[2:])
-	case strings.HasPrefix(args, "-e"):
-		EditEntry = true
-		entry = strings.TrimSpace(args[2:])
-	case strings.HasPrefix(args, "-"):
-		println("Error: unknown option. Type 'help entry' for usage.")
-		return
-	default:
-		entry = args
-	}
+The <expiry> may be one of:
+  YYYY-MM-DD   the password expires at the given date.
+  <n>d         the password expires n days after it is changed (also: w = weeks, m = months, y = years).
+  none         the password never expires.
 
-	switch {
-	case CreateEntry:
-		createEntry(entry, state, group, reader)
-	case DeleteEntry:
-		removeEntry(entry, state, group, reader)
-	case RenameEntry:
-		renameEntry(entry, state, group, reader)
-	case EditEntry:
-		editEntry(entry, state, group, reader)
+Without an <expiry>, the current expiry of the entry or group is shown.
 
-	// no option provided, the next cases list or offer to create an entry
-	case len(entry) > 0:
-		entries, _ := (*state)[group]
-		if entryIndex, found := findEntryIndex(&entries, entry); found {
-			println(entries[entryIndex].String())
-		} else {
-			newEntryWanted := yesNoQuestion("Entry does not exist, do you want to create it? [y/n]: ", reader)
-			if newEntryWanted {
-				newEntry := createOrEditEntry(entry, reader, nil)
-				(*state)[group] = append(entries, newEntry)
+The expiry of a group applies to all of its entries, and to the entries of its subgroups, unless an
+entry (or a subgroup) has its own expiry.
+
+go-hash warns you about passwords that have expired, or will expire within 14 days, when the database
+is opened and when they are copied with the 'cp' or 'goto' commands.
+Type 'expired' to list all of them.
+
+Examples:
+
+  # the password of the 'hello' entry expires at the end of 2026
+  expire hello 2026-12-31
+
+  # the passwords of all entries in the 'work' group must be changed every 3 months
+  expire -g work 3m
+
+  # the password of the 'hello' entry never expires
+  expire hello none
+`
+
+const expiredUsage = `
+=== expired command usage ===
+
+The expired command lists the entries, in all groups, whose passwords have expired or are about to expire.
+
+Usage:
+  expired [<days>]
+
+By default, entries whose passwords expire within 14 days are listed.
+If <days> is given, entries whose passwords expire within the given number of days are listed instead.
+
+To set when passwords expire, use the 'expire' command.
+`
+
+const genUsage = `
+=== gen command usage ===
+
+The gen command generates a password without creating an entry, and manages the password profiles
+used to generate passwords.
+
+Usage:
+  gen [-option] [<profile>]
+
+Options:
+  -p [<profile>]          print the generated password instead of copying it to the clipboard.
+  -l                      list all password profiles.
+  -a <name> <profile>     add (or replace) a custom password profile.
+  -d <name>               delete a custom password profile.
+
+Without an option, a password is generated and copied to the clipboard.
+Information is automatically removed from the clipboard after one minute (see the clipboard-timeout setting),
+or when go-hash exits. The prompt shows how many seconds are left until then.
+
+A <profile> may be the name of a profile, optionally followed by options that override the profile's options,
+or just a list of options (which override the 'default' profile's options):
+
+  len=<n>            length of the password.
+  chars=<classes>    allowed character classes: u = upper-case, l = lower-case, d = digits, s = symbols.
+  require=<classes>  character classes which must appear in the password.
+  symbols=<chars>    the symbols which may be used (by default, all ASCII symbols).
+  exclude=<chars>    characters which must not be used.
+  no-ambiguous       do not use characters which are easily confused, like 'l', '1' and 'I'.
+  pattern=<pattern>  generate the password following a pattern.
+
+Within a pattern, the letters u, l, d and s stand for a character of the corresponding class,
+'a' stands for a letter, 'x' for a letter or digit, and '*' for any allowed character.
+A number within braces repeats the previous element, e.g. 'd{4}', and a backslash escapes the next character.
+Any other character is used literally.
+
+When an entry's password is generated, the profile used is stored with the entry, so that the
+same rules are used by default when the password is changed.
+
+Examples:
+
+  # generate a password with the default profile and copy it to the clipboard
+  gen
+
+  # print a 24-characters long password without symbols
+  gen -p alnum len=24
+
+  # add a profile for websites which only accept a few symbols
+  gen -a bank len=12 symbols=!@# no-ambiguous
+
+  # generate a password like 'KQZ-4821'
+  gen pattern=u{3}-d{4}
+`
+
+const breachUsage = `
+=== breach command usage ===
+
+The breach command checks whether the master password, or the password of any entry in any group, appears
+in a local copy of the Have I Been Pwned (HIBP) Pwned Passwords list.
+
+No network access is required, and passwords are never displayed.
+
+Usage:
+  breach [<path>]
+
+The <path> may be either:
+  * a file containing SHA-1 hashes ordered by hash, with lines of the form HASH:COUNT, as downloaded from HIBP.
+  * a directory containing one file per hash range, named after the first 5 characters of the hashes
+    (e.g. 5BAA6.txt), with lines of the form SUFFIX:COUNT, as returned by the HIBP range API.
+
+If <path> is not given, the value of the ` + breachFileEnvVar + ` environment variable is used.
+
+The entries whose passwords appear in the list are shown along with the number of times the password was seen.
+
+Examples:
+
+  # check all passwords against the downloaded list of hashes
+  breach /data/pwned-passwords-sha1-ordered-by-hash.txt
+`
+
+const auditUsage = `
+=== audit command usage ===
+
+The audit command checks the entries of all groups for security problems, and reports them along with hints
+on how to fix them.
+
+Usage:
+  audit [<days>]
+
+The following problems are reported:
+  * weak passwords, which are easy to guess.
+  * reused passwords, i.e. passwords used by more than one entry.
+  * similar passwords, e.g. 'Summer2017!' and 'Summer2018!'.
+  * old passwords, which have not been changed for longer than <days> days (365 by default).
+  * insecure (http://) URLs.
+  * missing URLs.
+  * missing usernames.
+
+A score from 0 to 100 summarises the findings. An entry with a weak password lowers the score the most,
+while an entry with a missing URL or username has only a small effect.
+
+Passwords are never displayed.
+
+Examples:
+
+  # audit all entries
+  audit
+
+  # audit all entries, reporting passwords not changed for 90 days
+  audit 90
+`
+
+const findUsage = `
+=== find command usage ===
+
+The find command searches the names, URLs, usernames, descriptions and tags of the entries in all groups.
+
+Usage:
+  find [-r] [-v] <query>
+
+Options:
+  -r  each term of the query is a regular expression.
+  -v  show the details of each entry found, instead of only its address.
+
+Entries are shown by their address relative to the current group, which other commands accept.
+
+The query consists of one or more terms separated by spaces. Entries must match all terms to be found.
+Terms containing spaces may be quoted.
+
+By default, terms match fuzzily, ignoring case: 'gthb' finds 'github'. Closer matches are shown first.
+
+A term may start with a field selector to only search that field:
+  name:<term>  the entry name.
+  url:<term>   the URL.
+  user:<term>  the username.
+  desc:<term>  the description.
+  tag:<term>   any tag.
+
+Each entry found is shown as <group>/<entry>, one per line.
+
+Examples:
+
+  # find entries with 'github' in any field
+  find github
+
+  # find entries whose URL contains 'github' and whose username is 'joe'
+  find url:github user:joe
+
+  # find entries whose description mentions an old account
+  find desc:"old account"
+
+  # find entries whose names start with 'aws-'
+  find -r name:^aws-
+`
+
+const importUsage = `
+=== import command usage ===
+
+The import command imports the entries of another password manager's file into the current group,
+or into the given group.
+
+Usage:
+  import <format> [-g <group>] [-n] [options] <file>
+
+Options:
+  -g <group>  the group to import entries into, instead of the current group.
+  -n          dry run: show which entries would be imported, without importing anything.
+
+Groups of the imported file become subgroups of the group entries are imported into, which is created if
+necessary. Imported entries which have the same username and password as an entry of their group, and the
+same name or URL, are skipped as duplicates. Other entries whose names are already used within their group
+are renamed, e.g. 'mail (2)'.
+
+Anything which could not be imported is reported after the import.
+
+Formats and their options:
+`
+
+const importExamples = `
+Examples:
+
+  # show what would be imported from a Chrome export, without importing anything
+  import csv -n ~/Downloads/passwords.csv
+
+  # import a CSV file exported by another application, mapping its columns to go-hash fields
+  import csv -m "name=Title,username=Login,password=Secret,url=Address" ~/export.csv
+
+  # import the logins saved in a Firefox profile into the 'firefox' group
+  import firefox -g firefox ~/.mozilla/firefox/abcd1234.default-release
+
+  # import the logins saved by Chromium, asking for the secret of the desktop keyring
+  import chromium -k ~/.config/chromium/Default
+
+  # import a KeePass database into the 'keepass' group
+  import kdbx -g keepass ~/passwords.kdbx
+
+  # import a KeePass database which requires a key file
+  import kdbx -k ~/passwords.key ~/passwords.kdbx
+
+  # import a password store of pass into the 'pass' group
+  import pass -g pass -k ~/key.asc ~/.password-store
+
+  # import a Password Safe database into the current group
+  import psafe3 ~/pwsafe.psafe3
+`
+
+const exportUsage = `
+=== export command usage ===
+
+The export command writes the entries of all groups, or of the given groups and their subgroups, to a file.
+
+Usage:
+  export <format> [-g <group>]... [options] <file>
+
+Options:
+  -g <group>  exports the entries of the group and of its subgroups. It may be given more than once.
+              All groups are exported if it is not given.
+
+Before writing a file which holds passwords in plain text (CSV and unencrypted JSON files), go-hash asks
+you to confirm it by typing 'yes'. Anyone who can read such a file can read all of its passwords.
+An existing file is only replaced after you confirm it. New files can only be read and written by you.
+
+Formats and their options:
+`
+
+const exportExamples = `
+Examples:
+
+  # export all entries to a JSON file encrypted with a passphrase
+  export json -e ~/backup.json
+
+  # export the 'work' and 'personal' groups to a KeePass database
+  export kdbx -g work -g personal ~/passwords.kdbx
+
+  # export the 'web' group to a CSV file which Bitwarden can import
+  export csv -p bitwarden -g web ~/bitwarden.csv
+`
+
+const kitUsage = `
+=== kit command usage ===
+
+The kit command writes a printable emergency kit: an HTML document with the location of the database, the
+parameters used to derive its key from the master password, instructions to restore it, and either a recovery
+key or the whole encrypted database as QR codes.
+
+Usage:
+  kit [-v] <file>
+
+Options:
+  -v  include the whole encrypted database, split into QR codes, instead of the recovery key.
+
+The recovery key opens the database without the master password, which is asked for before writing it. Keep the
+kit safe: anyone who holds it and a copy of the database can read all of your passwords. The recovery key stops
+working when the master password is changed.
+
+A kit with the encrypted database is enough to restore it, but it can still only be opened with the master
+password. It does not include changes made after it was written.
+
+To restore the database, run 'go-hash recover' (see 'go-hash recover -help').
+
+Print the file, then delete it securely, e.g. with 'shred -u'.
+
+Examples:
+
+  # write an emergency kit with the recovery key
+  kit ~/kit.html
+
+  # write an emergency kit with the encrypted database
+  kit -v ~/kit.html
+`
+
+const kdfUsage = `
+=== kdf command usage ===
+
+The kdf command shows the parameters of Argon2, the key derivation function (KDF) which turns the master password
+into the key of the database, and tunes them to this computer.
+
+Usage:
+  kdf
+  kdf calibrate [-t <duration>] [-m <MiB>] [-p <threads>]
+
+Options:
+  -t  the time it should take to unlock the database, e.g. 500ms or 2s (default: 1s).
+  -m  the memory used to derive the key, in MiB (default: 64).
+  -p  the number of threads used to derive the key (default: the number of CPUs of this computer).
+
+Without arguments, the current parameters are shown along with how long deriving the key takes on this computer.
+
+The calibrate subcommand measures how long deriving a key takes on this computer, and proposes the number of
+iterations for which unlocking the database takes about the given time, using the given memory. The proposed
+parameters are compared to the current ones, showing how many guesses of the master password per second this
+computer could make with each: the slower and the more memory-hungry each guess is, the more expensive it is
+to guess the master password by brute force. If you accept, the database is re-encrypted with the proposed
+parameters, which are stored in the database file.
+
+Choose parameters which every computer you open the database on can handle: a slower computer takes longer
+to unlock the database, and a computer without enough memory cannot unlock it at all.
+
+Examples:
+  # show the current parameters
+  kdf
+
+  # unlock the database in about 2 seconds, using 256 MiB of memory
+  kdf calibrate -t 2s -m 256
+`
+
+const infoUsage = `
+=== info command usage ===
+
+The info command prints information about the database file: its location, size, modification time and hashes,
+its format version, and the parameters used to derive its key from the master password. These can be compared
+with another copy of the database, e.g. one synchronised to another computer, to find out whether they match.
+
+It also prints the number of groups and entries, and when entries and passwords were last changed.
+
+Usage:
+  info
+
+To inspect a database file without opening it, run 'go-hash info <file>' (see 'go-hash info -help').
+`
+
+const lockUsage = `
+=== lock command usage ===
+
+The lock command locks the session immediately: the database contents, the master password and the key derived
+from it are removed from memory, and the clipboard is cleared if it still contains something copied by go-hash.
+The go-hash agent, if running, is also locked.
+
+To continue, enter the master password again.
+
+The session is also locked automatically after it has been idle for some time (10 minutes by default).
+To change that, set lock-timeout in the configuration file (~/.go-hash.conf, or $GO_HASH_CONFIG), e.g.:
+
+  lock-timeout = 30m
+
+Use 'lock-timeout = off' to disable automatic locking.
+
+No options or arguments are accepted.
+`
+
+func (cmd helpCommand) longHelp() string {
+	return helpUsage
+}
+
+func (cmd entryCommand) longHelp() string {
+	return entryUsage
+}
+
+func (cmd groupCommand) longHelp() string {
+	return groupUsage
+}
+
+func (cmd cpCommand) longHelp() string {
+	return copyUsage
+}
+
+func (cmd gotoCommand) longHelp() string {
+	return gotoUsage
+}
+
+func (cmd cmpCommand) longHelp() string {
+	return cmpUsage
+}
+
+func (cmd tagCommand) longHelp() string {
+	return tagUsage
+}
+
+func (cmd expireCommand) longHelp() string {
+	return expireUsage
+}
+
+func (cmd expiredCommand) longHelp() string {
+	return expiredUsage
+}
+
+func (cmd genCommand) longHelp() string {
+	return genUsage
+}
+
+func (cmd breachCommand) longHelp() string {
+	return breachUsage
+}
+
+func (cmd auditCommand) longHelp() string {
+	return auditUsage
+}
+
+func (cmd findCommand) longHelp() string {
+	return findUsage
+}
+
+func (cmd importCommand) longHelp() string {
+	var b bytes.Buffer
+	b.WriteString(importUsage)
+	for _, name := range importFormatNames() {
+		format := importFormats[name]
+		fmt.Fprintf(&b, "\n  %s: %s.\n%s", name, format.description, format.usage)
+	}
+	b.WriteString(importExamples)
+	return b.String()
+}
+
+func (cmd exportCommand) longHelp() string {
+	var b bytes.Buffer
+	b.WriteString(exportUsage)
+	for _, name := range exportFormatNames() {
+		format := exportFormats[name]
+		fmt.Fprintf(&b, "\n  %s: %s.\n%s", name, format.description, format.usage)
+	}
+	b.WriteString(exportExamples)
+	return b.String()
+}
+
+func (cmd kitCommand) longHelp() string {
+	return kitUsage
+}
+
+func (cmd kdfCommand) longHelp() string {
+	return kdfUsage
+}
+
+func (cmd infoCommand) longHelp() string {
+	return infoUsage
+}
+
+func (cmd lockCommand) longHelp() string {
+	return lockUsage
+}
+
+// ============= Commands: Auto-completers ============= //
+
+func (cmd helpCommand) completer() readline.PrefixCompleterInterface {
+	commands := cmd.commands
+	commandItems := make([]readline.PrefixCompleterInterface, len(commands), len(commands))
+	i := 0
+	for name := range commands {
+		commandItems[i] = readline.PcItem(name)
+		i++
+	}
+	return readline.PcItem("help", commandItems...)
+}
+
+func commandCompleter(getValues func() []string) readline.PrefixCompleterInterface {
+	resolve := func(line string) []string {
+		return getValues()
+	}
+	return readline.PcItemDynamic(resolve)
+}
+
+func (cmd entryCommand) completer() readline.PrefixCompleterInterface {
+	cmp := commandCompleter(cmd.entries)
+	return readline.PcItem("entry",
+		cmp,
+		readline.PcItem("-c"),
+		readline.PcItem("-d", cmp),
+		readline.PcItem("-e", cmp),
+		readline.PcItem("-r", cmp),
+		readline.PcItem("-t", commandCompleter(cmd.tags)))
+}
+
+func (cmd groupCommand) completer() readline.PrefixCompleterInterface {
+	cmp := commandCompleter(cmd.groups)
+	return readline.PcItem("group",
+		cmp,
+		readline.PcItem("-c"),
+		readline.PcItem("-d", cmp),
+		readline.PcItem("-r", cmp))
+}
+
+func (cmd cpCommand) completer() readline.PrefixCompleterInterface {
+	cmp := commandCompleter(cmd.entries)
+	return readline.PcItem("cp",
+		cmp,
+		readline.PcItem("-u", cmp),
+		readline.PcItem("-p", cmp))
+}
+
+func (cmd gotoCommand) completer() readline.PrefixCompleterInterface {
+	cmp := commandCompleter(cmd.entries)
+	return readline.PcItem("goto",
+		cmp,
+		readline.PcItem("-n", cmp))
+}
+
+func (cmd cmpCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("cmp")
+}
+
+func (cmd expireCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("expire",
+		commandCompleter(cmd.entries),
+		readline.PcItem("-g", commandCompleter(cmd.groups)))
+}
+
+func (cmd expiredCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("expired")
+}
+
+func (cmd lockCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("lock")
+}
+
+func (cmd findCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("find",
+		readline.PcItem("-r"),
+		readline.PcItem("-v"),
+	)
+}
+
+func (cmd importCommand) completer() readline.PrefixCompleterInterface {
+	var formats []readline.PrefixCompleterInterface
+	for _, name := range importFormatNames() {
+		formats = append(formats, readline.PcItem(name,
+			readline.PcItem("-g", commandCompleter(cmd.groups)),
+			readline.PcItem("-n")))
+	}
+	return readline.PcItem("import", formats...)
+}
+
+func (cmd exportCommand) completer() readline.PrefixCompleterInterface {
+	var formats []readline.PrefixCompleterInterface
+	for _, name := range exportFormatNames() {
+		formats = append(formats, readline.PcItem(name,
+			readline.PcItem("-g", commandCompleter(cmd.groups))))
+	}
+	return readline.PcItem("export", formats...)
+}
+
+func (cmd kitCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("kit",
+		readline.PcItem("-v"),
+	)
+}
+
+func (cmd kdfCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("kdf",
+		readline.PcItem("calibrate",
+			readline.PcItem("-t"),
+			readline.PcItem("-m"),
+			readline.PcItem("-p"),
+		),
+	)
+}
+
+func (cmd infoCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("info")
+}
+
+func (cmd auditCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("audit")
+}
+
+func (cmd breachCommand) completer() readline.PrefixCompleterInterface {
+	return readline.PcItem("breach")
+}
+
+func (cmd genCommand) completer() readline.PrefixCompleterInterface {
+	profiles := commandCompleter(func() []string {
+		return profileNames(cmd.meta.Profiles)
+	})
+	return readline.PcItem("gen",
+		profiles,
+		readline.PcItem("-p", profiles),
+		readline.PcItem("-l"),
+		readline.PcItem("-a"),
+		readline.PcItem("-d", commandCompleter(func() []string {
+			names := make([]string, 0, len(cmd.meta.Profiles))
+			for name := range cmd.meta.Profiles {
+				names = append(names, name)
+			}
+			return names
+		})))
+}
+
+func (cmd tagCommand) completer() readline.PrefixCompleterInterface {
+	resolveTags := func(line string) []string {
+		return cmd.tags()
+	}
+	cmp := readline.PcItemDynamic(func(line string) []string {
+		return cmd.entries()
+	}, readline.PcItemDynamic(resolveTags))
+	return readline.PcItem("tag",
+		cmp,
+		readline.PcItem("-a", cmp),
+		readline.PcItem("-d", cmp))
+}
+
+// ============= Commands: run implementations ============= //
+
+func (cmd helpCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	commands := cmd.commands
+	if args == "" {
+		println("go-hash commands:\n")
+		for name, cmd := range commands {
+			fmt.Printf("  %-8s %s\n", name, cmd.help())
+		}
+		println("\nType 'exit' to go back to the parent group, or quit if you are not within a group.")
+		println("To quit from anywhere, type 'quit'.")
+	} else {
+		cmd, exists := commands[args]
+		if exists {
+			println(cmd.longHelp())
+		} else {
+			println("Error: command does not exist.")
+		}
+	}
+}
+
+func (cmd entryCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	var (
+		CreateEntry bool
+		DeleteEntry bool
+		RenameEntry bool
+		EditEntry   bool
+		ListTagged  bool
+		entry       string
+	)
+	switch {
+	case strings.HasPrefix(args, "-c"):
+		CreateEntry = true
+		entry = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-d"):
+		DeleteEntry = true
+		entry = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-r"):
+		RenameEntry = true
+		entry = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-e"):
+		EditEntry = true
+		entry = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-t"):
+		ListTagged = true
+		entry = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-"):
+		println("Error: unknown option. Type 'help entry' for usage.")
+		return
+	default:
+		entry = args
+	}
+
+	switch {
+	case CreateEntry:
+		createEntry(entry, state, cmd.meta, group, reader)
+	case DeleteEntry:
+		removeEntry(entry, state, group, reader)
+	case RenameEntry:
+		renameEntry(entry, state, group, reader)
+	case EditEntry:
+		editEntry(entry, state, cmd.meta, group, reader)
+	case ListTagged:
+		listTaggedEntries(strings.Fields(entry), state)
+
+	// no option provided, the next cases list or offer to create an entry
+	case len(entry) > 0:
+		if entryGroup, entryIndex, found := state.resolveEntry(group, entry); found {
+			entries := (*state)[entryGroup]
+			println(entries[entryIndex].String())
+			if warning := cmd.meta.expiryWarning(&entries[entryIndex], entryGroup); warning != "" {
+				println(warning)
+			}
+		} else if entryGroup, name, err := state.resolveNewEntry(group, entry); err != nil {
+			fmt.Printf("Error: %s.\n", err.Error())
+		} else {
+			newEntryWanted := yesNoQuestion("Entry does not exist, do you want to create it? [y/n]: ", reader)
+			if newEntryWanted {
+				newEntry := createOrEditEntry(name, reader, nil, cmd.meta)
+				(*state)[entryGroup] = append((*state)[entryGroup], newEntry)
+			}
+		}
+	default:
+		entries := (*state)[group]
+		fmt.Printf("Showing group %s:\n\n", groupDescription(group, &entries, false))
+		if len(entries) > 0 {
+			for _, e := range entries {
+				println(e.String())
+			}
+		}
+		println("\nHint: To show the details of a single entry, type 'entry <name>'.")
+	}
+}
+
+func (cmd groupCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	var (
+		CreateGroup bool
+		DeleteGroup bool
+		RenameGroup bool
+		groupName   string
+	)
+	switch {
+	case strings.HasPrefix(args, "-c"):
+		CreateGroup = true
+		groupName = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-d"):
+		DeleteGroup = true
+		groupName = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-r"):
+		RenameGroup = true
+		groupName = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-"):
+		println("Error: unknown option. Type 'help group' for usage.")
+		return
+	default:
+		groupName = args
+	}
+
+	switch {
+	case CreateGroup:
+		cmd.groupBox.value = createGroup(groupName, state, group, reader)
+	case DeleteGroup:
+		cmd.groupBox.value = removeGroup(groupName, state, cmd.meta, group, reader)
+	case RenameGroup:
+		cmd.groupBox.value = renameGroup(groupName, state, cmd.meta, group, reader)
+
+	// no option selected, list or offer to create group
+	case len(groupName) > 0:
+		path := resolveGroupPath(group, groupName)
+		_, groupExists := (*state)[path]
+		if groupExists {
+			cmd.groupBox.value = path
+		} else {
+			newGroupWanted := yesNoQuestion("Group does not exist, do you want to create it? [y/n]: ", reader)
+			if newGroupWanted {
+				cmd.groupBox.value = createGroup(groupName, state, group, reader)
+			}
+		}
+	default:
+		groupLen := len(*state)
+		switch groupLen {
+		case 1:
+			println("There is 1 group:\n")
+		default:
+			fmt.Printf("There are %d groups:\n\n", groupLen)
+		}
+		for _, groupName := range state.subgroups(rootGroup) {
+			entries := (*state)[groupName]
+			indent := strings.Repeat("  ", len(splitGroupPath(groupName)))
+			fmt.Printf("  %s%s\n", indent, groupDescription(groupBaseName(groupName), &entries, true))
+		}
+		println("\nHint: Type 'entry' to list all entries in the current group.")
+	}
+}
+
+func (cmd cpCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	CopyPassword := false
+	CopyUsername := false
+	var entry string
+	switch {
+	case strings.HasPrefix(args, "-p"):
+		CopyPassword = true
+		entry = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-u"):
+		CopyUsername = true
+		entry = strings.TrimSpace(args[2:])
+	case strings.HasPrefix(args, "-"):
+		println("Error: Unknown option.")
+		println("Hint: valid options are: -p (password), -u (username)")
+		return
+	default:
+		CopyUsername = true
+		entry = args
+	}
+
+	showEntryHint := func() {
+		entries := (*state)[group]
+		if len(entries) > 0 {
+			entryNames := make([]string, len(entries))
+			for i, e := range entries {
+				entryNames[i] = e.Name
+			}
+			fmt.Printf("Hint: under the current group, %s, the following entries exist: %s\n", group, strings.Join(entryNames, ", "))
+		} else if len(*state) > 1 {
+			println("Hint: there are no entries under the current group! " +
+				"To enter a group which contains entries, use the 'group' command. " +
+				"Type 'ls' to list all groups.")
+		} else {
+			println("Hint: there are no entries yet! You can create a new entry with the 'entry' command! " +
+				"For example, try typing 'entry gmail'.")
+		}
+	}
+
+	if len(entry) == 0 {
+		println("Error: please provide an entry name.")
+		showEntryHint()
+	} else {
+		entryGroup, entryIndex, found := state.resolveEntry(group, entry)
+		if found {
+			entries := (*state)[entryGroup]
+			var content string
+			switch {
+			case CopyPassword:
+				content = entries[entryIndex].Password
+				if warning := cmd.meta.expiryWarning(&entries[entryIndex], entryGroup); warning != "" {
+					println(warning)
+				}
+			case CopyUsername:
+				content = entries[entryIndex].Username
+			default:
+				panic("Unexpected field case")
+			}
+			copyToClipboard(content)
+		} else {
+			fmt.Printf("Error: entry '%s' does not exist.\n", entry)
+			showEntryHint()
+		}
+	}
+}
+
+func (cmd gotoCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	entryName := args
+	doCopyPass := true
+	if strings.HasPrefix(args, "-n ") {
+		entryName = strings.TrimSpace(args[3:])
+		doCopyPass = false
+	} else if len(args) == 0 {
+		println("Error: please provide the name of the entry to goto.")
+		return
+	}
+
+	if entryGroup, entryIndex, found := state.resolveEntry(group, entryName); found {
+		entries := (*state)[entryGroup]
+		URL := entries[entryIndex].URL
+		if len(URL) == 0 {
+			println("Error: entry does not have a URL to go to.")
+		} else {
+			go open(URL)
+			if doCopyPass {
+				cpCommand{meta: cmd.meta}.run(state, group, "-p "+entryName, reader)
+			} else if warning := cmd.meta.expiryWarning(&entries[entryIndex], entryGroup); warning != "" {
+				println(warning)
+			}
+		}
+	} else {
+		fmt.Printf("Error: entry '%s' does not exist.\n", entryName)
+	}
+}
+
+func (cmd tagCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	var (
+		AddTags    bool
+		RemoveTags bool
+	)
+	switch {
+	case strings.HasPrefix(args, "-a"):
+		AddTags = true
+		args = args[2:]
+	case strings.HasPrefix(args, "-d"):
+		RemoveTags = true
+		args = args[2:]
+	case strings.HasPrefix(args, "-"):
+		println("Error: unknown option. Type 'help tag' for usage.")
+		return
+	}
+
+	entryName, rest := splitFirstArg(args)
+	if len(entryName) == 0 {
+		if AddTags || RemoveTags {
+			println("Error: please provide the name of the entry and the tags.")
+		} else {
+			listTags(state)
+		}
+		return
+	}
+
+	tags := strings.Fields(rest)
+	entryGroup, entryIndex, found := state.resolveEntry(group, entryName)
+	if !found {
+		fmt.Printf("Error: entry '%s' does not exist.\n", entryName)
+		return
+	}
+	entry := &(*state)[entryGroup][entryIndex]
+
+	switch {
+	case AddTags || RemoveTags:
+		if len(tags) == 0 {
+			println("Error: please provide at least one tag.")
+			return
+		}
+		var changed int
+		if AddTags {
+			changed = entry.addTags(tags)
+		} else {
+			changed = entry.removeTags(tags)
+		}
+		if changed > 0 {
+			entry.UpdatedAt = time.Now()
+		}
+		fmt.Printf("Tags of '%s': %s\n", entry.Name, tagsDescription(entry.Tags))
+	case len(tags) > 0:
+		println("Error: too many arguments. To add tags to an entry, use the -a option.")
+	default:
+		fmt.Printf("Tags of '%s': %s\n", entry.Name, tagsDescription(entry.Tags))
+	}
+}
+
+func (cmd expireCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	SetGroupExpiry := false
+	if strings.HasPrefix(args, "-g") {
+		SetGroupExpiry = true
+		args = args[2:]
+	} else if strings.HasPrefix(args, "-") {
+		println("Error: unknown option. Type 'help expire' for usage.")
+		return
+	}
+
+	target, rest := splitFirstArg(args)
+	parts := append([]string{target}, strings.Fields(rest)...)
+	if len(target) == 0 || len(parts) > 2 {
+		if SetGroupExpiry {
+			println("Error: please provide the path of the group and, optionally, its expiry.")
+		} else {
+			println("Error: please provide the name of the entry and, optionally, its expiry.")
+		}
+		return
+	}
+
+	var expiry Expiry
+	if len(parts) == 2 {
+		var err error
+		expiry, err = parseExpiry(parts[1])
+		if err != nil {
+			fmt.Printf("Error: %s. Type 'help expire' for valid expiry values.\n", err.Error())
+			return
+		}
+	}
+
+	if SetGroupExpiry {
+		path := resolveGroupPath(group, parts[0])
+		if _, exists := (*state)[path]; !exists {
+			fmt.Printf("Error: group '%s' does not exist.\n", path)
+			return
+		}
+		if len(parts) == 2 {
+			cmd.meta.setGroupExpiry(path, expiry)
+		}
+		fmt.Printf("Expiry of group '%s': %s\n", path, cmd.meta.Groups[path].Expiry.String())
+	} else {
+		entryGroup, entryIndex, found := state.resolveEntry(group, parts[0])
+		if !found {
+			fmt.Printf("Error: entry '%s' does not exist.\n", parts[0])
+			return
+		}
+		entry := &(*state)[entryGroup][entryIndex]
+		if len(parts) == 2 {
+			entry.Expiry = expiry
+			entry.UpdatedAt = time.Now()
+		}
+		fmt.Printf("Expiry of '%s': %s\n", entry.Name, entry.Expiry.String())
+		if entry.Expiry.isZero() {
+			if groupExpiry := cmd.meta.expiryOf(entry, entryGroup); !groupExpiry.isZero() {
+				fmt.Printf("The expiry of its group applies: %s\n", groupExpiry.String())
+			}
+		}
+		if warning := cmd.meta.expiryWarning(entry, entryGroup); warning != "" {
+			println(warning)
+		}
+	}
+}
+
+func (cmd expiredCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	now := time.Now()
+	if len(args) > 0 {
+		days, err := strconv.Atoi(args)
+		if err != nil || days < 0 {
+			println("Error: please provide a valid number of days. Type 'help expired' for usage.")
+			return
+		}
+		// look for entries that will have expired or be about to expire in the given number of days
+		now = now.Add(time.Duration(days)*24*time.Hour - expiryWarningPeriod)
+	}
+	expiring := cmd.meta.expiringEntries(state, now)
+	if len(expiring) == 0 {
+		println("No passwords have expired or will expire soon.")
+		return
+	}
+	today := time.Now()
+	for _, e := range expiring {
+		var when string
+		if e.expiresAt.Before(today) {
+			when = "expired " + describeDaysFrom(today, e.expiresAt)
+		} else {
+			when = "expires " + describeDaysFrom(today, e.expiresAt)
+		}
+		fmt.Printf("  %-32s %s (%s)\n", entryPath(e.group, e.entry.Name), e.expiresAt.Format(expiryDateFormat), when)
+	}
+	println("\nHint: to change the password of an entry, type 'entry -e <name>' within its group.")
+}
+
+func (cmd genCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	switch {
+	case args == "-l":
+		for _, name := range profileNames(cmd.meta.Profiles) {
+			spec, custom := cmd.meta.Profiles[name]
+			if !custom {
+				spec = builtinProfiles[name]
+			}
+			profile, _ := parseProfile(spec, nil)
+			kind := "built-in"
+			if custom {
+				kind = "custom"
+			}
+			fmt.Printf("  %-12s %-10s %3.0f bits   %s\n", name, kind, profile.entropyBits(), spec)
+		}
+	case strings.HasPrefix(args, "-a"):
+		parts := strings.SplitN(strings.TrimSpace(args[2:]), " ", 2)
+		if len(parts) < 2 || strings.Contains(parts[0], "=") {
+			println("Error: please provide the name of the profile followed by its options.")
+			return
+		}
+		profile, err := parseProfile(parts[1], cmd.meta.Profiles)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+		if cmd.meta.Profiles == nil {
+			cmd.meta.Profiles = make(map[string]string)
+		}
+		cmd.meta.Profiles[parts[0]] = profile.String()
+		fmt.Printf("Saved profile '%s': %s\n", parts[0], profile.String())
+	case strings.HasPrefix(args, "-d"):
+		name := strings.TrimSpace(args[2:])
+		if _, exists := cmd.meta.Profiles[name]; exists {
+			delete(cmd.meta.Profiles, name)
+			fmt.Printf("Deleted profile '%s'.\n", name)
+		} else if _, builtin := builtinProfiles[name]; builtin {
+			println("Error: built-in profiles cannot be deleted.")
+		} else {
+			fmt.Printf("Error: profile '%s' does not exist.\n", name)
+		}
+	default:
+		PrintPassword := false
+		if strings.HasPrefix(args, "-p") {
+			PrintPassword = true
+			args = strings.TrimSpace(args[2:])
+		} else if strings.HasPrefix(args, "-") {
+			println("Error: unknown option. Type 'help gen' for usage.")
+			return
+		}
+		if len(args) == 0 {
+			args = defaultProfile
+		}
+		profile, err := parseProfile(args, cmd.meta.Profiles)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			return
+		}
+		password := profile.generate()
+		if PrintPassword {
+			fmt.Println(password)
+		} else if copyToClipboard(password) {
+			println("Generated password copied to the clipboard.")
+		}
+		fmt.Printf("Estimated entropy: %s.\n", describeEntropy(profile.entropyBits()))
+	}
+}
+
+func (cmd lockCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	if len(args) > 0 {
+		println("Error: the lock command does not accept any arguments.")
+		return
+	}
+	cmd.session.lockHeld()
+	agentLock()
+	println("Session locked. Hit Enter to unlock it.")
+}
+
+func (cmd findCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	useRegex, verbose := false, false
+	for {
+		if strings.HasPrefix(args, "-r ") {
+			useRegex = true
+		} else if strings.HasPrefix(args, "-v ") {
+			verbose = true
+		} else {
+			break
+		}
+		args = strings.TrimSpace(args[3:])
+	}
+	terms, err := parseSearchQuery(args, useRegex)
+	if err != nil {
+		fmt.Printf("Error: %s. Type 'help find' for usage.\n", err.Error())
+		return
+	}
+	results := searchEntries(state, terms)
+	if len(results) == 0 {
+		println("No entries found.")
+		return
+	}
+	for _, r := range results {
+		if verbose {
+			fmt.Printf("[%s]\n%s\n", r.group, r.entry.String())
+		} else {
+			// addresses are relative to the current group, so they can be given to other commands
+			fmt.Println(entryAddress(group, r.group, r.entry.Name))
+		}
+	}
+}
+
+func (cmd importCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	parts, err := splitQuotedArgs(args)
+	if err != nil || len(parts) == 0 {
+		println("Error: please provide the format and the file to import. Type 'help import' for usage.")
+		return
+	}
+	format, ok := importFormats[parts[0]]
+	if !ok {
+		fmt.Printf("Error: unknown format '%s'. Formats: %s.\n", parts[0], strings.Join(importFormatNames(), ", "))
+		return
+	}
+	fs := newFlagSet("import")
+	target := fs.String("g", "", "the group to import entries into")
+	dryRun := fs.Bool("n", false, "show what would be imported without importing anything")
+	read := format.options(fs)
+	positional, err := parseArgs(fs, parts[1:])
+	if err != nil || len(positional) != 1 {
+		println("Error: please provide the file to import. Type 'help import' for usage.")
+		return
+	}
+	path, err := homedir.Expand(positional[0])
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	if len(*target) > 0 {
+		group = resolveGroupPath(group, *target)
+	}
+
+	result, err := read(path, reader)
+	if err != nil {
+		fmt.Printf("Error: unable to import '%s': %s\n", path, err.Error())
+		return
+	}
+	destination := state
+	if *dryRun {
+		preview := state.copy()
+		destination = &preview
+	}
+	added, warnings := addImportedEntries(destination, group, result.entries, time.Now())
+	warnings = append(result.warnings, warnings...)
+	if *dryRun {
+		fmt.Printf("Entries which would be imported (%d):\n", len(added))
+		for _, path := range added {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	if len(warnings) > 0 {
+		fmt.Printf("Warnings (%d):\n", len(warnings))
+		for _, w := range warnings {
+			fmt.Printf("  %s\n", w)
+		}
+	}
+	if *dryRun {
+		fmt.Printf("Dry run: %d entries would be imported into group '%s', nothing was changed.\n", len(added), group)
+		return
+	}
+	fmt.Printf("Imported %d entries into group '%s'.\n", len(added), group)
+	if result.plaintext {
+		fmt.Printf("Reminder: '%s' contains your passwords in plain text. Delete it securely, e.g. with "+
+			"'shred -u' or 'srm', and remember copies in backups or in the trash.\n", path)
+	}
+}
+
+func (cmd exportCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	parts, err := splitQuotedArgs(args)
+	if err != nil || len(parts) == 0 {
+		println("Error: please provide the format and the file to export to. Type 'help export' for usage.")
+		return
+	}
+	format, ok := exportFormats[parts[0]]
+	if !ok {
+		fmt.Printf("Error: unknown format '%s'. Formats: %s.\n", parts[0], strings.Join(exportFormatNames(), ", "))
+		return
+	}
+	fs := newFlagSet("export")
+	var selected groupList
+	fs.Var(&selected, "g", "a group to export, with its subgroups")
+	exporter := format.options(fs)
+	positional, err := parseArgs(fs, parts[1:])
+	if err != nil || len(positional) != 1 {
+		println("Error: please provide the file to export to. Type 'help export' for usage.")
+		return
+	}
+	path, err := homedir.Expand(positional[0])
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	paths := []string{rootGroup}
+	if len(selected) > 0 {
+		paths = nil
+		for _, g := range selected {
+			resolved := resolveGroupPath(group, g)
+			if len(state.subgroups(resolved)) == 0 {
+				fmt.Printf("Error: group '%s' does not exist.\n", g)
+				return
 			}
+			paths = append(paths, resolved)
 		}
-	default:
-		entries := (*state)[group]
-		fmt.Printf("Showing group %s:\n\n", groupDescription(group, &entries, false))
-		if len(entries) > 0 {
-			for _, e := range entries {
-				println(e.String())
-			}
+	}
+	groups := exportedGroups(state, cmd.meta, paths)
+	count := 0
+	for _, g := range groups {
+		count += len(g.entries)
+	}
+	if count == 0 {
+		println("There are no entries to export.")
+		return
+	}
+
+	if exporter.plaintext() {
+		fmt.Printf("\033[31mWARNING: '%s' will contain the passwords of %d entries in PLAIN TEXT.\n"+
+			"Anyone who can read this file, or a backup or synced copy of it, can read them all.\033[0m\n",
+			path, count)
+		if read(reader, "To write it anyway, type 'yes': ") != "yes" {
+			println("Nothing was exported.")
+			return
 		}
-		println("\nHint: To show the details of a single entry, type 'entry <name>'.")
+	}
+	if _, err := os.Stat(path); err == nil {
+		if !yesNoQuestion(fmt.Sprintf("File '%s' already exists, do you want to replace it? [y/n]: ", path), reader) {
+			println("Nothing was exported.")
+			return
+		}
+	}
+	result, err := exporter.export(groups, reader)
+	if err != nil {
+		fmt.Printf("Error: unable to export: %s\n", err.Error())
+		return
+	}
+	if err = ioutil.WriteFile(path, result.content, 0600); err != nil {
+		fmt.Printf("Error: unable to write '%s': %s\n", path, err.Error())
+		return
+	}
+	if len(result.warnings) > 0 {
+		fmt.Printf("Warnings (%d):\n", len(result.warnings))
+		for _, w := range result.warnings {
+			fmt.Printf("  %s\n", w)
+		}
+	}
+	fmt.Printf("Exported %d entries from %d groups to '%s'.\n", count, len(groups), path)
+	if exporter.plaintext() {
+		println("Delete the file securely as soon as you no longer need it, e.g. with 'shred -u' or 'srm'.")
 	}
 }
 
-func (cmd groupCommand) run(state *State, group, args string, reader *bufio.Reader) {
-	var (
-		CreateGroup bool
-		DeleteGroup bool
-		RenameGroup bool
-		groupName   string
-	)
-	switch {
-	case strings.HasPrefix(args, "-c"):
-		CreateGroup = true
-		groupName = strings.TrimSpace(args[2:])
-	case strings.HasPrefix(args, "-d"):
-		DeleteGroup = true
-		groupName = strings.TrimSpace(args[2:])
-	case strings.HasPrefix(args, "-r"):
-		RenameGroup = true
-		groupName = strings.TrimSpace(args[2:])
-	case strings.HasPrefix(args, "-"):
-		println("Error: unknown option. Type 'help group' for usage.")
+func (cmd kitCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	parts, err := splitQuotedArgs(args)
+	if err != nil {
+		println("Error: " + err.Error())
 		return
-	default:
-		groupName = args
 	}
-
-	switch {
-	case CreateGroup:
-		cmd.groupBox.value = createGroup(groupName, state, group, reader)
-	case DeleteGroup:
-		cmd.groupBox.value = removeGroup(groupName, state, group, reader)
-	case RenameGroup:
-		cmd.groupBox.value = renameGroup(groupName, state, group, reader)
-
-	// no option selected, list or offer to create group
-	case len(groupName) > 0:
-		_, groupExists := (*state)[groupName]
-		if groupExists {
-			cmd.groupBox.value = groupName
-		} else {
-			newGroupWanted := yesNoQuestion("Group does not exist, do you want to create it? [y/n]: ", reader)
-			if newGroupWanted {
-				cmd.groupBox.value = createGroup(groupName, state, group, reader)
-			}
+	fs := newFlagSet("kit")
+	vault := fs.Bool("v", false, "include the encrypted database instead of the recovery key")
+	positional, err := parseArgs(fs, parts)
+	if err != nil || len(positional) != 1 {
+		println("Error: please provide the file to write the emergency kit to. Type 'help kit' for usage.")
+		return
+	}
+	path, err := homedir.Expand(positional[0])
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	if !*vault {
+		println("The recovery key opens the database without the master password.")
+		print("To write it, please enter your master password: ")
+		pass, err := terminal.ReadPassword(int(syscall.Stdin))
+		println("")
+		if err != nil {
+			panic(err)
 		}
-	default:
-		groupLen := len(*state)
-		switch groupLen {
-		case 1:
-			println("There is 1 group:\n")
-		default:
-			fmt.Printf("There are %d groups:\n\n", groupLen)
+		if !cmd.keyBox.value.Matches(string(pass)) {
+			println("Error: incorrect password.")
+			return
 		}
-		for groupName, entries := range *state {
-			fmt.Printf("  %s\n", groupDescription(groupName, &entries, true))
+	}
+	if _, err := os.Stat(path); err == nil {
+		if !yesNoQuestion(fmt.Sprintf("File '%s' already exists, do you want to replace it? [y/n]: ", path), reader) {
+			return
 		}
-		println("\nHint: Type 'entry' to list all entries in the current group.")
 	}
+	kit, err := newEmergencyKit(cmd.dbPath, cmd.keyBox.value, *vault, time.Now())
+	if err == nil {
+		err = writeEmergencyKit(path, kit)
+	}
+	if err != nil {
+		fmt.Printf("Error: unable to write the emergency kit: %s\n", err.Error())
+		return
+	}
+	if *vault {
+		fmt.Printf("Emergency kit with the encrypted database (%d QR codes) written to '%s'.\n", len(kit.Vault), path)
+	} else {
+		fmt.Printf("Emergency kit with the recovery key written to '%s'.\n", path)
+	}
+	println("Print it and keep it somewhere safe, then delete the file securely, e.g. with 'shred -u'.")
 }
 
-func (cmd cpCommand) run(state *State, group, args string, reader *bufio.Reader) {
-	CopyPassword := false
-	CopyUsername := false
-	entries := (*state)[group]
-	var entry string
-	switch {
-	case strings.HasPrefix(args, "-p"):
-		CopyPassword = true
-		entry = strings.TrimSpace(args[2:])
-	case strings.HasPrefix(args, "-u"):
-		CopyUsername = true
-		entry = strings.TrimSpace(args[2:])
-	case strings.HasPrefix(args, "-"):
-		println("Error: Unknown option.")
-		println("Hint: valid options are: -p (password), -u (username)")
+func (cmd kdfCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	parts, err := splitQuotedArgs(args)
+	if err != nil {
+		println("Error: " + err.Error())
 		return
-	default:
-		CopyUsername = true
-		entry = args
 	}
-
-	showEntryHint := func() {
-		if len(entries) > 0 {
-			entryNames := make([]string, len(entries))
-			for i, e := range entries {
-				entryNames[i] = e.Name
-			}
-			fmt.Printf("Hint: under the current group, %s, the following entries exist: %s\n", group, strings.Join(entryNames, ", "))
-		} else if len(*state) > 1 {
-			println("Hint: there are no entries under the current group! " +
-				"To enter a group which contains entries, use the 'group' command. " +
-				"Type 'ls' to list all groups.")
-		} else {
-			println("Hint: there are no entries yet! You can create a new entry with the 'entry' command! " +
-				"For example, try typing 'entry gmail'.")
+	current := cmd.keyBox.value.KDF
+	if len(parts) == 0 {
+		for _, param := range kdfParameters(current, DBVersion) {
+			fmt.Printf("  %-20s %s\n", param[0]+":", param[1])
 		}
+		fmt.Printf("Deriving the key takes %s on this computer.\n", formatKdfTime(current.Benchmark()))
+		return
+	}
+	if parts[0] != "calibrate" {
+		fmt.Printf("Error: unknown kdf subcommand: '%s'. Type 'help kdf' for usage.\n", parts[0])
+		return
+	}
+	fs := newFlagSet("kdf")
+	target := fs.Duration("t", time.Second, "the time it should take to unlock the database")
+	memory := fs.Uint("m", 64, "the memory to use, in MiB")
+	threads := fs.Uint("p", uint(encryption.THREADS), "the number of threads to use")
+	if positional, err := parseArgs(fs, parts[1:]); err != nil || len(positional) > 0 {
+		println("Error: invalid arguments. Type 'help kdf' for usage.")
+		return
+	}
+	switch {
+	case *target < minKdfTarget || *target > maxKdfTarget:
+		fmt.Printf("Error: the unlock time must be between %s and %s.\n", minKdfTarget, maxKdfTarget)
+		return
+	case *memory < minKdfMemoryMiB || *memory > maxKdfMemoryMiB:
+		fmt.Printf("Error: the memory must be between %d and %d MiB.\n", minKdfMemoryMiB, maxKdfMemoryMiB)
+		return
+	case *threads < 1 || *threads > 255:
+		println("Error: the number of threads must be between 1 and 255.")
+		return
 	}
 
-	if len(entry) == 0 {
-		println("Error: please provide an entry name.")
-		showEntryHint()
+	println("Measuring how long deriving a key takes on this computer, please wait...")
+	proposed, proposedTime := encryption.CalibrateKDF(*target, uint32(*memory)*1024, uint8(*threads))
+	if proposed.Time > maxKdfTime {
+		fmt.Printf("Error: the unlock time would require more than %d iterations, please use more memory.\n", maxKdfTime)
+		return
+	}
+	currentTime := current.Benchmark()
+	print(kdfComparison(current, proposed, currentTime, proposedTime))
+	ratio := kdfCost(proposed) / kdfCost(current)
+	if ratio < 1 {
+		fmt.Printf("\033[31mWarning: with these parameters, guessing the master password is %.1f times cheaper "+
+			"than with the current ones.\033[0m\n", 1/ratio)
 	} else {
-		entryIndex, found := findEntryIndex(&entries, entry)
-		if found {
-			var content string
-			switch {
-			case CopyPassword:
-				content = entries[entryIndex].Password
-			case CopyUsername:
-				content = entries[entryIndex].Username
-			default:
-				panic("Unexpected field case")
-			}
-			err := clipboard.WriteAll(content)
-			if err != nil {
-				fmt.Printf("Error: unable to copy! Reason: %s\n", err.Error())
-			} else {
-				go removeFromClipboardAfterDelay(content)
-			}
-		} else {
-			fmt.Printf("Error: entry '%s' does not exist.\n", entry)
-			showEntryHint()
+		fmt.Printf("With these parameters, each guess of the master password takes %.1f times as much time and "+
+			"memory as with the current ones, on any computer.\n", ratio)
+	}
+	if proposed == current || !yesNoQuestion("Re-encrypt the database with the proposed parameters? [y/n]: ", reader) {
+		return
+	}
+	print("Please enter your master password: ")
+	pass, err := terminal.ReadPassword(int(syscall.Stdin))
+	println("")
+	if err != nil {
+		panic(err)
+	}
+	if !cmd.keyBox.value.Matches(string(pass)) {
+		println("Error: incorrect password.")
+		return
+	}
+	cmd.keyBox.value = NewDatabaseKeyWithKDF(string(pass), proposed)
+	println("The database was re-encrypted. Print a new emergency kit if you have one, as its recovery key no longer works.")
+}
+
+func (cmd infoCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	if len(strings.TrimSpace(args)) > 0 {
+		println("Error: the info command takes no arguments. Type 'help info' for usage.")
+		return
+	}
+	info, err := readDatabaseInfo(cmd.dbPath)
+	if info != nil {
+		printDatabaseInfo(os.Stdout, info)
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+	}
+	printContentInfo(os.Stdout, *state, cmd.meta)
+}
+
+func (cmd auditCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	maxAgeDays := defaultAuditMaxAgeDays
+	if len(args) > 0 {
+		days, err := strconv.Atoi(args)
+		if err != nil || days <= 0 {
+			println("Error: please provide a valid number of days. Type 'help audit' for usage.")
+			return
 		}
+		maxAgeDays = days
 	}
+	fmt.Println(auditState(state, maxAgeDays, time.Now()).String())
 }
 
-func (cmd gotoCommand) run(state *State, group, args string, reader *bufio.Reader) {
-	entryName := args
-	doCopyPass := true
-	if strings.HasPrefix(args, "-n ") {
-		entryName = strings.TrimSpace(args[3:])
-		doCopyPass = false
-	} else if len(args) == 0 {
-		println("Error: please provide the name of the entry to goto.")
+func (cmd breachCommand) run(state *State, group, args string, reader *bufio.Reader) {
+	path := args
+	if len(path) == 0 {
+		path = os.Getenv(breachFileEnvVar)
+	}
+	if len(path) == 0 {
+		println("Error: please provide the path to the breached passwords list. Type 'help breach' for usage.")
+		return
+	}
+	db, err := openBreachDatabase(path)
+	if err != nil {
+		fmt.Printf("Error: unable to open the breached passwords list: %s\n", err.Error())
 		return
 	}
+	defer db.Close()
 
-	entries := (*state)[group]
-	if entryIndex, found := findEntryIndex(&entries, entryName); found {
-		URL := entries[entryIndex].URL
-		if len(URL) == 0 {
-			println("Error: entry does not have a URL to go to.")
+	var masterCount int
+	if len(cmd.mpBox.value) > 0 {
+		masterCount, err = db.lookup(cmd.mpBox.value)
+	} else {
+		println("The master password was not checked, as the database was unlocked by the go-hash agent.")
+	}
+	if err == nil && len(cmd.mpBox.value) > 0 {
+		if masterCount > 0 {
+			fmt.Printf("Warning: the master password appears in breaches (seen %d times)! Change it with the 'cmp' command.\n\n",
+				masterCount)
 		} else {
-			go open(URL)
-			if doCopyPass {
-				cpCommand{}.run(state, group, "-p "+entryName, reader)
-			}
+			println("The master password does not appear in any breach.")
 		}
-	} else {
-		fmt.Printf("Error: entry '%s' does not exist.\n", entryName)
 	}
+	var breached []breachedEntry
+	if err == nil {
+		breached, err = findBreachedEntries(state, db)
+	}
+	if err != nil {
+		fmt.Printf("Error: unable to check passwords: %s\n", err.Error())
+		return
+	}
+
+	if len(breached) == 0 {
+		println("No entry passwords appear in any breach.")
+		return
+	}
+	fmt.Printf("The passwords of %d entries appear in breaches:\n\n", len(breached))
+	for _, e := range breached {
+		fmt.Printf("  %-32s (seen %d times)\n", entryPath(e.group, e.name), e.count)
+	}
+	println("\nHint: breached passwords are tried first by attackers, so change them as soon as possible " +
+		"with 'entry -e <name>' within their groups.")
 }
 
 func (cmd cmpCommand) run(state *State, group, args string, reader *bufio.Reader) {
@@ -604,8 +2043,9 @@ func (cmd cmpCommand) run(state *State, group, args string, reader *bufio.Reader
 			if err != nil {
 				panic(err)
 			}
-			if string(pass) == cmd.mpBox.value {
-				cmd.mpBox.value = createPassword()
+			if cmd.keyBox.value.Matches(string(pass)) {
+				cmd.mpBox.value = createPassword(reader, cmd.meta)
+				cmd.keyBox.value = NewDatabaseKeyWithKDF(cmd.mpBox.value, cmd.keyBox.value.KDF)
 				break
 			} else if attempts == 0 {
 				panic("Too many failed attempts.")
@@ -619,14 +2059,19 @@ func (cmd cmpCommand) run(state *State, group, args string, reader *bufio.Reader
 
 // ============= Entry helper functions ============= //
 
-func createEntry(entry string, state *State, group string, reader *bufio.Reader) {
+func createEntry(entry string, state *State, meta *Meta, group string, reader *bufio.Reader) {
 	if len(entry) > 0 {
-		entries, _ := (*state)[group]
-		if _, exists := findEntryIndex(&entries, entry); exists {
+		entryGroup, name, err := state.resolveNewEntry(group, entry)
+		if err != nil {
+			fmt.Printf("Error: %s.\n", err.Error())
+			return
+		}
+		entries := (*state)[entryGroup]
+		if _, exists := findEntryIndex(&entries, name); exists {
 			println("Error: entry already exists.")
 		} else {
-			newEntry := createOrEditEntry(entry, reader, nil)
-			(*state)[group] = append(entries, newEntry)
+			newEntry := createOrEditEntry(name, reader, nil, meta)
+			(*state)[entryGroup] = append(entries, newEntry)
 		}
 	} else {
 		println("Error: please provide the name of the entry to be created.")
@@ -635,8 +2080,8 @@ func createEntry(entry string, state *State, group string, reader *bufio.Reader)
 
 func renameEntry(entry string, state *State, group string, reader *bufio.Reader) {
 	if len(entry) > 0 {
-		entries, _ := (*state)[group]
-		if index, exists := findEntryIndex(&entries, entry); exists {
+		if entryGroup, index, exists := state.resolveEntry(group, entry); exists {
+			entries := (*state)[entryGroup]
 			for {
 				newName := read(reader, "Please enter the new entry name: ")
 				if len(newName) == 0 {
@@ -656,13 +2101,13 @@ func renameEntry(entry string, state *State, group string, reader *bufio.Reader)
 	}
 }
 
-func editEntry(entry string, state *State, group string, reader *bufio.Reader) {
+func editEntry(entry string, state *State, meta *Meta, group string, reader *bufio.Reader) {
 	if len(entry) > 0 {
-		entries, _ := (*state)[group]
-		if index, exists := findEntryIndex(&entries, entry); exists {
+		if entryGroup, index, exists := state.resolveEntry(group, entry); exists {
+			entries := (*state)[entryGroup]
 			fmt.Printf("Editing entry:\n%s\n", entries[index].String())
 			println("\nHint: to keep the current value for a field, don't enter a new value.\n")
-			entries[index] = createOrEditEntry(entry, reader, &entries[index])
+			entries[index] = createOrEditEntry(entries[index].Name, reader, &entries[index], meta)
 		} else {
 			println("Error: entry does not exist.")
 		}
@@ -675,22 +2120,18 @@ func removeEntry(entryName string, state *State, group string, reader *bufio.Rea
 	if len(entryName) == 0 {
 		println("Error: please provide the name of the entry to remove.")
 	} else {
-		removed := false
-		entries, ok := (*state)[group]
-		if ok {
-			entries, removed = removeEntryFrom(&entries, entryName)
-			if removed {
-				(*state)[group] = entries
-			}
-		}
-		if !removed {
+		entryGroup, index, found := state.resolveEntry(group, entryName)
+		if found {
+			entries := (*state)[entryGroup]
+			(*state)[entryGroup], _ = removeEntryFrom(&entries, entries[index].Name)
+		} else {
 			println("Error: entry does not exist. Are you within the correct group?")
-			println("Hint: To enter a group called <group-name>, type 'group group-name'.")
+			println("Hint: to refer to an entry in another group, type <group>/<entry>, e.g. 'work/github'.")
 		}
 	}
 }
 
-func createOrEditEntry(name string, reader *bufio.Reader, entry *LoginInfo) (result LoginInfo) {
+func createOrEditEntry(name string, reader *bufio.Reader, entry *LoginInfo, meta *Meta) (result LoginInfo) {
 	username := read(reader, "Enter username: ")
 
 	var URL string
@@ -711,7 +2152,7 @@ func createOrEditEntry(name string, reader *bufio.Reader, entry *LoginInfo) (res
 
 	description := read(reader, "Enter description: ")
 
-	var password string
+	var password, generator string
 	doChangePassword := true
 	if entry != nil {
 		doChangePassword = yesNoQuestion("Do you want to change the password? [y/n]: ", reader)
@@ -720,7 +2161,15 @@ func createOrEditEntry(name string, reader *bufio.Reader, entry *LoginInfo) (res
 	if doChangePassword {
 		doGeneratePassword := yesNoQuestion("Generate password? [y/n]: ", reader)
 		if doGeneratePassword {
-			password = generatePassword()
+			currentProfile := defaultProfile
+			if entry != nil && entry.Generator != "" {
+				currentProfile = entry.Generator
+			} else {
+				println("Hint: use the 'passphrase' profile to generate a passphrase which is easy to type by hand.")
+			}
+			profile := readPasswordProfile(reader, meta, currentProfile)
+			password = profile.generate()
+			generator = profile.String()
 			fmt.Printf("Generated password for %s!\n", name)
 			fmt.Printf("Hint: To copy it to the clipboard, type 'cp -p %s'.\n", name)
 		} else {
@@ -735,13 +2184,21 @@ func createOrEditEntry(name string, reader *bufio.Reader, entry *LoginInfo) (res
 				if len(password) < 4 {
 					println("Error: Password too short, please try again!")
 				} else {
+					if strength := estimateStrength(password, name, username, URL); strength.isWeak() {
+						fmt.Printf("Warning: this password is %s.\n", strength.String())
+						println("Hint: consider generating a password instead.")
+					}
 					break
 				}
 			}
 		}
 	}
 
+	now := time.Now()
+
 	if entry != nil {
+		// keep the fields that are not edited here, such as tags
+		result = *entry
 		if username == "" {
 			username = entry.Username
 		}
@@ -756,12 +2213,19 @@ func createOrEditEntry(name string, reader *bufio.Reader, entry *LoginInfo) (res
 		}
 	}
 
+	if entry == nil || password != entry.Password {
+		result.PasswordUpdatedAt = now
+	}
+	if generator != "" {
+		result.Generator = generator
+	}
+
 	result.Name = name
 	result.Username = username
 	result.URL = URL
 	result.Password = password
 	result.Description = description
-	result.UpdatedAt = time.Now()
+	result.UpdatedAt = now
 
 	return
 }
@@ -782,14 +2246,76 @@ func removeEntryFrom(entries *[]LoginInfo, name string) ([]LoginInfo, bool) {
 	return *entries, false
 }
 
+func listTaggedEntries(tags []string, state *State) {
+	if len(tags) == 0 {
+		println("Error: please provide at least one tag.")
+		return
+	}
+	groups := make([]string, 0, len(*state))
+	for group := range *state {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	matches := 0
+	for _, group := range groups {
+		for _, e := range (*state)[group] {
+			if e.hasAllTags(tags) {
+				if matches == 0 {
+					fmt.Printf("Entries tagged with %s:\n\n", strings.Join(tags, ", "))
+				}
+				fmt.Printf("[%s]\n%s\n", group, e.String())
+				matches++
+			}
+		}
+	}
+	if matches == 0 {
+		fmt.Printf("No entries are tagged with %s.\n", strings.Join(tags, ", "))
+		println("Hint: to tag an entry, type 'tag -a <name> <tag>'.")
+	}
+}
+
+// ============= Tag helper functions ============= //
+
+func listTags(state *State) {
+	tags := state.allTags()
+	if len(tags) == 0 {
+		println("There are no tags yet.")
+		println("Hint: to tag an entry, type 'tag -a <name> <tag>'.")
+		return
+	}
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	for _, tag := range names {
+		count := tags[tag]
+		if count == 1 {
+			fmt.Printf("  %-16s (1 entry)\n", tag)
+		} else {
+			fmt.Printf("  %-16s (%d entries)\n", tag, count)
+		}
+	}
+	println("\nHint: Type 'entry -t <tag>' to list all entries with a tag.")
+}
+
+func tagsDescription(tags []string) string {
+	if len(tags) == 0 {
+		return "(none)"
+	}
+	return strings.Join(tags, ", ")
+}
+
 // ============= Group helper functions ============= //
 
 func createGroup(name string, state *State, group string, reader *bufio.Reader) string {
 	if len(name) > 0 {
-		_, ok := (*state)[name]
+		path := resolveGroupPath(group, name)
+		_, ok := (*state)[path]
 		if !ok {
-			(*state)[name] = []LoginInfo{}
-			return name
+			state.ensureGroup(path)
+			return path
 		}
 		println("Error: group already exists.")
 	} else {
@@ -798,17 +2324,27 @@ func createGroup(name string, state *State, group string, reader *bufio.Reader)
 	return group
 }
 
-func renameGroup(name string, state *State, group string, reader *bufio.Reader) string {
+func renameGroup(name string, state *State, meta *Meta, group string, reader *bufio.Reader) string {
 	if len(name) > 0 {
-		entries, ok := (*state)[name]
+		path := resolveGroupPath(group, name)
+		entries, ok := (*state)[path]
 		if ok {
-			var newGroupName string
+			var newPath string
 			for {
-				newGroupName = read(reader, "Enter a new name for the group: ")
+				newGroupName := read(reader, "Enter a new name for the group: ")
 				if len(newGroupName) > 0 {
-					_, exists := (*state)[newGroupName]
+					if strings.Contains(newGroupName, groupSeparator) {
+						// a path moves the group (relative to the current group, like the other commands)
+						newPath = resolveGroupPath(group, newGroupName)
+					} else {
+						// a simple name renames the group within its parent group
+						newPath = resolveGroupPath(parentGroup(path), newGroupName)
+					}
+					_, exists := (*state)[newPath]
 					if exists {
 						println("Error: name already taken.")
+					} else if path != rootGroup && isSubgroupOf(newPath, path) {
+						println("Error: cannot move a group into itself.")
 					} else {
 						break
 					}
@@ -816,14 +2352,25 @@ func renameGroup(name string, state *State, group string, reader *bufio.Reader)
 					println("Error: no name provided.")
 				}
 			}
-			if name == "default" {
-				(*state)["default"] = []LoginInfo{}
+			if path == rootGroup {
+				// the default group always exists, so only its entries are moved, not its subgroups
+				(*state)[rootGroup] = []LoginInfo{}
+				state.ensureGroup(newPath)
+				(*state)[newPath] = entries
+				if group == rootGroup {
+					return newPath
+				}
 			} else {
-				delete(*state, name)
-			}
-			(*state)[newGroupName] = entries
-			if name == group {
-				return newGroupName
+				// move the whole subtree
+				for _, subgroup := range state.subgroups(path) {
+					(*state)[newPath+subgroup[len(path):]] = (*state)[subgroup]
+					delete(*state, subgroup)
+				}
+				meta.moveGroup(path, newPath)
+				state.ensureGroup(newPath)
+				if isSubgroupOf(group, path) {
+					return newPath + group[len(path):]
+				}
 			}
 		} else {
 			println("Error: Group does not exist.")
@@ -834,36 +2381,51 @@ func renameGroup(name string, state *State, group string, reader *bufio.Reader)
 	return group
 }
 
-func removeGroup(groupName string, state *State, group string, reader *bufio.Reader) string {
+func removeGroup(groupName string, state *State, meta *Meta, group string, reader *bufio.Reader) string {
 	if len(groupName) == 0 {
 		println("Error: please provide the name of the group to remove.")
 	} else {
-		entries, ok := (*state)[groupName]
-		entriesLen := len(entries)
+		path := resolveGroupPath(group, groupName)
+		entries, ok := (*state)[path]
 		if ok {
-			goAhead := entriesLen == 0 // if there are no entries, don't bother asking for confirmation
-			if groupName == "default" {
+			if path == rootGroup {
+				entriesLen := len(entries)
+				goAhead := entriesLen == 0 // if there are no entries, don't bother asking for confirmation
 				if !goAhead {
 					goAhead = yesNoQuestion(fmt.Sprintf("Are you sure you want to remove all (%d) entries of the default group? [y/n]: ",
 						entriesLen), reader)
 					if goAhead {
-						(*state)[groupName] = []LoginInfo{}
+						(*state)[path] = []LoginInfo{}
 					}
 				} else {
 					println("Warning: cannot delete the default group and there are no entries to remove.")
 				}
 			} else {
+				subgroups := state.subgroups(path)
+				entriesLen := 0
+				for _, subgroup := range subgroups {
+					entriesLen += len((*state)[subgroup])
+				}
+				goAhead := entriesLen == 0 // if there are no entries, don't bother asking for confirmation
 				if !goAhead {
-					goAhead = yesNoQuestion(fmt.Sprintf("Are you sure you want to remove group '%s' and all of its (%d) entries? [y/n]: ",
-						groupName, entriesLen), reader)
+					if len(subgroups) > 1 {
+						goAhead = yesNoQuestion(fmt.Sprintf("Are you sure you want to remove group '%s', its %d subgroups and all of their (%d) entries? [y/n]: ",
+							path, len(subgroups)-1, entriesLen), reader)
+					} else {
+						goAhead = yesNoQuestion(fmt.Sprintf("Are you sure you want to remove group '%s' and all of its (%d) entries? [y/n]: ",
+							path, entriesLen), reader)
+					}
 					if !goAhead {
 						println("Aborted!")
 					}
 				}
 				if goAhead {
-					delete(*state, groupName)
-					if group == groupName {
-						return "default" // exit the deleted group
+					for _, subgroup := range subgroups {
+						delete(*state, subgroup)
+					}
+					meta.removeGroup(path)
+					if isSubgroupOf(group, path) {
+						return parentGroup(path) // exit the deleted group
 					}
 				}
 			}
@@ -919,27 +2481,25 @@ func open(url string) error {
 
 // ============= Other helper functions ============= //
 
-func generatePassword() (password string) {
-	charRange := encryption.DefaultPasswordCharRange()
-
-	containsChars := func(p string, min rune, max rune) bool {
-		for _, c := range p {
-			if min <= c && c <= max {
-				return true
-			}
-		}
-		return false
-	}
-
+// readPasswordProfile asks the user for the profile to generate a password with.
+func readPasswordProfile(reader *bufio.Reader, meta *Meta, currentProfile string) passwordProfile {
 	for {
-		password = encryption.GeneratePassword(16, charRange)
-		if containsChars(password, '0', '9') &&
-			containsChars(password, 'A', 'Z') &&
-			containsChars(password, 'a', 'z') {
-			break
+		spec := read(reader, fmt.Sprintf("Password profile (hit Enter to use '%s'): ", currentProfile))
+		if len(spec) == 0 {
+			spec = currentProfile
+		}
+		profile, err := parseProfile(spec, meta.Profiles)
+		if err == nil {
+			return profile
 		}
+		fmt.Printf("Error: %s\n", err.Error())
+		printProfilesHint(meta)
 	}
-	return
+}
+
+func printProfilesHint(meta *Meta) {
+	fmt.Printf("Hint: the available profiles are: %s. Type 'help gen' for details.\n",
+		strings.Join(profileNames(meta.Profiles), ", "))
 }
 
 func read(reader *bufio.Reader, prompt string) string {
@@ -963,11 +2523,3 @@ func yesNoQuestion(question string, reader *bufio.Reader) bool {
 		}
 	}
 }
-
-func removeFromClipboardAfterDelay(content string) {
-	time.Sleep(60 * time.Second)
-	c, err := clipboard.ReadAll()
-	if err == nil && c == content {
-		clipboard.WriteAll("")
-	}
-}
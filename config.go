@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// configEnvVar environment variable with the path of the configuration file.
+const configEnvVar = "GO_HASH_CONFIG"
+
+// defaultLockTimeout how long an interactive session may be idle before it is locked, by default.
+const defaultLockTimeout = 10 * time.Minute
+
+// Config user settings, read from the configuration file.
+type Config struct {
+	// LockTimeout how long an interactive session may be idle before it is locked. Zero disables locking.
+	LockTimeout time.Duration
+	// Clipboard the clipboard backend, one of clipboardBackendNames.
+	Clipboard string
+	// ClipboardSelection the selection used by X11 and Wayland backends: clipboard or primary.
+	ClipboardSelection string
+	// ClipboardFile the file written to by the file clipboard backend.
+	ClipboardFile string
+	// ClipboardTimeout how long copied content is kept in the clipboard. Zero keeps it until go-hash exits.
+	ClipboardTimeout time.Duration
+	// ClipboardSensitive whether copied content is marked as sensitive, so clipboard managers do not keep it.
+	ClipboardSensitive bool
+	// ClipboardSensitiveSet whether clipboard-sensitive was set in the configuration file.
+	ClipboardSensitiveSet bool
+}
+
+// defaultConfig returns the settings used when there is no configuration file.
+func defaultConfig() Config {
+	return Config{
+		LockTimeout:        defaultLockTimeout,
+		Clipboard:          "auto",
+		ClipboardSelection: "clipboard",
+		ClipboardTimeout:   defaultClipboardTimeout,
+		ClipboardSensitive: true,
+	}
+}
+
+// configFilePath returns the path of the configuration file.
+func configFilePath() string {
+	if path := os.Getenv(configEnvVar); len(path) > 0 {
+		return path
+	}
+	path, err := homedir.Expand("~/.go-hash.conf")
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+// loadConfig reads the configuration file at the given path. If the file does not exist, the default
+// configuration is returned.
+//
+// The file contains one 'key = value' setting per line. Empty lines and lines starting with '#' are ignored.
+func loadConfig(path string) (Config, error) {
+	config := defaultConfig()
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return config, fmt.Errorf("%s:%d: expected 'key = value'", path, lineNumber)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if err = config.set(key, value); err != nil {
+			return config, fmt.Errorf("%s:%d: %s", path, lineNumber, err.Error())
+		}
+	}
+	return config, scanner.Err()
+}
+
+// set sets the setting with the given key.
+func (config *Config) set(key, value string) error {
+	switch key {
+	case "lock-timeout":
+		timeout, err := parseTimeout(key, value)
+		if err != nil {
+			return err
+		}
+		config.LockTimeout = timeout
+	case "clipboard-timeout":
+		timeout, err := parseTimeout(key, value)
+		if err != nil {
+			return err
+		}
+		config.ClipboardTimeout = timeout
+	case "clipboard-sensitive":
+		switch value {
+		case "on", "yes", "true":
+			config.ClipboardSensitive = true
+		case "off", "no", "false":
+			config.ClipboardSensitive = false
+		default:
+			return errors.New("invalid clipboard-sensitive, expected on or off: " + value)
+		}
+		config.ClipboardSensitiveSet = true
+	case "clipboard":
+		for _, name := range clipboardBackendNames {
+			if value == name {
+				config.Clipboard = value
+				return nil
+			}
+		}
+		return errors.New("invalid clipboard, expected one of " + strings.Join(clipboardBackendNames, ", ") + ": " + value)
+	case "clipboard-selection":
+		if value != "clipboard" && value != "primary" {
+			return errors.New("invalid clipboard-selection, expected clipboard or primary: " + value)
+		}
+		config.ClipboardSelection = value
+	case "clipboard-file":
+		path, err := homedir.Expand(value)
+		if err != nil {
+			return err
+		}
+		config.ClipboardFile = path
+	default:
+		return errors.New("unknown setting: " + key)
+	}
+	return nil
+}
+
+// parseTimeout parses the value of a timeout setting: a duration, or 'off' (or 0) for no timeout.
+func parseTimeout(key, value string) (time.Duration, error) {
+	if value == "off" || value == "0" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, errors.New("invalid " + key + ", expected a duration such as 5m or 1h, or off: " + value)
+	}
+	return timeout, nil
+}
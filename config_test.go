@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "go-hash-conf")
+	require.NoError(t, err)
+	_, err = file.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	return file.Name()
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := loadConfig("/does/not/exist")
+	require.NoError(t, err)
+	require.Equal(t, defaultConfig(), config)
+
+	path := writeConfig(t, "# go-hash settings\n\n  lock-timeout = 30m  \n")
+	defer os.Remove(path)
+	config, err = loadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Minute, config.LockTimeout)
+
+	off := writeConfig(t, "lock-timeout=off\n")
+	defer os.Remove(off)
+	config, err = loadConfig(off)
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), config.LockTimeout)
+
+	clip := writeConfig(t, "clipboard-timeout = 15s\nclipboard-sensitive = off\n")
+	defer os.Remove(clip)
+	config, err = loadConfig(clip)
+	require.NoError(t, err)
+	require.Equal(t, 15*time.Second, config.ClipboardTimeout)
+	require.False(t, config.ClipboardSensitive)
+	require.True(t, config.ClipboardSensitiveSet)
+	require.False(t, defaultConfig().ClipboardSensitiveSet)
+}
+
+func TestLoadInvalidConfig(t *testing.T) {
+	for _, content := range []string{"lock-timeout", "lock-timeout = soon", "lock-timeout = -1m", "unknown = 1",
+		"clipboard-timeout = later", "clipboard-sensitive = maybe"} {
+		path := writeConfig(t, content)
+		_, err := loadConfig(path)
+		os.Remove(path)
+		require.Error(t, err, "config: %s", content)
+	}
+}
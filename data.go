@@ -6,30 +6,129 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 )
 
 // LoginInfo single entry containing login information for a particular website.
 type LoginInfo struct {
-	Name        string
-	URL         string
-	Username    string
-	Password    string
-	Description string
-	UpdatedAt   time.Time
+	Name              string
+	URL               string
+	Username          string
+	Password          string
+	Description       string
+	UpdatedAt         time.Time
+	Tags              []string
+	Expiry            Expiry
+	PasswordUpdatedAt time.Time
+	Generator         string
 }
 
 // State the actual login information persisted by the database.
 type State map[string][]LoginInfo
 
+// GroupSettings settings that apply to all entries within a group (and its subgroups).
+type GroupSettings struct {
+	Expiry Expiry
+}
+
+// Meta information persisted by the database alongside the State.
+type Meta struct {
+	// Groups settings of groups, by full group path.
+	Groups map[string]GroupSettings
+	// Profiles custom password profiles, by name.
+	Profiles map[string]string
+	// Clients clients of the HTTP API paired with the database, by name.
+	Clients map[string]APIClient
+}
+
+// APIClient a client of the HTTP API, which authenticates with the token it was given when it was paired.
+type APIClient struct {
+	// TokenHash the SHA-256 hash of the client's token.
+	TokenHash []byte
+	// ReadOnly whether the client is denied changing entries.
+	ReadOnly bool
+	// Groups the groups, with their subgroups, the client can access. Empty for all groups.
+	Groups  []string
+	Created time.Time
+}
+
 // String human-readable representation of LoginInfo.
 func (info *LoginInfo) String() string {
-	return fmt.Sprintf("  %s:\n    %-16s %s\n    %-16s %s\n    %-16s %s\n    %-16s %s", info.Name,
+	return fmt.Sprintf("  %s:\n    %-16s %s\n    %-16s %s\n    %-16s %s\n    %-16s %s\n    %-16s %s\n    %-16s %s", info.Name,
 		"username:", info.Username,
 		"URL:", info.URL,
 		"updatedAt:", info.UpdatedAt.Format("2006-01-02 15:04:05"),
-		"description:", info.Description)
+		"description:", info.Description,
+		"tags:", strings.Join(info.Tags, ", "),
+		"expiry:", info.Expiry.String())
+}
+
+// passwordUpdatedAt returns the last time the password of this entry was changed.
+// Entries created before this was tracked fall back on the last time the entry was modified.
+func (info *LoginInfo) passwordUpdatedAt() time.Time {
+	if info.PasswordUpdatedAt.IsZero() {
+		return info.UpdatedAt
+	}
+	return info.PasswordUpdatedAt
+}
+
+// hasTag returns true if the entry has the given tag. Tags are case-insensitive.
+func (info *LoginInfo) hasTag(tag string) bool {
+	for _, t := range info.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAllTags returns true if the entry has all of the given tags.
+func (info *LoginInfo) hasAllTags(tags []string) bool {
+	for _, t := range tags {
+		if !info.hasTag(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// addTags adds the given tags to the entry, ignoring the ones it already has.
+// Returns the number of tags actually added.
+func (info *LoginInfo) addTags(tags []string) (added int) {
+	for _, t := range tags {
+		if len(t) > 0 && !info.hasTag(t) {
+			info.Tags = append(info.Tags, t)
+			added++
+		}
+	}
+	return
+}
+
+// removeTags removes the given tags from the entry.
+// Returns the number of tags actually removed.
+func (info *LoginInfo) removeTags(tags []string) (removed int) {
+	kept := info.Tags[:0]
+	for _, t := range info.Tags {
+		remove := false
+		for _, r := range tags {
+			if strings.EqualFold(t, r) {
+				remove = true
+				break
+			}
+		}
+		if remove {
+			removed++
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	info.Tags = kept
+	return
 }
 
 func (info *LoginInfo) bytes() []byte {
@@ -83,26 +182,65 @@ func decodeLoginInfo(info []byte) (LoginInfo, error) {
 	return result, nil
 }
 
-// Encode the state into Go's serialization format.
-func (data *State) bytes() ([]byte, error) {
+// allTags returns all tags used in the State, mapped to the number of entries using each of them.
+// As tags are case-insensitive, each tag is reported with one of the spellings used in the State.
+func (data *State) allTags() map[string]int {
+	result := make(map[string]int)
+	spelling := make(map[string]string)
+	for _, entries := range *data {
+		for _, e := range entries {
+			for _, t := range e.Tags {
+				key := strings.ToLower(t)
+				if _, seen := spelling[key]; !seen {
+					spelling[key] = t
+				}
+				result[spelling[key]]++
+			}
+		}
+	}
+	return result
+}
+
+// copy returns a copy of the State, which can be modified without affecting this State.
+func (data *State) copy() State {
+	result := make(State, len(*data))
+	for group, entries := range *data {
+		result[group] = append([]LoginInfo{}, entries...)
+	}
+	return result
+}
+
+// Encode the state and meta information into Go's serialization format.
+// The meta information is encoded after the state so that older versions of go-hash can still read the state.
+func (data *State) bytes(meta *Meta) ([]byte, error) {
 	stateBuffer := bytes.Buffer{}
 	gobEncoder := gob.NewEncoder(&stateBuffer)
 	err := gobEncoder.Encode(data)
 	if err != nil {
 		return nil, err
 	}
+	err = gobEncoder.Encode(meta)
+	if err != nil {
+		return nil, err
+	}
 	return stateBuffer.Bytes(), nil
 }
 
-// Decode the state from the given bytes.
-func decodeState(stateBytes []byte) (State, error) {
+// Decode the state and meta information from the given bytes.
+// Databases written by older versions of go-hash do not contain meta information, in which case it is left empty.
+func decodeState(stateBytes []byte) (State, Meta, error) {
 	var data State
+	var meta Meta
 	stateBuffer := bytes.Buffer{}
 	stateBuffer.Write(stateBytes)
 	gobDecoder := gob.NewDecoder(&stateBuffer)
 	err := gobDecoder.Decode(&data)
 	if err != nil {
-		return nil, err
+		return nil, meta, err
+	}
+	err = gobDecoder.Decode(&meta)
+	if err != nil && err != io.EOF {
+		return nil, meta, err
 	}
-	return data, nil
+	return data, meta, nil
 }
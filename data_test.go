@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryTags(t *testing.T) {
+	entry := LoginInfo{Name: "aws"}
+	require.False(t, entry.hasTag("prod"))
+
+	added := entry.addTags([]string{"prod", "Cloud", "PROD", ""})
+	require.Equal(t, 2, added)
+	require.Equal(t, []string{"prod", "Cloud"}, entry.Tags)
+	require.True(t, entry.hasTag("cloud"))
+	require.True(t, entry.hasAllTags([]string{"Prod", "cloud"}))
+	require.False(t, entry.hasAllTags([]string{"prod", "work"}))
+
+	removed := entry.removeTags([]string{"CLOUD", "work"})
+	require.Equal(t, 1, removed)
+	require.Equal(t, []string{"prod"}, entry.Tags)
+
+	removed = entry.removeTags([]string{"prod"})
+	require.Equal(t, 1, removed)
+	require.Nil(t, entry.Tags)
+}
+
+func TestAllTags(t *testing.T) {
+	state := State{
+		"default": []LoginInfo{
+			{Name: "google", Tags: []string{"mail"}},
+		},
+		"Work": []LoginInfo{
+			{Name: "aws", Tags: []string{"prod", "cloud"}},
+			{Name: "gcp", Tags: []string{"prod"}},
+		},
+	}
+	require.Equal(t, map[string]int{"mail": 1, "prod": 2, "cloud": 1}, state.allTags())
+}
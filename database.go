@@ -1,7 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
 	"errors"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 
@@ -9,7 +15,14 @@ import (
 )
 
 // DBVersion is the current version of the go-hash database format.
-const DBVersion = "GH00"
+const DBVersion = "GH01"
+
+// legacyDBVersion the first version of the database format, which did not store the parameters of the KDF.
+// Databases in this format can still be read, and are converted to the current format when written.
+const legacyDBVersion = "GH00"
+
+// kdfLength the length of the parameters of the KDF in the header: time (4 bytes) | memory (4 bytes) | threads
+const kdfLength = 4 + 4 + 1
 
 // MinDBLength      V | S  | B1 | B2 | B3 | B4 | MAC| E
 const MinDBLength = 4 + 32 + 32 + 32 + 32 + 32 + 32 + 4
@@ -17,23 +30,150 @@ const MinDBLength = 4 + 32 + 32 + 32 + 32 + 32 + 32 + 4
 // MaxDBLength the maximum allowed size of a database
 const MaxDBLength = 64 * 1000 * 1024
 
-// WriteDatabase writes the encrypted database to the given filePath with the provided state and key.
-func WriteDatabase(filePath, password string, data *State) error {
+// DatabaseKey the hash of the master password (P) together with the salt and the KDF parameters used to calculate it.
+//
+// Holding on to the key, rather than to the master password, allows the database to be read and written
+// without running Argon2 again, as long as the salt does not change.
+type DatabaseKey struct {
+	Salt []byte
+	P    []byte
+	KDF  encryption.KDFParams
+}
+
+// NewDatabaseKey derives a key from the given password, using a new random salt and the default KDF parameters.
+func NewDatabaseKey(password string) DatabaseKey {
+	return NewDatabaseKeyWithKDF(password, encryption.DefaultKDFParams())
+}
+
+// NewDatabaseKeyWithKDF derives a key from the given password, using a new random salt and the given KDF parameters.
+func NewDatabaseKeyWithKDF(password string, kdf encryption.KDFParams) DatabaseKey {
+	salt := encryption.GenerateSalt()
+	return DatabaseKey{Salt: salt, P: kdf.Hash(password, salt), KDF: kdf}
+}
+
+// DeriveDatabaseKey derives the key of the database at filePath from the given password, using the database's salt
+// and KDF parameters.
+func DeriveDatabaseKey(filePath, password string) (DatabaseKey, error) {
+	header, err := readDatabaseHeader(filePath)
+	if err != nil {
+		return DatabaseKey{}, err
+	}
+	return DatabaseKey{Salt: header.salt, P: header.kdf.Hash(password, header.salt), KDF: header.kdf}, nil
+}
+
+// databaseHeader the unencrypted fields at the start of a database file, before B1.
+type databaseHeader struct {
+	version string
+	salt    []byte
+	kdf     encryption.KDFParams
+	// authenticated the fields covered by the HMAC, along with the database entries
+	authenticated []byte
+	// length the length of the header, in bytes
+	length int64
+}
+
+// parseDatabaseHeader parses the header at the start of the content of a database file.
+func parseDatabaseHeader(content []byte) (databaseHeader, error) {
+	var header databaseHeader
+	if len(content) < 4 {
+		return header, errors.New("corrupt database")
+	}
+	header.version = string(content[:4])
+	header.length = 4 + int64(encryption.SALTLEN)
+	switch header.version {
+	case legacyDBVersion:
+		header.kdf = encryption.DefaultKDFParams()
+	case DBVersion:
+		header.length += kdfLength
+	default:
+		return header, errors.New("unsupported database version")
+	}
+	if int64(len(content)) < header.length {
+		return header, errors.New("corrupt database")
+	}
+	header.salt = content[4 : 4+encryption.SALTLEN]
+	header.authenticated = content[4:header.length]
+	if header.version == DBVersion {
+		kdf := content[4+encryption.SALTLEN : header.length]
+		header.kdf = encryption.KDFParams{
+			Time:    binary.LittleEndian.Uint32(kdf[0:4]),
+			Memory:  binary.LittleEndian.Uint32(kdf[4:8]),
+			Threads: kdf[8],
+		}
+		if !validKDF(header.kdf) {
+			return header, errors.New("corrupt database")
+		}
+	}
+	return header, nil
+}
+
+// readDatabaseHeader reads the header of the database at filePath.
+func readDatabaseHeader(filePath string) (databaseHeader, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return databaseHeader{}, err
+	}
+	defer file.Close()
+
+	content := make([]byte, 4+encryption.SALTLEN+kdfLength)
+	n, err := io.ReadFull(file, content)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return databaseHeader{}, errors.New("corrupt database")
+	}
+	return parseDatabaseHeader(content[:n])
+}
+
+// kdfBytes encodes the parameters of the KDF as stored in the header.
+func kdfBytes(kdf encryption.KDFParams) []byte {
+	b := make([]byte, kdfLength)
+	binary.LittleEndian.PutUint32(b[0:4], kdf.Time)
+	binary.LittleEndian.PutUint32(b[4:8], kdf.Memory)
+	b[8] = kdf.Threads
+	return b
+}
+
+// Matches returns true if the given password derives this key.
+func (key DatabaseKey) Matches(password string) bool {
+	if len(key.Salt) == 0 || key.KDF.Time == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key.P, key.KDF.Hash(password, key.Salt)) == 1
+}
+
+// IsZero returns true if the key has not been set.
+func (key DatabaseKey) IsZero() bool {
+	return len(key.P) == 0
+}
+
+// Wipe overwrites the key in memory.
+func (key DatabaseKey) Wipe() {
+	for i := range key.P {
+		key.P[i] = 0
+	}
+}
+
+// WriteDatabase writes the encrypted database to the given filePath with the provided state, meta information and key.
+func WriteDatabase(filePath, password string, data *State, meta *Meta) error {
+	return WriteDatabaseWithKey(filePath, NewDatabaseKey(password), data, meta)
+}
+
+// WriteDatabaseWithKey writes the encrypted database to the given filePath, using a key derived from the
+// master password.
+func WriteDatabaseWithKey(filePath string, key DatabaseKey, data *State, meta *Meta) error {
 	file, err := os.Create(filePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	stateBytes, err := data.bytes()
+	stateBytes, err := data.bytes(meta)
 	if err != nil {
 		return err
 	}
 
-	salt := encryption.GenerateSalt()
+	salt := key.Salt
 	log.Printf("Writing salt: %x", salt)
-	P := encryption.PasswordHash(password, salt)
-	log.Printf("Calculated P: %x", P)
+	P := key.P
 
 	K := encryption.GenerateRandomBytes(32)
 	L := encryption.GenerateRandomBytes(32)
@@ -70,13 +210,14 @@ func WriteDatabase(filePath, password string, data *State) error {
 		return errors.New("database too big! Cannot save it to avoid file bomb attacks. Please remove entries you don't need")
 	}
 
-	mac := encryption.Hmac(L, append(salt, stateBytes...))
+	kdf := kdfBytes(key.KDF)
+	mac := encryption.Hmac(L, append(append(append([]byte{}, salt...), kdf...), stateBytes...))
 	log.Printf("Generated HMAC with length %d", len(mac))
 
 	fileOffset := 0
 
-	// version | salt | B1 | B2 | B3 | B4 | HMAC | E
-	for _, b := range [][]byte{[]byte(DBVersion), salt, B1, B2, B3, B4, mac, encryptedState} {
+	// version | salt | KDF | B1 | B2 | B3 | B4 | HMAC | E
+	for _, b := range [][]byte{[]byte(DBVersion), salt, kdf, B1, B2, B3, B4, mac, encryptedState} {
 		_, err = file.WriteAt(b, int64(fileOffset))
 		if err != nil {
 			return err
@@ -87,12 +228,21 @@ func WriteDatabase(filePath, password string, data *State) error {
 }
 
 // ReadDatabase reads the encrypted database from the filePath, using the given password for decryption.
-func ReadDatabase(filePath string, password string) (State, error) {
+func ReadDatabase(filePath string, password string) (State, Meta, error) {
+	key, err := DeriveDatabaseKey(filePath, password)
+	if err != nil {
+		return nil, Meta{}, err
+	}
+	return ReadDatabaseWithKey(filePath, key)
+}
+
+// ReadDatabaseWithKey reads the encrypted database from the filePath, using a key derived from the master password.
+func ReadDatabaseWithKey(filePath string, key DatabaseKey) (State, Meta, error) {
 	dbError := "Corrupt database"
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, err
+		return nil, Meta{}, err
 	}
 	defer file.Close()
 
@@ -106,30 +256,19 @@ func ReadDatabase(filePath string, password string) (State, error) {
 		panic(dbError)
 	}
 
-	var fileOffset int64
-
-	version := make([]byte, 4, 4)
-	_, err = file.ReadAt(version, fileOffset)
+	log.Println("Reading header")
+	header, err := readDatabaseHeader(filePath)
 	if err != nil {
 		panic(err)
 	}
-	fileOffset += 4
+	fileOffset := header.length
+	log.Println("Header read successfully.")
 
-	if string(version) != DBVersion {
-		panic("Unsupported database version")
-	}
-
-	log.Println("Reading salt")
-	salt := make([]byte, 32, 32)
-	_, err = file.ReadAt(salt, fileOffset)
-	if err != nil {
-		panic(err)
+	if !bytes.Equal(header.salt, key.Salt) || header.kdf != key.KDF {
+		return nil, Meta{}, errors.New("the key does not belong to this database")
 	}
-	fileOffset += 32
-	log.Println("Salt read successfully, calculating P.")
-
-	P := encryption.PasswordHash(password, salt)
-	log.Printf("Calculated P, reading Bs. P = %x", P)
+	P := key.P
+	log.Printf("Reading Bs. P = %x", P)
 
 	B1 := make([]byte, 32, 32)
 	_, err = file.ReadAt(B1, fileOffset)
@@ -220,14 +359,24 @@ func ReadDatabase(filePath string, password string) (State, error) {
 		panic(dbError)
 	}
 
-	expectedMac := encryption.Hmac(L, append(salt, stateBytes...))
+	expectedMac := encryption.Hmac(L, append(append([]byte{}, header.authenticated...), stateBytes...))
 
 	log.Printf("Verifying HMAC")
 	if ok := encryption.VerifyHmac(expectedMac, mac); !ok {
-		return nil, errors.New("incorrect password or corrupt database")
+		return nil, Meta{}, errors.New("incorrect password or corrupt database")
 	}
 	log.Printf("Database read successfully")
 
 	// decryption and validation completed successfully!
 	return decodeState(stateBytes)
 }
+
+// databaseFileHash returns the SHA-256 hash of the database file. It changes every time the database is
+// written, as its content is encrypted with a new random key, so it tells whether another process wrote it.
+func databaseFileHash(filePath string) ([sha256.Size]byte, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(content), nil
+}
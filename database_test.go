@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/renatoathaydes/go-hash/encryption"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,11 +33,11 @@ func largeDB() State {
 		},
 		"Personal": []LoginInfo{
 			{Name: "github", URL: "github.com", Password: "easy password"},
-			{Name: "facebook", Password: "other password", UpdatedAt: knownTime},
+			{Name: "facebook", Password: "other password", UpdatedAt: knownTime, Expiry: Expiry{At: knownTime}},
 			{Name: "google", URL: "google.com", Password: "new password", UpdatedAt: knownTime, Description: "very nice one"},
 		},
 		"Work": []LoginInfo{
-			{Name: "amazon", Password: "difficult password"},
+			{Name: "amazon", Password: "difficult password", Tags: []string{"shopping", "prod"}},
 			{Name: "VPN", Password: "super difficult password"},
 		},
 	}
@@ -50,10 +54,189 @@ func TestCreateAndReadDBs(t *testing.T) {
 		t.Logf("Testing example: %s", example)
 		tmpDbPath := os.TempDir() + "/" + example.name
 		userPass := "very safe password"
-		err := WriteDatabase(tmpDbPath, userPass, &example.db)
+		err := WriteDatabase(tmpDbPath, userPass, &example.db, &Meta{})
 		require.NoError(t, err, "Error writing database %s", example.name)
-		persistedState, err := ReadDatabase(tmpDbPath, userPass)
+		persistedState, _, err := ReadDatabase(tmpDbPath, userPass)
 		require.NoError(t, err, "Error reading database: %s", example.name)
 		require.Equal(t, example.db, persistedState, "The restored State (%s) is not as expected", example.name)
 	}
 }
+
+func TestCreateAndReadDBWithMeta(t *testing.T) {
+	tmpDbPath := os.TempDir() + "/MetaDB"
+	userPass := "very safe password"
+	db := largeDB()
+	meta := Meta{Groups: map[string]GroupSettings{
+		"Work": {Expiry: Expiry{MaxAgeDays: 90}},
+	}}
+	err := WriteDatabase(tmpDbPath, userPass, &db, &meta)
+	require.NoError(t, err, "Error writing database")
+	persistedState, persistedMeta, err := ReadDatabase(tmpDbPath, userPass)
+	require.NoError(t, err, "Error reading database")
+	require.Equal(t, db, persistedState, "The restored State is not as expected")
+	require.Equal(t, meta, persistedMeta, "The restored Meta is not as expected")
+}
+
+func TestReadStateWithoutMeta(t *testing.T) {
+	// databases written by older versions of go-hash only contain the State
+	db := largeDB()
+	stateBuffer := bytes.Buffer{}
+	require.NoError(t, gob.NewEncoder(&stateBuffer).Encode(&db))
+
+	state, meta, err := decodeState(stateBuffer.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, db, state)
+	require.Equal(t, Meta{}, meta)
+}
+
+func TestDatabaseKey(t *testing.T) {
+	file, err := ioutil.TempFile("", "go-hash-key")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	key := NewDatabaseKey("password")
+	require.True(t, key.Matches("password"))
+	require.False(t, key.Matches("other"))
+
+	state := State{"default": []LoginInfo{{Name: "google"}}}
+	require.NoError(t, WriteDatabaseWithKey(file.Name(), key, &state, &Meta{}))
+
+	derived, err := DeriveDatabaseKey(file.Name(), "password")
+	require.NoError(t, err)
+	require.Equal(t, key, derived)
+
+	read, _, err := ReadDatabaseWithKey(file.Name(), key)
+	require.NoError(t, err)
+	require.Equal(t, state, read)
+
+	_, _, err = ReadDatabaseWithKey(file.Name(), NewDatabaseKey("password"))
+	require.Error(t, err, "a key with a different salt should not be accepted")
+}
+
+func TestDatabaseKDF(t *testing.T) {
+	file, err := ioutil.TempFile("", "go-hash-kdf")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	kdf := encryption.KDFParams{Time: 2, Memory: 1024, Threads: 1}
+	key := NewDatabaseKeyWithKDF("password", kdf)
+	require.Equal(t, kdf, key.KDF)
+	require.True(t, key.Matches("password"))
+
+	state := State{"default": []LoginInfo{{Name: "google"}}}
+	require.NoError(t, WriteDatabaseWithKey(file.Name(), key, &state, &Meta{}))
+
+	header, err := readDatabaseHeader(file.Name())
+	require.NoError(t, err)
+	require.Equal(t, DBVersion, header.version)
+	require.Equal(t, kdf, header.kdf)
+
+	read, _, err := ReadDatabase(file.Name(), "password")
+	require.NoError(t, err)
+	require.Equal(t, state, read)
+
+	other := key
+	other.KDF.Time = 3
+	_, _, err = ReadDatabaseWithKey(file.Name(), other)
+	require.Error(t, err, "a key with different KDF parameters should not be accepted")
+
+	// the parameters are authenticated
+	content, err := ioutil.ReadFile(file.Name())
+	require.NoError(t, err)
+	content[4+32+8] = 2
+	require.NoError(t, ioutil.WriteFile(file.Name(), content, 0600))
+	_, _, err = ReadDatabaseWithKey(file.Name(), DatabaseKey{Salt: key.Salt, P: key.P,
+		KDF: encryption.KDFParams{Time: 2, Memory: 1024, Threads: 2}})
+	require.Error(t, err)
+}
+
+func TestDatabaseKDFLimits(t *testing.T) {
+	// version | salt | KDF
+	content := append([]byte(DBVersion), encryption.GenerateSalt()...)
+	content = append(content, kdfBytes(encryption.KDFParams{Time: 1, Memory: 1024, Threads: 1})...)
+	_, err := parseDatabaseHeader(content)
+	require.NoError(t, err)
+
+	// parameters which would take too much memory or time are rejected before a key is derived with them
+	for _, kdf := range []encryption.KDFParams{
+		{Time: 1, Memory: 0xFFFFFFFF, Threads: 1},
+		{Time: 1, Memory: maxKdfMemoryMiB*1024 + 1, Threads: 1},
+		{Time: maxKdfTime + 1, Memory: 1024, Threads: 1},
+		{Time: 0, Memory: 1024, Threads: 1},
+		{Time: 1, Memory: 1024, Threads: 0},
+	} {
+		copy(content[4+32:], kdfBytes(kdf))
+		_, err = parseDatabaseHeader(content)
+		require.EqualError(t, err, "corrupt database", "%+v", kdf)
+	}
+	require.True(t, validKDF(encryption.DefaultKDFParams()))
+}
+
+func TestReadLegacyDatabase(t *testing.T) {
+	file, err := ioutil.TempFile("", "go-hash-legacy")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	// version | salt | B1 | B2 | B3 | B4 | HMAC | E, with the default KDF parameters
+	db := largeDB()
+	stateBytes, err := db.bytes(&Meta{})
+	require.NoError(t, err)
+	salt := encryption.GenerateSalt()
+	P := encryption.PasswordHash("password", salt)
+	K := encryption.GenerateRandomBytes(32)
+	L := encryption.GenerateRandomBytes(32)
+	var content bytes.Buffer
+	content.WriteString("GH00")
+	content.Write(salt)
+	for _, half := range [][]byte{K[:16], K[16:], L[:16], L[16:]} {
+		B, err := encryption.Encrypt(P, half)
+		require.NoError(t, err)
+		content.Write(B)
+	}
+	content.Write(encryption.Hmac(L, append(append([]byte{}, salt...), stateBytes...)))
+	E, err := encryption.Encrypt(K, stateBytes)
+	require.NoError(t, err)
+	content.Write(E)
+	require.NoError(t, ioutil.WriteFile(file.Name(), content.Bytes(), 0600))
+
+	key, err := DeriveDatabaseKey(file.Name(), "password")
+	require.NoError(t, err)
+	require.Equal(t, encryption.DefaultKDFParams(), key.KDF)
+	read, _, err := ReadDatabaseWithKey(file.Name(), key)
+	require.NoError(t, err)
+	require.Equal(t, db, read)
+
+	// the database is converted to the current version when written
+	require.NoError(t, WriteDatabaseWithKey(file.Name(), key, &read, &Meta{}))
+	header, err := readDatabaseHeader(file.Name())
+	require.NoError(t, err)
+	require.Equal(t, DBVersion, header.version)
+	read, _, err = ReadDatabase(file.Name(), "password")
+	require.NoError(t, err)
+	require.Equal(t, db, read)
+}
+
+func TestDatabaseFileHash(t *testing.T) {
+	file, err := ioutil.TempFile("", "go-hash-hash")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	key := NewDatabaseKey("password")
+	state := State{rootGroup: {{Name: "mail", Password: "secret"}}}
+	require.NoError(t, WriteDatabaseWithKey(file.Name(), key, &state, &Meta{}))
+	hash, err := databaseFileHash(file.Name())
+	require.NoError(t, err)
+	same, err := databaseFileHash(file.Name())
+	require.NoError(t, err)
+	require.Equal(t, hash, same)
+
+	// writing the same state again changes the file, as it is encrypted with a new key
+	require.NoError(t, WriteDatabaseWithKey(file.Name(), key, &state, &Meta{}))
+	changed, err := databaseFileHash(file.Name())
+	require.NoError(t, err)
+	require.NotEqual(t, hash, changed)
+}
@@ -10,6 +10,7 @@ import (
 	"io"
 	"math/big"
 	"runtime"
+	"time"
 
 	"github.com/golang/crypto/argon2"
 )
@@ -31,6 +32,21 @@ const (
 // THREADS number of Threads to use in PasswordHash.
 var THREADS = uint8(runtime.NumCPU())
 
+// KDFParams parameters of Argon2i, which derives keys from passwords.
+type KDFParams struct {
+	// Time the number of iterations.
+	Time uint32
+	// Memory the memory used, in KiB.
+	Memory uint32
+	// Threads the degree of parallelism.
+	Threads uint8
+}
+
+// DefaultKDFParams returns the parameters used by PasswordHash.
+func DefaultKDFParams() KDFParams {
+	return KDFParams{Time: TIME, Memory: MEMORY, Threads: THREADS}
+}
+
 var defaultPasswordCharRange []uint8
 
 func init() {
@@ -129,9 +145,49 @@ func GeneratePassword(length int, characters []uint8) string {
 	return string(result)
 }
 
+// RandomInt generates a uniformly distributed random number in the range [0, max).
+func RandomInt(max int) int {
+	if max < 1 {
+		panic("max must be positive")
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		panic(err)
+	}
+	return int(n.Int64())
+}
+
 // PasswordHash creates a cryptographical hash of the salted password.
 func PasswordHash(password string, salt []byte) []byte {
-	return argon2.Key([]byte(password), salt, TIME, MEMORY, THREADS, KEYLEN)
+	return DefaultKDFParams().Hash(password, salt)
+}
+
+// Hash creates a cryptographical hash of the salted password using these parameters.
+func (params KDFParams) Hash(password string, salt []byte) []byte {
+	return argon2.Key([]byte(password), salt, params.Time, params.Memory, params.Threads, KEYLEN)
+}
+
+// Benchmark measures how long it takes to hash a password using these parameters on this computer.
+func (params KDFParams) Benchmark() time.Duration {
+	start := time.Now()
+	params.Hash("benchmark", make([]byte, SALTLEN))
+	return time.Since(start)
+}
+
+// CalibrateKDF finds the number of iterations for which hashing a password with the given memory (in KiB) and
+// threads takes about the target duration on this computer. It returns the parameters, which use at least
+// one iteration, and how long hashing a password with them took.
+func CalibrateKDF(target time.Duration, memory uint32, threads uint8) (KDFParams, time.Duration) {
+	params := KDFParams{Time: 1, Memory: memory, Threads: threads}
+	// the first run may be slower as the memory is allocated for the first time
+	perIteration := params.Benchmark()
+	if elapsed := params.Benchmark(); elapsed < perIteration {
+		perIteration = elapsed
+	}
+	if perIteration > 0 && target > perIteration {
+		params.Time = uint32((target + perIteration/2) / perIteration)
+	}
+	return params, params.Benchmark()
 }
 
 // CheckSum checksum of the message.
@@ -3,6 +3,7 @@ package encryption
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -25,6 +26,29 @@ func TestPasswordHash(t *testing.T) {
 	require.Equal(t, h4, h5)
 }
 
+func TestKDFParams(t *testing.T) {
+	salt := GenerateSalt()
+	require.Equal(t, PasswordHash("userpassword", salt), DefaultKDFParams().Hash("userpassword", salt))
+
+	params := KDFParams{Time: 1, Memory: 1024, Threads: 1}
+	h1 := params.Hash("userpassword", salt)
+	require.Len(t, h1, int(KEYLEN))
+	require.Equal(t, h1, params.Hash("userpassword", salt))
+	params.Time = 2
+	require.NotEqual(t, h1, params.Hash("userpassword", salt))
+}
+
+func TestCalibrateKDF(t *testing.T) {
+	params, elapsed := CalibrateKDF(0, 1024, 2)
+	require.Equal(t, KDFParams{Time: 1, Memory: 1024, Threads: 2}, params)
+	require.True(t, elapsed > 0)
+
+	params, _ = CalibrateKDF(20*time.Millisecond, 1024, 1)
+	require.True(t, params.Time >= 1)
+	require.Equal(t, uint32(1024), params.Memory)
+	require.Equal(t, uint8(1), params.Threads)
+}
+
 func TestGeneratePassword(t *testing.T) {
 	i := 0
 
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expiryWarningPeriod how long before a password expires users start being warned about it.
+const expiryWarningPeriod = 14 * 24 * time.Hour
+
+const expiryDateFormat = "2006-01-02"
+
+// Expiry determines when a password expires.
+// A password may expire at an absolute date, or after a maximum age since it was last changed.
+// The zero value means the password never expires.
+type Expiry struct {
+	At         time.Time
+	MaxAgeDays int
+}
+
+// expiryStatus the status of a password with respect to its expiry.
+type expiryStatus int
+
+const (
+	notExpiring expiryStatus = iota
+	expiringLater
+	expiringSoon
+	expired
+)
+
+// expiringEntry an entry whose password expires.
+type expiringEntry struct {
+	group     string
+	entry     *LoginInfo
+	expiresAt time.Time
+	status    expiryStatus
+}
+
+// parseExpiry parses an expiry specification, which may be one of:
+//
+//   YYYY-MM-DD  an absolute date.
+//   <n>d        a maximum age of n days (similarly, w = weeks, m = months, y = years).
+//   none        no expiry.
+func parseExpiry(spec string) (Expiry, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "none" {
+		return Expiry{}, nil
+	}
+	if len(spec) < 2 {
+		return Expiry{}, errors.New("invalid expiry: " + spec)
+	}
+	if date, err := time.ParseInLocation(expiryDateFormat, spec, time.Local); err == nil {
+		return Expiry{At: date}, nil
+	}
+	n, err := strconv.Atoi(spec[:len(spec)-1])
+	if err != nil || n <= 0 {
+		return Expiry{}, errors.New("invalid expiry: " + spec)
+	}
+	var days int
+	switch spec[len(spec)-1] {
+	case 'd':
+		days = n
+	case 'w':
+		days = n * 7
+	case 'm':
+		days = n * 30
+	case 'y':
+		days = n * 365
+	default:
+		return Expiry{}, errors.New("invalid expiry unit: " + spec[len(spec)-1:])
+	}
+	return Expiry{MaxAgeDays: days}, nil
+}
+
+// isZero returns true if this Expiry never expires.
+func (e Expiry) isZero() bool {
+	return e.At.IsZero() && e.MaxAgeDays == 0
+}
+
+// String human-readable representation of Expiry.
+func (e Expiry) String() string {
+	switch {
+	case !e.At.IsZero():
+		return e.At.Format(expiryDateFormat)
+	case e.MaxAgeDays > 0:
+		return fmt.Sprintf("%d days after the password is changed", e.MaxAgeDays)
+	default:
+		return "none"
+	}
+}
+
+// expiresAt returns when a password last changed at the given time expires, or false if it never expires.
+func (e Expiry) expiresAt(passwordUpdatedAt time.Time) (time.Time, bool) {
+	if !e.At.IsZero() {
+		return e.At, true
+	}
+	if e.MaxAgeDays > 0 {
+		return passwordUpdatedAt.AddDate(0, 0, e.MaxAgeDays), true
+	}
+	return time.Time{}, false
+}
+
+// expiryOf returns the Expiry that applies to an entry within a group.
+// An entry's own Expiry takes precedence over the Expiry of its group, or of the closest ancestor group which has one.
+func (meta *Meta) expiryOf(entry *LoginInfo, group string) Expiry {
+	if !entry.Expiry.isZero() {
+		return entry.Expiry
+	}
+	for {
+		if settings, ok := meta.Groups[group]; ok && !settings.Expiry.isZero() {
+			return settings.Expiry
+		}
+		if group == rootGroup {
+			return Expiry{}
+		}
+		group = parentGroup(group)
+	}
+}
+
+// setGroupExpiry sets the Expiry of a group.
+func (meta *Meta) setGroupExpiry(group string, expiry Expiry) {
+	if meta.Groups == nil {
+		meta.Groups = make(map[string]GroupSettings)
+	}
+	settings := meta.Groups[group]
+	settings.Expiry = expiry
+	if settings == (GroupSettings{}) {
+		delete(meta.Groups, group)
+	} else {
+		meta.Groups[group] = settings
+	}
+}
+
+// moveGroup moves the settings of a group, and of all of its subgroups, to a new path.
+func (meta *Meta) moveGroup(path, newPath string) {
+	moved := make(map[string]GroupSettings)
+	for group, settings := range meta.Groups {
+		if isSubgroupOf(group, path) {
+			delete(meta.Groups, group)
+			moved[newPath+group[len(path):]] = settings
+		}
+	}
+	for group, settings := range moved {
+		meta.Groups[group] = settings
+	}
+}
+
+// removeGroup removes the settings of a group and of all of its subgroups.
+func (meta *Meta) removeGroup(path string) {
+	for group := range meta.Groups {
+		if isSubgroupOf(group, path) {
+			delete(meta.Groups, group)
+		}
+	}
+}
+
+// expiryStatusOf returns when the password of an entry within a group expires, and its status at the given time.
+func (meta *Meta) expiryStatusOf(entry *LoginInfo, group string, now time.Time) (time.Time, expiryStatus) {
+	expiresAt, expires := meta.expiryOf(entry, group).expiresAt(entry.passwordUpdatedAt())
+	switch {
+	case !expires:
+		return expiresAt, notExpiring
+	case !now.Before(expiresAt):
+		return expiresAt, expired
+	case expiresAt.Sub(now) <= expiryWarningPeriod:
+		return expiresAt, expiringSoon
+	default:
+		return expiresAt, expiringLater
+	}
+}
+
+// expiringEntries returns all entries of the State whose passwords have expired or are about to expire
+// at the given time, sorted by expiry date.
+func (meta *Meta) expiringEntries(state *State, now time.Time) []expiringEntry {
+	var result []expiringEntry
+	for group, entries := range *state {
+		for i := range entries {
+			entry := &entries[i]
+			expiresAt, status := meta.expiryStatusOf(entry, group, now)
+			if status == expired || status == expiringSoon {
+				result = append(result, expiringEntry{group, entry, expiresAt, status})
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].expiresAt.Before(result[j].expiresAt)
+	})
+	return result
+}
+
+// expiryWarning returns a warning about the password of the given entry if it has expired or is about to expire,
+// or the empty string otherwise.
+func (meta *Meta) expiryWarning(entry *LoginInfo, group string) string {
+	now := time.Now()
+	expiresAt, status := meta.expiryStatusOf(entry, group, now)
+	switch status {
+	case expired:
+		return fmt.Sprintf("Warning: the password of '%s' expired %s. Please change it!",
+			entry.Name, describeDaysFrom(now, expiresAt))
+	case expiringSoon:
+		return fmt.Sprintf("Warning: the password of '%s' expires %s.",
+			entry.Name, describeDaysFrom(now, expiresAt))
+	default:
+		return ""
+	}
+}
+
+// describeDaysFrom describes the given time relative to now, e.g. "today", "in 3 days" or "5 days ago".
+func describeDaysFrom(now, t time.Time) string {
+	days := int(t.Sub(now).Hours() / 24)
+	switch {
+	case days == 0:
+		if t.Before(now) {
+			return "today"
+		}
+		return "within a day"
+	case days == 1:
+		return "in 1 day"
+	case days > 1:
+		return fmt.Sprintf("in %d days", days)
+	case days == -1:
+		return "1 day ago"
+	default:
+		return fmt.Sprintf("%d days ago", -days)
+	}
+}
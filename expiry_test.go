@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpiry(t *testing.T) {
+	type Ex struct {
+		spec     string
+		expected Expiry
+	}
+	examples := []Ex{
+		{"none", Expiry{}},
+		{"90d", Expiry{MaxAgeDays: 90}},
+		{"2w", Expiry{MaxAgeDays: 14}},
+		{"3M", Expiry{MaxAgeDays: 90}},
+		{"1y", Expiry{MaxAgeDays: 365}},
+		{"2026-12-31", Expiry{At: time.Date(2026, 12, 31, 0, 0, 0, 0, time.Local)}},
+	}
+	for _, ex := range examples {
+		expiry, err := parseExpiry(ex.spec)
+		require.NoError(t, err, "parsing '%s'", ex.spec)
+		require.Equal(t, ex.expected, expiry, "parsing '%s'", ex.spec)
+	}
+
+	for _, invalid := range []string{"", "d", "0d", "-1d", "10x", "2026-13-01", "soon"} {
+		_, err := parseExpiry(invalid)
+		require.Error(t, err, "parsing '%s'", invalid)
+	}
+}
+
+func TestExpiryOfEntries(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	meta := Meta{}
+	meta.setGroupExpiry("work", Expiry{MaxAgeDays: 90})
+
+	old := LoginInfo{Name: "old", PasswordUpdatedAt: now.AddDate(0, 0, -100)}
+	recent := LoginInfo{Name: "recent", PasswordUpdatedAt: now.AddDate(0, 0, -80)}
+	own := LoginInfo{Name: "own", PasswordUpdatedAt: now.AddDate(0, 0, -100), Expiry: Expiry{At: now.AddDate(1, 0, 0)}}
+	legacy := LoginInfo{Name: "legacy", UpdatedAt: now.AddDate(0, 0, -200)}
+
+	_, status := meta.expiryStatusOf(&old, "work/aws", now)
+	require.Equal(t, expired, status, "group expiry should apply to subgroups")
+	_, status = meta.expiryStatusOf(&recent, "work", now)
+	require.Equal(t, expiringSoon, status)
+	_, status = meta.expiryStatusOf(&own, "work", now)
+	require.Equal(t, expiringLater, status, "entry expiry should take precedence")
+	_, status = meta.expiryStatusOf(&old, "personal", now)
+	require.Equal(t, notExpiring, status)
+	_, status = meta.expiryStatusOf(&legacy, "work", now)
+	require.Equal(t, expired, status, "entries without PasswordUpdatedAt should use UpdatedAt")
+
+	state := State{
+		"work":     []LoginInfo{recent, own},
+		"work/aws": []LoginInfo{old},
+		"personal": []LoginInfo{old},
+	}
+	expiring := meta.expiringEntries(&state, now)
+	require.Len(t, expiring, 2)
+	require.Equal(t, "work/aws", expiring[0].group)
+	require.Equal(t, "recent", expiring[1].entry.Name)
+
+	meta.setGroupExpiry("work", Expiry{})
+	require.Empty(t, meta.Groups)
+}
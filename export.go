@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/crypto/argon2"
+	"github.com/renatoathaydes/go-hash/encryption"
+	"github.com/renatoathaydes/go-hash/kdbx"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// exportedGroup a group whose entries are exported.
+type exportedGroup struct {
+	// path the full path of the group.
+	path     string
+	entries  []LoginInfo
+	settings GroupSettings
+}
+
+// exportResult the content of an exported file, and anything which could not be exported.
+type exportResult struct {
+	content  []byte
+	warnings []string
+}
+
+func (result *exportResult) warn(format string, args ...interface{}) {
+	result.warnings = append(result.warnings, fmt.Sprintf(format, args...))
+}
+
+// exporter writes groups in an export format, as configured by the options of the format.
+type exporter struct {
+	// plaintext returns whether the exported file holds passwords unencrypted.
+	plaintext func() bool
+	// export writes the groups. The reader may be used to ask the user for passwords.
+	export func(groups []exportedGroup, reader *bufio.Reader) (exportResult, error)
+}
+
+// exportFormat a format entries can be exported to.
+type exportFormat struct {
+	description string
+	// usage describes the options of the format.
+	usage string
+	// options adds the options of the format to the flag set, and returns the exporter using them.
+	options func(fs *flag.FlagSet) exporter
+}
+
+// exportFormats the formats which entries can be exported to, by name.
+var exportFormats = map[string]exportFormat{
+	"csv":  {"CSV file, in the format of go-hash or of another password manager", csvExportUsage, csvExportOptions},
+	"json": {"JSON file, optionally encrypted with a passphrase", jsonExportUsage, jsonExportOptions},
+	"kdbx": {"KeePass 2 database (KDBX 4)", kdbxExportUsage, kdbxExportOptions},
+}
+
+// exportFormatNames returns the names of the formats entries can be exported to, sorted.
+func exportFormatNames() []string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// groupList the value of a flag which may be given more than once, each time with a group.
+type groupList []string
+
+func (list *groupList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *groupList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// exportedGroups returns the given groups and all of their subgroups, the root group first and the others
+// sorted by path. Groups are given as full paths, and groups without entries or settings are left out.
+func exportedGroups(state *State, meta *Meta, paths []string) []exportedGroup {
+	selected := make(map[string]bool)
+	for _, path := range paths {
+		for _, group := range state.subgroups(path) {
+			selected[group] = true
+		}
+	}
+	var groups []exportedGroup
+	for _, path := range state.subgroups(rootGroup) {
+		settings := meta.Groups[path]
+		if selected[path] && (len((*state)[path]) > 0 || settings != (GroupSettings{})) {
+			groups = append(groups, exportedGroup{path: path, entries: (*state)[path], settings: settings})
+		}
+	}
+	// the root group comes first
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].path == rootGroup && groups[j].path != rootGroup
+	})
+	return groups
+}
+
+// readNewPassphrase asks the user for a new passphrase, then asks for it again with the second prompt.
+func readNewPassphrase(prompt, again string) (string, error) {
+	print(prompt)
+	pass, err := terminal.ReadPassword(int(syscall.Stdin))
+	println("")
+	if err != nil {
+		return "", err
+	}
+	if len(pass) == 0 {
+		return "", errors.New("nothing was entered")
+	}
+	print(again)
+	pass2, err := terminal.ReadPassword(int(syscall.Stdin))
+	println("")
+	if err != nil {
+		return "", err
+	}
+	if string(pass) != string(pass2) {
+		return "", errors.New("the two entries do not match")
+	}
+	return string(pass), nil
+}
+
+// ============= JSON ============= //
+
+// exportFormatName and exportFormatVersion identify JSON exports.
+const (
+	exportFormatName          = "go-hash-export"
+	encryptedExportFormatName = "go-hash-export-encrypted"
+	exportFormatVersion       = 1
+)
+
+// parameters of the Argon2id KDF deriving the key of encrypted JSON exports from their passphrase.
+var (
+	exportKdfTime    uint32 = 4
+	exportKdfMemory  uint32 = 64 * 1024
+	exportKdfThreads uint8  = 4
+)
+
+type jsonExport struct {
+	Format     string            `json:"format"`
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Groups     []jsonExportGroup `json:"groups"`
+}
+
+type jsonExportGroup struct {
+	Path    string            `json:"path"`
+	Expiry  *jsonExportExpiry `json:"expiry,omitempty"`
+	Entries []jsonExportEntry `json:"entries"`
+}
+
+type jsonExportEntry struct {
+	Name              string            `json:"name"`
+	Username          string            `json:"username"`
+	Password          string            `json:"password"`
+	URL               string            `json:"url"`
+	Description       string            `json:"description"`
+	Tags              []string          `json:"tags"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+	PasswordUpdatedAt time.Time         `json:"password_updated_at"`
+	Generator         string            `json:"generator"`
+	Expiry            *jsonExportExpiry `json:"expiry,omitempty"`
+}
+
+type jsonExportExpiry struct {
+	At         *time.Time `json:"at,omitempty"`
+	MaxAgeDays int        `json:"max_age_days,omitempty"`
+}
+
+// encryptedJSONExport a JSON export encrypted with AES-256-GCM, using a key derived from a passphrase.
+type encryptedJSONExport struct {
+	Format  string        `json:"format"`
+	Version int           `json:"version"`
+	KDF     jsonExportKDF `json:"kdf"`
+	Cipher  string        `json:"cipher"`
+	// Nonce and Ciphertext are base64-encoded, as are all byte slices in JSON.
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type jsonExportKDF struct {
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	Time      uint32 `json:"time"`
+	MemoryKiB uint32 `json:"memory_kib"`
+	Threads   uint8  `json:"threads"`
+}
+
+func jsonExportOptions(fs *flag.FlagSet) exporter {
+	encrypted := fs.Bool("e", false, "encrypt the file with a passphrase")
+	return exporter{
+		plaintext: func() bool {
+			return !*encrypted
+		},
+		export: func(groups []exportedGroup, reader *bufio.Reader) (exportResult, error) {
+			content, err := jsonExportContent(groups, time.Now())
+			if err != nil || !*encrypted {
+				return exportResult{content: content}, err
+			}
+			passphrase, err := readNewPassphrase("Passphrase of the exported file: ", "Re-enter the passphrase: ")
+			if err != nil {
+				return exportResult{}, err
+			}
+			content, err = encryptJSONExport(content, passphrase)
+			return exportResult{content: content}, err
+		},
+	}
+}
+
+// jsonExportContent writes the groups as a JSON document.
+func jsonExportContent(groups []exportedGroup, now time.Time) ([]byte, error) {
+	export := jsonExport{
+		Format:     exportFormatName,
+		Version:    exportFormatVersion,
+		ExportedAt: now.UTC(),
+		Groups:     []jsonExportGroup{},
+	}
+	for _, g := range groups {
+		group := jsonExportGroup{Path: g.path, Expiry: jsonExpiry(g.settings.Expiry), Entries: []jsonExportEntry{}}
+		for _, e := range g.entries {
+			entry := jsonExportEntry{
+				Name:              e.Name,
+				Username:          e.Username,
+				Password:          e.Password,
+				URL:               e.URL,
+				Description:       e.Description,
+				Tags:              append([]string{}, e.Tags...),
+				UpdatedAt:         e.UpdatedAt.UTC(),
+				PasswordUpdatedAt: e.passwordUpdatedAt().UTC(),
+				Generator:         e.Generator,
+				Expiry:            jsonExpiry(e.Expiry),
+			}
+			group.Entries = append(group.Entries, entry)
+		}
+		export.Groups = append(export.Groups, group)
+	}
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// jsonExpiry returns the JSON form of an Expiry, or nil if there is none.
+func jsonExpiry(expiry Expiry) *jsonExportExpiry {
+	if expiry.isZero() {
+		return nil
+	}
+	result := &jsonExportExpiry{MaxAgeDays: expiry.MaxAgeDays}
+	if !expiry.At.IsZero() {
+		at := expiry.At.UTC()
+		result.At = &at
+	}
+	return result
+}
+
+// encryptJSONExport encrypts a JSON export with a key derived from the passphrase.
+func encryptJSONExport(content []byte, passphrase string) ([]byte, error) {
+	kdf := jsonExportKDF{
+		Algorithm: "argon2id",
+		Salt:      encryption.GenerateSalt(),
+		Time:      exportKdfTime,
+		MemoryKiB: exportKdfMemory,
+		Threads:   exportKdfThreads,
+	}
+	gcm, err := jsonExportCipher(passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+	nonce := encryption.GenerateRandomBytes(uint32(gcm.NonceSize()))
+	return json.MarshalIndent(encryptedJSONExport{
+		Format:     encryptedExportFormatName,
+		Version:    exportFormatVersion,
+		KDF:        kdf,
+		Cipher:     "aes-256-gcm",
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, content, nil),
+	}, "", "  ")
+}
+
+func jsonExportCipher(passphrase string, kdf jsonExportKDF) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), kdf.Salt, kdf.Time, kdf.MemoryKiB, kdf.Threads, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+const jsonExportUsage = `    -e  encrypt the file with a passphrase, which is asked for twice. It is not the master password.
+
+    The file is a JSON document, described in the README, with the full path of each group ('default' being
+    the root group), its expiry setting and all fields of its entries. Encrypted files hold that document encrypted with
+    AES-256-GCM, using a key derived from the passphrase with Argon2id.
+`
+
+// ============= CSV ============= //
+
+func csvExportOptions(fs *flag.FlagSet) exporter {
+	preset := fs.String("p", defaultCSVPreset, "the application the file is exported for")
+	return exporter{
+		plaintext: func() bool {
+			return true
+		},
+		export: func(groups []exportedGroup, reader *bufio.Reader) (exportResult, error) {
+			return csvExportResult(groups, *preset)
+		},
+	}
+}
+
+// csvExportResult writes the groups in the CSV format of a preset. Fields the preset has no column for are
+// left out, with a warning.
+func csvExportResult(groups []exportedGroup, presetName string) (exportResult, error) {
+	preset, ok := csvPresets[strings.ToLower(presetName)]
+	if !ok || len(preset.header) == 0 {
+		return exportResult{}, fmt.Errorf("unknown preset '%s', presets are: %s",
+			presetName, strings.Join(csvPresetNames(), ", "))
+	}
+	// the field of each column of the header, if any
+	fields := make([]string, len(preset.header))
+	for i, column := range preset.header {
+		for field, c := range preset.mapping.columns {
+			if strings.EqualFold(c, column) {
+				fields[i] = field
+			}
+		}
+	}
+	has := func(field string) bool {
+		_, ok := preset.mapping.columns[field]
+		return ok
+	}
+
+	var result exportResult
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(preset.header)
+	lost := make(map[string]int)
+	for _, g := range groups {
+		if !has("group") && g.path != rootGroup {
+			lost["group"] += len(g.entries)
+		}
+		for _, e := range g.entries {
+			values := map[string]string{
+				"name":     e.Name,
+				"username": e.Username,
+				"password": e.Password,
+				"url":      e.URL,
+				"notes":    e.Description,
+				"group":    strings.Join(splitGroupPath(g.path), preset.mapping.groupSeparator),
+				"tags":     strings.Join(e.Tags, ","),
+				"modified": formatCSVTime(e.UpdatedAt, preset.timeInMillis),
+			}
+			for _, field := range []string{"name", "notes", "tags"} {
+				if !has(field) && len(values[field]) > 0 {
+					lost[field]++
+				}
+			}
+			row := make([]string, len(preset.header))
+			for i, column := range preset.header {
+				if len(fields[i]) > 0 {
+					row[i] = values[fields[i]]
+				} else {
+					row[i] = preset.defaults[column]
+				}
+			}
+			w.Write(row)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return exportResult{}, err
+	}
+	for _, field := range []string{"group", "name", "notes", "tags"} {
+		if n := lost[field]; n > 0 {
+			result.warn("the %s format has no %s column: the %s of %d entries was not exported",
+				preset.description, field, field, n)
+		}
+	}
+	result.content = b.Bytes()
+	return result, nil
+}
+
+// formatCSVTime formats a time as parseCSVTime parses it, in RFC 3339 format or in milliseconds since the
+// Unix epoch. Returns the empty string for the zero time.
+func formatCSVTime(t time.Time, millis bool) string {
+	switch {
+	case t.IsZero():
+		return ""
+	case millis:
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+const csvExportUsage = `    -p <preset>  the application the file is exported for: go-hash (the default), chrome, firefox, bitwarden,
+                 lastpass or 1password.
+
+    Fields which the chosen application has no column for, such as groups in Chrome and Firefox files, are
+    not exported. The go-hash preset keeps all fields but expiry settings, and is imported back with
+    'import csv'. Groups are given by their full path, nested groups being separated by '/'.
+`
+
+// ============= KDBX ============= //
+
+func kdbxExportOptions(fs *flag.FlagSet) exporter {
+	return exporter{
+		plaintext: func() bool {
+			return false
+		},
+		export: func(groups []exportedGroup, reader *bufio.Reader) (exportResult, error) {
+			password, err := readNewPassphrase("Password of the KeePass database: ", "Re-enter the password: ")
+			if err != nil {
+				return exportResult{}, err
+			}
+			println("Encrypting the KeePass database...")
+			var b bytes.Buffer
+			if err = kdbx.Encode(&b, kdbxExportDatabase(groups), kdbx.Credentials{Password: password}); err != nil {
+				return exportResult{}, err
+			}
+			return exportResult{content: b.Bytes()}, nil
+		},
+	}
+}
+
+// kdbxExportDatabase maps go-hash groups and entries into a KeePass database, whose root group is the
+// go-hash root group.
+func kdbxExportDatabase(groups []exportedGroup) *kdbx.Database {
+	db := &kdbx.Database{Root: kdbx.Group{Name: "go-hash"}}
+	for _, g := range groups {
+		group := &db.Root
+		for _, name := range splitGroupPath(g.path) {
+			var sub *kdbx.Group
+			for i := range group.Groups {
+				if group.Groups[i].Name == name {
+					sub = &group.Groups[i]
+				}
+			}
+			if sub == nil {
+				group.Groups = append(group.Groups, kdbx.Group{Name: name})
+				sub = &group.Groups[len(group.Groups)-1]
+			}
+			group = sub
+		}
+		for i := range g.entries {
+			e := &g.entries[i]
+			entry := kdbx.Entry{
+				Fields: []kdbx.Field{
+					{Key: kdbx.FieldTitle, Value: e.Name},
+					{Key: kdbx.FieldUserName, Value: e.Username},
+					{Key: kdbx.FieldPassword, Value: e.Password, Protected: true},
+					{Key: kdbx.FieldURL, Value: e.URL},
+					{Key: kdbx.FieldNotes, Value: e.Description},
+				},
+				Tags:     e.Tags,
+				Modified: e.UpdatedAt,
+			}
+			entry.Expires, _ = e.Expiry.expiresAt(e.passwordUpdatedAt())
+			group.Entries = append(group.Entries, entry)
+		}
+	}
+	return db
+}
+
+const kdbxExportUsage = `    The password of the database is asked for twice. Groups become KeePass groups within a root group
+    named 'go-hash', and expiry settings become the expiry time of entries.
+`
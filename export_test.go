@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renatoathaydes/go-hash/kdbx"
+	"github.com/stretchr/testify/require"
+)
+
+func testExportState() State {
+	modified := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	return State{
+		rootGroup: {{Name: "mail", Username: "joe", Password: "s3cr3t", URL: "https://mail.example.com",
+			Description: "my mail", UpdatedAt: modified, Tags: []string{"email", "personal"}}},
+		"work":     {},
+		"work/aws": {{Name: "root", Password: "p@ss, \"w0rd\"", UpdatedAt: modified, Expiry: Expiry{MaxAgeDays: 90}}},
+		"web":      {{Name: "forum", Username: "joe", UpdatedAt: modified, Generator: "len=6 chars=d"}},
+	}
+}
+
+func TestExportedGroups(t *testing.T) {
+	state := testExportState()
+	paths := func(groups []exportedGroup) []string {
+		var result []string
+		for _, g := range groups {
+			result = append(result, g.path)
+		}
+		return result
+	}
+	require.Equal(t, []string{rootGroup, "web", "work/aws"}, paths(exportedGroups(&state, &Meta{}, []string{rootGroup})))
+	require.Equal(t, []string{"work/aws"}, paths(exportedGroups(&state, &Meta{}, []string{"work"})))
+	require.Equal(t, []string{"web", "work/aws"}, paths(exportedGroups(&state, &Meta{}, []string{"work/aws", "web", "work"})))
+
+	// groups without entries are exported if they have settings
+	meta := Meta{Groups: map[string]GroupSettings{"work": {Expiry: Expiry{MaxAgeDays: 30}}}}
+	groups := exportedGroups(&state, &meta, []string{"work"})
+	require.Equal(t, []string{"work", "work/aws"}, paths(groups))
+	require.Equal(t, meta.Groups["work"], groups[0].settings)
+}
+
+func TestJSONExportContent(t *testing.T) {
+	state := testExportState()
+	now := time.Date(2018, 5, 6, 7, 8, 9, 0, time.UTC)
+	meta := Meta{Groups: map[string]GroupSettings{"work": {Expiry: Expiry{MaxAgeDays: 30}}}}
+	content, err := jsonExportContent(exportedGroups(&state, &meta, []string{rootGroup}), now)
+	require.NoError(t, err)
+
+	var export jsonExport
+	require.NoError(t, json.Unmarshal(content, &export))
+	require.Equal(t, exportFormatName, export.Format)
+	require.Equal(t, 1, export.Version)
+	require.Equal(t, now, export.ExportedAt)
+	require.Len(t, export.Groups, 4)
+	modified := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	require.Equal(t, jsonExportGroup{Path: rootGroup, Entries: []jsonExportEntry{{Name: "mail", Username: "joe",
+		Password: "s3cr3t", URL: "https://mail.example.com", Description: "my mail",
+		Tags: []string{"email", "personal"}, UpdatedAt: modified, PasswordUpdatedAt: modified}}}, export.Groups[0])
+	require.Equal(t, []string{}, export.Groups[1].Entries[0].Tags)
+	require.Equal(t, "len=6 chars=d", export.Groups[1].Entries[0].Generator)
+	require.Equal(t, jsonExportGroup{Path: "work", Expiry: &jsonExportExpiry{MaxAgeDays: 30},
+		Entries: []jsonExportEntry{}}, export.Groups[2])
+	require.Equal(t, &jsonExportExpiry{MaxAgeDays: 90}, export.Groups[3].Entries[0].Expiry)
+	require.Contains(t, string(content), `"expiry": {
+            "max_age_days": 90
+          }`)
+}
+
+func TestEncryptJSONExport(t *testing.T) {
+	iterations, memory := exportKdfTime, exportKdfMemory
+	exportKdfTime, exportKdfMemory = 1, 1024
+	defer func() {
+		exportKdfTime, exportKdfMemory = iterations, memory
+	}()
+
+	content := []byte(`{"format":"go-hash-export"}`)
+	encrypted, err := encryptJSONExport(content, "passphrase")
+	require.NoError(t, err)
+	require.NotContains(t, string(encrypted), "go-hash-export\"")
+
+	var export encryptedJSONExport
+	require.NoError(t, json.Unmarshal(encrypted, &export))
+	require.Equal(t, encryptedExportFormatName, export.Format)
+	require.Equal(t, jsonExportKDF{Algorithm: "argon2id", Salt: export.KDF.Salt, Time: 1, MemoryKiB: 1024,
+		Threads: exportKdfThreads}, export.KDF)
+	require.Len(t, export.KDF.Salt, 32)
+
+	gcm, err := jsonExportCipher("passphrase", export.KDF)
+	require.NoError(t, err)
+	plain, err := gcm.Open(nil, export.Nonce, export.Ciphertext, nil)
+	require.NoError(t, err)
+	require.Equal(t, content, plain)
+
+	gcm, err = jsonExportCipher("wrong", export.KDF)
+	require.NoError(t, err)
+	_, err = gcm.Open(nil, export.Nonce, export.Ciphertext, nil)
+	require.Error(t, err)
+}
+
+func TestCsvExportResult(t *testing.T) {
+	state := testExportState()
+	groups := exportedGroups(&state, &Meta{}, []string{rootGroup})
+
+	result, err := csvExportResult(groups, defaultCSVPreset)
+	require.NoError(t, err)
+	require.Empty(t, result.warnings)
+	require.Equal(t, "group,name,username,password,url,notes,tags,modified\n"+
+		",mail,joe,s3cr3t,https://mail.example.com,my mail,\"email,personal\",2018-03-04T05:06:07Z\n"+
+		"web,forum,joe,,,,,2018-03-04T05:06:07Z\n"+
+		"work/aws,root,,\"p@ss, \"\"w0rd\"\"\",,,,2018-03-04T05:06:07Z\n", string(result.content))
+
+	// the go-hash preset is detected and imported back
+	imported, err := csvImportResult(bytes.NewReader(result.content), "", "")
+	require.NoError(t, err)
+	require.Len(t, imported.entries, 3)
+	require.Equal(t, []string{"work", "aws"}, imported.entries[2].groups)
+	require.Equal(t, state["work/aws"][0].Password, imported.entries[2].entry.Password)
+	require.Equal(t, state[rootGroup][0].Tags, imported.entries[0].entry.Tags)
+
+	result, err = csvExportResult(groups, "firefox")
+	require.NoError(t, err)
+	require.Equal(t, "url,username,password,httpRealm,formActionOrigin,guid,timeCreated,timeLastUsed,"+
+		"timePasswordChanged\n"+
+		"https://mail.example.com,joe,s3cr3t,,,,,,1520139967000\n", strings.SplitAfter(string(result.content), "\n")[0]+
+		strings.SplitAfter(string(result.content), "\n")[1])
+	require.Equal(t, []string{
+		"the Firefox format has no group column: the group of 2 entries was not exported",
+		"the Firefox format has no name column: the name of 3 entries was not exported",
+		"the Firefox format has no notes column: the notes of 1 entries was not exported",
+		"the Firefox format has no tags column: the tags of 1 entries was not exported",
+	}, result.warnings)
+
+	result, err = csvExportResult(groups[2:], "bitwarden")
+	require.NoError(t, err)
+	require.Equal(t, "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,"+
+		"login_totp\n"+
+		"work/aws,,login,root,,,0,,,\"p@ss, \"\"w0rd\"\"\",\n", string(result.content))
+
+	_, err = csvExportResult(groups, "keepass")
+	require.Error(t, err)
+}
+
+func TestKdbxExportDatabase(t *testing.T) {
+	state := testExportState()
+	db := kdbxExportDatabase(exportedGroups(&state, &Meta{}, []string{rootGroup}))
+	modified := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	require.Equal(t, "go-hash", db.Root.Name)
+	require.Len(t, db.Root.Entries, 1)
+	mail := db.Root.Entries[0]
+	require.Equal(t, []kdbx.Field{
+		{Key: kdbx.FieldTitle, Value: "mail"},
+		{Key: kdbx.FieldUserName, Value: "joe"},
+		{Key: kdbx.FieldPassword, Value: "s3cr3t", Protected: true},
+		{Key: kdbx.FieldURL, Value: "https://mail.example.com"},
+		{Key: kdbx.FieldNotes, Value: "my mail"},
+	}, mail.Fields)
+	require.Equal(t, []string{"email", "personal"}, mail.Tags)
+	require.Equal(t, modified, mail.Modified)
+	require.True(t, mail.Expires.IsZero())
+
+	require.Len(t, db.Root.Groups, 2)
+	require.Equal(t, "web", db.Root.Groups[0].Name)
+	work := db.Root.Groups[1]
+	require.Equal(t, "work", work.Name)
+	require.Empty(t, work.Entries)
+	require.Len(t, work.Groups, 1)
+	require.Equal(t, "aws", work.Groups[0].Name)
+	root := work.Groups[0].Entries[0]
+	require.Equal(t, "root", root.Get(kdbx.FieldTitle))
+	require.Equal(t, modified.AddDate(0, 0, 90), root.Expires)
+
+	// the database is imported back as it was exported
+	result := kdbxImportResult(db)
+	require.Len(t, result.entries, 3)
+	require.Equal(t, []string{"work", "aws"}, result.entries[2].groups)
+	require.Equal(t, state["work/aws"][0].Password, result.entries[2].entry.Password)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/renatoathaydes/go-hash/encryption"
+)
+
+// defaultProfile name of the password profile used when none is chosen.
+const defaultProfile = "default"
+
+// ambiguousChars characters which are easily confused with others when read or typed by hand.
+const ambiguousChars = "Il1|O0o`'\".,;:"
+
+// password character classes, identified by a single letter within profile specifications.
+const (
+	upperChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	lowerChars  = "abcdefghijklmnopqrstuvwxyz"
+	digitChars  = "0123456789"
+	symbolChars = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+)
+
+// builtinProfiles password profiles which are always available.
+var builtinProfiles = map[string]string{
+	defaultProfile: "len=16 chars=ulds require=uld",
+	"alnum":        "len=16 chars=uld require=uld",
+	"readable":     "len=16 chars=ulds require=uld no-ambiguous",
+	"strong":       "len=32 chars=ulds require=ulds",
+	"pin":          "len=6 chars=d",
+	"passphrase":   "words=6 sep=- caps=none",
+}
+
+// passwordProfile rules used to generate passwords.
+type passwordProfile struct {
+	length      int
+	classes     string
+	required    string
+	symbols     string
+	exclude     string
+	noAmbiguous bool
+	pattern     string
+
+	// passphrase options
+	words     int
+	separator string
+	caps      string
+	wordlist  string
+}
+
+// parseProfile parses a password profile specification.
+//
+// A specification may start with the name of a built-in or custom profile, and is followed by
+// any number of space-separated options which override the options of that profile:
+//
+//   len=<n>           length of the password.
+//   chars=<classes>   allowed character classes: u = upper-case, l = lower-case, d = digits, s = symbols.
+//   require=<classes> character classes which must appear in the password.
+//   symbols=<chars>   the symbols which may be used (by default, all ASCII symbols).
+//   exclude=<chars>   characters which must not be used.
+//   no-ambiguous      do not use characters which are easily confused, like 'l', '1' and 'I'.
+//   pattern=<pattern> generate the password following a pattern (the length is given by the pattern).
+//   words=<n>         generate a passphrase with n words instead of a password.
+//   sep=<separator>   separator between the words of a passphrase ('space' and 'none' are also accepted).
+//   caps=<caps>       capitalisation of the words of a passphrase: none, first, all or random.
+//   wordlist=<path>   file containing the words for passphrases (by default, the EFF large wordlist is used).
+//
+// Within a pattern, the letters u, l, d and s stand for a character of the corresponding class,
+// 'a' stands for a letter, 'x' for a letter or digit, and '*' for any allowed character.
+// A number within braces repeats the previous element, e.g. 'u{4}', and a backslash escapes the next character.
+// Any other character is used literally.
+func parseProfile(spec string, custom map[string]string) (passwordProfile, error) {
+	options := strings.Fields(spec)
+	base := builtinProfiles[defaultProfile]
+	if len(options) > 0 && !strings.Contains(options[0], "=") && options[0] != "no-ambiguous" {
+		name := options[0]
+		options = options[1:]
+		if s, ok := custom[name]; ok {
+			base = s
+		} else if s, ok := builtinProfiles[name]; ok {
+			base = s
+		} else {
+			return passwordProfile{}, fmt.Errorf("unknown password profile '%s'", name)
+		}
+	}
+
+	var profile passwordProfile
+	for _, option := range append(strings.Fields(base), options...) {
+		var err error
+		switch {
+		case option == "no-ambiguous":
+			profile.noAmbiguous = true
+		case strings.HasPrefix(option, "len="):
+			profile.length, err = strconv.Atoi(option[len("len="):])
+			if err == nil && (profile.length < 1 || profile.length > 1024) {
+				err = errors.New("length must be between 1 and 1024")
+			}
+		case strings.HasPrefix(option, "chars="):
+			profile.classes, err = parseCharClasses(option[len("chars="):])
+		case strings.HasPrefix(option, "require="):
+			profile.required, err = parseCharClasses(option[len("require="):])
+		case strings.HasPrefix(option, "symbols="):
+			profile.symbols = option[len("symbols="):]
+		case strings.HasPrefix(option, "exclude="):
+			profile.exclude = option[len("exclude="):]
+		case strings.HasPrefix(option, "pattern="):
+			profile.pattern = option[len("pattern="):]
+		case strings.HasPrefix(option, "words="):
+			profile.words, err = strconv.Atoi(option[len("words="):])
+			if err == nil && (profile.words < 1 || profile.words > 64) {
+				err = errors.New("number of words must be between 1 and 64")
+			}
+		case strings.HasPrefix(option, "sep="):
+			profile.separator = option[len("sep="):]
+		case strings.HasPrefix(option, "caps="):
+			profile.caps = option[len("caps="):]
+		case strings.HasPrefix(option, "wordlist="):
+			profile.wordlist = option[len("wordlist="):]
+		default:
+			err = fmt.Errorf("unknown option '%s'", option)
+		}
+		if err != nil {
+			return passwordProfile{}, fmt.Errorf("invalid password profile: %s", err.Error())
+		}
+	}
+
+	return profile, profile.validate()
+}
+
+func parseCharClasses(classes string) (string, error) {
+	var result []byte
+	for _, c := range []byte("ulds") {
+		if strings.IndexByte(classes, c) >= 0 {
+			result = append(result, c)
+		}
+	}
+	if len(result) != len(classes) {
+		return "", fmt.Errorf("invalid character classes '%s' (valid classes: u, l, d, s)", classes)
+	}
+	return string(result), nil
+}
+
+func (profile passwordProfile) validate() error {
+	if profile.isPassphrase() {
+		switch profile.caps {
+		case "", "none", "first", "all", "random":
+		default:
+			return fmt.Errorf("invalid password profile: unknown capitalisation '%s'", profile.caps)
+		}
+		_, err := loadWordlist(profile.wordlist)
+		return err
+	}
+	if profile.pattern != "" {
+		elements, err := profile.patternElements()
+		if err != nil {
+			return err
+		}
+		if len(elements) == 0 {
+			return errors.New("invalid password profile: empty pattern")
+		}
+		return nil
+	}
+	if profile.classes == "" {
+		return errors.New("invalid password profile: no character classes allowed")
+	}
+	for _, c := range profile.required {
+		if !strings.ContainsRune(profile.classes, c) {
+			return fmt.Errorf("invalid password profile: required class '%c' is not allowed", c)
+		}
+		if len(profile.charsOf(byte(c))) == 0 {
+			return fmt.Errorf("invalid password profile: all characters of required class '%c' are excluded", c)
+		}
+	}
+	if len(profile.required) > profile.length {
+		return errors.New("invalid password profile: too short to contain all required classes")
+	}
+	if len(profile.charset()) < 2 {
+		return errors.New("invalid password profile: at least 2 characters must be allowed")
+	}
+	return nil
+}
+
+// charsOf returns the allowed characters of the given class.
+func (profile passwordProfile) charsOf(class byte) string {
+	var chars string
+	switch class {
+	case 'u':
+		chars = upperChars
+	case 'l':
+		chars = lowerChars
+	case 'd':
+		chars = digitChars
+	case 's':
+		chars = symbolChars
+		if profile.symbols != "" {
+			chars = profile.symbols
+		}
+	}
+	return profile.filter(chars)
+}
+
+// filter removes the excluded characters from chars.
+func (profile passwordProfile) filter(chars string) string {
+	return strings.Map(func(c rune) rune {
+		if strings.ContainsRune(profile.exclude, c) ||
+			(profile.noAmbiguous && strings.ContainsRune(ambiguousChars, c)) {
+			return -1
+		}
+		return c
+	}, chars)
+}
+
+// charset returns all characters this profile may use.
+func (profile passwordProfile) charset() []uint8 {
+	var result []uint8
+	for _, c := range []byte(profile.classes) {
+		result = append(result, profile.charsOf(c)...)
+	}
+	return result
+}
+
+// patternElements returns the characters that may be used at each position of the pattern.
+func (profile passwordProfile) patternElements() ([]string, error) {
+	var elements []string
+	pattern := profile.pattern
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case 'u', 'l', 'd', 's':
+			elements = append(elements, profile.charsOf(c))
+		case 'a':
+			elements = append(elements, profile.charsOf('u')+profile.charsOf('l'))
+		case 'x':
+			elements = append(elements, profile.charsOf('u')+profile.charsOf('l')+profile.charsOf('d'))
+		case '*':
+			elements = append(elements, string(profile.charset()))
+		case '\\':
+			if i+1 == len(pattern) {
+				return nil, errors.New("invalid pattern: nothing to escape at the end")
+			}
+			i++
+			elements = append(elements, pattern[i:i+1])
+		case '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 || len(elements) == 0 {
+				return nil, errors.New("invalid pattern: unexpected '{'")
+			}
+			n, err := strconv.Atoi(pattern[i+1 : i+end])
+			if err != nil || n < 1 || len(elements)+n > 1024 {
+				return nil, fmt.Errorf("invalid pattern: bad repetition '%s'", pattern[i:i+end+1])
+			}
+			last := elements[len(elements)-1]
+			for j := 1; j < n; j++ {
+				elements = append(elements, last)
+			}
+			i += end
+		default:
+			elements = append(elements, pattern[i:i+1])
+		}
+		if len(elements[len(elements)-1]) == 0 {
+			return nil, fmt.Errorf("invalid pattern: all characters for '%c' are excluded", c)
+		}
+	}
+	return elements, nil
+}
+
+// isPassphrase returns true if this profile generates passphrases rather than passwords.
+func (profile passwordProfile) isPassphrase() bool {
+	return profile.words > 0
+}
+
+// generate a password according to this profile.
+func (profile passwordProfile) generate() (password string) {
+	if profile.isPassphrase() {
+		words, err := loadWordlist(profile.wordlist)
+		if err != nil {
+			panic(err)
+		}
+		return generatePassphrase(words, profile.words, passphraseSeparator(profile.separator), profile.caps)
+	}
+	if profile.pattern != "" {
+		elements, err := profile.patternElements()
+		if err != nil {
+			panic(err)
+		}
+		result := make([]string, len(elements))
+		for i, chars := range elements {
+			result[i] = pickChar(chars)
+		}
+		return strings.Join(result, "")
+	}
+
+	charset := profile.charset()
+	for {
+		password = encryption.GeneratePassword(profile.length, charset)
+		if profile.hasRequiredClasses(password) {
+			return
+		}
+	}
+}
+
+func (profile passwordProfile) hasRequiredClasses(password string) bool {
+	for _, class := range []byte(profile.required) {
+		if !strings.ContainsAny(password, profile.charsOf(class)) {
+			return false
+		}
+	}
+	return true
+}
+
+// pickChar picks a random character from the given ones.
+func pickChar(chars string) string {
+	if len(chars) == 1 {
+		return chars
+	}
+	return encryption.GeneratePassword(1, []uint8(chars))
+}
+
+// entropyBits estimates the entropy, in bits, of the passwords generated by this profile.
+// The small reduction caused by required character classes is ignored.
+func (profile passwordProfile) entropyBits() float64 {
+	if profile.isPassphrase() {
+		words, _ := loadWordlist(profile.wordlist)
+		return passphraseEntropyBits(len(words), profile.words, profile.caps)
+	}
+	if profile.pattern != "" {
+		elements, _ := profile.patternElements()
+		bits := 0.0
+		for _, chars := range elements {
+			bits += math.Log2(float64(len(chars)))
+		}
+		return bits
+	}
+	return float64(profile.length) * math.Log2(float64(len(profile.charset())))
+}
+
+// String the full specification of this profile, which does not depend on other profiles.
+func (profile passwordProfile) String() string {
+	var options []string
+	if profile.isPassphrase() {
+		options = append(options, "words="+strconv.Itoa(profile.words))
+		if profile.separator != "" {
+			options = append(options, "sep="+profile.separator)
+		}
+		if profile.caps != "" {
+			options = append(options, "caps="+profile.caps)
+		}
+		if profile.wordlist != "" {
+			options = append(options, "wordlist="+profile.wordlist)
+		}
+		return strings.Join(options, " ")
+	}
+	if profile.pattern != "" {
+		options = append(options, "pattern="+profile.pattern)
+	} else {
+		options = append(options, "len="+strconv.Itoa(profile.length))
+	}
+	options = append(options, "chars="+profile.classes)
+	if profile.required != "" {
+		options = append(options, "require="+profile.required)
+	}
+	if profile.symbols != "" {
+		options = append(options, "symbols="+profile.symbols)
+	}
+	if profile.exclude != "" {
+		options = append(options, "exclude="+profile.exclude)
+	}
+	if profile.noAmbiguous {
+		options = append(options, "no-ambiguous")
+	}
+	return strings.Join(options, " ")
+}
+
+// profileNames returns the names of all built-in and custom profiles, sorted.
+func profileNames(custom map[string]string) []string {
+	var names []string
+	for name := range builtinProfiles {
+		if _, overridden := custom[name]; !overridden {
+			names = append(names, name)
+		}
+	}
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
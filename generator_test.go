@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProfile(t *testing.T) {
+	profile, err := parseProfile("", nil)
+	require.NoError(t, err)
+	require.Equal(t, builtinProfiles[defaultProfile], profile.String())
+
+	profile, err = parseProfile("alnum len=24 no-ambiguous", nil)
+	require.NoError(t, err)
+	require.Equal(t, "len=24 chars=uld require=uld no-ambiguous", profile.String())
+
+	custom := map[string]string{"bank": "len=12 chars=ulds require=s symbols=!@#"}
+	profile, err = parseProfile("bank len=10", custom)
+	require.NoError(t, err)
+	require.Equal(t, "len=10 chars=ulds require=s symbols=!@#", profile.String())
+
+	invalid := []string{
+		"unknown",
+		"len=0",
+		"len=abc",
+		"chars=xyz",
+		"chars=d require=u",
+		"len=2 require=uld",
+		"chars=d exclude=0123456789",
+		"chars=d exclude=012345678",
+		"pattern=u{",
+		"pattern=\\",
+		"foo=bar",
+	}
+	for _, spec := range invalid {
+		_, err = parseProfile(spec, nil)
+		require.Error(t, err, "profile '%s' should be invalid", spec)
+	}
+}
+
+func TestGenerateWithProfile(t *testing.T) {
+	profile, err := parseProfile("len=40 chars=uds require=uds symbols=!@ exclude=ABC no-ambiguous", nil)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		password := profile.generate()
+		require.Len(t, password, 40)
+		require.True(t, strings.ContainsAny(password, upperChars))
+		require.True(t, strings.ContainsAny(password, digitChars))
+		require.True(t, strings.ContainsAny(password, "!@"))
+		require.False(t, strings.ContainsAny(password, lowerChars+"ABC#$%"+ambiguousChars), password)
+	}
+}
+
+func TestGenerateWithPattern(t *testing.T) {
+	profile, err := parseProfile(`pattern=u{3}-d{4}\d`, nil)
+	require.NoError(t, err)
+	require.InDelta(t, 3*4.70+4*3.32, profile.entropyBits(), 0.1)
+	for i := 0; i < 100; i++ {
+		password := profile.generate()
+		require.Len(t, password, 9)
+		require.True(t, strings.Trim(password[:3], upperChars) == "", password)
+		require.Equal(t, "-", password[3:4])
+		require.True(t, strings.Trim(password[4:8], digitChars) == "", password)
+		require.Equal(t, "d", password[8:])
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// rootGroup is the name of the group at the root of the group hierarchy, which always exists.
+const rootGroup = "default"
+
+// groupSeparator separates the names of nested groups in a group path, e.g. "work/aws/prod".
+const groupSeparator = "/"
+
+// splitGroupPath splits a full group path into the names of its groups.
+// The root group is represented by an empty slice.
+func splitGroupPath(path string) []string {
+	if path == rootGroup || len(path) == 0 {
+		return nil
+	}
+	return strings.Split(path, groupSeparator)
+}
+
+// joinGroupPath is the inverse of splitGroupPath.
+func joinGroupPath(names []string) string {
+	if len(names) == 0 {
+		return rootGroup
+	}
+	return strings.Join(names, groupSeparator)
+}
+
+// resolveGroupPath resolves a path, possibly relative to the current group, into a full group path.
+//
+// Paths starting with '/' or with the name of the root group are absolute.
+// The special names '.' and '..' refer to the current group and its parent, respectively.
+func resolveGroupPath(current, path string) string {
+	var names []string
+	switch {
+	case strings.HasPrefix(path, groupSeparator):
+		// absolute path
+	case path == rootGroup || strings.HasPrefix(path, rootGroup+groupSeparator):
+		path = path[len(rootGroup):]
+	default:
+		names = splitGroupPath(current)
+	}
+	for _, name := range strings.Split(path, groupSeparator) {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "", ".":
+			// nothing to do
+		case "..":
+			if len(names) > 0 {
+				names = names[:len(names)-1]
+			}
+		default:
+			names = append(names, name)
+		}
+	}
+	return joinGroupPath(names)
+}
+
+// parentGroup returns the full path of the parent of the given group.
+// The parent of the root group is the root group itself.
+func parentGroup(path string) string {
+	names := splitGroupPath(path)
+	if len(names) == 0 {
+		return rootGroup
+	}
+	return joinGroupPath(names[:len(names)-1])
+}
+
+// groupBaseName returns the name of the group without the names of its ancestors.
+func groupBaseName(path string) string {
+	names := splitGroupPath(path)
+	if len(names) == 0 {
+		return rootGroup
+	}
+	return names[len(names)-1]
+}
+
+// isSubgroupOf returns true if path is the same as ancestor or any of its descendants.
+func isSubgroupOf(path, ancestor string) bool {
+	if ancestor == rootGroup {
+		return true
+	}
+	return path == ancestor || strings.HasPrefix(path, ancestor+groupSeparator)
+}
+
+// relativeGroupPath returns the path of a group relative to the given ancestor group.
+func relativeGroupPath(path, ancestor string) string {
+	if ancestor == rootGroup {
+		return path
+	}
+	return strings.TrimPrefix(path[len(ancestor):], groupSeparator)
+}
+
+// entryPath returns the full path of an entry within a group, e.g. "work/aws/root".
+func entryPath(group, name string) string {
+	if group == rootGroup {
+		return name
+	}
+	return group + groupSeparator + name
+}
+
+// subgroups returns the full path of the given group and of all of its descendants, sorted.
+func (data *State) subgroups(path string) []string {
+	var result []string
+	for group := range *data {
+		if isSubgroupOf(group, path) {
+			result = append(result, group)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ensureGroup creates the group with the given full path, and all of its ancestors, if necessary.
+func (data *State) ensureGroup(path string) {
+	names := splitGroupPath(path)
+	for i := 0; i <= len(names); i++ {
+		group := joinGroupPath(names[:i])
+		if _, exists := (*data)[group]; !exists {
+			(*data)[group] = []LoginInfo{}
+		}
+	}
+}
+
+// parseEntryAddress parses the address of an entry, which is the entry name, optionally qualified by the path
+// of its group, e.g. "work/aws/root" or "/google".
+//
+// Quotes may be used around names containing '/' or spaces, e.g. 'work/"a/b"' is the entry "a/b" in the
+// group "work". A backslash escapes the next character.
+// The group path is empty if the address is not qualified.
+func parseEntryAddress(address string) (groupPath, name string, err error) {
+	var out []rune
+	var quote rune
+	lastSeparator := -1
+	escaped := false
+	for _, r := range strings.TrimSpace(address) {
+		switch {
+		case escaped:
+			out = append(out, r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				out = append(out, r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		default:
+			if string(r) == groupSeparator {
+				lastSeparator = len(out)
+			}
+			out = append(out, r)
+		}
+	}
+	if quote != 0 {
+		return "", "", errors.New("unterminated quote in " + address)
+	}
+	if lastSeparator < 0 {
+		return "", string(out), nil
+	}
+	groupPath = string(out[:lastSeparator])
+	if len(groupPath) == 0 {
+		groupPath = groupSeparator
+	}
+	return groupPath, string(out[lastSeparator+1:]), nil
+}
+
+// candidateGroups returns the full paths a group path may refer to: first relative to the current group,
+// then relative to the root group.
+func candidateGroups(current, groupPath string) []string {
+	relative := resolveGroupPath(current, groupPath)
+	absolute := resolveGroupPath(rootGroup, groupPath)
+	if relative == absolute {
+		return []string{relative}
+	}
+	return []string{relative, absolute}
+}
+
+// resolveEntry finds the entry with the given address, as described in parseEntryAddress.
+//
+// For compatibility with entries whose names contain '/', an entry of the current group whose name is exactly
+// the given address is always found first.
+func (data *State) resolveEntry(current, address string) (group string, index int, found bool) {
+	entries := (*data)[current]
+	if index, found = findEntryIndex(&entries, address); found {
+		return current, index, true
+	}
+	groupPath, name, err := parseEntryAddress(address)
+	if err != nil {
+		return "", -1, false
+	}
+	if len(groupPath) == 0 {
+		index, found = findEntryIndex(&entries, name)
+		return current, index, found
+	}
+	for _, group := range candidateGroups(current, groupPath) {
+		if entries, exists := (*data)[group]; exists {
+			if index, found = findEntryIndex(&entries, name); found {
+				return group, index, true
+			}
+		}
+	}
+	return "", -1, false
+}
+
+// resolveNewEntry resolves the group and name of an entry which may not exist yet.
+// An error is returned if the address is invalid or its group does not exist.
+func (data *State) resolveNewEntry(current, address string) (group, name string, err error) {
+	groupPath, name, err := parseEntryAddress(address)
+	if err != nil {
+		return "", "", err
+	}
+	if len(groupPath) == 0 {
+		return current, name, nil
+	}
+	candidates := candidateGroups(current, groupPath)
+	for _, group := range candidates {
+		if _, exists := (*data)[group]; exists {
+			return group, name, nil
+		}
+	}
+	return "", "", errors.New("group '" + candidates[0] + "' does not exist")
+}
+
+// entryAddress returns the shortest address of an entry which resolves to it from the current group.
+func entryAddress(current, group, name string) string {
+	name = quoteEntryName(name)
+	switch {
+	case group == current:
+		return name
+	case current == rootGroup:
+		return entryPath(group, name)
+	case isSubgroupOf(group, current):
+		return relativeGroupPath(group, current) + groupSeparator + name
+	default:
+		return groupSeparator + entryPath(group, name)
+	}
+}
+
+// quoteEntryName quotes an entry name if it contains characters that have a special meaning in addresses.
+func quoteEntryName(name string) string {
+	if !strings.ContainsAny(name, groupSeparator+" \t\"'\\") {
+		return name
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
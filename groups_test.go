@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveGroupPath(t *testing.T) {
+	type Ex struct {
+		current, path, expected string
+	}
+	examples := []Ex{
+		{"default", "work", "work"},
+		{"default", "work/aws/prod", "work/aws/prod"},
+		{"work", "aws", "work/aws"},
+		{"work/aws", "..", "work"},
+		{"work/aws", "../gcp", "work/gcp"},
+		{"work", "..", "default"},
+		{"default", "..", "default"},
+		{"work/aws", "/personal", "personal"},
+		{"work/aws", "/", "default"},
+		{"work/aws", "default", "default"},
+		{"work/aws", "default/personal", "personal"},
+		{"work", "./aws/", "work/aws"},
+	}
+	for _, ex := range examples {
+		require.Equal(t, ex.expected, resolveGroupPath(ex.current, ex.path),
+			"resolving '%s' from '%s'", ex.path, ex.current)
+	}
+}
+
+func TestGroupPathHelpers(t *testing.T) {
+	require.Equal(t, "work/aws", parentGroup("work/aws/prod"))
+	require.Equal(t, "default", parentGroup("work"))
+	require.Equal(t, "default", parentGroup("default"))
+	require.Equal(t, "prod", groupBaseName("work/aws/prod"))
+
+	require.True(t, isSubgroupOf("work/aws", "work"))
+	require.True(t, isSubgroupOf("work", "work"))
+	require.True(t, isSubgroupOf("work", "default"))
+	require.False(t, isSubgroupOf("workshop", "work"))
+
+	require.Equal(t, "aws/prod", relativeGroupPath("work/aws/prod", "work"))
+	require.Equal(t, "work/aws", relativeGroupPath("work/aws", "default"))
+}
+
+func TestSubgroupsAndEnsureGroup(t *testing.T) {
+	state := State{"default": []LoginInfo{}}
+	state.ensureGroup("work/aws/prod")
+	state.ensureGroup("workshop")
+
+	require.Equal(t, []string{"work", "work/aws", "work/aws/prod"}, state.subgroups("work"))
+	require.Equal(t, []string{"default", "work", "work/aws", "work/aws/prod", "workshop"}, state.subgroups("default"))
+}
+
+func TestParseEntryAddress(t *testing.T) {
+	for address, expected := range map[string][2]string{
+		"google":         {"", "google"},
+		" google ":       {"", "google"},
+		"work/github":    {"work", "github"},
+		"work/aws/root":  {"work/aws", "root"},
+		"/google":        {"/", "google"},
+		"../google":      {"..", "google"},
+		`"a/b"`:          {"", "a/b"},
+		`work/"my bank"`: {"work", "my bank"},
+		`work/'a/b'`:     {"work", "a/b"},
+		`work/a\/b`:      {"work", "a/b"},
+		`"say \"hi\""`:   {"", `say "hi"`},
+		`"work"/"a b/c"`: {"work", "a b/c"},
+	} {
+		groupPath, name, err := parseEntryAddress(address)
+		require.NoError(t, err)
+		require.Equal(t, expected, [2]string{groupPath, name}, "address: %s", address)
+	}
+	_, _, err := parseEntryAddress(`work/"unterminated`)
+	require.Error(t, err)
+}
+
+func TestResolveEntry(t *testing.T) {
+	state := State{
+		"default":  []LoginInfo{{Name: "google"}, {Name: "a/b"}},
+		"work":     []LoginInfo{{Name: "github"}, {Name: "my bank"}},
+		"work/aws": []LoginInfo{{Name: "root"}},
+		"aws":      []LoginInfo{{Name: "root"}},
+	}
+	type location struct {
+		group string
+		name  string
+	}
+	resolve := func(current, address string) *location {
+		group, index, found := state.resolveEntry(current, address)
+		if !found {
+			return nil
+		}
+		return &location{group, state[group][index].Name}
+	}
+
+	require.Equal(t, &location{"default", "google"}, resolve("default", "google"))
+	require.Equal(t, &location{"default", "a/b"}, resolve("default", "a/b"))
+	require.Equal(t, &location{"default", "a/b"}, resolve("default", `"a/b"`))
+	require.Equal(t, &location{"work", "github"}, resolve("default", "work/github"))
+	require.Equal(t, &location{"work", "my bank"}, resolve("default", `work/"my bank"`))
+	require.Equal(t, &location{"work", "my bank"}, resolve("work", "my bank"))
+	require.Equal(t, &location{"default", "google"}, resolve("work", "/google"))
+	require.Equal(t, &location{"default", "google"}, resolve("work", "../google"))
+
+	// relative paths are tried first, then absolute paths
+	require.Equal(t, &location{"work/aws", "root"}, resolve("work", "aws/root"))
+	require.Equal(t, &location{"aws", "root"}, resolve("default", "aws/root"))
+	require.Equal(t, &location{"aws", "root"}, resolve("work", "/aws/root"))
+	require.Equal(t, &location{"work", "github"}, resolve("work/aws", "work/github"))
+
+	require.Nil(t, resolve("work", "google"))
+	require.Nil(t, resolve("default", "nothing/google"))
+	require.Nil(t, resolve("default", "work/nothing"))
+}
+
+func TestResolveNewEntry(t *testing.T) {
+	state := State{"default": nil, "work": nil, "work/aws": nil}
+
+	group, name, err := state.resolveNewEntry("default", "work/aws/new")
+	require.NoError(t, err)
+	require.Equal(t, []string{"work/aws", "new"}, []string{group, name})
+
+	group, name, err = state.resolveNewEntry("work/aws", "new")
+	require.NoError(t, err)
+	require.Equal(t, []string{"work/aws", "new"}, []string{group, name})
+
+	_, _, err = state.resolveNewEntry("default", "nothing/new")
+	require.Error(t, err)
+}
+
+func TestEntryAddress(t *testing.T) {
+	require.Equal(t, "google", entryAddress("default", "default", "google"))
+	require.Equal(t, "work/aws/root", entryAddress("default", "work/aws", "root"))
+	require.Equal(t, "aws/root", entryAddress("work", "work/aws", "root"))
+	require.Equal(t, "/google", entryAddress("work", "default", "google"))
+	require.Equal(t, "/other/x", entryAddress("work", "other", "x"))
+	require.Equal(t, `work/"my bank"`, entryAddress("default", "work", "my bank"))
+	require.Equal(t, `"a/\"b\""`, entryAddress("default", "default", `a/"b"`))
+
+	// addresses always resolve to the entry
+	state := State{"default": []LoginInfo{{Name: `a/"b"`}}, "work": []LoginInfo{{Name: "my bank"}}}
+	group, _, found := state.resolveEntry("work", entryAddress("work", "default", `a/"b"`))
+	require.True(t, found)
+	require.Equal(t, "default", group)
+}
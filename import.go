@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// importedEntry an entry read from another password manager.
+type importedEntry struct {
+	// groups the names of the nested groups of the entry, relative to the group it is imported into.
+	groups []string
+	entry  LoginInfo
+}
+
+// importResult the entries read from another password manager, and anything which could not be imported.
+type importResult struct {
+	entries  []importedEntry
+	warnings []string
+	// plaintext whether the imported file holds passwords unencrypted, so the user should delete it.
+	plaintext bool
+}
+
+func (result *importResult) warn(format string, args ...interface{}) {
+	result.warnings = append(result.warnings, fmt.Sprintf(format, args...))
+}
+
+// importFormat a format which can be imported into go-hash.
+type importFormat struct {
+	description string
+	// usage describes the options of the format.
+	usage string
+	// options adds the options of the format to the flag set, and returns the function which reads a file
+	// using them. The reader may be used to ask the user for passwords.
+	options func(fs *flag.FlagSet) func(path string, reader *bufio.Reader) (importResult, error)
+}
+
+// importFormats the formats which can be imported, by name.
+var importFormats = map[string]importFormat{
+	"chromium": {"Logins saved by Chromium-based browsers on Linux", chromiumImportUsage, chromiumImportOptions},
+	"csv":      {"CSV exports of browsers and password managers", csvImportUsage, csvImportOptions},
+	"firefox":  {"Logins saved in a Firefox profile", firefoxImportUsage, firefoxImportOptions},
+	"kdbx":     {"KeePass 2 database (KDBX 3.1 and 4)", kdbxImportUsage, kdbxImportOptions},
+	"pass":     {"Password store of pass, the standard Unix password manager", passImportUsage, passImportOptions},
+	"psafe3":   {"Password Safe database (PWS3)", psafe3ImportUsage, psafe3ImportOptions},
+}
+
+// importFormatNames returns the names of the formats which can be imported, sorted.
+func importFormatNames() []string {
+	names := make([]string, 0, len(importFormats))
+	for name := range importFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// importGroupName turns the name of a group of another password manager into a valid go-hash group name.
+//
+// Groups named like the root group are renamed, as paths starting with its name refer to the root group itself.
+func importGroupName(name string) string {
+	name = strings.TrimSpace(strings.Replace(name, groupSeparator, "-", -1))
+	switch name {
+	case "", ".", "..":
+		return "unnamed"
+	case rootGroup:
+		return rootGroup + "-imported"
+	}
+	return name
+}
+
+// importHostName returns the host of a URL, without the www prefix, or the URL itself if it has no host.
+func importHostName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && len(u.Hostname()) > 0 {
+		return strings.TrimPrefix(u.Hostname(), "www.")
+	}
+	return rawURL
+}
+
+// addImportedEntries adds imported entries to the State, within the given group.
+//
+// Groups are created as necessary. Entries which duplicate an existing entry of their group are skipped, and
+// entries whose names are already used within their group are renamed.
+// Returns the paths of the entries added, and a warning for each skipped or renamed entry.
+func addImportedEntries(state *State, group string, entries []importedEntry, now time.Time) ([]string, []string) {
+	var added, warnings []string
+	// the entries imported so far in each group, before they were renamed
+	previous := make(map[string][]LoginInfo)
+	for _, imported := range entries {
+		names := splitGroupPath(group)
+		for _, g := range imported.groups {
+			names = append(names, importGroupName(g))
+		}
+		path := joinGroupPath(names)
+
+		entry := imported.entry
+		entry.Name = strings.TrimSpace(entry.Name)
+		if len(entry.Name) == 0 {
+			entry.Name = "untitled"
+		}
+		if existing, found := findDuplicateEntry((*state)[path], &entry); found {
+			warnings = append(warnings, fmt.Sprintf("%s: skipped as it duplicates '%s'",
+				entryPath(path, entry.Name), existing))
+			continue
+		}
+		if _, found := findDuplicateEntry(previous[path], &entry); found {
+			warnings = append(warnings, fmt.Sprintf("%s: skipped as it duplicates another imported entry",
+				entryPath(path, entry.Name)))
+			continue
+		}
+		previous[path] = append(previous[path], entry)
+		state.ensureGroup(path)
+		if name := uniqueEntryName((*state)[path], entry.Name); name != entry.Name {
+			warnings = append(warnings, fmt.Sprintf("%s: renamed to '%s' as the name is already used",
+				entryPath(path, entry.Name), name))
+			entry.Name = name
+		}
+		if entry.UpdatedAt.IsZero() {
+			entry.UpdatedAt = now
+		}
+		if entry.PasswordUpdatedAt.IsZero() {
+			entry.PasswordUpdatedAt = entry.UpdatedAt
+		}
+		(*state)[path] = append((*state)[path], entry)
+		added = append(added, entryPath(path, entry.Name))
+	}
+	return added, warnings
+}
+
+// findDuplicateEntry returns the name of the entry which has the same username and password as the given
+// entry, and either the same name or the same URL.
+func findDuplicateEntry(entries []LoginInfo, entry *LoginInfo) (string, bool) {
+	for _, e := range entries {
+		if e.Username == entry.Username && e.Password == entry.Password &&
+			(e.Name == entry.Name || len(e.URL) > 0 && e.URL == entry.URL) {
+			return e.Name, true
+		}
+	}
+	return "", false
+}
+
+// uniqueEntryName returns the given name if no entry uses it, or the name followed by a number otherwise.
+func uniqueEntryName(entries []LoginInfo, name string) string {
+	used := func(n string) bool {
+		for _, e := range entries {
+			if e.Name == n {
+				return true
+			}
+		}
+		return false
+	}
+	unique := name
+	for i := 2; used(unique); i++ {
+		unique = fmt.Sprintf("%s (%d)", name, i)
+	}
+	return unique
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/renatoathaydes/go-hash/browser"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func firefoxImportOptions(fs *flag.FlagSet) func(path string, reader *bufio.Reader) (importResult, error) {
+	return func(path string, reader *bufio.Reader) (importResult, error) {
+		profile, err := browser.OpenFirefoxProfile(path)
+		if err != nil {
+			return importResult{}, err
+		}
+		return firefoxImportResult(profile, func() ([]byte, error) {
+			print("Firefox primary password: ")
+			pass, err := terminal.ReadPassword(int(syscall.Stdin))
+			println("")
+			return pass, err
+		})
+	}
+}
+
+// firefoxImportResult decrypts the logins of a Firefox profile, asking for its primary password if it has one.
+func firefoxImportResult(profile *browser.FirefoxProfile,
+	askPrimaryPassword func() ([]byte, error)) (importResult, error) {
+	logins, err := profile.Logins("")
+	if err == browser.ErrInvalidPassword {
+		var pass []byte
+		if pass, err = askPrimaryPassword(); err != nil {
+			return importResult{}, err
+		}
+		println("Decrypting the Firefox logins...")
+		logins, err = profile.Logins(string(pass))
+	}
+	if err != nil {
+		return importResult{}, err
+	}
+	return browserImportResult(logins), nil
+}
+
+func chromiumImportOptions(fs *flag.FlagSet) func(path string, reader *bufio.Reader) (importResult, error) {
+	askKeyringSecret := fs.Bool("k", false, "ask for the secret of the desktop keyring")
+	return func(path string, reader *bufio.Reader) (importResult, error) {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, "Login Data")
+		}
+		var secret string
+		if *askKeyringSecret {
+			print("Keyring secret: ")
+			pass, err := terminal.ReadPassword(int(syscall.Stdin))
+			println("")
+			if err != nil {
+				return importResult{}, err
+			}
+			secret = string(pass)
+		}
+		logins, skipped, err := browser.ChromiumLogins(path, secret)
+		if err != nil {
+			return importResult{}, err
+		}
+		result := browserImportResult(logins)
+		if skipped > 0 {
+			result.warn("%d logins encrypted with a key stored in the desktop keyring were not imported, "+
+				"use -k to give the secret of the keyring", skipped)
+		}
+		return result, nil
+	}
+}
+
+// browserImportResult maps the logins saved by a browser into go-hash entries, grouped by the domain of their
+// site, and named after their username.
+func browserImportResult(logins []browser.Login) importResult {
+	var result importResult
+	for _, l := range logins {
+		domain := importHostName(l.URL)
+		entry := LoginInfo{
+			Name:              l.Username,
+			Username:          l.Username,
+			Password:          l.Password,
+			URL:               l.URL,
+			UpdatedAt:         l.PasswordChanged,
+			PasswordUpdatedAt: l.PasswordChanged,
+		}
+		if len(entry.Name) == 0 {
+			entry.Name = domain
+		}
+		if entry.UpdatedAt.IsZero() {
+			entry.UpdatedAt, entry.PasswordUpdatedAt = l.Created, l.Created
+		}
+		if len(l.Realm) > 0 {
+			entry.Description = "HTTP authentication realm: " + l.Realm
+		}
+		result.entries = append(result.entries, importedEntry{groups: []string{domain}, entry: entry})
+	}
+	return result
+}
+
+const firefoxImportUsage = `    The file is the directory of the Firefox profile, e.g. ~/.mozilla/firefox/abcd1234.default-release.
+    The primary password of the profile is asked for if it has one. Please close Firefox first.
+    Logins are grouped by the domain of their site, and named after their username.
+`
+
+const chromiumImportUsage = `    -k  ask for the secret of the desktop keyring.
+
+    The file is the 'Login Data' database, or the directory of the browser profile containing it, e.g.
+    ~/.config/chromium/Default or ~/.config/google-chrome/Default. Please close the browser first.
+    Passwords encrypted with Chromium's fallback key, used when no desktop keyring is available, are always
+    imported. Passwords protected by the desktop keyring are imported only if its secret is given with -k,
+    which can be found with 'secret-tool lookup application chromium' (or 'chrome' for Google Chrome).
+    Logins are grouped by the domain of their site, and named after their username.
+`
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvFields the go-hash fields which columns of a CSV file can be mapped to.
+var csvFields = []string{"name", "username", "password", "url", "notes", "group", "tags", "modified"}
+
+// csvRow a row of a CSV file.
+type csvRow struct {
+	// number the number of the row, the header being row 0.
+	number int
+	// columns the index of each column, by lower-case name.
+	columns map[string]int
+	values  []string
+}
+
+// get returns the value of the column with the given name, or the empty string if there is no such column.
+func (row csvRow) get(column string) string {
+	if i, ok := row.columns[strings.ToLower(column)]; ok && i < len(row.values) {
+		return row.values[i]
+	}
+	return ""
+}
+
+// csvMapping maps the columns of a CSV file to the fields of go-hash entries.
+type csvMapping struct {
+	// columns the name of the column of each field.
+	columns map[string]string
+	// groupSeparator the separator of nested group names in the group column.
+	groupSeparator string
+}
+
+// entry creates an entry from the mapped columns of a row.
+func (mapping csvMapping) entry(row csvRow) importedEntry {
+	get := func(field string) string {
+		if column, ok := mapping.columns[field]; ok {
+			return row.get(column)
+		}
+		return ""
+	}
+	entry := LoginInfo{
+		Name:        strings.TrimSpace(get("name")),
+		Username:    get("username"),
+		Password:    get("password"),
+		URL:         strings.TrimSpace(get("url")),
+		Description: strings.TrimSpace(get("notes")),
+	}
+	if len(entry.Name) == 0 {
+		entry.Name = importHostName(entry.URL)
+	}
+	for _, tag := range strings.FieldsFunc(get("tags"), func(r rune) bool {
+		return r == ',' || r == ';'
+	}) {
+		entry.addTags([]string{strings.Join(strings.Fields(tag), "-")})
+	}
+	entry.UpdatedAt = parseCSVTime(get("modified"))
+	entry.PasswordUpdatedAt = entry.UpdatedAt
+
+	var groups []string
+	if group := get("group"); len(group) > 0 {
+		for _, g := range strings.Split(group, mapping.groupSeparator) {
+			if g = strings.TrimSpace(g); len(g) > 0 {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return importedEntry{groups: groups, entry: entry}
+}
+
+// parseCSVMapping parses a manual column mapping, e.g. 'name=Title,password=Secret'.
+func parseCSVMapping(value string) (csvMapping, error) {
+	mapping := csvMapping{columns: make(map[string]string), groupSeparator: groupSeparator}
+	for _, part := range strings.Split(value, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		field := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) != 2 || len(strings.TrimSpace(kv[1])) == 0 {
+			return csvMapping{}, fmt.Errorf("invalid column mapping '%s', expected <field>=<column>", part)
+		}
+		known := false
+		for _, f := range csvFields {
+			known = known || f == field
+		}
+		if !known {
+			return csvMapping{}, fmt.Errorf("unknown field '%s' in the column mapping, fields are: %s",
+				field, strings.Join(csvFields, ", "))
+		}
+		mapping.columns[field] = strings.TrimSpace(kv[1])
+	}
+	return mapping, nil
+}
+
+// csvPreset the CSV export format of a password manager or browser.
+type csvPreset struct {
+	description string
+	// columns the columns which identify the format, all of which appear in the header of its files.
+	columns []string
+	mapping csvMapping
+	// header the columns of the files exported in this format, in order.
+	header []string
+	// defaults the values of the columns which are not mapped to a field, in exported files.
+	defaults map[string]string
+	// timeInMillis whether times are written as milliseconds since the Unix epoch in exported files.
+	timeInMillis bool
+	// convert adjusts the entry mapped from a row, if necessary. Returns false if the row must not be imported.
+	convert func(row csvRow, imported *importedEntry, result *importResult) bool
+}
+
+// defaultCSVPreset the preset files are exported with by default.
+const defaultCSVPreset = "go-hash"
+
+// csvPresets the known CSV export formats, by name.
+var csvPresets = map[string]csvPreset{
+	"go-hash": {
+		description: "go-hash",
+		columns:     []string{"group", "name", "username", "password", "url", "notes", "tags", "modified"},
+		mapping: csvMapping{columns: map[string]string{
+			"group": "group", "name": "name", "username": "username", "password": "password", "url": "url",
+			"notes": "notes", "tags": "tags", "modified": "modified",
+		}, groupSeparator: groupSeparator},
+		header: []string{"group", "name", "username", "password", "url", "notes", "tags", "modified"},
+	},
+	"chrome": {
+		description: "Chrome",
+		columns:     []string{"name", "url", "username", "password"},
+		mapping: csvMapping{columns: map[string]string{
+			"name": "name", "url": "url", "username": "username", "password": "password", "notes": "note",
+		}},
+		header: []string{"name", "url", "username", "password", "note"},
+	},
+	"firefox": {
+		description: "Firefox",
+		columns:     []string{"url", "username", "password", "httpRealm", "timePasswordChanged"},
+		mapping: csvMapping{columns: map[string]string{
+			"url": "url", "username": "username", "password": "password", "modified": "timePasswordChanged",
+		}},
+		header: []string{"url", "username", "password", "httpRealm", "formActionOrigin", "guid", "timeCreated",
+			"timeLastUsed", "timePasswordChanged"},
+		timeInMillis: true,
+	},
+	"bitwarden": {
+		description: "Bitwarden",
+		columns:     []string{"folder", "type", "name", "notes", "login_uri", "login_username", "login_password"},
+		mapping: csvMapping{columns: map[string]string{
+			"name": "name", "notes": "notes", "group": "folder", "url": "login_uri",
+			"username": "login_username", "password": "login_password",
+		}, groupSeparator: "/"},
+		header: []string{"folder", "favorite", "type", "name", "notes", "fields", "reprompt", "login_uri",
+			"login_username", "login_password", "login_totp"},
+		defaults: map[string]string{"type": "login", "reprompt": "0"},
+		convert:  convertBitwardenRow,
+	},
+	"lastpass": {
+		description: "LastPass",
+		columns:     []string{"url", "username", "password", "extra", "name", "grouping"},
+		mapping: csvMapping{columns: map[string]string{
+			"url": "url", "username": "username", "password": "password", "notes": "extra", "name": "name",
+			"group": "grouping",
+		}, groupSeparator: "\\"},
+		header:   []string{"url", "username", "password", "totp", "extra", "name", "grouping", "fav"},
+		defaults: map[string]string{"fav": "0"},
+		convert:  convertLastPassRow,
+	},
+	"1password": {
+		description: "1Password",
+		columns:     []string{"title", "url", "username", "password", "otpauth", "notes"},
+		mapping: csvMapping{columns: map[string]string{
+			"name": "title", "url": "url", "username": "username", "password": "password", "notes": "notes",
+			"tags": "tags",
+		}},
+		header: []string{"Title", "Url", "Username", "Password", "OTPAuth", "Favorite", "Archived", "Tags",
+			"Notes"},
+		defaults: map[string]string{"Favorite": "false", "Archived": "false"},
+		convert:  convert1PasswordRow,
+	},
+}
+
+// csvPresetNames returns the names of the CSV presets, sorted.
+func csvPresetNames() []string {
+	names := make([]string, 0, len(csvPresets))
+	for name := range csvPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// detectCSVPreset returns the name of the preset whose columns all appear in the header. If more than one
+// does, the most specific one, which has the most columns, is chosen.
+func detectCSVPreset(columns map[string]int) (string, bool) {
+	detected := ""
+	for _, name := range csvPresetNames() {
+		preset := csvPresets[name]
+		matches := true
+		for _, c := range preset.columns {
+			if _, ok := columns[strings.ToLower(c)]; !ok {
+				matches = false
+				break
+			}
+		}
+		if matches && (len(detected) == 0 || len(preset.columns) > len(csvPresets[detected].columns)) {
+			detected = name
+		}
+	}
+	return detected, len(detected) > 0
+}
+
+func convertBitwardenRow(row csvRow, imported *importedEntry, result *importResult) bool {
+	entry := &imported.entry
+	var extra []string
+	// login_uri holds all URLs of the entry, separated by commas
+	if urls := strings.Split(entry.URL, ","); len(urls) > 1 {
+		entry.URL = strings.TrimSpace(urls[0])
+		for _, u := range urls[1:] {
+			if u = strings.TrimSpace(u); len(u) > 0 {
+				extra = append(extra, "URL: "+u)
+			}
+		}
+	}
+	if fields := strings.TrimSpace(row.get("fields")); len(fields) > 0 {
+		extra = append(extra, fields)
+	}
+	appendDescription(entry, extra)
+	if len(row.get("login_totp")) > 0 {
+		result.warn("%s: the TOTP secret was not imported", entryPath(joinGroupPath(imported.groups), entry.Name))
+	}
+	return true
+}
+
+func convertLastPassRow(row csvRow, imported *importedEntry, result *importResult) bool {
+	entry := &imported.entry
+	// secure notes have this fake URL
+	if entry.URL == "http://sn" {
+		entry.URL = ""
+	}
+	if len(row.get("totp")) > 0 {
+		result.warn("%s: the TOTP secret was not imported", entryPath(joinGroupPath(imported.groups), entry.Name))
+	}
+	return true
+}
+
+func convert1PasswordRow(row csvRow, imported *importedEntry, result *importResult) bool {
+	path := entryPath(joinGroupPath(imported.groups), imported.entry.Name)
+	if strings.EqualFold(row.get("archived"), "true") {
+		result.warn("%s: archived item was not imported", path)
+		return false
+	}
+	if len(row.get("otpauth")) > 0 {
+		result.warn("%s: the TOTP secret was not imported", path)
+	}
+	return true
+}
+
+// appendDescription appends lines to the description of an entry.
+func appendDescription(entry *LoginInfo, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	if len(entry.Description) > 0 {
+		lines = append([]string{entry.Description}, lines...)
+	}
+	entry.Description = strings.Join(lines, "\n")
+}
+
+// parseCSVTime parses a time, given as seconds or milliseconds since the Unix epoch, or as a date.
+// Returns the zero time if it cannot be parsed.
+func parseCSVTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+		// times after 1973 in milliseconds are greater than any time in seconds before the year 5000
+		if n > 1e11 {
+			return time.Unix(n/1000, n%1000*int64(time.Millisecond)).UTC()
+		}
+		return time.Unix(n, 0).UTC()
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func csvImportOptions(fs *flag.FlagSet) func(path string, reader *bufio.Reader) (importResult, error) {
+	preset := fs.String("p", "", "the application which exported the file")
+	mapping := fs.String("m", "", "the mapping of columns to fields")
+	return func(path string, reader *bufio.Reader) (importResult, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return importResult{}, err
+		}
+		defer file.Close()
+		return csvImportResult(file, *preset, *mapping)
+	}
+}
+
+// csvImportResult reads the entries of a CSV file, whose first row is the header, using either the given preset,
+// the given manual mapping, or the preset detected from the header if neither is given.
+func csvImportResult(r io.Reader, presetName, manualMapping string) (importResult, error) {
+	if len(presetName) > 0 && len(manualMapping) > 0 {
+		return importResult{}, errors.New("a preset and a column mapping cannot be used together")
+	}
+	buffered := bufio.NewReader(r)
+	// Excel and some password managers start files with a byte order mark
+	if bom, err := buffered.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		buffered.Discard(3)
+	}
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return importResult{}, errors.New("the file is empty")
+	}
+	if err != nil {
+		return importResult{}, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, c := range header {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if _, duplicate := columns[c]; !duplicate {
+			columns[c] = i
+		}
+	}
+
+	var preset csvPreset
+	switch {
+	case len(manualMapping) > 0:
+		if preset.mapping, err = parseCSVMapping(manualMapping); err != nil {
+			return importResult{}, err
+		}
+		for _, column := range preset.mapping.columns {
+			if _, ok := columns[strings.ToLower(column)]; !ok {
+				return importResult{}, fmt.Errorf("column '%s' not found in the header of the file", column)
+			}
+		}
+	case len(presetName) > 0:
+		var ok bool
+		if preset, ok = csvPresets[strings.ToLower(presetName)]; !ok {
+			return importResult{}, fmt.Errorf("unknown preset '%s', presets are: %s",
+				presetName, strings.Join(csvPresetNames(), ", "))
+		}
+	default:
+		name, ok := detectCSVPreset(columns)
+		if !ok {
+			return importResult{}, errors.New("unable to recognize the CSV format, " +
+				"please give a preset with -p or map the columns with -m")
+		}
+		preset = csvPresets[name]
+		println("Reading a " + preset.description + " export.")
+	}
+
+	result := importResult{plaintext: true}
+	for number := 1; ; number++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return importResult{}, err
+		}
+		if len(strings.TrimSpace(strings.Join(values, ""))) == 0 {
+			continue
+		}
+		row := csvRow{number: number, columns: columns, values: values}
+		imported := preset.mapping.entry(row)
+		if preset.convert != nil && !preset.convert(row, &imported, &result) {
+			continue
+		}
+		e := &imported.entry
+		if len(e.Name) == 0 && len(e.Username) == 0 && len(e.Password) == 0 && len(e.Description) == 0 {
+			result.warn("row %d: skipped as it has no name, username, password or notes", row.number)
+			continue
+		}
+		result.entries = append(result.entries, imported)
+	}
+	return result, nil
+}
+
+const csvImportUsage = `    -p <preset>   the application which exported the file: chrome, firefox, bitwarden, lastpass, 1password
+                  or go-hash. It is detected from the header of the file if not given.
+    -m <mapping>  maps the columns of files exported by other applications to go-hash fields, e.g.
+                  -m "name=Title,username=Login,password=Secret,url=Address,group=Folder"
+                  Fields: name, username, password, url, notes, group, tags, modified.
+
+    The first row of the file must be the header with the names of the columns. Entries without a name are
+    named after the host of their URL. Groups given with -m use '/' between nested groups. Columns which are
+    not mapped, TOTP secrets and archived 1Password items are not imported.
+    The file holds your passwords in plain text: delete it securely once it is imported.
+`
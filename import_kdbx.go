@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/renatoathaydes/go-hash/kdbx"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func kdbxImportOptions(fs *flag.FlagSet) func(path string, reader *bufio.Reader) (importResult, error) {
+	keyFile := fs.String("k", "", "the KeePass key file")
+	return func(path string, reader *bufio.Reader) (importResult, error) {
+		var credentials kdbx.Credentials
+		if len(*keyFile) > 0 {
+			keyPath, err := homedir.Expand(*keyFile)
+			if err != nil {
+				return importResult{}, err
+			}
+			if credentials.KeyFile, err = ioutil.ReadFile(keyPath); err != nil {
+				return importResult{}, err
+			}
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return importResult{}, err
+		}
+		defer file.Close()
+
+		print("KeePass password: ")
+		pass, err := terminal.ReadPassword(int(syscall.Stdin))
+		println("")
+		if err != nil {
+			return importResult{}, err
+		}
+		credentials.Password = string(pass)
+		if len(credentials.Password) == 0 && len(credentials.KeyFile) == 0 {
+			println("No password was entered, trying an empty password.")
+		}
+		println("Decrypting the KeePass database...")
+		db, err := kdbx.Decode(file, credentials)
+		if err != nil {
+			return importResult{}, err
+		}
+		return kdbxImportResult(db), nil
+	}
+}
+
+// kdbxImportResult maps the groups and entries of a KeePass database into go-hash groups and entries.
+//
+// The entries of the KeePass root group are imported into the group the database is imported into, and
+// the other KeePass groups become its subgroups. Custom fields are appended to the description, unless they
+// are protected. Protected custom fields, attachments and history cannot be imported.
+func kdbxImportResult(db *kdbx.Database) importResult {
+	var result importResult
+	var withHistory int
+	var importGroup func(g kdbx.Group, groups []string)
+	importGroup = func(g kdbx.Group, groups []string) {
+		for i := range g.Entries {
+			e := &g.Entries[i]
+			entry := LoginInfo{
+				Name:              e.Get(kdbx.FieldTitle),
+				Username:          e.Get(kdbx.FieldUserName),
+				Password:          e.Get(kdbx.FieldPassword),
+				URL:               e.Get(kdbx.FieldURL),
+				Description:       e.Get(kdbx.FieldNotes),
+				UpdatedAt:         e.Modified,
+				PasswordUpdatedAt: e.Modified,
+				Tags:              e.Tags,
+			}
+			entry.Expiry.At = e.Expires
+			path := entryPath(joinGroupPath(groups), entry.Name)
+			var custom []string
+			for _, f := range e.Fields {
+				switch {
+				case kdbx.IsStandardField(f.Key):
+				case f.Protected:
+					result.warn("%s: protected field '%s' was not imported", path, f.Key)
+				default:
+					custom = append(custom, f.Key+": "+f.Value)
+				}
+			}
+			if len(custom) > 0 {
+				if len(entry.Description) > 0 {
+					custom = append([]string{entry.Description}, custom...)
+				}
+				entry.Description = strings.Join(custom, "\n")
+			}
+			for _, a := range e.Attachments {
+				result.warn("%s: attachment '%s' was not imported", path, a)
+			}
+			if e.HistorySize > 0 {
+				withHistory++
+			}
+			result.entries = append(result.entries, importedEntry{groups: groups, entry: entry})
+		}
+		for _, sub := range g.Groups {
+			if len(db.RecycleBin) > 0 && sub.UUID == db.RecycleBin {
+				if n := countKdbxEntries(sub); n > 0 {
+					result.warn("%d entries in the recycle bin were not imported", n)
+				}
+				continue
+			}
+			importGroup(sub, append(append([]string{}, groups...), sub.Name))
+		}
+	}
+	importGroup(db.Root, nil)
+	if withHistory > 0 {
+		result.warn("the history of previous versions of %d entries was not imported", withHistory)
+	}
+	return result
+}
+
+func countKdbxEntries(g kdbx.Group) int {
+	n := len(g.Entries)
+	for _, sub := range g.Groups {
+		n += countKdbxEntries(sub)
+	}
+	return n
+}
+
+const kdbxImportUsage = `    -k <file>  the key file, if the database requires one.
+
+    KeePass groups become subgroups of the group the database is imported into. Custom fields are added
+    to the description of entries, unless they are protected. Protected fields, attachments and the history
+    of entries are not imported.
+`
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func passImportOptions(fs *flag.FlagSet) func(path string, reader *bufio.Reader) (importResult, error) {
+	keyFile := fs.String("k", "", "the OpenPGP private key")
+	return func(path string, reader *bufio.Reader) (importResult, error) {
+		if len(*keyFile) == 0 {
+			return importResult{}, errors.New("please give the OpenPGP private key of the password store with -k")
+		}
+		keyPath, err := homedir.Expand(*keyFile)
+		if err != nil {
+			return importResult{}, err
+		}
+		keyring, err := readPrivateKeys(keyPath)
+		if err != nil {
+			return importResult{}, err
+		}
+		if err = decryptPrivateKeys(keyring); err != nil {
+			return importResult{}, err
+		}
+		return passImportResult(path, keyring)
+	}
+}
+
+// readPrivateKeys reads the OpenPGP keys of a file, armored or not, which must include private keys.
+func readPrivateKeys(path string) (openpgp.EntityList, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keyring openpgp.EntityList
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("-----BEGIN")) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(content))
+	}
+	if _, unsupported := err.(pgperrors.UnsupportedError); unsupported {
+		return nil, fmt.Errorf("%s (only RSA and ElGamal keys are supported)", err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(keyring.DecryptionKeys()) == 0 {
+		return nil, errors.New("the key file has no private key, " +
+			"export it with 'gpg --export-secret-keys --armor <key-id>'")
+	}
+	return keyring, nil
+}
+
+// decryptPrivateKeys decrypts the private keys protected by a passphrase, asking the user for it.
+func decryptPrivateKeys(keyring openpgp.EntityList) error {
+	var passphrase []byte
+	asked := false
+	for _, key := range keyring.DecryptionKeys() {
+		if !key.PrivateKey.Encrypted {
+			continue
+		}
+		if !asked {
+			print("Passphrase of the OpenPGP key: ")
+			pass, err := terminal.ReadPassword(int(syscall.Stdin))
+			println("")
+			if err != nil {
+				return err
+			}
+			passphrase, asked = pass, true
+		}
+		if err := key.PrivateKey.Decrypt(passphrase); err != nil {
+			return errors.New("invalid passphrase for the OpenPGP key")
+		}
+	}
+	return nil
+}
+
+// passImportResult decrypts the entries of a password store, whose directories become groups.
+//
+// The first line of each entry is its password. Lines formatted as 'key: value' are fields, of which login,
+// username, user, url and website are mapped to the username and URL of entries, and the other ones are added
+// to the description with the remaining lines.
+func passImportResult(root string, keyring openpgp.EntityList) (importResult, error) {
+	var result importResult
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && path != root {
+			// the git repository and extensions of pass
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".gpg") {
+			return nil
+		}
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		groups := strings.Split(filepath.ToSlash(filepath.Dir(relative)), "/")
+		if groups[0] == "." {
+			groups = nil
+		}
+		name := strings.TrimSuffix(info.Name(), ".gpg")
+		address := entryPath(joinGroupPath(groups), name)
+
+		content, err := decryptPassEntry(path, keyring)
+		if err != nil {
+			result.warn("%s: unable to decrypt: %s", address, err.Error())
+			return nil
+		}
+		entry, hasOTP := parsePassEntry(content)
+		entry.Name = name
+		entry.UpdatedAt = info.ModTime().UTC()
+		if hasOTP {
+			result.warn("%s: the one-time password (otpauth) URL was not imported", address)
+		}
+		result.entries = append(result.entries, importedEntry{groups: groups, entry: entry})
+		return nil
+	})
+	return result, err
+}
+
+func decryptPassEntry(path string, keyring openpgp.EntityList) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	message, err := openpgp.ReadMessage(file, keyring, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	// reading the whole body checks its integrity
+	content, err := ioutil.ReadAll(message.UnverifiedBody)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// parsePassEntry parses the decrypted content of a pass entry. Returns whether it has an otpauth URL, which is
+// not imported.
+func parsePassEntry(content string) (LoginInfo, bool) {
+	lines := strings.Split(strings.Replace(content, "\r\n", "\n", -1), "\n")
+	entry := LoginInfo{Password: lines[0]}
+	var description []string
+	hasOTP := false
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(strings.TrimSpace(line), "otpauth://") {
+			hasOTP = true
+			continue
+		}
+		if kv := strings.SplitN(line, ":", 2); len(kv) == 2 && !strings.ContainsAny(kv[0], " \t") {
+			value := strings.TrimSpace(kv[1])
+			switch strings.ToLower(kv[0]) {
+			case "login", "username", "user":
+				if len(entry.Username) == 0 {
+					entry.Username = value
+					continue
+				}
+			case "url", "website":
+				if len(entry.URL) == 0 {
+					entry.URL = value
+					continue
+				}
+			}
+		}
+		description = append(description, line)
+	}
+	entry.Description = strings.TrimSpace(strings.Join(description, "\n"))
+	return entry, hasOTP
+}
+
+const passImportUsage = `    -k <file>  the OpenPGP private key of the password store, exported with
+               'gpg --export-secret-keys --armor <key-id> > key.asc'. Its passphrase is asked for.
+
+    The file is the directory of the password store, usually ~/.password-store. Its directories become groups.
+    The first line of each entry is its password. The login, username, user, url and website fields
+    ('key: value' lines) become the username and URL of entries, and other lines are added to their description.
+    Only RSA and ElGamal keys are supported, not the elliptic-curve keys created by default by GnuPG 2.3 and later.
+`
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/renatoathaydes/go-hash/psafe3"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func psafe3ImportOptions(fs *flag.FlagSet) func(path string, reader *bufio.Reader) (importResult, error) {
+	return func(path string, reader *bufio.Reader) (importResult, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return importResult{}, err
+		}
+		defer file.Close()
+
+		print("Password Safe passphrase: ")
+		pass, err := terminal.ReadPassword(int(syscall.Stdin))
+		println("")
+		if err != nil {
+			return importResult{}, err
+		}
+		println("Decrypting the Password Safe database...")
+		records, err := psafe3.Decode(file, string(pass))
+		if err != nil {
+			return importResult{}, err
+		}
+		return psafe3ImportResult(records), nil
+	}
+}
+
+// psafe3ImportResult maps the records of a Password Safe database into go-hash groups and entries.
+//
+// Password Safe groups become subgroups of the group the database is imported into. The email of a record
+// is appended to its description. Aliases and shortcuts are imported with the password of the record they
+// refer to. The password history cannot be imported.
+func psafe3ImportResult(records []psafe3.Record) importResult {
+	var result importResult
+	byUUID := make(map[string]*psafe3.Record, len(records))
+	for i := range records {
+		if len(records[i].UUID) > 0 {
+			byUUID[records[i].UUID] = &records[i]
+		}
+	}
+	var withHistory int
+	for i := range records {
+		r := &records[i]
+		entry := LoginInfo{
+			Name:              r.Title,
+			Username:          r.Username,
+			Password:          r.Password,
+			URL:               r.URL,
+			Description:       r.Notes,
+			UpdatedAt:         r.Modified,
+			PasswordUpdatedAt: r.PasswordModified,
+		}
+		if entry.UpdatedAt.IsZero() {
+			entry.UpdatedAt = r.Created
+		}
+		entry.Expiry.At = r.PasswordExpiry
+		entry.Expiry.MaxAgeDays = r.PasswordExpiryDays
+		if len(r.Email) > 0 {
+			lines := []string{"Email: " + r.Email}
+			if len(entry.Description) > 0 {
+				lines = append([]string{entry.Description}, lines...)
+			}
+			entry.Description = strings.Join(lines, "\n")
+		}
+		if uuid, ok := r.IsAlias(); ok {
+			if target, found := byUUID[uuid]; found {
+				entry.Password = target.Password
+				if len(entry.Username) == 0 {
+					entry.Username = target.Username
+				}
+			} else {
+				result.warn("%s: the record its password refers to was not found",
+					entryPath(joinGroupPath(r.Group), entry.Name))
+			}
+		}
+		if r.HistorySize > 0 {
+			withHistory++
+		}
+		result.entries = append(result.entries, importedEntry{groups: r.Group, entry: entry})
+	}
+	if withHistory > 0 {
+		result.warn("the password history of %d entries was not imported", withHistory)
+	}
+	return result
+}
+
+const psafe3ImportUsage = `    Password Safe groups become subgroups of the group the database is imported into. The email of entries
+    is added to their description. Aliases and shortcuts get the password of the entry they refer to.
+    The password history of entries is not imported. The HMAC of the database is verified before any entry
+    is imported.
+`
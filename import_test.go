@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/renatoathaydes/go-hash/browser"
+	"github.com/renatoathaydes/go-hash/kdbx"
+	"github.com/renatoathaydes/go-hash/psafe3"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestAddImportedEntries(t *testing.T) {
+	state := State{rootGroup: {{Name: "mail"}, {Name: "bank", Username: "joe", Password: "x", URL: "https://bank.com"}}}
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	modified := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	added, warnings := addImportedEntries(&state, rootGroup, []importedEntry{
+		{entry: LoginInfo{Name: "mail", Password: "1"}},
+		{entry: LoginInfo{Name: "mail", Password: "2"}},
+		{entry: LoginInfo{Name: "mail", Password: "2"}},
+		{entry: LoginInfo{Name: "My bank", Username: "joe", Password: "x", URL: "https://bank.com"}},
+		{groups: []string{"work", "a/b"}, entry: LoginInfo{Name: " vpn ", UpdatedAt: modified}},
+		{groups: []string{".."}, entry: LoginInfo{}},
+	}, now)
+
+	require.Equal(t, []string{"mail (2)", "mail (3)", "work/a-b/vpn", "unnamed/untitled"}, added)
+	require.Equal(t, []string{
+		"mail: renamed to 'mail (2)' as the name is already used",
+		"mail: renamed to 'mail (3)' as the name is already used",
+		"mail: skipped as it duplicates another imported entry",
+		"My bank: skipped as it duplicates 'bank'",
+	}, warnings)
+	require.Equal(t, []string{"mail", "mail (2)", "mail (3)"},
+		[]string{state[rootGroup][0].Name, state[rootGroup][2].Name, state[rootGroup][3].Name})
+	require.Equal(t, now, state[rootGroup][2].UpdatedAt)
+	require.Equal(t, now, state[rootGroup][2].PasswordUpdatedAt)
+
+	require.Contains(t, state, "work")
+	vpn := state["work/a-b"][0]
+	require.Equal(t, "vpn", vpn.Name)
+	require.Equal(t, modified, vpn.UpdatedAt)
+	require.Equal(t, modified, vpn.PasswordUpdatedAt)
+
+	require.Equal(t, "untitled", state["unnamed"][0].Name)
+}
+
+func TestImportRootGroupName(t *testing.T) {
+	state := State{rootGroup: {}}
+	added, _ := addImportedEntries(&state, rootGroup, []importedEntry{
+		{groups: []string{"default"}, entry: LoginInfo{Name: "mail", Password: "1"}},
+		{groups: []string{"default", "x"}, entry: LoginInfo{Name: "vpn", Password: "2"}},
+	}, time.Now())
+
+	require.Equal(t, []string{"default-imported/mail", "default-imported/x/vpn"}, added)
+	require.Empty(t, state[rootGroup])
+	// the imported groups can be addressed
+	require.Equal(t, "default-imported/x", resolveGroupPath(rootGroup, "default-imported/x"))
+	require.Len(t, state[resolveGroupPath(rootGroup, "default-imported/x")], 1)
+}
+
+func TestKdbxImportResult(t *testing.T) {
+	modified := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	expires := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := &kdbx.Database{
+		RecycleBin: "bin",
+		Root: kdbx.Group{Name: "Database",
+			Entries: []kdbx.Entry{{
+				Fields: []kdbx.Field{
+					{Key: kdbx.FieldTitle, Value: "Mail"},
+					{Key: kdbx.FieldUserName, Value: "joe"},
+					{Key: kdbx.FieldPassword, Value: "s3cr3t", Protected: true},
+					{Key: kdbx.FieldURL, Value: "https://mail.example.com"},
+					{Key: kdbx.FieldNotes, Value: "my mail"},
+					{Key: "PIN", Value: "1234", Protected: true},
+					{Key: "Recovery email", Value: "joe@example.org"},
+				},
+				Tags:        []string{"work"},
+				Modified:    modified,
+				Expires:     expires,
+				Attachments: []string{"photo.png"},
+				HistorySize: 2,
+			}},
+			Groups: []kdbx.Group{
+				{Name: "Web", Entries: []kdbx.Entry{{Fields: []kdbx.Field{{Key: kdbx.FieldTitle, Value: "Forum"}}}}},
+				{UUID: "bin", Name: "Recycle Bin", Entries: []kdbx.Entry{{}, {}}},
+			},
+		},
+	}
+
+	result := kdbxImportResult(db)
+	require.Equal(t, []importedEntry{
+		{entry: LoginInfo{Name: "Mail", Username: "joe", Password: "s3cr3t", URL: "https://mail.example.com",
+			Description: "my mail\nRecovery email: joe@example.org", UpdatedAt: modified, PasswordUpdatedAt: modified,
+			Tags: []string{"work"}, Expiry: Expiry{At: expires}}},
+		{groups: []string{"Web"}, entry: LoginInfo{Name: "Forum"}},
+	}, result.entries)
+	require.Equal(t, []string{
+		"Mail: protected field 'PIN' was not imported",
+		"Mail: attachment 'photo.png' was not imported",
+		"2 entries in the recycle bin were not imported",
+		"the history of previous versions of 1 entries was not imported",
+	}, result.warnings)
+}
+
+func TestPsafe3ImportResult(t *testing.T) {
+	created := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	modified := time.Date(2018, 4, 5, 6, 7, 8, 0, time.UTC)
+	records := []psafe3.Record{
+		{UUID: "0123456789abcdef0123456789abcdef", Group: []string{"work", "example.com"}, Title: "Mail",
+			Username: "joe", Password: "s3cr3t", URL: "https://mail.example.com", Notes: "my mail",
+			Email: "joe@example.org", Created: created, Modified: modified, PasswordModified: created,
+			PasswordExpiryDays: 90, HistorySize: 3},
+		{Title: "Alias", Password: "[[0123456789ABCDEF0123456789ABCDEF]]", Created: created},
+		{Title: "Broken", Password: "[~ffffffffffffffffffffffffffffffff~]"},
+	}
+
+	result := psafe3ImportResult(records)
+	require.Equal(t, []importedEntry{
+		{groups: []string{"work", "example.com"}, entry: LoginInfo{Name: "Mail", Username: "joe", Password: "s3cr3t",
+			URL: "https://mail.example.com", Description: "my mail\nEmail: joe@example.org", UpdatedAt: modified,
+			PasswordUpdatedAt: created, Expiry: Expiry{MaxAgeDays: 90}}},
+		{entry: LoginInfo{Name: "Alias", Username: "joe", Password: "s3cr3t", UpdatedAt: created}},
+		{entry: LoginInfo{Name: "Broken", Password: "[~ffffffffffffffffffffffffffffffff~]"}},
+	}, result.entries)
+	require.Equal(t, []string{
+		"Broken: the record its password refers to was not found",
+		"the password history of 1 entries was not imported",
+	}, result.warnings)
+}
+
+func TestCsvImportResultPresets(t *testing.T) {
+	changed := time.Date(2018, 5, 6, 7, 8, 9, 0, time.UTC)
+	type test struct {
+		preset  string
+		csv     string
+		entries []importedEntry
+		warns   []string
+	}
+	tests := []test{
+		{"chrome", "name,url,username,password,note\n" +
+			"mail.example.com,https://mail.example.com/,joe,s3cr3t,my mail\n",
+			[]importedEntry{{entry: LoginInfo{Name: "mail.example.com", URL: "https://mail.example.com/",
+				Username: "joe", Password: "s3cr3t", Description: "my mail"}}}, nil},
+		{"firefox", "\xef\xbb\xbf\"url\",\"username\",\"password\",\"httpRealm\",\"formActionOrigin\",\"guid\"," +
+			"\"timeCreated\",\"timeLastUsed\",\"timePasswordChanged\"\n" +
+			"\"https://www.example.com\",\"joe\",\"p,w\",,\"https://www.example.com\",\"{1}\",\"1\",\"2\",\"1525590489000\"\n",
+			[]importedEntry{{entry: LoginInfo{Name: "example.com", URL: "https://www.example.com", Username: "joe",
+				Password: "p,w", UpdatedAt: changed, PasswordUpdatedAt: changed}}}, nil},
+		{"bitwarden", "folder,favorite,type,name,notes,fields,reprompt,login_uri,login_username,login_password,login_totp\n" +
+			"Work/Mail,1,login,Mail,my mail,\"PIN: 1234\",0,\"https://a.com,https://b.com\",joe,s3cr3t,JBSWY3DP\n" +
+			",,note,Recovery codes,\"1\n2\",,0,,,,\n",
+			[]importedEntry{
+				{groups: []string{"Work", "Mail"}, entry: LoginInfo{Name: "Mail", URL: "https://a.com", Username: "joe",
+					Password: "s3cr3t", Description: "my mail\nURL: https://b.com\nPIN: 1234"}},
+				{entry: LoginInfo{Name: "Recovery codes", Description: "1\n2"}},
+			}, []string{"Work/Mail/Mail: the TOTP secret was not imported"}},
+		{"lastpass", "url,username,password,totp,extra,name,grouping,fav\n" +
+			"https://mail.example.com,joe,s3cr3t,,my mail,Mail,Personal\\Email,0\n" +
+			"http://sn,,,,NoteType:Server,Server,,0\n",
+			[]importedEntry{
+				{groups: []string{"Personal", "Email"}, entry: LoginInfo{Name: "Mail", URL: "https://mail.example.com",
+					Username: "joe", Password: "s3cr3t", Description: "my mail"}},
+				{entry: LoginInfo{Name: "Server", Description: "NoteType:Server"}},
+			}, nil},
+		{"1password", "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\n" +
+			"Mail,https://mail.example.com,joe,s3cr3t,otpauth://totp/x,false,false,\"work,my mail\",\n" +
+			"Old,,,old,,false,true,,\n",
+			[]importedEntry{{entry: LoginInfo{Name: "Mail", URL: "https://mail.example.com", Username: "joe",
+				Password: "s3cr3t", Tags: []string{"work", "my-mail"}}}},
+			[]string{"Mail: the TOTP secret was not imported", "Old: archived item was not imported"}},
+	}
+	for _, test := range tests {
+		// the preset is detected from the header
+		for _, preset := range []string{test.preset, ""} {
+			result, err := csvImportResult(strings.NewReader(test.csv), preset, "")
+			require.NoError(t, err, test.preset)
+			require.Equal(t, test.entries, result.entries, test.preset)
+			require.Equal(t, test.warns, result.warnings, test.preset)
+			require.True(t, result.plaintext)
+		}
+	}
+}
+
+func TestCsvImportResultMapping(t *testing.T) {
+	csv := "Site,Login,Secret,Address,Folder,Changed\n" +
+		"Mail,joe,s3cr3t,https://mail.example.com,work/web,2018-05-06\n" +
+		",,,,,\n" +
+		",,,,work,\n"
+	result, err := csvImportResult(strings.NewReader(csv), "",
+		"name=Site, username=Login,password=Secret,url=Address,group=Folder,modified=Changed")
+	require.NoError(t, err)
+	changed := time.Date(2018, 5, 6, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, []importedEntry{{groups: []string{"work", "web"}, entry: LoginInfo{Name: "Mail", Username: "joe",
+		Password: "s3cr3t", URL: "https://mail.example.com", UpdatedAt: changed, PasswordUpdatedAt: changed}}},
+		result.entries)
+	require.Equal(t, []string{"row 3: skipped as it has no name, username, password or notes"}, result.warnings)
+
+	_, err = csvImportResult(strings.NewReader(csv), "", "name=Title")
+	require.EqualError(t, err, "column 'Title' not found in the header of the file")
+	_, err = csvImportResult(strings.NewReader(csv), "", "color=Site")
+	require.Error(t, err)
+	_, err = csvImportResult(strings.NewReader(csv), "", "")
+	require.Error(t, err)
+	_, err = csvImportResult(strings.NewReader(csv), "keepass", "")
+	require.Error(t, err)
+}
+
+func TestBrowserImportResult(t *testing.T) {
+	created := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	changed := time.Date(2018, 4, 5, 6, 7, 8, 0, time.UTC)
+	result := browserImportResult([]browser.Login{
+		{URL: "https://www.example.com", Username: "joe", Password: "1", Created: created, PasswordChanged: changed},
+		{URL: "https://intranet.example.com:8080", Realm: "Intranet", Password: "2", Created: created},
+	})
+	require.Equal(t, []importedEntry{
+		{groups: []string{"example.com"}, entry: LoginInfo{Name: "joe", Username: "joe", Password: "1",
+			URL: "https://www.example.com", UpdatedAt: changed, PasswordUpdatedAt: changed}},
+		{groups: []string{"intranet.example.com"}, entry: LoginInfo{Name: "intranet.example.com", Password: "2",
+			URL: "https://intranet.example.com:8080", Description: "HTTP authentication realm: Intranet",
+			UpdatedAt: created, PasswordUpdatedAt: created}},
+	}, result.entries)
+	require.Empty(t, result.warnings)
+}
+
+// firefoxKey4Database a gzipped key4.db of a Firefox profile with the primary password "primary", created with
+// Python's sqlite3 module, holding a single AES-256 key encrypted as NSS does.
+const firefoxKey4Database = `
+H4sIAAAAAAACAwsO9MksSVVIyy/KTSxRMGZgYmBkZHBQUGBgYGABYlYGBGCGisEAIwNhwMKgl8zIy/gDyNjKwBjJeJxhK6MKA6Ug
+l5ldXFGRsVG1JDEpJzWvuDigKLMssQSJxeIc5OoY4qoQ4ujk46qAEFfQyExRCAjy9HUMilTwdo1UCPXzDAx1VfD3U3D293Pz8XQO
+UXB08g8K0VFINDQEEQZGmsYsbOLuiowMmXkpqRXFhTnAAItPLC3JB/PjEYbHGyLYrDmM7OKysoyN2mA35qaWJLokliTCaCYU98FE
+iXFdkGuAj6Ozq44C0BW5hhDKSFOfiU3cWRaXE2HmxxvCWKC45AAFJS8oIhlDGYBoFFALNGowssqaNEkVJBYXl+cXpTBiAQaNLQYF
+bJxabR5t33kZWXkNkg1cEFweA3MWBSaCQF2AiVHBgIeNA6KPiZOVwUCajTOhzYMxlZmFUYuFjxkFsAhMEGXbr7xbpq2tfNn6LV+v
+/eQCx/8XBiAaBSMEcDPLcsKSJiT/OzIA0SggK6/bMLJyNkXpGDQuGYD8bHCZ/9ANl43dAboZbI+luLx2VrUrrJLwFX/179PXlxG/
+ZwSpl8YuPhu6c8ncwpVX43fXbv+B6npGSP7/wwBEo2CEAWZmTk4Ax/RwLwAKAAA=`
+
+const firefoxLoginsJSON = `{"logins": [{"hostname": "https://www.example.com", "httpRealm": null,
+	"encryptedUsername": "MEMEEPgAAAAAAAAAAAAAAAAAAAEwHQYJYIZIAWUDBAEqBBAFBQUFBQUFBQUFBQUFBQUFBBC68Y69xyVnX9ypJIok39zk",
+	"encryptedPassword": "MEMEEPgAAAAAAAAAAAAAAAAAAAEwHQYJYIZIAWUDBAEqBBAFBQUFBQUFBQUFBQUFBQUFBBBJX/QjH9JygtdnfAQz7TIJ",
+	"timeCreated": 1520139967000, "timePasswordChanged": 1520139967000}]}`
+
+func TestFirefoxImportResultWithPrimaryPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-hash-firefox")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	compressed, err := base64.StdEncoding.DecodeString(strings.Replace(firefoxKey4Database, "\n", "", -1))
+	require.NoError(t, err)
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	key4, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "key4.db"), key4, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "logins.json"), []byte(firefoxLoginsJSON), 0600))
+	profile, err := browser.OpenFirefoxProfile(dir)
+	require.NoError(t, err)
+
+	asked := 0
+	result, err := firefoxImportResult(profile, func() ([]byte, error) {
+		asked++
+		return []byte("primary"), nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, asked)
+	created := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	require.Equal(t, []importedEntry{
+		{groups: []string{"example.com"}, entry: LoginInfo{Name: "joe", Username: "joe", Password: "s3cr3t",
+			URL: "https://www.example.com", UpdatedAt: created, PasswordUpdatedAt: created}},
+	}, result.entries)
+
+	_, err = firefoxImportResult(profile, func() ([]byte, error) { return []byte("wrong"), nil })
+	require.Equal(t, browser.ErrInvalidPassword, err)
+
+	failure := errors.New("no terminal")
+	_, err = firefoxImportResult(profile, func() ([]byte, error) { return nil, failure })
+	require.Equal(t, failure, err)
+}
+
+func TestParsePassEntry(t *testing.T) {
+	entry, hasOTP := parsePassEntry("s3cr3t\nlogin: joe\nURL: https://example.com\nhttps://other.example.com\n" +
+		"security question: none\notpauth://totp/joe?secret=ABC\nextra notes\n")
+	require.Equal(t, LoginInfo{Password: "s3cr3t", Username: "joe", URL: "https://example.com",
+		Description: "https://other.example.com\nsecurity question: none\nextra notes"}, entry)
+	require.True(t, hasOTP)
+
+	entry, hasOTP = parsePassEntry("only a password")
+	require.Equal(t, LoginInfo{Password: "only a password"}, entry)
+	require.False(t, hasOTP)
+}
+
+func TestPassImportResult(t *testing.T) {
+	key, err := openpgp.NewEntity("joe", "", "joe@example.com", &packet.Config{RSABits: 1024})
+	require.NoError(t, err)
+	for _, id := range key.Identities {
+		// SHA-256, as the default RIPEMD-160 is not linked in
+		id.SelfSignature.PreferredHash = []uint8{8}
+	}
+	root, err := ioutil.TempDir("", "go-hash-pass")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	write := func(path string, content string, encrypt bool) {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		var b bytes.Buffer
+		if encrypt {
+			w, err := openpgp.Encrypt(&b, []*openpgp.Entity{key}, nil, nil, nil)
+			require.NoError(t, err)
+			w.Write([]byte(content))
+			require.NoError(t, w.Close())
+		} else {
+			b.WriteString(content)
+		}
+		require.NoError(t, ioutil.WriteFile(path, b.Bytes(), 0600))
+	}
+	write(".gpg-id", "joe@example.com\n", false)
+	write("mail.gpg", "s3cr3t\nlogin: joe\n", true)
+	write("work/aws/console.gpg", "1234\n", true)
+	write("work/broken.gpg", "not encrypted", false)
+	write(".git/objects.gpg", "not an entry", false)
+	write("notes.txt", "not an entry", false)
+
+	result, err := passImportResult(root, openpgp.EntityList{key})
+	require.NoError(t, err)
+	require.Len(t, result.entries, 2)
+	require.Equal(t, importedEntry{entry: LoginInfo{Name: "mail", Username: "joe", Password: "s3cr3t",
+		UpdatedAt: result.entries[0].entry.UpdatedAt}}, result.entries[0])
+	require.Equal(t, []string{"work", "aws"}, result.entries[1].groups)
+	require.Equal(t, "console", result.entries[1].entry.Name)
+	require.Equal(t, "1234", result.entries[1].entry.Password)
+	require.Len(t, result.warnings, 1)
+	require.Contains(t, result.warnings[0], "work/broken: unable to decrypt")
+}
+
+func TestReadPrivateKeys(t *testing.T) {
+	key, err := openpgp.NewEntity("joe", "", "joe@example.com", &packet.Config{RSABits: 1024})
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "go-hash-keys")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var private, public bytes.Buffer
+	w, err := armor.Encode(&private, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, key.SerializePrivate(w, nil))
+	require.NoError(t, w.Close())
+	require.NoError(t, key.Serialize(&public))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "private.asc"), private.Bytes(), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "public.gpg"), public.Bytes(), 0600))
+
+	keyring, err := readPrivateKeys(filepath.Join(dir, "private.asc"))
+	require.NoError(t, err)
+	require.Len(t, keyring.DecryptionKeys(), 1)
+
+	_, err = readPrivateKeys(filepath.Join(dir, "public.gpg"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no private key")
+}
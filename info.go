@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/renatoathaydes/go-hash/encryption"
+)
+
+// keysLength the length of the fields following the header of a database file: B1 | B2 | B3 | B4 | HMAC
+const keysLength = 4*32 + 64
+
+// databaseInfo what can be learned about a database file without its master password.
+type databaseInfo struct {
+	Path        string
+	Size        int64
+	Modified    time.Time
+	SHA256      string
+	SHA512      string
+	Version     string
+	Salt        string
+	KDF         [][2]string
+	KeySlots    int
+	PayloadSize int64
+}
+
+// kdfParameters describes the parameters used to derive the key of a database from its master password.
+func kdfParameters(kdf encryption.KDFParams, version string) [][2]string {
+	threads := strconv.Itoa(int(kdf.Threads))
+	if version == legacyDBVersion {
+		// the number of threads was not stored in the first version of the format
+		threads += " (the number of CPUs of this computer)"
+	}
+	return [][2]string{
+		{"Algorithm", "Argon2i, version 0x13"},
+		{"Time (iterations)", strconv.Itoa(int(kdf.Time))},
+		{"Memory", fmt.Sprintf("%d KiB", kdf.Memory)},
+		{"Parallelism", threads},
+		{"Key length", fmt.Sprintf("%d bytes", encryption.KEYLEN)},
+	}
+}
+
+// readDatabaseInfo parses the header of the database file at the given path.
+func readDatabaseInfo(path string) (*databaseInfo, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, fmt.Errorf("'%s' is a directory", path)
+	}
+	if stat.Size() > 4+int64(encryption.SALTLEN)+kdfLength+keysLength+MaxDBLength {
+		return nil, fmt.Errorf("file too big to be a go-hash database (%d bytes)", stat.Size())
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sha256Sum := sha256.Sum256(content)
+	sha512Sum := sha512.Sum512(content)
+	info := &databaseInfo{
+		Path:     absPath,
+		Size:     int64(len(content)),
+		Modified: stat.ModTime(),
+		SHA256:   hex.EncodeToString(sha256Sum[:]),
+		SHA512:   hex.EncodeToString(sha512Sum[:]),
+	}
+	if len(content) < 4 || !strings.HasPrefix(string(content), "GH") {
+		return info, errors.New("not a go-hash database")
+	}
+	info.Version = string(content[:4])
+	if info.Version != DBVersion && info.Version != legacyDBVersion {
+		return info, fmt.Errorf("unsupported database version: %q", info.Version)
+	}
+	header, err := parseDatabaseHeader(content)
+	if err == nil && (len(content) < MinDBLength || int64(len(content)) < header.length+keysLength) {
+		err = fmt.Errorf("truncated database: the header alone takes %d bytes", header.length+keysLength)
+	}
+	if err != nil {
+		return info, err
+	}
+	info.Salt = hex.EncodeToString(header.salt)
+	info.KDF = kdfParameters(header.kdf, header.version)
+	// B1..B4 hold the keys of the payload, encrypted with the hash of the master password
+	info.KeySlots = 1
+	info.PayloadSize = info.Size - header.length - keysLength
+	return info, nil
+}
+
+// printDatabaseInfo prints the information read from the header of a database. The header is only printed if it
+// could be parsed.
+func printDatabaseInfo(w io.Writer, info *databaseInfo) {
+	row := func(name string, value interface{}) {
+		fmt.Fprintf(w, "%-22s %v\n", name+":", value)
+	}
+	row("File", info.Path)
+	row("Size", fmt.Sprintf("%d bytes", info.Size))
+	row("Modified", info.Modified.Format("2006-01-02 15:04:05 MST"))
+	row("SHA-256", info.SHA256)
+	row("SHA-512", info.SHA512)
+	if len(info.Salt) == 0 {
+		return
+	}
+	if info.Version == legacyDBVersion {
+		row("Format version", info.Version+" (converted to "+DBVersion+" when the database is next saved)")
+	} else {
+		row("Format version", info.Version)
+	}
+	row("Salt", info.Salt)
+	row("Key slots", fmt.Sprintf("%d (master password)", info.KeySlots))
+	row("Encrypted payload", fmt.Sprintf("%d bytes", info.PayloadSize))
+	fmt.Fprintln(w, "Key derivation:")
+	for _, param := range info.KDF {
+		fmt.Fprintf(w, "  %-20s %s\n", param[0]+":", param[1])
+	}
+}
+
+// printContentInfo prints statistics about the contents of an unlocked database.
+func printContentInfo(w io.Writer, state State, meta *Meta) {
+	entries := 0
+	var lastChange, lastPasswordChange time.Time
+	var lastChanged, lastPasswordChanged string
+	for group, groupEntries := range state {
+		entries += len(groupEntries)
+		for _, e := range groupEntries {
+			if e.UpdatedAt.After(lastChange) {
+				lastChange, lastChanged = e.UpdatedAt, entryPath(group, e.Name)
+			}
+			if e.PasswordUpdatedAt.After(lastPasswordChange) {
+				lastPasswordChange, lastPasswordChanged = e.PasswordUpdatedAt, entryPath(group, e.Name)
+			}
+		}
+	}
+	row := func(name string, value interface{}) {
+		fmt.Fprintf(w, "%-22s %v\n", name+":", value)
+	}
+	row("Groups", len(state))
+	row("Entries", entries)
+	row("Tags", len(state.allTags()))
+	row("Password profiles", len(meta.Profiles))
+	if len(lastChanged) > 0 {
+		row("Last entry change", lastChange.Format("2006-01-02 15:04:05")+" ("+lastChanged+")")
+	}
+	if len(lastPasswordChanged) > 0 {
+		row("Last password change", lastPasswordChange.Format("2006-01-02 15:04:05")+" ("+lastPasswordChanged+")")
+	}
+}
+
+func runInfoSubcommand(args []string) int {
+	var opts databaseOptions
+	fs := newFlagSet("info")
+	opts.addFlags(fs)
+	unlock := fs.Bool("unlock", false, "also show the contents of the database, asking for the master password")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) > 1 {
+		return exitCodeOf(cliError{exitUsage, "too many arguments"})
+	}
+	if len(positional) == 1 {
+		opts.path = positional[0]
+	}
+	info, err := readDatabaseInfo(opts.path)
+	if info != nil {
+		printDatabaseInfo(os.Stdout, info)
+	}
+	if err != nil {
+		return exitCodeOf(err)
+	}
+
+	var state State
+	var meta Meta
+	if *unlock || opts.password.isSet() {
+		if state, meta, _, err = opts.open(); err != nil {
+			return exitCodeOf(err)
+		}
+	} else {
+		var unlocked bool
+		if state, meta, _, unlocked = readDatabaseWithAgent(opts.path); !unlocked {
+			return exitOK
+		}
+		prepareState(&state)
+	}
+	printContentInfo(os.Stdout, state, &meta)
+	return exitOK
+}
+
+const infoSubUsage = `
+Usage:
+  go-hash info [<options>] [<file>]
+
+Prints information read from the header of a database file (by default, the one given by -db) without the master
+password: the format version, the parameters used to derive the key from the master password, the number of key
+slots, the size of the encrypted payload, and the hashes of the file, which tell whether two copies are the same.
+
+If the database can be unlocked, the number of groups and entries, and when they last changed, are printed as well.
+
+Options:
+  -unlock            unlock the database, prompting for the master password if necessary.
+` + databaseOptionsUsage + `
+Example:
+  go-hash info ~/Dropbox/.go-hash
+`
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadDatabaseInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-hash-info")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "db")
+	state := State{"default": []LoginInfo{{Name: "google", Username: "joe", Password: "secret"}}}
+	key := NewDatabaseKey("master")
+	require.NoError(t, WriteDatabaseWithKey(dbPath, key, &state, &Meta{}))
+	content, err := ioutil.ReadFile(dbPath)
+	require.NoError(t, err)
+
+	info, err := readDatabaseInfo(dbPath)
+	require.NoError(t, err)
+	hash := sha256.Sum256(content)
+	require.Equal(t, dbPath, info.Path)
+	require.Equal(t, int64(len(content)), info.Size)
+	require.Equal(t, hex.EncodeToString(hash[:]), info.SHA256)
+	require.Equal(t, DBVersion, info.Version)
+	require.Equal(t, hex.EncodeToString(key.Salt), info.Salt)
+	require.Equal(t, 1, info.KeySlots)
+	require.Equal(t, int64(len(content)-4-32-kdfLength-keysLength), info.PayloadSize)
+	require.Equal(t, kdfParameters(key.KDF, DBVersion), info.KDF)
+
+	var out bytes.Buffer
+	printDatabaseInfo(&out, info)
+	require.Contains(t, out.String(), "Format version:        GH01\n")
+	require.Contains(t, out.String(), "SHA-256:               "+info.SHA256+"\n")
+	require.Contains(t, out.String(), "  Algorithm:           Argon2i, version 0x13\n")
+
+	other := filepath.Join(dir, "other")
+	write := func(content []byte) {
+		require.NoError(t, ioutil.WriteFile(other, content, 0600))
+	}
+
+	write([]byte("hello world"))
+	info, err = readDatabaseInfo(other)
+	require.EqualError(t, err, "not a go-hash database")
+	require.Equal(t, int64(11), info.Size)
+	out.Reset()
+	printDatabaseInfo(&out, info)
+	require.NotContains(t, out.String(), "Format version")
+
+	write(append([]byte("GH99"), content[4:]...))
+	_, err = readDatabaseInfo(other)
+	require.EqualError(t, err, `unsupported database version: "GH99"`)
+
+	write(content[:100])
+	_, err = readDatabaseInfo(other)
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), "truncated database"))
+
+	_, err = readDatabaseInfo(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
+
+func TestPrintContentInfo(t *testing.T) {
+	state := State{
+		"default": []LoginInfo{
+			{Name: "google", Tags: []string{"mail"}, UpdatedAt: time.Date(2018, 1, 5, 10, 0, 0, 0, time.UTC),
+				PasswordUpdatedAt: time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)},
+		},
+		"work": []LoginInfo{
+			{Name: "aws", Tags: []string{"cloud", "mail"}, UpdatedAt: time.Date(2018, 2, 1, 9, 30, 0, 0, time.UTC),
+				PasswordUpdatedAt: time.Date(2016, 6, 1, 10, 0, 0, 0, time.UTC)},
+			{Name: "ci"},
+		},
+		"empty": []LoginInfo{},
+	}
+	var out bytes.Buffer
+	printContentInfo(&out, state, &Meta{Profiles: map[string]string{"pin": "digits=4"}})
+	require.Equal(t, `Groups:                3
+Entries:               3
+Tags:                  2
+Password profiles:     1
+Last entry change:     2018-02-01 09:30:00 (work/aws)
+Last password change:  2017-06-01 10:00:00 (google)
+`, out.String())
+}
@@ -0,0 +1,266 @@
+package kdbx
+
+import (
+	"encoding/binary"
+	"hash"
+
+	"github.com/golang/crypto/blake2b"
+)
+
+// Argon2 variants, as identified in the Argon2 specification.
+const (
+	argon2d  = 0
+	argon2i  = 1
+	argon2id = 2
+)
+
+const (
+	argon2Version = 0x13
+	// blockWords number of 64-bit words in an Argon2 memory block of 1 KiB.
+	blockWords = 128
+	// syncPoints number of slices each lane is divided into.
+	syncPoints = 4
+)
+
+type block [blockWords]uint64
+
+// argon2Key derives a key with Argon2 (version 1.3).
+//
+// The golang.org/x/crypto/argon2 package only implements Argon2i and Argon2id, but KeePass uses Argon2d by
+// default, so this is a complete implementation of the specification (RFC 9106) supporting all variants.
+// memory is given in KiB.
+func argon2Key(mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8,
+	keyLen uint32) []byte {
+	if time < 1 || threads < 1 {
+		panic("argon2: time and threads must be at least 1")
+	}
+	h0 := argon2InitHash(mode, password, salt, secret, data, time, memory, uint32(threads), keyLen)
+
+	lanes := uint32(threads)
+	if memory < 2*syncPoints*lanes {
+		memory = 2 * syncPoints * lanes
+	}
+	memory = memory / (syncPoints * lanes) * (syncPoints * lanes)
+	laneLength := memory / lanes
+	segmentLength := laneLength / syncPoints
+
+	B := make([]block, memory)
+	var h0Ext [blake2b.Size + 8]byte
+	copy(h0Ext[:], h0[:])
+	var buf [1024]byte
+	for lane := uint32(0); lane < lanes; lane++ {
+		binary.LittleEndian.PutUint32(h0Ext[blake2b.Size+4:], lane)
+		for i := uint32(0); i < 2; i++ {
+			binary.LittleEndian.PutUint32(h0Ext[blake2b.Size:], i)
+			argon2Hash(buf[:], h0Ext[:])
+			for w := range B[lane*laneLength+i] {
+				B[lane*laneLength+i][w] = binary.LittleEndian.Uint64(buf[w*8:])
+			}
+		}
+	}
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < syncPoints; slice++ {
+			for lane := uint32(0); lane < lanes; lane++ {
+				argon2Segment(B, mode, pass, slice, lane, lanes, laneLength, segmentLength, memory, time)
+			}
+		}
+	}
+
+	// the final block is the XOR of the last block of each lane
+	final := B[laneLength-1]
+	for lane := uint32(1); lane < lanes; lane++ {
+		last := &B[lane*laneLength+laneLength-1]
+		for w := range final {
+			final[w] ^= last[w]
+		}
+	}
+	for w := range final {
+		binary.LittleEndian.PutUint64(buf[w*8:], final[w])
+	}
+	key := make([]byte, keyLen)
+	argon2Hash(key, buf[:])
+	return key
+}
+
+func argon2InitHash(mode int, password, salt, secret, data []byte, time, memory, threads, keyLen uint32) [blake2b.Size]byte {
+	var params [24]byte
+	binary.LittleEndian.PutUint32(params[0:], threads)
+	binary.LittleEndian.PutUint32(params[4:], keyLen)
+	binary.LittleEndian.PutUint32(params[8:], memory)
+	binary.LittleEndian.PutUint32(params[12:], time)
+	binary.LittleEndian.PutUint32(params[16:], argon2Version)
+	binary.LittleEndian.PutUint32(params[20:], uint32(mode))
+
+	b2, _ := blake2b.New512(nil)
+	b2.Write(params[:])
+	for _, input := range [][]byte{password, salt, secret, data} {
+		writeWithLength(b2, input)
+	}
+	var h0 [blake2b.Size]byte
+	b2.Sum(h0[:0])
+	return h0
+}
+
+func writeWithLength(h hash.Hash, b []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(b)))
+	h.Write(length[:])
+	h.Write(b)
+}
+
+// argon2Hash the variable-length hash function H' of the Argon2 specification.
+func argon2Hash(out []byte, in []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(out)))
+	if len(out) <= blake2b.Size {
+		b2, _ := blake2b.New(len(out), nil)
+		b2.Write(length[:])
+		b2.Write(in)
+		b2.Sum(out[:0])
+		return
+	}
+	b2, _ := blake2b.New512(nil)
+	b2.Write(length[:])
+	b2.Write(in)
+	var v [blake2b.Size]byte
+	b2.Sum(v[:0])
+	copy(out, v[:32])
+	out = out[32:]
+	for len(out) > blake2b.Size {
+		v = blake2b.Sum512(v[:])
+		copy(out, v[:32])
+		out = out[32:]
+	}
+	b2, _ = blake2b.New(len(out), nil)
+	b2.Write(v[:])
+	b2.Sum(out[:0])
+}
+
+// argon2Segment fills one segment of a lane.
+func argon2Segment(B []block, mode int, pass, slice, lane, lanes, laneLength, segmentLength, memory, time uint32) {
+	dataIndependent := mode == argon2i || (mode == argon2id && pass == 0 && slice < syncPoints/2)
+	var addresses, input, zero block
+	if dataIndependent {
+		input[0] = uint64(pass)
+		input[1] = uint64(lane)
+		input[2] = uint64(slice)
+		input[3] = uint64(memory)
+		input[4] = uint64(time)
+		input[5] = uint64(mode)
+	}
+	nextAddresses := func() {
+		input[6]++
+		compressBlock(&addresses, &input, &zero, false)
+		compressBlock(&addresses, &addresses, &zero, false)
+	}
+
+	index := uint32(0)
+	if pass == 0 && slice == 0 {
+		// the first two blocks of each lane are already filled
+		index = 2
+		if dataIndependent {
+			nextAddresses()
+		}
+	}
+	offset := lane*laneLength + slice*segmentLength + index
+	for ; index < segmentLength; index, offset = index+1, offset+1 {
+		prev := offset - 1
+		if index == 0 && slice == 0 {
+			// the previous block of the first block of a lane is the lane's last block
+			prev += laneLength
+		}
+		var random uint64
+		if dataIndependent {
+			if index%blockWords == 0 {
+				nextAddresses()
+			}
+			random = addresses[index%blockWords]
+		} else {
+			random = B[prev][0]
+		}
+		ref := referenceIndex(random, lanes, laneLength, segmentLength, pass, slice, lane, index)
+		// in the first pass, blocks are still zero, so XORing into them is the same as overwriting them
+		compressBlock(&B[offset], &B[prev], &B[ref], true)
+	}
+}
+
+// referenceIndex computes the index of the block referenced when filling a block, from a pseudo-random value.
+func referenceIndex(random uint64, lanes, laneLength, segmentLength, pass, slice, lane, index uint32) uint32 {
+	refLane := uint32(random>>32) % lanes
+	if pass == 0 && slice == 0 {
+		refLane = lane
+	}
+	// the number of blocks which may be referenced, and the index where they start
+	area, start := 3*segmentLength, ((slice+1)%syncPoints)*segmentLength
+	if lane == refLane {
+		area += index
+	}
+	if pass == 0 {
+		area, start = slice*segmentLength, 0
+		if slice == 0 || lane == refLane {
+			area += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		area--
+	}
+	x := random & 0xFFFFFFFF
+	x = (x * x) >> 32
+	x = (uint64(area) * x) >> 32
+	return refLane*laneLength + uint32((uint64(start)+uint64(area)-(x+1))%uint64(laneLength))
+}
+
+// compressBlock applies the compression function G to x and y, writing or XORing the result into out.
+func compressBlock(out, x, y *block, xor bool) {
+	var r, z block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	z = r
+	// apply the permutation P to each row of 16 words, then to each column of 8 pairs of words
+	for i := 0; i < blockWords; i += 16 {
+		permute(&z[i], &z[i+1], &z[i+2], &z[i+3], &z[i+4], &z[i+5], &z[i+6], &z[i+7],
+			&z[i+8], &z[i+9], &z[i+10], &z[i+11], &z[i+12], &z[i+13], &z[i+14], &z[i+15])
+	}
+	for i := 0; i < 16; i += 2 {
+		permute(&z[i], &z[i+1], &z[i+16], &z[i+17], &z[i+32], &z[i+33], &z[i+48], &z[i+49],
+			&z[i+64], &z[i+65], &z[i+80], &z[i+81], &z[i+96], &z[i+97], &z[i+112], &z[i+113])
+	}
+	if !xor {
+		for i := range out {
+			out[i] = z[i] ^ r[i]
+		}
+		return
+	}
+	for i := range out {
+		out[i] ^= z[i] ^ r[i]
+	}
+}
+
+// permute the permutation P, based on the BLAKE2b round function with an added multiplication.
+func permute(v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 *uint64) {
+	mix(v0, v4, v8, v12)
+	mix(v1, v5, v9, v13)
+	mix(v2, v6, v10, v14)
+	mix(v3, v7, v11, v15)
+	mix(v0, v5, v10, v15)
+	mix(v1, v6, v11, v12)
+	mix(v2, v7, v8, v13)
+	mix(v3, v4, v9, v14)
+}
+
+func mix(a, b, c, d *uint64) {
+	*a = *a + *b + 2*uint64(uint32(*a))*uint64(uint32(*b))
+	*d = rotr(*d^*a, 32)
+	*c = *c + *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+	*b = rotr(*b^*c, 24)
+	*a = *a + *b + 2*uint64(uint32(*a))*uint64(uint32(*b))
+	*d = rotr(*d^*a, 16)
+	*c = *c + *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+	*b = rotr(*b^*c, 63)
+}
+
+func rotr(x uint64, n uint) uint64 {
+	return x>>n | x<<(64-n)
+}
@@ -0,0 +1,35 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/golang/crypto/argon2"
+	"github.com/stretchr/testify/require"
+)
+
+// test vectors from RFC 9106, section 5
+func TestArgon2RFCVectors(t *testing.T) {
+	password := bytes.Repeat([]byte{1}, 32)
+	salt := bytes.Repeat([]byte{2}, 16)
+	secret := bytes.Repeat([]byte{3}, 8)
+	data := bytes.Repeat([]byte{4}, 12)
+	vectors := map[int]string{
+		argon2d:  "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb",
+		argon2i:  "c814d9d1dc7f37aa13f0d77f2494bda1c8de6b016dd388d29952a4c4672b6ce8",
+		argon2id: "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659",
+	}
+	for mode, expected := range vectors {
+		key := argon2Key(mode, password, salt, secret, data, 3, 32, 4, 32)
+		require.Equal(t, expected, hex.EncodeToString(key), "mode: %d", mode)
+	}
+}
+
+func TestArgon2MatchesXCrypto(t *testing.T) {
+	password, salt := []byte("password"), []byte("somesalt")
+	require.Equal(t, argon2.IDKey(password, salt, 2, 1024, 2, 64),
+		argon2Key(argon2id, password, salt, nil, nil, 2, 1024, 2, 64))
+	require.Equal(t, argon2.Key(password, salt, 3, 256, 1, 32),
+		argon2Key(argon2i, password, salt, nil, nil, 3, 256, 1, 32))
+}
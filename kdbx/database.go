@@ -0,0 +1,269 @@
+package kdbx
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Standard fields of KeePass entries.
+const (
+	FieldTitle    = "Title"
+	FieldUserName = "UserName"
+	FieldPassword = "Password"
+	FieldURL      = "URL"
+	FieldNotes    = "Notes"
+)
+
+// Database the content of a KeePass database.
+type Database struct {
+	Root Group
+	// RecycleBin the UUID of the group holding deleted entries, if the recycle bin is enabled.
+	RecycleBin string
+}
+
+// Group a KeePass group, containing entries and other groups.
+type Group struct {
+	UUID    string
+	Name    string
+	Notes   string
+	Groups  []Group
+	Entries []Entry
+}
+
+// Field a string field of an entry.
+type Field struct {
+	Key   string
+	Value string
+	// Protected whether the field is protected in memory by KeePass, as passwords are.
+	Protected bool
+}
+
+// Entry a KeePass entry.
+type Entry struct {
+	UUID   string
+	Fields []Field
+	Tags   []string
+	// Modified when the entry was last modified.
+	Modified time.Time
+	// Expires the time when the entry expires, or the zero time if it never expires.
+	Expires time.Time
+	// Attachments the names of the files attached to the entry.
+	Attachments []string
+	// HistorySize the number of previous versions of the entry kept by KeePass.
+	HistorySize int
+}
+
+// Get returns the value of the field with the given key, or the empty string if there is no such field.
+func (e *Entry) Get(key string) string {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// IsStandardField returns true if the key is the key of one of the fields every KeePass entry has.
+func IsStandardField(key string) bool {
+	switch key {
+	case FieldTitle, FieldUserName, FieldPassword, FieldURL, FieldNotes:
+		return true
+	}
+	return false
+}
+
+// xmlNode an element of the XML document of a KeePass database.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return &xmlNode{name: name}
+}
+
+func (n *xmlNode) all(name string) []*xmlNode {
+	var result []*xmlNode
+	for _, c := range n.children {
+		if c.name == name {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// parseXML parses the XML document of a KeePass database.
+//
+// Protected values are decrypted with the inner stream as they are found. As the stream is not seekable, they
+// must be decrypted in the order they appear in the document, which is why the document is parsed this way
+// rather than with xml.Unmarshal.
+func parseXML(r io.Reader, stream cipher.Stream) (*xmlNode, error) {
+	decoder := xml.NewDecoder(r)
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		current := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			current.children = append(current.children, node)
+			stack = append(stack, node)
+		case xml.CharData:
+			current.text += string(t)
+		case xml.EndElement:
+			if strings.EqualFold(current.attr("Protected"), "True") {
+				value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(current.text))
+				if err != nil {
+					return nil, ErrCorrupt
+				}
+				stream.XORKeyStream(value, value)
+				current.text = string(value)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return root, nil
+}
+
+func parseDatabase(r io.Reader, stream cipher.Stream) (*Database, error) {
+	doc, err := parseXML(r, stream)
+	if err != nil {
+		return nil, err
+	}
+	file := doc.child("KeePassFile")
+	root := file.child("Root").all("Group")
+	if len(root) != 1 {
+		return nil, ErrCorrupt
+	}
+	db := &Database{Root: parseGroup(root[0])}
+	meta := file.child("Meta")
+	if strings.EqualFold(meta.child("RecycleBinEnabled").text, "True") {
+		db.RecycleBin = meta.child("RecycleBinUUID").text
+	}
+	return db, nil
+}
+
+func parseGroup(node *xmlNode) Group {
+	group := Group{
+		UUID:  node.child("UUID").text,
+		Name:  node.child("Name").text,
+		Notes: node.child("Notes").text,
+	}
+	for _, e := range node.all("Entry") {
+		group.Entries = append(group.Entries, parseEntry(e))
+	}
+	for _, g := range node.all("Group") {
+		group.Groups = append(group.Groups, parseGroup(g))
+	}
+	return group
+}
+
+func parseEntry(node *xmlNode) Entry {
+	entry := Entry{UUID: node.child("UUID").text}
+	for _, s := range node.all("String") {
+		value := s.child("Value")
+		entry.Fields = append(entry.Fields, Field{
+			Key:       s.child("Key").text,
+			Value:     value.text,
+			Protected: strings.EqualFold(value.attr("Protected"), "True"),
+		})
+	}
+	for _, tag := range strings.FieldsFunc(node.child("Tags").text, func(r rune) bool {
+		return r == ';' || r == ','
+	}) {
+		if tag = strings.TrimSpace(tag); len(tag) > 0 {
+			entry.Tags = append(entry.Tags, tag)
+		}
+	}
+	times := node.child("Times")
+	entry.Modified = parseTime(times.child("LastModificationTime").text)
+	if strings.EqualFold(times.child("Expires").text, "True") {
+		entry.Expires = parseTime(times.child("ExpiryTime").text)
+	}
+	for _, b := range node.all("Binary") {
+		entry.Attachments = append(entry.Attachments, b.child("Key").text)
+	}
+	entry.HistorySize = len(node.child("History").all("Entry"))
+	return entry
+}
+
+// parseTime parses a time, which is either in ISO 8601 format (KDBX 3.1), or the base64-encoded number of
+// seconds since 0001-01-01 (KDBX 4). Returns the zero time if it cannot be parsed.
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC()
+	}
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == 8 {
+		// seconds between 0001-01-01 and 1970-01-01
+		const unixEpoch = 62135596800
+		return time.Unix(int64(binary.LittleEndian.Uint64(b))-unixEpoch, 0).UTC()
+	}
+	return time.Time{}
+}
+
+// xmlKeyFile reads the key from an XML key file. Returns false if the content is not an XML key file.
+func xmlKeyFile(content []byte) (key []byte, ok bool, err error) {
+	var keyFile struct {
+		XMLName xml.Name `xml:"KeyFile"`
+		Meta    struct {
+			Version string
+		}
+		Key struct {
+			Data struct {
+				Hash  string `xml:",attr"`
+				Value string `xml:",chardata"`
+			}
+		}
+	}
+	if xml.Unmarshal(content, &keyFile) != nil {
+		return nil, false, nil
+	}
+	data := strings.Join(strings.Fields(keyFile.Key.Data.Value), "")
+	invalid := errors.New("invalid key file")
+	if strings.HasPrefix(keyFile.Meta.Version, "2.") {
+		if key, err = hex.DecodeString(data); err != nil {
+			return nil, true, invalid
+		}
+		hash := sha256.Sum256(key)
+		if len(keyFile.Key.Data.Hash) > 0 && !strings.EqualFold(hex.EncodeToString(hash[:4]), keyFile.Key.Data.Hash) {
+			return nil, true, invalid
+		}
+		return key, true, nil
+	}
+	if key, err = base64.StdEncoding.DecodeString(data); err != nil {
+		return nil, true, invalid
+	}
+	return key, true, nil
+}
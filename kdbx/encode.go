@@ -0,0 +1,283 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+// parameters of the Argon2d KDF used by Encode, as chosen by KeePassXC for new databases on a typical computer.
+// They are variables so tests can make them cheaper.
+var (
+	encodeIterations  uint64 = 10
+	encodeMemory      uint64 = 64 * 1024 * 1024
+	encodeParallelism uint32 = 2
+)
+
+// blockSize the size of the HMAC-authenticated blocks of the payload.
+const blockSize = 1024 * 1024
+
+// Encode writes a KeePass database in the KDBX 4 format, encrypted with AES-256 using a key derived from the
+// credentials with Argon2d. Values of fields marked as protected, such as passwords, are also encrypted within
+// the XML document. Groups and entries without a UUID get a random one.
+func Encode(w io.Writer, db *Database, credentials Credentials) error {
+	random := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(rand.Reader, b)
+		return b, err
+	}
+	masterSeed, err := random(32)
+	if err != nil {
+		return err
+	}
+	iv, err := random(aes.BlockSize)
+	if err != nil {
+		return err
+	}
+	kdfSeed, err := random(32)
+	if err != nil {
+		return err
+	}
+	streamKey, err := random(64)
+	if err != nil {
+		return err
+	}
+
+	kdf := variantDictionary{"$UUID": []byte(kdfArgon2d), "S": kdfSeed, "I": encodeIterations,
+		"M": encodeMemory, "P": encodeParallelism, "V": uint32(argon2Version)}
+	var hdr bytes.Buffer
+	binary.Write(&hdr, binary.LittleEndian, signature1)
+	binary.Write(&hdr, binary.LittleEndian, signature2)
+	binary.Write(&hdr, binary.LittleEndian, uint16(0))
+	binary.Write(&hdr, binary.LittleEndian, uint16(4))
+	writeField(&hdr, fieldCipherID, []byte(cipherAES256))
+	writeField(&hdr, fieldCompressionFlags, uint32Bytes(1))
+	writeField(&hdr, fieldMasterSeed, masterSeed)
+	writeField(&hdr, fieldEncryptionIV, iv)
+	writeField(&hdr, fieldKdfParameters, kdf.bytes())
+	writeField(&hdr, fieldEndOfHeader, []byte{'\r', '\n', '\r', '\n'})
+
+	composite, err := credentials.compositeKey()
+	if err != nil {
+		return err
+	}
+	transformed, err := header{kdf: kdf}.transformKey(composite)
+	if err != nil {
+		return err
+	}
+	masterKey := sha256.Sum256(append(append([]byte{}, masterSeed...), transformed...))
+	hmacKey := sha512.Sum512(append(append(append([]byte{}, masterSeed...), transformed...), 1))
+
+	// the inner header, followed by the XML document
+	var payload bytes.Buffer
+	writeField(&payload, innerFieldRandomStreamID, uint32Bytes(innerStreamChaCha20))
+	writeField(&payload, innerFieldRandomStreamKey, streamKey)
+	writeField(&payload, innerFieldEnd, nil)
+	stream, err := newInnerStream(innerStreamChaCha20, streamKey)
+	if err != nil {
+		return err
+	}
+	if err = writeDocument(&payload, db, stream); err != nil {
+		return err
+	}
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(payload.Bytes())
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	encrypted, err := encrypt(masterKey[:], iv, compressed.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var file bytes.Buffer
+	file.Write(hdr.Bytes())
+	headerHash := sha256.Sum256(hdr.Bytes())
+	file.Write(headerHash[:])
+	headerMAC := hmac.New(sha256.New, blockHMACKey(hmacKey[:], ^uint64(0)))
+	headerMAC.Write(hdr.Bytes())
+	file.Write(headerMAC.Sum(nil))
+	writeHMACBlocks(&file, encrypted, hmacKey[:])
+	_, err = w.Write(file.Bytes())
+	return err
+}
+
+// writeField writes a field of the outer or inner header of a KDBX 4 file.
+func writeField(b *bytes.Buffer, id byte, value []byte) {
+	b.WriteByte(id)
+	b.Write(uint32Bytes(uint32(len(value))))
+	b.Write(value)
+}
+
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+// encrypt encrypts the payload with AES-256 in CBC mode, with PKCS#7 padding.
+func encrypt(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := block.BlockSize() - len(data)%block.BlockSize()
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+	return padded, nil
+}
+
+// writeHMACBlocks writes data as HMAC-authenticated blocks, the last of which is empty.
+func writeHMACBlocks(b *bytes.Buffer, data, hmacKey []byte) {
+	for index := uint64(0); ; index++ {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+		content := data[:n]
+		data = data[n:]
+		var i [8]byte
+		binary.LittleEndian.PutUint64(i[:], index)
+		size := uint32Bytes(uint32(len(content)))
+		mac := hmac.New(sha256.New, blockHMACKey(hmacKey, index))
+		mac.Write(i[:])
+		mac.Write(size)
+		mac.Write(content)
+		b.Write(mac.Sum(nil))
+		b.Write(size)
+		b.Write(content)
+		if len(content) == 0 {
+			return
+		}
+	}
+}
+
+// documentWriter writes the XML document of a database.
+type documentWriter struct {
+	b      *bytes.Buffer
+	stream cipher.Stream
+	err    error
+}
+
+func writeDocument(b *bytes.Buffer, db *Database, stream cipher.Stream) error {
+	d := &documentWriter{b: b, stream: stream}
+	b.WriteString(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>` + "\n<KeePassFile>\n<Meta>\n")
+	d.element("Generator", "go-hash")
+	d.element("DatabaseName", db.Root.Name)
+	d.element("RecycleBinEnabled", "False")
+	b.WriteString("</Meta>\n<Root>\n")
+	d.group(&db.Root)
+	b.WriteString("</Root>\n</KeePassFile>\n")
+	return d.err
+}
+
+func (d *documentWriter) element(name, value string) {
+	d.b.WriteString("<" + name + ">")
+	xml.EscapeText(d.b, []byte(value))
+	d.b.WriteString("</" + name + ">\n")
+}
+
+func (d *documentWriter) uuid(uuid string) {
+	if len(uuid) == 0 {
+		b := make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			d.err = err
+		}
+		uuid = base64.StdEncoding.EncodeToString(b)
+	}
+	d.element("UUID", uuid)
+}
+
+func (d *documentWriter) group(g *Group) {
+	d.b.WriteString("<Group>\n")
+	d.uuid(g.UUID)
+	d.element("Name", g.Name)
+	d.element("Notes", g.Notes)
+	for i := range g.Entries {
+		d.entry(&g.Entries[i])
+	}
+	for i := range g.Groups {
+		d.group(&g.Groups[i])
+	}
+	d.b.WriteString("</Group>\n")
+}
+
+func (d *documentWriter) entry(e *Entry) {
+	d.b.WriteString("<Entry>\n")
+	d.uuid(e.UUID)
+	d.element("Tags", strings.Join(e.Tags, ";"))
+	d.b.WriteString("<Times>\n")
+	d.element("LastModificationTime", formatTime(e.Modified))
+	d.element("ExpiryTime", formatTime(e.Expires))
+	if e.Expires.IsZero() {
+		d.element("Expires", "False")
+	} else {
+		d.element("Expires", "True")
+	}
+	d.b.WriteString("</Times>\n")
+	for _, f := range e.Fields {
+		d.b.WriteString("<String>\n")
+		d.element("Key", f.Key)
+		if f.Protected {
+			value := []byte(f.Value)
+			d.stream.XORKeyStream(value, value)
+			d.b.WriteString(`<Value Protected="True">` + base64.StdEncoding.EncodeToString(value) + "</Value>\n")
+		} else {
+			d.element("Value", f.Value)
+		}
+		d.b.WriteString("</String>\n")
+	}
+	d.b.WriteString("</Entry>\n")
+}
+
+// formatTime formats a time as KDBX 4 does: the base64-encoded number of seconds since 0001-01-01.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	// seconds between 0001-01-01 and 1970-01-01
+	const unixEpoch = 62135596800
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(t.Unix()+unixEpoch))
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// bytes encodes the dictionary.
+func (dict variantDictionary) bytes() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(0x0100))
+	for key, value := range dict {
+		var valueType byte
+		var v []byte
+		switch x := value.(type) {
+		case uint32:
+			valueType, v = variantUInt32, uint32Bytes(x)
+		case uint64:
+			valueType, v = variantUInt64, make([]byte, 8)
+			binary.LittleEndian.PutUint64(v, x)
+		case []byte:
+			valueType, v = variantByteArray, x
+		default:
+			continue
+		}
+		b.WriteByte(valueType)
+		b.Write(uint32Bytes(uint32(len(key))))
+		b.WriteString(key)
+		b.Write(uint32Bytes(uint32(len(v))))
+		b.Write(v)
+	}
+	b.WriteByte(variantEnd)
+	return b.Bytes()
+}
@@ -0,0 +1,540 @@
+// Package kdbx reads KeePass databases in the KDBX 3.1 and KDBX 4 formats, and writes them in the KDBX 4 format.
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/crypto/chacha20"
+	"github.com/golang/crypto/salsa20/salsa"
+	"github.com/golang/crypto/twofish"
+)
+
+const (
+	signature1 uint32 = 0x9AA2D903
+	signature2 uint32 = 0xB54BFB67
+)
+
+// header field IDs
+const (
+	fieldEndOfHeader         = 0
+	fieldCipherID            = 2
+	fieldCompressionFlags    = 3
+	fieldMasterSeed          = 4
+	fieldTransformSeed       = 5
+	fieldTransformRounds     = 6
+	fieldEncryptionIV        = 7
+	fieldProtectedStreamKey  = 8
+	fieldStreamStartBytes    = 9
+	fieldInnerRandomStreamID = 10
+	fieldKdfParameters       = 11
+)
+
+// limits of the KDF parameters accepted, so that a damaged or hostile file cannot make deriving its key exhaust
+// the memory or time of the computer. They are well above what KeePass and KeePassXC propose.
+const (
+	maxAESRounds        = 1 << 30
+	maxArgon2Iterations = 1000
+	maxArgon2Memory     = 4 << 30
+)
+
+// inner header field IDs (KDBX 4)
+const (
+	innerFieldEnd             = 0
+	innerFieldRandomStreamID  = 1
+	innerFieldRandomStreamKey = 2
+)
+
+// inner random stream IDs, used to protect values within the XML document
+const (
+	innerStreamSalsa20  = 2
+	innerStreamChaCha20 = 3
+)
+
+var (
+	cipherAES256   = mustDecodeUUID("31c1f2e6bf714350be5805216afc5aff")
+	cipherChaCha20 = mustDecodeUUID("d6038a2b8b6f4cb5a524339a31dbb59a")
+	cipherTwofish  = mustDecodeUUID("ad68f29f576f4bb9a36ad47af965346c")
+
+	kdfAESKDBX3 = mustDecodeUUID("c9d9f39a628a4460bf740d08c18a4fea")
+	kdfAESKDBX4 = mustDecodeUUID("7c02bb8279a74ac0927d114a00648238")
+	kdfArgon2d  = mustDecodeUUID("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdfArgon2id = mustDecodeUUID("9e298b1956db4773b23dfc3ec6f0a1e6")
+
+	salsa20Nonce = []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}
+)
+
+// ErrInvalidCredentials returned when the password or key file do not match the database.
+var ErrInvalidCredentials = errors.New("invalid password or key file")
+
+// ErrCorrupt returned when the database is damaged or is not a KeePass database.
+var ErrCorrupt = errors.New("the file is not a valid KeePass database, or it is damaged")
+
+func mustDecodeUUID(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 16 {
+		panic("invalid UUID: " + s)
+	}
+	return string(b)
+}
+
+// Credentials the secrets which unlock a KeePass database.
+type Credentials struct {
+	// Password the master password. It is not used if it is empty and a key file is given.
+	Password string
+	// KeyFile the content of the key file, if any.
+	KeyFile []byte
+}
+
+// compositeKey combines the password and the key file into the key which is given to the KDF.
+func (c Credentials) compositeKey() ([]byte, error) {
+	h := sha256.New()
+	if len(c.Password) > 0 || len(c.KeyFile) == 0 {
+		p := sha256.Sum256([]byte(c.Password))
+		h.Write(p[:])
+	}
+	if len(c.KeyFile) > 0 {
+		k, err := keyFileHash(c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(k)
+	}
+	return h.Sum(nil), nil
+}
+
+// keyFileHash returns the key contained in a key file, which may be an XML key file (version 1 or 2),
+// a binary key of 32 bytes, a key of 64 hexadecimal characters, or any other file, which is hashed.
+func keyFileHash(content []byte) ([]byte, error) {
+	if key, ok, err := xmlKeyFile(content); ok {
+		return key, err
+	}
+	if len(content) == 32 {
+		return content, nil
+	}
+	if len(content) == 64 {
+		if key, err := hex.DecodeString(string(content)); err == nil {
+			return key, nil
+		}
+	}
+	h := sha256.Sum256(content)
+	return h[:], nil
+}
+
+// header the outer header of a KDBX file.
+type header struct {
+	major  uint16
+	fields map[byte][]byte
+	kdf    variantDictionary
+	// length of the header in the file, including the signature and version
+	length int
+}
+
+// parseHeader parses the outer header at the start of a KDBX file.
+func parseHeader(data []byte) (header, error) {
+	h := header{fields: make(map[byte][]byte)}
+	if len(data) < 12 || binary.LittleEndian.Uint32(data) != signature1 ||
+		binary.LittleEndian.Uint32(data[4:]) != signature2 {
+		return h, ErrCorrupt
+	}
+	h.major = binary.LittleEndian.Uint16(data[10:])
+	if h.major != 3 && h.major != 4 {
+		return h, fmt.Errorf("unsupported KDBX version %d.%d, only versions 3.1 and 4 are supported",
+			h.major, binary.LittleEndian.Uint16(data[8:]))
+	}
+	pos := 12
+	for {
+		sizeLength := 2
+		if h.major == 4 {
+			sizeLength = 4
+		}
+		if len(data) < pos+1+sizeLength {
+			return h, ErrCorrupt
+		}
+		id := data[pos]
+		var size int
+		if h.major == 4 {
+			size = int(binary.LittleEndian.Uint32(data[pos+1:]))
+		} else {
+			size = int(binary.LittleEndian.Uint16(data[pos+1:]))
+		}
+		pos += 1 + sizeLength
+		if size < 0 || len(data) < pos+size {
+			return h, ErrCorrupt
+		}
+		h.fields[id] = data[pos : pos+size]
+		pos += size
+		if id == fieldEndOfHeader {
+			break
+		}
+	}
+	h.length = pos
+
+	if h.major == 4 {
+		kdf, err := parseVariantDictionary(h.fields[fieldKdfParameters])
+		if err != nil {
+			return h, err
+		}
+		h.kdf = kdf
+	} else {
+		// KDBX 3.1 always uses AES-KDF, with its parameters in separate header fields
+		rounds := h.fields[fieldTransformRounds]
+		if len(rounds) != 8 {
+			return h, ErrCorrupt
+		}
+		h.kdf = variantDictionary{
+			"$UUID": []byte(kdfAESKDBX3),
+			"S":     h.fields[fieldTransformSeed],
+			"R":     binary.LittleEndian.Uint64(rounds),
+		}
+	}
+	for _, id := range []byte{fieldCipherID, fieldMasterSeed, fieldEncryptionIV} {
+		if len(h.fields[id]) == 0 {
+			return h, ErrCorrupt
+		}
+	}
+	return h, nil
+}
+
+// transformKey derives the transformed key from the composite key, using the KDF given in the header.
+func (h header) transformKey(composite []byte) ([]byte, error) {
+	id, _ := h.kdf["$UUID"].([]byte)
+	seed, _ := h.kdf["S"].([]byte)
+	switch string(id) {
+	case kdfAESKDBX3, kdfAESKDBX4:
+		rounds, ok := h.kdf["R"].(uint64)
+		if !ok || len(seed) != 32 {
+			return nil, ErrCorrupt
+		}
+		if rounds > maxAESRounds {
+			return nil, fmt.Errorf("unsupported AES-KDF parameters: more than %d rounds", maxAESRounds)
+		}
+		block, err := aes.NewCipher(seed)
+		if err != nil {
+			return nil, err
+		}
+		key := append([]byte{}, composite...)
+		for i := uint64(0); i < rounds; i++ {
+			block.Encrypt(key[:16], key[:16])
+			block.Encrypt(key[16:], key[16:])
+		}
+		result := sha256.Sum256(key)
+		return result[:], nil
+	case kdfArgon2d, kdfArgon2id:
+		iterations, ok1 := h.kdf["I"].(uint64)
+		memory, ok2 := h.kdf["M"].(uint64)
+		parallelism, ok3 := h.kdf["P"].(uint32)
+		if !ok1 || !ok2 || !ok3 || len(seed) == 0 {
+			return nil, ErrCorrupt
+		}
+		if version, ok := h.kdf["V"].(uint32); ok && version != argon2Version {
+			return nil, fmt.Errorf("unsupported Argon2 version: %#x", version)
+		}
+		if iterations == 0 || parallelism == 0 || parallelism > 255 {
+			return nil, errors.New("unsupported Argon2 parameters")
+		}
+		if iterations > maxArgon2Iterations || memory > maxArgon2Memory {
+			return nil, fmt.Errorf("unsupported Argon2 parameters: more than %d iterations or %d GiB of memory",
+				maxArgon2Iterations, maxArgon2Memory>>30)
+		}
+		mode := argon2d
+		if string(id) == kdfArgon2id {
+			mode = argon2id
+		}
+		secret, _ := h.kdf["K"].([]byte)
+		data, _ := h.kdf["A"].([]byte)
+		return argon2Key(mode, composite, seed, secret, data, uint32(iterations), uint32(memory/1024),
+			uint8(parallelism), 32), nil
+	}
+	return nil, fmt.Errorf("unsupported key derivation function: %x", id)
+}
+
+// Decode decrypts a KeePass database with the given credentials.
+func Decode(r io.Reader, credentials Credentials) (*Database, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	composite, err := credentials.compositeKey()
+	if err != nil {
+		return nil, err
+	}
+	transformed, err := h.transformKey(composite)
+	if err != nil {
+		return nil, err
+	}
+	masterSeed := h.fields[fieldMasterSeed]
+	masterKey := sha256.Sum256(append(append([]byte{}, masterSeed...), transformed...))
+
+	var payload []byte
+	var stream cipher.Stream
+	if h.major == 4 {
+		payload, stream, err = decodeKDBX4(data, h, masterSeed, transformed, masterKey[:])
+	} else {
+		payload, stream, err = decodeKDBX3(data, h, masterKey[:])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseDatabase(bytes.NewReader(payload), stream)
+}
+
+func decodeKDBX3(data []byte, h header, masterKey []byte) ([]byte, cipher.Stream, error) {
+	plain, err := decrypt(h.fields[fieldCipherID], masterKey, h.fields[fieldEncryptionIV], data[h.length:])
+	if err != nil {
+		return nil, nil, err
+	}
+	start := h.fields[fieldStreamStartBytes]
+	if len(start) == 0 || len(plain) < len(start) || !hmac.Equal(plain[:len(start)], start) {
+		return nil, nil, ErrInvalidCredentials
+	}
+	payload, err := readHashedBlocks(plain[len(start):])
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload, err = decompress(h, payload); err != nil {
+		return nil, nil, err
+	}
+	streamID := h.fields[fieldInnerRandomStreamID]
+	if len(streamID) != 4 {
+		return nil, nil, ErrCorrupt
+	}
+	stream, err := newInnerStream(binary.LittleEndian.Uint32(streamID), h.fields[fieldProtectedStreamKey])
+	return payload, stream, err
+}
+
+func decodeKDBX4(data []byte, h header, masterSeed, transformed, masterKey []byte) ([]byte, cipher.Stream, error) {
+	if len(data) < h.length+64 {
+		return nil, nil, ErrCorrupt
+	}
+	headerData := data[:h.length]
+	headerHash := sha256.Sum256(headerData)
+	if !hmac.Equal(headerHash[:], data[h.length:h.length+32]) {
+		return nil, nil, ErrCorrupt
+	}
+	hmacKeyInput := append(append(append([]byte{}, masterSeed...), transformed...), 1)
+	hmacKey := sha512.Sum512(hmacKeyInput)
+	headerMAC := hmac.New(sha256.New, blockHMACKey(hmacKey[:], ^uint64(0)))
+	headerMAC.Write(headerData)
+	if !hmac.Equal(headerMAC.Sum(nil), data[h.length+32:h.length+64]) {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	encrypted, err := readHMACBlocks(data[h.length+64:], hmacKey[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err := decrypt(h.fields[fieldCipherID], masterKey, h.fields[fieldEncryptionIV], encrypted)
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload, err = decompress(h, payload); err != nil {
+		return nil, nil, err
+	}
+
+	// the inner header precedes the XML document
+	var streamID uint32
+	var streamKey []byte
+	pos := 0
+	for {
+		if len(payload) < pos+5 {
+			return nil, nil, ErrCorrupt
+		}
+		id := payload[pos]
+		size := int(binary.LittleEndian.Uint32(payload[pos+1:]))
+		pos += 5
+		if size < 0 || len(payload) < pos+size {
+			return nil, nil, ErrCorrupt
+		}
+		value := payload[pos : pos+size]
+		pos += size
+		switch id {
+		case innerFieldRandomStreamID:
+			if len(value) != 4 {
+				return nil, nil, ErrCorrupt
+			}
+			streamID = binary.LittleEndian.Uint32(value)
+		case innerFieldRandomStreamKey:
+			streamKey = value
+		}
+		if id == innerFieldEnd {
+			break
+		}
+	}
+	stream, err := newInnerStream(streamID, streamKey)
+	return payload[pos:], stream, err
+}
+
+// blockHMACKey returns the key used to calculate the HMAC of the block with the given index.
+func blockHMACKey(hmacKey []byte, index uint64) []byte {
+	var i [8]byte
+	binary.LittleEndian.PutUint64(i[:], index)
+	key := sha512.Sum512(append(i[:], hmacKey...))
+	return key[:]
+}
+
+// readHMACBlocks reads the HMAC-authenticated blocks of a KDBX 4 file, returning their content.
+func readHMACBlocks(data, hmacKey []byte) ([]byte, error) {
+	var result bytes.Buffer
+	for index := uint64(0); ; index++ {
+		if len(data) < 36 {
+			return nil, ErrCorrupt
+		}
+		mac, sizeBytes := data[:32], data[32:36]
+		size := int(binary.LittleEndian.Uint32(sizeBytes))
+		if size < 0 || len(data) < 36+size {
+			return nil, ErrCorrupt
+		}
+		content := data[36 : 36+size]
+		var i [8]byte
+		binary.LittleEndian.PutUint64(i[:], index)
+		h := hmac.New(sha256.New, blockHMACKey(hmacKey, index))
+		h.Write(i[:])
+		h.Write(sizeBytes)
+		h.Write(content)
+		if !hmac.Equal(h.Sum(nil), mac) {
+			return nil, ErrCorrupt
+		}
+		if size == 0 {
+			return result.Bytes(), nil
+		}
+		result.Write(content)
+		data = data[36+size:]
+	}
+}
+
+// readHashedBlocks reads the hashed blocks of a KDBX 3.1 file, returning their content.
+func readHashedBlocks(data []byte) ([]byte, error) {
+	var result bytes.Buffer
+	for {
+		if len(data) < 40 {
+			return nil, ErrCorrupt
+		}
+		hash := data[4:36]
+		size := int(binary.LittleEndian.Uint32(data[36:]))
+		if size < 0 || len(data) < 40+size {
+			return nil, ErrCorrupt
+		}
+		content := data[40 : 40+size]
+		if size == 0 {
+			return result.Bytes(), nil
+		}
+		if actual := sha256.Sum256(content); !hmac.Equal(actual[:], hash) {
+			return nil, ErrCorrupt
+		}
+		result.Write(content)
+		data = data[40+size:]
+	}
+}
+
+// decrypt decrypts the payload of a KDBX file with the cipher given in the header.
+func decrypt(cipherID, key, iv, data []byte) ([]byte, error) {
+	var block cipher.Block
+	var err error
+	switch string(cipherID) {
+	case cipherAES256:
+		block, err = aes.NewCipher(key)
+	case cipherTwofish:
+		block, err = twofish.NewCipher(key)
+	case cipherChaCha20:
+		c, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]byte, len(data))
+		c.XORKeyStream(result, data)
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported cipher: %x", cipherID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, ErrCorrupt
+	}
+	result := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(result, data)
+	// remove the PKCS#7 padding, which is invalid if the key is wrong
+	padding := int(result[len(result)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, ErrInvalidCredentials
+	}
+	for _, b := range result[len(result)-padding:] {
+		if int(b) != padding {
+			return nil, ErrInvalidCredentials
+		}
+	}
+	return result[:len(result)-padding], nil
+}
+
+func decompress(h header, data []byte) ([]byte, error) {
+	flags := h.fields[fieldCompressionFlags]
+	if len(flags) != 4 || binary.LittleEndian.Uint32(flags) == 0 {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	defer r.Close()
+	result, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return result, nil
+}
+
+// newInnerStream creates the stream cipher protecting values, such as passwords, within the XML document.
+func newInnerStream(id uint32, key []byte) (cipher.Stream, error) {
+	switch id {
+	case innerStreamSalsa20:
+		k := sha256.Sum256(key)
+		return &salsa20Stream{key: k, nonce: salsa20Nonce}, nil
+	case innerStreamChaCha20:
+		k := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(k[:32], k[32:44])
+	}
+	return nil, fmt.Errorf("unsupported inner random stream: %d", id)
+}
+
+// salsa20Stream a Salsa20 cipher.Stream. The salsa20 package only encrypts whole messages, but protected
+// values are encrypted with consecutive parts of a single key stream.
+type salsa20Stream struct {
+	key     [32]byte
+	nonce   []byte
+	counter uint64
+	// buffer the unused part of the last block of the key stream
+	buffer []byte
+}
+
+func (s *salsa20Stream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if len(s.buffer) == 0 {
+			var input [16]byte
+			copy(input[:], s.nonce)
+			binary.LittleEndian.PutUint64(input[8:], s.counter)
+			block := make([]byte, 64)
+			salsa.XORKeyStream(block, block, &input, &s.key)
+			s.buffer = block
+			s.counter++
+		}
+		dst[i] = src[i] ^ s.buffer[0]
+		s.buffer = s.buffer[1:]
+	}
+}
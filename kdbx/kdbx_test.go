@@ -0,0 +1,456 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/crypto/chacha20"
+	"github.com/golang/crypto/twofish"
+	"github.com/stretchr/testify/require"
+)
+
+// testFile options of a KeePass database written by encodeTestFile.
+type testFile struct {
+	major       uint16
+	cipher      string
+	kdf         string
+	compress    bool
+	innerStream uint32
+	credentials Credentials
+}
+
+var testMasterSeed = bytes.Repeat([]byte{1}, 32)
+var testKdfSeed = bytes.Repeat([]byte{2}, 32)
+var testStreamKey = bytes.Repeat([]byte{3}, 32)
+var testStartBytes = bytes.Repeat([]byte{4}, 32)
+
+// testDocument writes the XML document of the test database, protecting values with the stream.
+func testDocument(stream cipher.Stream) string {
+	protect := func(value string) string {
+		b := []byte(value)
+		stream.XORKeyStream(b, b)
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	// the History of the first entry comes before the second entry, so its protected values must be skipped
+	return `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+	<Meta>
+		<Generator>KeePass</Generator>
+		<RecycleBinEnabled>True</RecycleBinEnabled>
+		<RecycleBinUUID>cmVjeWNsZQ==</RecycleBinUUID>
+	</Meta>
+	<Root>
+		<Group>
+			<UUID>cm9vdA==</UUID>
+			<Name>Database</Name>
+			<Entry>
+				<UUID>ZW50cnkx</UUID>
+				<Tags>work;email</Tags>
+				<Times>
+					<LastModificationTime>2018-03-04T05:06:07Z</LastModificationTime>
+					<ExpiryTime>2019-01-01T00:00:00Z</ExpiryTime>
+					<Expires>True</Expires>
+				</Times>
+				<String><Key>Title</Key><Value>Mail</Value></String>
+				<String><Key>UserName</Key><Value>joe</Value></String>
+				<String><Key>Password</Key><Value Protected="True">` + protect("s3cr3t") + `</Value></String>
+				<String><Key>URL</Key><Value>https://mail.example.com</Value></String>
+				<String><Key>Notes</Key><Value>my mail</Value></String>
+				<String><Key>PIN</Key><Value Protected="True">` + protect("1234") + `</Value></String>
+				<String><Key>Recovery email</Key><Value>joe@example.org</Value></String>
+				<Binary><Key>photo.png</Key><Value Ref="0" /></Binary>
+				<History>
+					<Entry>
+						<String><Key>Title</Key><Value>Mail</Value></String>
+						<String><Key>Password</Key><Value Protected="True">` + protect("old password") + `</Value></String>
+					</Entry>
+				</History>
+			</Entry>
+			<Group>
+				<UUID>d2Vi</UUID>
+				<Name>Web</Name>
+				<Entry>
+					<UUID>ZW50cnky</UUID>
+					<Times>
+						<LastModificationTime>9CsH0g4AAAA=</LastModificationTime>
+						<Expires>False</Expires>
+					</Times>
+					<String><Key>Title</Key><Value>Forum</Value></String>
+					<String><Key>Password</Key><Value Protected="True">` + protect("p@ss w0rd") + `</Value></String>
+				</Entry>
+			</Group>
+			<Group>
+				<UUID>cmVjeWNsZQ==</UUID>
+				<Name>Recycle Bin</Name>
+			</Group>
+		</Group>
+	</Root>
+</KeePassFile>`
+}
+
+// encodeTestFile writes a KeePass database, following the KDBX specification.
+func encodeTestFile(t *testing.T, f testFile) []byte {
+	var hdr bytes.Buffer
+	binary.Write(&hdr, binary.LittleEndian, signature1)
+	binary.Write(&hdr, binary.LittleEndian, signature2)
+	binary.Write(&hdr, binary.LittleEndian, uint16(1))
+	binary.Write(&hdr, binary.LittleEndian, f.major)
+	writeField := func(id byte, value []byte) {
+		hdr.WriteByte(id)
+		if f.major == 4 {
+			binary.Write(&hdr, binary.LittleEndian, uint32(len(value)))
+		} else {
+			binary.Write(&hdr, binary.LittleEndian, uint16(len(value)))
+		}
+		hdr.Write(value)
+	}
+	uint32Bytes := func(v uint32) []byte {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, v)
+		return b
+	}
+
+	iv := bytes.Repeat([]byte{5}, 16)
+	if f.cipher == cipherChaCha20 {
+		iv = iv[:12]
+	}
+	compression := uint32(0)
+	if f.compress {
+		compression = 1
+	}
+	writeField(fieldCipherID, []byte(f.cipher))
+	writeField(fieldCompressionFlags, uint32Bytes(compression))
+	writeField(fieldMasterSeed, testMasterSeed)
+	writeField(fieldEncryptionIV, iv)
+	var kdf variantDictionary
+	switch f.kdf {
+	case kdfAESKDBX3, kdfAESKDBX4:
+		kdf = variantDictionary{"$UUID": []byte(f.kdf), "S": testKdfSeed, "R": uint64(1000)}
+	default:
+		kdf = variantDictionary{"$UUID": []byte(f.kdf), "S": testKdfSeed, "I": uint64(2), "M": uint64(1024 * 1024),
+			"P": uint32(2), "V": uint32(argon2Version)}
+	}
+	if f.major == 4 {
+		writeField(fieldKdfParameters, encodeVariantDictionary(kdf))
+	} else {
+		rounds := make([]byte, 8)
+		binary.LittleEndian.PutUint64(rounds, kdf["R"].(uint64))
+		writeField(fieldTransformSeed, testKdfSeed)
+		writeField(fieldTransformRounds, rounds)
+		writeField(fieldProtectedStreamKey, testStreamKey)
+		writeField(fieldStreamStartBytes, testStartBytes)
+		writeField(fieldInnerRandomStreamID, uint32Bytes(f.innerStream))
+	}
+	writeField(fieldEndOfHeader, []byte{'\r', '\n', '\r', '\n'})
+
+	composite, err := f.credentials.compositeKey()
+	require.NoError(t, err)
+	h := header{kdf: kdf}
+	transformed, err := h.transformKey(composite)
+	require.NoError(t, err)
+	masterKey := sha256.Sum256(append(append([]byte{}, testMasterSeed...), transformed...))
+
+	stream, err := newInnerStream(f.innerStream, testStreamKey)
+	require.NoError(t, err)
+	document := []byte(testDocument(stream))
+
+	var payload bytes.Buffer
+	if f.major == 4 {
+		payload.WriteByte(innerFieldRandomStreamID)
+		binary.Write(&payload, binary.LittleEndian, uint32(4))
+		payload.Write(uint32Bytes(f.innerStream))
+		payload.WriteByte(innerFieldRandomStreamKey)
+		binary.Write(&payload, binary.LittleEndian, uint32(len(testStreamKey)))
+		payload.Write(testStreamKey)
+		payload.WriteByte(innerFieldEnd)
+		binary.Write(&payload, binary.LittleEndian, uint32(0))
+	}
+	payload.Write(document)
+	content := payload.Bytes()
+	if f.compress {
+		var compressed bytes.Buffer
+		w := gzip.NewWriter(&compressed)
+		w.Write(content)
+		w.Close()
+		content = compressed.Bytes()
+	}
+
+	var file bytes.Buffer
+	file.Write(hdr.Bytes())
+	if f.major == 4 {
+		headerHash := sha256.Sum256(hdr.Bytes())
+		file.Write(headerHash[:])
+		hmacKey := sha512.Sum512(append(append(append([]byte{}, testMasterSeed...), transformed...), 1))
+		mac := hmac.New(sha256.New, blockHMACKey(hmacKey[:], ^uint64(0)))
+		mac.Write(hdr.Bytes())
+		file.Write(mac.Sum(nil))
+
+		encrypted := encryptTestPayload(t, f.cipher, masterKey[:], iv, content)
+		// split the payload in two blocks, followed by the empty final block
+		blocks := [][]byte{encrypted[:len(encrypted)/2], encrypted[len(encrypted)/2:], {}}
+		for i, block := range blocks {
+			var index [8]byte
+			binary.LittleEndian.PutUint64(index[:], uint64(i))
+			size := uint32Bytes(uint32(len(block)))
+			mac := hmac.New(sha256.New, blockHMACKey(hmacKey[:], uint64(i)))
+			mac.Write(index[:])
+			mac.Write(size)
+			mac.Write(block)
+			file.Write(mac.Sum(nil))
+			file.Write(size)
+			file.Write(block)
+		}
+	} else {
+		var hashed bytes.Buffer
+		hashed.Write(testStartBytes)
+		blocks := [][]byte{content[:len(content)/2], content[len(content)/2:], {}}
+		for i, block := range blocks {
+			hashed.Write(uint32Bytes(uint32(i)))
+			if len(block) == 0 {
+				hashed.Write(make([]byte, 32))
+			} else {
+				hash := sha256.Sum256(block)
+				hashed.Write(hash[:])
+			}
+			hashed.Write(uint32Bytes(uint32(len(block))))
+			hashed.Write(block)
+		}
+		file.Write(encryptTestPayload(t, f.cipher, masterKey[:], iv, hashed.Bytes()))
+	}
+	return file.Bytes()
+}
+
+func encryptTestPayload(t *testing.T, cipherID string, key, iv, data []byte) []byte {
+	var block cipher.Block
+	var err error
+	switch cipherID {
+	case cipherChaCha20:
+		c, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		require.NoError(t, err)
+		result := make([]byte, len(data))
+		c.XORKeyStream(result, data)
+		return result
+	case cipherTwofish:
+		block, err = twofish.NewCipher(key)
+	default:
+		block, err = aes.NewCipher(key)
+	}
+	require.NoError(t, err)
+	padding := block.BlockSize() - len(data)%block.BlockSize()
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	result := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(result, padded)
+	return result
+}
+
+func encodeVariantDictionary(dict variantDictionary) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint16(0x0100))
+	for key, value := range dict {
+		var valueType byte
+		var v []byte
+		switch x := value.(type) {
+		case uint32:
+			valueType, v = variantUInt32, make([]byte, 4)
+			binary.LittleEndian.PutUint32(v, x)
+		case uint64:
+			valueType, v = variantUInt64, make([]byte, 8)
+			binary.LittleEndian.PutUint64(v, x)
+		case []byte:
+			valueType, v = variantByteArray, x
+		default:
+			panic(fmt.Sprintf("unsupported type: %T", value))
+		}
+		b.WriteByte(valueType)
+		binary.Write(&b, binary.LittleEndian, int32(len(key)))
+		b.WriteString(key)
+		binary.Write(&b, binary.LittleEndian, int32(len(v)))
+		b.Write(v)
+	}
+	b.WriteByte(variantEnd)
+	return b.Bytes()
+}
+
+func requireTestDatabase(t *testing.T, db *Database) {
+	require.Equal(t, "Database", db.Root.Name)
+	require.Equal(t, "cmVjeWNsZQ==", db.RecycleBin)
+	require.Len(t, db.Root.Entries, 1)
+
+	mail := db.Root.Entries[0]
+	require.Equal(t, "Mail", mail.Get(FieldTitle))
+	require.Equal(t, "joe", mail.Get(FieldUserName))
+	require.Equal(t, "s3cr3t", mail.Get(FieldPassword))
+	require.Equal(t, "https://mail.example.com", mail.Get(FieldURL))
+	require.Equal(t, "my mail", mail.Get(FieldNotes))
+	require.Equal(t, Field{Key: "PIN", Value: "1234", Protected: true}, mail.Fields[5])
+	require.Equal(t, Field{Key: "Recovery email", Value: "joe@example.org"}, mail.Fields[6])
+	require.Equal(t, []string{"work", "email"}, mail.Tags)
+	require.Equal(t, time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC), mail.Modified)
+	require.Equal(t, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), mail.Expires)
+	require.Equal(t, []string{"photo.png"}, mail.Attachments)
+	require.Equal(t, 1, mail.HistorySize)
+
+	require.Len(t, db.Root.Groups, 2)
+	web := db.Root.Groups[0]
+	require.Equal(t, "Web", web.Name)
+	require.Len(t, web.Entries, 1)
+	forum := web.Entries[0]
+	require.Equal(t, "Forum", forum.Get(FieldTitle))
+	require.Equal(t, "p@ss w0rd", forum.Get(FieldPassword))
+	require.Equal(t, time.Date(2018, 2, 3, 4, 5, 8, 0, time.UTC), forum.Modified)
+	require.True(t, forum.Expires.IsZero())
+	require.Equal(t, db.RecycleBin, db.Root.Groups[1].UUID)
+}
+
+func TestDecode(t *testing.T) {
+	keyFile := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta><Version>2.0</Version></Meta>
+	<Key>
+		<Data Hash="A4DB2BC1">
+			E7A7C1E3 27F0F6A5 3D4D4A0F 4E7E3C26
+			5E1B4E66 8B2C7F5A 3E9D6B7C 1A2B3C4D
+		</Data>
+	</Key>
+</KeyFile>`)
+	keyHash := sha256.Sum256(mustHex("E7A7C1E327F0F6A53D4D4A0F4E7E3C265E1B4E668B2C7F5A3E9D6B7C1A2B3C4D"))
+	keyFile = bytes.Replace(keyFile, []byte("A4DB2BC1"), []byte(hex.EncodeToString(keyHash[:4])), 1)
+
+	files := map[string]testFile{
+		"KDBX 4, Argon2d, AES": {major: 4, cipher: cipherAES256, kdf: kdfArgon2d, compress: true,
+			innerStream: innerStreamChaCha20, credentials: Credentials{Password: "secret"}},
+		"KDBX 4, Argon2id, ChaCha20, key file": {major: 4, cipher: cipherChaCha20, kdf: kdfArgon2id,
+			innerStream: innerStreamChaCha20, credentials: Credentials{Password: "secret", KeyFile: keyFile}},
+		"KDBX 4, AES-KDF, Twofish, key file only": {major: 4, cipher: cipherTwofish, kdf: kdfAESKDBX4,
+			compress: true, innerStream: innerStreamSalsa20, credentials: Credentials{KeyFile: []byte("any file")}},
+		"KDBX 3.1, AES-KDF, AES": {major: 3, cipher: cipherAES256, kdf: kdfAESKDBX3, compress: true,
+			innerStream: innerStreamSalsa20, credentials: Credentials{Password: "secret"}},
+		"KDBX 3.1, AES-KDF, Twofish": {major: 3, cipher: cipherTwofish, kdf: kdfAESKDBX3,
+			innerStream: innerStreamSalsa20, credentials: Credentials{Password: "secret"}},
+	}
+	for name, f := range files {
+		data := encodeTestFile(t, f)
+
+		db, err := Decode(bytes.NewReader(data), f.credentials)
+		require.NoError(t, err, name)
+		requireTestDatabase(t, db)
+
+		wrong := f.credentials
+		wrong.Password = "wrong"
+		_, err = Decode(bytes.NewReader(data), wrong)
+		require.Equal(t, ErrInvalidCredentials, err, name)
+	}
+}
+
+func TestDecodeInvalidFile(t *testing.T) {
+	_, err := Decode(bytes.NewReader([]byte("not a KeePass database")), Credentials{Password: "secret"})
+	require.Equal(t, ErrCorrupt, err)
+
+	data := encodeTestFile(t, testFile{major: 4, cipher: cipherAES256, kdf: kdfAESKDBX4,
+		innerStream: innerStreamChaCha20, credentials: Credentials{Password: "secret"}})
+	data[len(data)-50] ^= 1
+	_, err = Decode(bytes.NewReader(data), Credentials{Password: "secret"})
+	require.Equal(t, ErrCorrupt, err)
+}
+
+func TestTransformKeyLimits(t *testing.T) {
+	composite := make([]byte, 32)
+	for _, kdf := range []variantDictionary{
+		{"$UUID": []byte(kdfArgon2d), "S": testKdfSeed, "I": uint64(2), "M": uint64(1<<32-1) * 1024, "P": uint32(1)},
+		{"$UUID": []byte(kdfArgon2id), "S": testKdfSeed, "I": uint64(maxArgon2Iterations + 1), "M": uint64(1024 * 1024),
+			"P": uint32(1)},
+		{"$UUID": []byte(kdfAESKDBX4), "S": testKdfSeed, "R": uint64(1 << 62)},
+	} {
+		_, err := header{kdf: kdf}.transformKey(composite)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported")
+	}
+}
+
+func TestKeyFileHash(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	hash, err := keyFileHash(key)
+	require.NoError(t, err)
+	require.Equal(t, key, hash)
+
+	hash, err = keyFileHash([]byte(hex.EncodeToString(key)))
+	require.NoError(t, err)
+	require.Equal(t, key, hash)
+
+	hash, err = keyFileHash([]byte(`<KeyFile><Meta><Version>1.00</Version></Meta><Key><Data>` +
+		base64.StdEncoding.EncodeToString(key) + `</Data></Key></KeyFile>`))
+	require.NoError(t, err)
+	require.Equal(t, key, hash)
+
+	other := sha256.Sum256([]byte("some file"))
+	hash, err = keyFileHash([]byte("some file"))
+	require.NoError(t, err)
+	require.Equal(t, other[:], hash)
+
+	_, err = keyFileHash([]byte(`<KeyFile><Meta><Version>2.0</Version></Meta><Key><Data Hash="00000000">` +
+		hex.EncodeToString(key) + `</Data></Key></KeyFile>`))
+	require.Error(t, err)
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestEncode(t *testing.T) {
+	iterations, memory := encodeIterations, encodeMemory
+	encodeIterations, encodeMemory = 1, 1024*1024
+	defer func() {
+		encodeIterations, encodeMemory = iterations, memory
+	}()
+
+	modified := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	expires := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	db := &Database{Root: Group{Name: "go-hash", Groups: []Group{{Name: "Web <&>", Entries: []Entry{{
+		Fields: []Field{
+			{Key: FieldTitle, Value: "Forum"},
+			{Key: FieldUserName, Value: "joe"},
+			{Key: FieldPassword, Value: "p@ss w0rd", Protected: true},
+			{Key: FieldNotes, Value: "line 1\nline 2"},
+		},
+		Tags:     []string{"work", "forum"},
+		Modified: modified,
+		Expires:  expires,
+	}}}}}}
+	credentials := Credentials{Password: "secret"}
+	var b bytes.Buffer
+	require.NoError(t, Encode(&b, db, credentials))
+
+	decoded, err := Decode(bytes.NewReader(b.Bytes()), credentials)
+	require.NoError(t, err)
+	require.Equal(t, "go-hash", decoded.Root.Name)
+	require.NotEmpty(t, decoded.Root.UUID)
+	require.Empty(t, decoded.RecycleBin)
+	require.Len(t, decoded.Root.Groups, 1)
+	web := decoded.Root.Groups[0]
+	require.Equal(t, "Web <&>", web.Name)
+	require.Len(t, web.Entries, 1)
+	entry := web.Entries[0]
+	require.NotEmpty(t, entry.UUID)
+	require.Equal(t, db.Root.Groups[0].Entries[0].Fields, entry.Fields)
+	require.Equal(t, []string{"work", "forum"}, entry.Tags)
+	require.Equal(t, modified, entry.Modified)
+	require.Equal(t, expires, entry.Expires)
+
+	_, err = Decode(bytes.NewReader(b.Bytes()), Credentials{Password: "wrong"})
+	require.Equal(t, ErrInvalidCredentials, err)
+}
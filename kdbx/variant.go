@@ -0,0 +1,87 @@
+package kdbx
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// variantDictionary a dictionary of typed values, used by KDBX 4 to store the parameters of the KDF.
+// Values are uint32, uint64, bool, int32, int64, string or []byte.
+type variantDictionary map[string]interface{}
+
+// value types of a variantDictionary
+const (
+	variantEnd       = 0x00
+	variantUInt32    = 0x04
+	variantUInt64    = 0x05
+	variantBool      = 0x08
+	variantInt32     = 0x0C
+	variantInt64     = 0x0D
+	variantString    = 0x18
+	variantByteArray = 0x42
+)
+
+func parseVariantDictionary(data []byte) (variantDictionary, error) {
+	if len(data) < 2 {
+		return nil, ErrCorrupt
+	}
+	if version := binary.LittleEndian.Uint16(data); version>>8 != 1 {
+		return nil, fmt.Errorf("unsupported KDF parameters version: %#x", version)
+	}
+	dict := make(variantDictionary)
+	pos := 2
+	// next returns the next length-prefixed item
+	next := func() ([]byte, bool) {
+		if len(data) < pos+4 {
+			return nil, false
+		}
+		size := int(int32(binary.LittleEndian.Uint32(data[pos:])))
+		pos += 4
+		if size < 0 || len(data) < pos+size {
+			return nil, false
+		}
+		item := data[pos : pos+size]
+		pos += size
+		return item, true
+	}
+	for {
+		if len(data) < pos+1 {
+			return nil, ErrCorrupt
+		}
+		valueType := data[pos]
+		pos++
+		if valueType == variantEnd {
+			return dict, nil
+		}
+		key, ok := next()
+		if !ok {
+			return nil, ErrCorrupt
+		}
+		value, ok := next()
+		if !ok {
+			return nil, ErrCorrupt
+		}
+		size := map[byte]int{variantUInt32: 4, variantUInt64: 8, variantBool: 1, variantInt32: 4, variantInt64: 8}
+		if expected, fixed := size[valueType]; fixed && len(value) != expected {
+			return nil, ErrCorrupt
+		}
+		switch valueType {
+		case variantUInt32:
+			dict[string(key)] = binary.LittleEndian.Uint32(value)
+		case variantUInt64:
+			dict[string(key)] = binary.LittleEndian.Uint64(value)
+		case variantBool:
+			dict[string(key)] = value[0] != 0
+		case variantInt32:
+			dict[string(key)] = int32(binary.LittleEndian.Uint32(value))
+		case variantInt64:
+			dict[string(key)] = int64(binary.LittleEndian.Uint64(value))
+		case variantString:
+			dict[string(key)] = string(value)
+		case variantByteArray:
+			dict[string(key)] = append([]byte{}, value...)
+		default:
+			return nil, fmt.Errorf("unsupported KDF parameter type: %#x", valueType)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/renatoathaydes/go-hash/encryption"
+)
+
+// limits of the parameters accepted by the kdf calibrate command, and of those read from database headers
+const (
+	minKdfTarget    = 100 * time.Millisecond
+	maxKdfTarget    = time.Minute
+	minKdfMemoryMiB = 8
+	maxKdfMemoryMiB = 4096
+	maxKdfTime      = 1000
+)
+
+// validKDF whether the KDF parameters are within the limits go-hash uses, so that deriving a key with parameters
+// read from an unauthenticated header cannot exhaust the memory or time of the computer.
+func validKDF(kdf encryption.KDFParams) bool {
+	return kdf.Time > 0 && kdf.Time <= maxKdfTime && kdf.Threads > 0 &&
+		kdf.Memory >= 8*uint32(kdf.Threads) && kdf.Memory <= maxKdfMemoryMiB*1024
+}
+
+// kdfCost the relative cost of a guess of the master password, as the product of its time and memory parameters.
+func kdfCost(kdf encryption.KDFParams) float64 {
+	return float64(kdf.Time) * float64(kdf.Memory)
+}
+
+// kdfComparison shows the current and proposed KDF parameters side by side, with how long deriving a key takes
+// and how many passwords per second could be guessed with them on this computer.
+func kdfComparison(current, proposed encryption.KDFParams, currentTime, proposedTime time.Duration) string {
+	var b bytes.Buffer
+	row := func(name, current, proposed string) {
+		fmt.Fprintf(&b, "  %-22s %-12s %s\n", name, current, proposed)
+	}
+	memory := func(kdf encryption.KDFParams) string {
+		return fmt.Sprintf("%d MiB", kdf.Memory/1024)
+	}
+	guesses := func(elapsed time.Duration) string {
+		return fmt.Sprintf("%.1f", 1/elapsed.Seconds())
+	}
+	row("", "current", "proposed")
+	row("Time (iterations):", fmt.Sprint(current.Time), fmt.Sprint(proposed.Time))
+	row("Memory:", memory(current), memory(proposed))
+	row("Parallelism:", fmt.Sprint(current.Threads), fmt.Sprint(proposed.Threads))
+	row("Unlock time:", formatKdfTime(currentTime), formatKdfTime(proposedTime))
+	row("Guesses per second:", guesses(currentTime), guesses(proposedTime))
+	return b.String()
+}
+
+func formatKdfTime(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
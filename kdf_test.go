@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/renatoathaydes/go-hash/encryption"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKdfCost(t *testing.T) {
+	current := encryption.KDFParams{Time: 8, Memory: 32 * 1024, Threads: 4}
+	proposed := encryption.KDFParams{Time: 4, Memory: 256 * 1024, Threads: 4}
+	require.Equal(t, 4.0, kdfCost(proposed)/kdfCost(current))
+	require.Equal(t, 0.25, kdfCost(current)/kdfCost(proposed))
+}
+
+func TestKdfComparison(t *testing.T) {
+	current := encryption.KDFParams{Time: 8, Memory: 32 * 1024, Threads: 4}
+	proposed := encryption.KDFParams{Time: 12, Memory: 64 * 1024, Threads: 2}
+	require.Equal(t, `                         current      proposed
+  Time (iterations):     8            12
+  Memory:                32 MiB       64 MiB
+  Parallelism:           4            2
+  Unlock time:           250ms        1.2s
+  Guesses per second:    4.0          0.8
+`, kdfComparison(current, proposed, 250*time.Millisecond, 1200400*time.Microsecond))
+}
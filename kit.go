@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/renatoathaydes/go-hash/encryption"
+	"golang.org/x/crypto/ssh/terminal"
+	"rsc.io/qr"
+)
+
+// recoveryKeyPrefix identifies recovery keys, and the version of their format.
+const recoveryKeyPrefix = "GHRK1"
+
+// recoveryKeyChecksumLength the number of bytes of the SHA-256 hash of the key appended to it, to detect typos.
+const recoveryKeyChecksumLength = 3
+
+// vaultCodePrefix identifies the QR codes holding the encrypted database, and the version of their format.
+const vaultCodePrefix = "GHKIT1"
+
+// vaultCodeLength the number of base32 characters of the database in each QR code.
+const vaultCodeLength = 1800
+
+// maxVaultCodes the maximum number of QR codes printed for the encrypted database.
+const maxVaultCodes = 100
+
+// kitEncoding the encoding of recovery keys and of the encrypted database, whose characters can all be encoded
+// in the compact alphanumeric mode of QR codes.
+var kitEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// encodeRecoveryKey encodes the hash of the master password (P), which can be used to open the database without
+// it, in groups of 4 characters, e.g. GHRK1-ABCD-EFGH-...
+func encodeRecoveryKey(key DatabaseKey) string {
+	checksum := sha256.Sum256(key.P)
+	encoded := kitEncoding.EncodeToString(append(append([]byte{}, key.P...), checksum[:recoveryKeyChecksumLength]...))
+	groups := []string{recoveryKeyPrefix}
+	for i := 0; i < len(encoded); i += 4 {
+		end := i + 4
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		groups = append(groups, encoded[i:end])
+	}
+	return strings.Join(groups, "-")
+}
+
+// decodeRecoveryKey decodes a recovery key, ignoring case, whitespace and dashes.
+func decodeRecoveryKey(recoveryKey string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.Join(strings.Fields(strings.Replace(recoveryKey, "-", " ", -1)), ""))
+	if !strings.HasPrefix(normalized, recoveryKeyPrefix) {
+		return nil, errors.New("not a go-hash recovery key, which starts with " + recoveryKeyPrefix)
+	}
+	decoded, err := kitEncoding.DecodeString(normalized[len(recoveryKeyPrefix):])
+	if err != nil || len(decoded) != int(encryption.KEYLEN)+recoveryKeyChecksumLength {
+		return nil, errors.New("invalid recovery key, please check it was entered correctly")
+	}
+	p := decoded[:encryption.KEYLEN]
+	checksum := sha256.Sum256(p)
+	if subtle.ConstantTimeCompare(checksum[:recoveryKeyChecksumLength], decoded[encryption.KEYLEN:]) != 1 {
+		return nil, errors.New("invalid recovery key, please check it was entered correctly")
+	}
+	return p, nil
+}
+
+// vaultCodes splits the content of the database file into the texts of QR codes, formatted as
+// GHKIT1:<n>/<total>:<hash>:<data>, where hash is the start of the SHA-256 hash of the whole file and data is
+// a part of the file, base32-encoded.
+func vaultCodes(content []byte) []string {
+	hash := sha256.Sum256(content)
+	id := strings.ToUpper(hex.EncodeToString(hash[:4]))
+	encoded := kitEncoding.EncodeToString(content)
+	total := (len(encoded) + vaultCodeLength - 1) / vaultCodeLength
+	var codes []string
+	for i := 0; i < total; i++ {
+		end := (i + 1) * vaultCodeLength
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		codes = append(codes, fmt.Sprintf("%s:%d/%d:%s:%s", vaultCodePrefix, i+1, total, id,
+			encoded[i*vaultCodeLength:end]))
+	}
+	return codes
+}
+
+// assembleVault rebuilds the database file from the texts of its QR codes, given in any order. Lines which are
+// not vault codes are ignored.
+func assembleVault(lines []string) ([]byte, error) {
+	var parts []string
+	var id string
+	found := 0
+	for _, line := range lines {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 4 || fields[0] != vaultCodePrefix {
+			continue
+		}
+		numbers := strings.Split(fields[1], "/")
+		if len(numbers) != 2 {
+			return nil, fmt.Errorf("invalid code number: %s", fields[1])
+		}
+		n, err1 := strconv.Atoi(numbers[0])
+		total, err2 := strconv.Atoi(numbers[1])
+		if err1 != nil || err2 != nil || n < 1 || n > total {
+			return nil, fmt.Errorf("invalid code number: %s", fields[1])
+		}
+		if parts == nil {
+			parts, id = make([]string, total), fields[2]
+		}
+		if total != len(parts) || fields[2] != id {
+			return nil, errors.New("the codes belong to different emergency kits")
+		}
+		if len(parts[n-1]) == 0 {
+			found++
+		}
+		parts[n-1] = fields[3]
+	}
+	if parts == nil {
+		return nil, errors.New("no codes of an emergency kit found, they start with " + vaultCodePrefix)
+	}
+	if found < len(parts) {
+		var missing []string
+		for i, p := range parts {
+			if len(p) == 0 {
+				missing = append(missing, strconv.Itoa(i+1))
+			}
+		}
+		return nil, fmt.Errorf("codes %s of %d are missing", strings.Join(missing, ", "), len(parts))
+	}
+	content, err := kitEncoding.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		return nil, errors.New("invalid code, please scan the codes again")
+	}
+	hash := sha256.Sum256(content)
+	if strings.ToUpper(hex.EncodeToString(hash[:4])) != id {
+		return nil, errors.New("the rebuilt database is damaged, please scan the codes again")
+	}
+	return content, nil
+}
+
+// kitCode a QR code of an emergency kit, with its text.
+type kitCode struct {
+	Label string
+	SVG   template.HTML
+	Text  string
+}
+
+// emergencyKit the content of a printable emergency kit.
+type emergencyKit struct {
+	Created      time.Time
+	DatabasePath string
+	Version      string
+	Salt         string
+	KDF          [][2]string
+	RecoveryKey  *kitCode
+	Vault        []kitCode
+	VaultSize    int
+	VaultSHA256  string
+}
+
+// newEmergencyKit creates the emergency kit of the database at the given path. With vault, it holds the whole
+// encrypted database, otherwise it holds the recovery key derived from the master password.
+func newEmergencyKit(dbPath string, key DatabaseKey, vault bool, now time.Time) (*emergencyKit, error) {
+	absPath, err := filepath.Abs(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < 4+int(encryption.SALTLEN) || !bytes.Equal(content[4:4+encryption.SALTLEN], key.Salt) {
+		return nil, errors.New("the key does not belong to this database")
+	}
+	kit := &emergencyKit{
+		Created:      now,
+		DatabasePath: absPath,
+		Version:      string(content[:4]),
+		Salt:         hex.EncodeToString(key.Salt),
+		KDF:          kdfParameters(key.KDF, string(content[:4])),
+	}
+	if vault {
+		codes := vaultCodes(content)
+		if len(codes) > maxVaultCodes {
+			return nil, fmt.Errorf("the database is too big to be printed (%d QR codes), "+
+				"use a kit with the recovery key and keep a copy of the database instead", len(codes))
+		}
+		for i, text := range codes {
+			svg, err := qrSVG(text)
+			if err != nil {
+				return nil, err
+			}
+			kit.Vault = append(kit.Vault, kitCode{Label: fmt.Sprintf("%d of %d", i+1, len(codes)), SVG: svg, Text: text})
+		}
+		hash := sha256.Sum256(content)
+		kit.VaultSize, kit.VaultSHA256 = len(content), hex.EncodeToString(hash[:])
+	} else {
+		text := encodeRecoveryKey(key)
+		svg, err := qrSVG(text)
+		if err != nil {
+			return nil, err
+		}
+		kit.RecoveryKey = &kitCode{Label: "Recovery key", SVG: svg, Text: text}
+	}
+	return kit, nil
+}
+
+// qrSVG draws the QR code of the text as an SVG image, with the quiet zone around it.
+func qrSVG(text string) (template.HTML, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", err
+	}
+	const quietZone = 4
+	var path bytes.Buffer
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			start := x
+			for x+1 < code.Size && code.Black(x+1, y) {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+quietZone, y+quietZone, x-start+1, x-start+1)
+		}
+	}
+	size := code.Size + 2*quietZone
+	return template.HTML(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" `+
+		`shape-rendering="crispEdges"><rect width="%d" height="%d" fill="#fff"/><path d="%s"/></svg>`,
+		size, size, size, size, path.String())), nil
+}
+
+// writeEmergencyKit writes the emergency kit as an HTML document to the given path.
+func writeEmergencyKit(path string, kit *emergencyKit) error {
+	var b bytes.Buffer
+	if err := kitTemplate.Execute(&b, kit); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(b.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+var kitTemplate = template.Must(template.New("kit").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>go-hash emergency kit</title>
+<style>
+  body { font-family: sans-serif; max-width: 48em; margin: 2em auto; color: #000; }
+  h1 { border-bottom: 2px solid #000; }
+  table { border-collapse: collapse; }
+  td, th { border: 1px solid #888; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+  code, .text { font-family: monospace; word-break: break-all; }
+  .warning { border: 2px solid #c00; padding: 0.5em 1em; }
+  .code { page-break-inside: avoid; break-inside: avoid; margin: 1em 0; }
+  .code svg { width: 12cm; height: 12cm; display: block; }
+  .key svg { width: 6cm; height: 6cm; }
+  .key .text { font-size: 1.3em; }
+  .vault .text { font-size: 0.55em; }
+  @media print { a { color: #000; text-decoration: none; } }
+</style>
+</head>
+<body>
+<h1>go-hash emergency kit</h1>
+<p>Created on {{.Created.Format "2006-01-02 15:04 MST"}}.</p>
+{{if .RecoveryKey}}
+<p class="warning"><strong>Keep this document somewhere safe, e.g. locked away at home.</strong> Together with a copy of
+the database, the recovery key opens it without the master password: anyone who holds both can read all of your
+passwords. The key stops working when the master password is changed, so print a new kit when you change it.</p>
+{{else}}
+<p class="warning"><strong>Keep this document somewhere safe.</strong> It holds your whole database, encrypted. It can
+only be opened with your master password, so its protection depends on the strength of that password.
+Entries added or changed after {{.Created.Format "2006-01-02"}} are not in it: print a new kit from time to time.</p>
+{{end}}
+
+<h2>Database</h2>
+<table>
+  <tr><th>Location</th><td><code>{{.DatabasePath}}</code></td></tr>
+  <tr><th>Format version</th><td><code>{{.Version}}</code></td></tr>
+  <tr><th>Salt</th><td><code>{{.Salt}}</code></td></tr>
+  {{if .Vault}}<tr><th>Size</th><td>{{.VaultSize}} bytes</td></tr>
+  <tr><th>SHA-256</th><td><code>{{.VaultSHA256}}</code></td></tr>{{end}}
+</table>
+
+<h3>Key derivation function</h3>
+<p>The master password is hashed with these parameters, and with the salt above, to get the key (P) which
+decrypts the database.</p>
+<table>
+  {{range .KDF}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+  {{end}}
+</table>
+
+<h2>Restoring the database</h2>
+<ol>
+  <li>Install go-hash from <a href="https://github.com/renatoathaydes/go-hash/releases">https://github.com/renatoathaydes/go-hash/releases</a>.</li>
+{{if .RecoveryKey}}
+  <li>Get a copy of the database file, e.g. from a backup or a cloud drive, and save it as
+    <code>~/.go-hash</code> (or anywhere else).</li>
+  <li>If you remember the master password, just run <code>go-hash</code> (or <code>go-hash &lt;file&gt;</code>).
+    Otherwise run <code>go-hash recover -db &lt;file&gt;</code>, enter the recovery key below (scan its QR code,
+    or type it: dashes, spaces and case do not matter), and choose a new master password.</li>
+  <li>Print a new emergency kit with the <code>kit</code> command, and destroy this one.</li>
+</ol>
+
+<h2>Recovery key</h2>
+<div class="code key">
+  {{.RecoveryKey.SVG}}
+  <p class="text">{{.RecoveryKey.Text}}</p>
+</div>
+<p>The recovery key is the base32 encoding (RFC 4648, without padding) of the 32-byte key P followed by the first
+3 bytes of its SHA-256 hash, after the <code>GHRK1</code> prefix.</p>
+{{else}}
+  <li>Scan all of the {{len .Vault}} QR codes below, in any order, e.g. with the camera of a phone, and save their
+    texts in a file, one per line. Codes which fail to scan can be typed from the text printed under them.</li>
+  <li>Run <code>go-hash recover -vault &lt;codes-file&gt; -db ~/.go-hash</code> to rebuild the database file,
+    then open it with <code>go-hash</code> and your master password.</li>
+</ol>
+<p>Each code holds the text <code>GHKIT1:&lt;n&gt;/&lt;total&gt;:&lt;id&gt;:&lt;data&gt;</code>. Without go-hash,
+the database file can be rebuilt by joining the data of all codes in order, and decoding it with base32
+(RFC 4648, without padding). The first 8 hexadecimal digits of its SHA-256 hash are the id of the codes.</p>
+
+<h2>Encrypted database</h2>
+{{range .Vault}}
+<div class="code vault">
+  <p><strong>Code {{.Label}}</strong></p>
+  {{.SVG}}
+  <p class="text">{{.Text}}</p>
+</div>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func runRecoverSubcommand(args []string) int {
+	fs := newFlagSet("recover")
+	dbPath := fs.String("db", defaultDatabasePath(), "path of the database file (default: $GO_HASH_DB or ~/.go-hash)")
+	vaultFile := fs.String("vault", "", "rebuild the database from a file holding the texts of the kit's QR codes")
+	var recoveryKey secretSource
+	recoveryKey.addFlags(fs, "key", "recovery key")
+	if positional, err := parseArgs(fs, args); err != nil || len(positional) > 0 {
+		return exitUsage
+	}
+	if len(*vaultFile) > 0 {
+		if recoveryKey.isSet() {
+			println("Error: -vault cannot be used together with a recovery key")
+			return exitUsage
+		}
+		return exitCodeOf(recoverVault(*vaultFile, *dbPath))
+	}
+	return exitCodeOf(recoverWithKey(*dbPath, &recoveryKey))
+}
+
+// recoverVault rebuilds the database file at dbPath from the texts of the QR codes of an emergency kit.
+func recoverVault(vaultFile, dbPath string) error {
+	if _, err := os.Stat(dbPath); err == nil {
+		return cliError{exitError, "'" + dbPath + "' already exists, choose another path with -db or move it away"}
+	}
+	codes, err := ioutil.ReadFile(vaultFile)
+	if err != nil {
+		return err
+	}
+	content, err := assembleVault(strings.Split(string(codes), "\n"))
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(dbPath, content, 0600); err != nil {
+		return err
+	}
+	println("Database restored to '" + dbPath + "'. Open it with your master password.")
+	return nil
+}
+
+// recoverWithKey opens the database at dbPath with a recovery key, and re-encrypts it with a new master password.
+func recoverWithKey(dbPath string, recoveryKey *secretSource) error {
+	if _, err := os.Stat(dbPath); err != nil {
+		return cliError{exitError, "cannot open database: " + err.Error()}
+	}
+	text, ok, err := recoveryKey.read()
+	if err != nil {
+		return cliError{exitUsage, err.Error()}
+	}
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		return cliError{exitUsage, "a terminal is needed to choose the new master password"}
+	}
+	if !ok {
+		print("Please enter the recovery key: ")
+		line, err := terminal.ReadPassword(int(syscall.Stdin))
+		println("")
+		if err != nil {
+			return err
+		}
+		text = string(line)
+	}
+	p, err := decodeRecoveryKey(text)
+	if err != nil {
+		return cliError{exitAuth, err.Error()}
+	}
+	header, err := readDatabaseHeader(dbPath)
+	if err != nil {
+		return err
+	}
+	state, meta, err := ReadDatabaseWithKey(dbPath, DatabaseKey{Salt: header.salt, P: p, KDF: header.kdf})
+	if err != nil {
+		return cliError{exitAuth, "the recovery key does not open this database: " + err.Error()}
+	}
+	println("The recovery key opened the database. Please choose a new master password.")
+	key := NewDatabaseKeyWithKDF(createPassword(stdinReader, &meta), header.kdf)
+	if err = WriteDatabaseWithKey(dbPath, key, &state, &meta); err != nil {
+		return err
+	}
+	agentPutKey(dbPath, key)
+	println("The master password was changed. The recovery key no longer works: print a new emergency kit now.")
+	return nil
+}
+
+const recoverSubUsage = `
+Usage:
+  go-hash recover [-db <path>] [-key-stdin | -key-fd <fd> | -key-env <name>]
+  go-hash recover -vault <codes-file> [-db <path>]
+
+Restores a database with an emergency kit printed by the 'kit' command.
+
+With a recovery key, the database is opened without the master password, then a new master password is chosen.
+The key is asked for in the terminal unless one of the -key options is given.
+
+With -vault, the database file is rebuilt from the texts of the QR codes of the kit, saved one per line in
+<codes-file>, in any order. The file given by -db must not exist yet. The rebuilt database is opened with the
+master password as usual.
+
+Examples:
+  go-hash recover -db ~/backup/.go-hash
+  go-hash recover -vault codes.txt -db ~/.go-hash
+`
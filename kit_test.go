@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryKey(t *testing.T) {
+	key := DatabaseKey{Salt: make([]byte, 32), P: bytes.Repeat([]byte{0xAB, 0x12, 0x7F, 0x00}, 8)}
+	text := encodeRecoveryKey(key)
+	require.True(t, strings.HasPrefix(text, "GHRK1-"))
+	for _, group := range strings.Split(text, "-")[1:] {
+		require.True(t, len(group) <= 4, group)
+	}
+
+	p, err := decodeRecoveryKey(text)
+	require.NoError(t, err)
+	require.Equal(t, key.P, p)
+
+	// case, spaces and dashes do not matter
+	p, err = decodeRecoveryKey(" " + strings.ToLower(strings.Replace(text, "-", " ", -1)) + "\n")
+	require.NoError(t, err)
+	require.Equal(t, key.P, p)
+
+	// a typo is detected by the checksum
+	typo := []byte(text)
+	if typo[7] == 'A' {
+		typo[7] = 'B'
+	} else {
+		typo[7] = 'A'
+	}
+	_, err = decodeRecoveryKey(string(typo))
+	require.Error(t, err)
+
+	_, err = decodeRecoveryKey(strings.Replace(text, "GHRK1", "GHRK9", 1))
+	require.Error(t, err)
+	_, err = decodeRecoveryKey("")
+	require.Error(t, err)
+}
+
+func TestVaultCodes(t *testing.T) {
+	content := make([]byte, 3000)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	codes := vaultCodes(content)
+	require.Len(t, codes, 3)
+	for _, code := range codes {
+		require.True(t, strings.HasPrefix(code, "GHKIT1:"), code)
+	}
+
+	assembled, err := assembleVault(codes)
+	require.NoError(t, err)
+	require.Equal(t, content, assembled)
+
+	// codes can be given in any order, mixed with other lines and duplicates
+	assembled, err = assembleVault([]string{"", codes[2] + "\r", "hello", codes[0], codes[1], codes[0]})
+	require.NoError(t, err)
+	require.Equal(t, content, assembled)
+
+	_, err = assembleVault([]string{codes[0], codes[2]})
+	require.EqualError(t, err, "codes 2 of 3 are missing")
+
+	_, err = assembleVault([]string{"hello"})
+	require.Error(t, err)
+
+	other := vaultCodes(content[:2500])
+	_, err = assembleVault([]string{codes[0], codes[1], other[2]})
+	require.EqualError(t, err, "the codes belong to different emergency kits")
+
+	damaged := []byte(codes[1])
+	if damaged[len(damaged)-1] == 'A' {
+		damaged[len(damaged)-1] = 'B'
+	} else {
+		damaged[len(damaged)-1] = 'A'
+	}
+	_, err = assembleVault([]string{codes[0], string(damaged), codes[2]})
+	require.Error(t, err)
+}
+
+func TestEmergencyKit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-hash-kit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "db")
+	state := State{"default": []LoginInfo{{Name: "google", Username: "joe", Password: "secret"}}}
+	key := NewDatabaseKey("master")
+	require.NoError(t, WriteDatabaseWithKey(dbPath, key, &state, &Meta{}))
+	now := time.Date(2018, 3, 4, 10, 30, 0, 0, time.UTC)
+
+	kit, err := newEmergencyKit(dbPath, key, false, now)
+	require.NoError(t, err)
+	require.Nil(t, kit.Vault)
+	require.Equal(t, DBVersion, kit.Version)
+	kitPath := filepath.Join(dir, "kit.html")
+	require.NoError(t, writeEmergencyKit(kitPath, kit))
+	html, err := ioutil.ReadFile(kitPath)
+	require.NoError(t, err)
+	require.Contains(t, string(html), encodeRecoveryKey(key))
+	require.Contains(t, string(html), dbPath)
+	require.Contains(t, string(html), "<svg")
+	require.Contains(t, string(html), "2018-03-04")
+
+	// the recovery key opens the database
+	p, err := decodeRecoveryKey(kit.RecoveryKey.Text)
+	require.NoError(t, err)
+	header, err := readDatabaseHeader(dbPath)
+	require.NoError(t, err)
+	readState, _, err := ReadDatabaseWithKey(dbPath, DatabaseKey{Salt: header.salt, P: p, KDF: header.kdf})
+	require.NoError(t, err)
+	require.Equal(t, state, readState)
+
+	kit, err = newEmergencyKit(dbPath, key, true, now)
+	require.NoError(t, err)
+	require.Nil(t, kit.RecoveryKey)
+	require.NotEmpty(t, kit.Vault)
+	require.NoError(t, writeEmergencyKit(kitPath, kit))
+	html, err = ioutil.ReadFile(kitPath)
+	require.NoError(t, err)
+	var codes []string
+	for _, code := range kit.Vault {
+		require.Contains(t, string(html), code.Text)
+		codes = append(codes, code.Text)
+	}
+
+	// the database is rebuilt from the codes
+	restored := filepath.Join(dir, "restored")
+	codesFile := filepath.Join(dir, "codes.txt")
+	require.NoError(t, ioutil.WriteFile(codesFile, []byte(strings.Join(codes, "\n")), 0600))
+	require.NoError(t, recoverVault(codesFile, restored))
+	readState, _, err = ReadDatabase(restored, "master")
+	require.NoError(t, err)
+	require.Equal(t, state, readState)
+	require.Error(t, recoverVault(codesFile, restored))
+
+	_, err = newEmergencyKit(dbPath, NewDatabaseKey("master"), false, now)
+	require.EqualError(t, err, "the key does not belong to this database")
+}
+
+func TestQrSVG(t *testing.T) {
+	svg, err := qrSVG("GHRK1-ABCD")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(svg), "<svg"))
+	require.Contains(t, string(svg), "</svg>")
+}
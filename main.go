@@ -8,9 +8,13 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/mitchellh/go-homedir"
@@ -49,15 +53,25 @@ func isDir(path string) bool {
 	return false
 }
 
-func createPassword() string {
+func createPassword(reader *bufio.Reader, meta *Meta) string {
 	for i := 0; i < 10; i++ {
-		print("Please enter a master password: ")
-		pass, err := terminal.ReadPassword(int(syscall.Stdin))
-		println("")
-		if err != nil {
-			panic(err)
+		var pass []byte
+		generated := yesNoQuestion("Would you like go-hash to generate a passphrase which is easy to remember? [y/n]: ", reader)
+		if generated {
+			pass = []byte(generateMasterPassphrase(reader, meta))
+		} else {
+			print("Please enter a master password: ")
+			var err error
+			pass, err = terminal.ReadPassword(int(syscall.Stdin))
+			println("")
+			if err != nil {
+				panic(err)
+			}
 		}
 		if len(pass) > 7 {
+			if !generated && !acceptMasterPasswordStrength(string(pass), reader) {
+				continue
+			}
 			for i := 0; i < 3; i++ {
 				print("Re-enter the password: ")
 				pass2, err := terminal.ReadPassword(int(syscall.Stdin))
@@ -80,7 +94,45 @@ func createPassword() string {
 	panic("Too many attempts!")
 }
 
-func openDatabase(dbFilePath string) (state State, userPass string) {
+// acceptMasterPasswordStrength checks the strength of a master password chosen by the user.
+// Weak passwords are only accepted if the user explicitly insists on using them.
+func acceptMasterPasswordStrength(password string, reader *bufio.Reader) bool {
+	strength := estimateStrength(password)
+	if !strength.isWeak() {
+		fmt.Printf("Password strength: %s.\n", strength.String())
+		return true
+	}
+	fmt.Printf("Warning: this password is %s.\n", strength.String())
+	println("Anyone who gets hold of your database could guess it, so please choose a stronger password.")
+	return read(reader, "To use it anyway, type 'yes', or just hit Enter to choose another password: ") == "yes"
+}
+
+// generateMasterPassphrase generates a passphrase and shows it to the user, who must memorise it.
+func generateMasterPassphrase(reader *bufio.Reader, meta *Meta) string {
+	profile := readPasswordProfile(reader, meta, "passphrase")
+	passphrase := profile.generate()
+	fmt.Printf("\nYour new master password is:\n\n    %s\n\n", passphrase)
+	fmt.Printf("Its estimated entropy is %s.\n", describeEntropy(profile.entropyBits()))
+	println("Memorise it, or write it down and keep it in a safe place, then clear the screen.\n")
+	return passphrase
+}
+
+// openDatabase opens the database with the key held by the go-hash agent, if possible, or else with the master
+// password entered by the user. The master password is empty if the database was unlocked by the agent.
+func openDatabase(dbFilePath string) (state State, meta Meta, key DatabaseKey, userPass string) {
+	var ok bool
+	if state, meta, key, ok = readDatabaseWithAgent(dbFilePath); ok {
+		println("Database unlocked by the go-hash agent.")
+		return
+	}
+	if state, meta, key, userPass, ok = unlockDatabase(dbFilePath); ok {
+		return
+	}
+	panic("Too many attempts!")
+}
+
+// unlockDatabase asks the user for the master password until the database can be read, up to 5 times.
+func unlockDatabase(dbFilePath string) (state State, meta Meta, key DatabaseKey, userPass string, ok bool) {
 	for i := 0; i < 5; i++ {
 		print("Please enter your master password: ")
 		bytePassword, err := terminal.ReadPassword(int(syscall.Stdin))
@@ -89,14 +141,18 @@ func openDatabase(dbFilePath string) (state State, userPass string) {
 			panic(err)
 		}
 		userPass = string(bytePassword)
-		state, err = ReadDatabase(dbFilePath, userPass)
+		key, err = DeriveDatabaseKey(dbFilePath, userPass)
+		if err == nil {
+			state, meta, err = ReadDatabaseWithKey(dbFilePath, key)
+		}
 		if err != nil {
 			println("An error occurred: " + err.Error())
 		} else {
-			return
+			agentPutKey(dbFilePath, key)
+			return state, meta, key, userPass, true
 		}
 	}
-	panic("Too many attempts!")
+	return nil, Meta{}, DatabaseKey{}, "", false
 }
 
 func splitTrimN(text string, max int) []string {
@@ -108,79 +164,290 @@ func splitTrimN(text string, max int) []string {
 	return result
 }
 
-func runCliLoop(state *State, dbPath string, userPass string) {
-	grBox := stringBox{value: "default"}
+// warnAboutExpiredPasswords tells the user how many passwords have expired or will expire soon, if any.
+func warnAboutExpiredPasswords(state *State, meta *Meta) {
+	expiredCount, expiringCount := 0, 0
+	for _, e := range meta.expiringEntries(state, time.Now()) {
+		if e.status == expired {
+			expiredCount++
+		} else {
+			expiringCount++
+		}
+	}
+	if expiredCount+expiringCount > 0 {
+		fmt.Printf("Warning: %d password(s) have expired and %d will expire soon. Type 'expired' to see which.\n\n",
+			expiredCount, expiringCount)
+	}
+}
+
+func runCliLoop(state *State, meta *Meta, dbPath string, key DatabaseKey, userPass string, config Config) {
+	grBox := stringBox{value: rootGroup}
 	mpBox := stringBox{value: userPass}
+	dbKeyBox := keyBox{value: key}
 	userPass = ""
-	reader := bufio.NewReader(os.Stdin)
+	reader := stdinReader
 	prompt := func() string {
 		var modifier string
-		if len(grBox.value) > 0 && grBox.value != "default" {
+		if len(grBox.value) > 0 && grBox.value != rootGroup {
 			modifier = ":" + grBox.value
 		}
 		return fmt.Sprintf("\033[31mgo-hash%s»\033[0m ", modifier)
 	}
 
-	commands := createCommands(state, &grBox, &mpBox)
+	commands := createCommands(state, meta, dbPath, &grBox, &mpBox, &dbKeyBox)
+
+	// the hash of the database as last read or written by this session, to detect changes made by other go-hash
+	// processes, e.g. 'go-hash serve', which writing the database would discard
+	dbHash, _ := databaseFileHash(dbPath)
+
+	var cli *readline.Instance
+
+	// the prompt shows how long until the clipboard is cleared, if something was copied to it
+	var promptMutex sync.Mutex
+	var basePrompt, shownIndicator string
+	setPrompt := func(p string) {
+		promptMutex.Lock()
+		defer promptMutex.Unlock()
+		basePrompt, shownIndicator = p, clipboardIndicator()
+		cli.SetPrompt(shownIndicator + basePrompt)
+	}
+	refreshClipboardIndicator := func() {
+		promptMutex.Lock()
+		defer promptMutex.Unlock()
+		if indicator := clipboardIndicator(); indicator != shownIndicator {
+			shownIndicator = indicator
+			cli.SetPrompt(shownIndicator + basePrompt)
+			cli.Refresh()
+		}
+	}
+
+	// wipe removes all secrets from memory. Strings cannot be overwritten in Go, so they are only
+	// dereferenced and left to the garbage collector.
+	wipe := func() {
+		for group := range *state {
+			delete(*state, group)
+		}
+		*meta = Meta{}
+		dbKeyBox.value.Wipe()
+		dbKeyBox.value = DatabaseKey{}
+		mpBox.value = ""
+		clearClipboard()
+		runtime.GC()
+	}
+	session := newSessionLock(config.LockTimeout, wipe, func() {
+		fmt.Fprintf(cli.Stdout(), "\nSession locked after %s of inactivity. Hit Enter to unlock it.\n",
+			config.LockTimeout.String())
+		setPrompt("\033[31mgo-hash (locked)»\033[0m ")
+		cli.Refresh()
+	})
+	commands["lock"] = lockCommand{session: session}
+
+	// unlock restores the secrets of a locked session, returning false if the user fails to enter the master password
+	unlock := func() bool {
+		println("The session is locked.")
+		newState, newMeta, newKey, newPass, ok := unlockDatabase(dbPath)
+		if !ok {
+			return false
+		}
+		for group, entries := range newState {
+			(*state)[group] = entries
+		}
+		prepareState(state)
+		if _, exists := (*state)[grBox.value]; !exists {
+			grBox.value = rootGroup
+		}
+		*meta = newMeta
+		dbKeyBox.value = newKey
+		mpBox.value = newPass
+		dbHash, _ = databaseFileHash(dbPath)
+		session.unlocked()
+		return true
+	}
+
+	// reload replaces the state with the database as written by another go-hash process
+	reload := func(key DatabaseKey) error {
+		newState, newMeta, err := ReadDatabaseWithKey(dbPath, key)
+		if err != nil {
+			return err
+		}
+		for group := range *state {
+			delete(*state, group)
+		}
+		for group, entries := range newState {
+			(*state)[group] = entries
+		}
+		prepareState(state)
+		if _, exists := (*state)[grBox.value]; !exists {
+			grBox.value = rootGroup
+		}
+		*meta = newMeta
+		return nil
+	}
+
+	// runCommand runs a command while the session is unlocked, returning true if the user wants to quit
+	runCommand := func(cmd, args string) bool {
+		switch cmd {
+		case "exit":
+			if grBox.value == rootGroup {
+				return true
+			}
+			grBox.value = parentGroup(grBox.value)
+		default:
+			command := commands[cmd]
+			if command != nil {
+				key, pass := dbKeyBox.value, mpBox.value
+				command.run(state, grBox.value, args, reader)
+				if session.locked {
+					// the secrets needed to write the database are gone, but it was written after the last change
+					return false
+				}
+				if current, err := databaseFileHash(dbPath); err == nil && current != dbHash {
+					// writing the database would discard the changes made by the other process
+					dbKeyBox.value, mpBox.value = key, pass
+					if err = reload(key); err != nil {
+						println("The database was changed by another go-hash process, but it cannot be read: " +
+							err.Error())
+					} else {
+						dbHash = current
+						println("The database was changed by another go-hash process, e.g. 'go-hash serve', so it " +
+							"was reloaded. Any change made by the last command was not saved, please repeat it.")
+					}
+					return false
+				}
+				if err := WriteDatabaseWithKey(dbPath, dbKeyBox.value, state, meta); err != nil {
+					println("Error writing to database: " + err.Error())
+					return false
+				}
+				dbHash, _ = databaseFileHash(dbPath)
+				if !bytes.Equal(key.Salt, dbKeyBox.value.Salt) {
+					// the master password was changed
+					agentPutKey(dbPath, dbKeyBox.value)
+				}
+			} else if len(cmd) > 0 {
+				fmt.Printf("Unknown command: '%s'. Type 'help' for usage.\n", cmd)
+			}
+		}
+		return false
+	}
 
 	cli, err := readline.NewEx(&readline.Config{
 		Prompt:          prompt(),
-		AutoComplete:    createCompleter(commands),
+		AutoComplete:    sessionCompleter{completer: createCompleter(commands), session: session},
 		InterruptPrompt: "^C",
 	})
 	if err != nil {
 		panic(err)
 	}
 	defer cli.Close()
+	// never leave anything copied by go-hash in the clipboard after exiting
+	defer clearClipboard()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				refreshClipboardIndicator()
+			case sig := <-signals:
+				clearClipboard()
+				cli.Close()
+				println("\nExiting due to signal: " + sig.String())
+				os.Exit(1)
+			}
+		}
+	}()
 
-Loop:
 	for {
-		cli.SetPrompt(prompt())
+		setPrompt(prompt())
 		line, err := cli.Readline()
 		if err == readline.ErrInterrupt {
 			if len(line) == 0 {
-				break Loop
+				break
 			} else {
 				continue
 			}
 		} else if err == io.EOF {
-			break Loop
+			break
 		}
 
 		parts := splitTrimN(line, 2)
 		cmd := parts[0]
 		args := parts[1]
 
-		switch cmd {
-		case "quit":
-			break Loop
-		case "exit":
-			if grBox.value != "default" {
-				grBox.value = "default"
-			} else {
-				break Loop
-			}
-		default:
-			command := commands[cmd]
-			if command != nil {
-				command.run(state, grBox.value, args, reader)
-				err := WriteDatabase(dbPath, mpBox.value, state)
-				if err != nil {
-					println("Error writing to database: " + err.Error())
-				}
-			} else if len(cmd) > 0 {
-				fmt.Printf("Unknown command: '%s'. Type 'help' for usage.\n", cmd)
-			}
+		if cmd == "quit" {
+			break
+		}
+		if session.begin() && !unlock() {
+			session.end()
+			break
+		}
+		quit := runCommand(cmd, args)
+		session.end()
+		if quit {
+			break
 		}
 	}
 }
 
+// clipboardIndicator shows how many seconds are left until the clipboard is cleared, or nothing if there is
+// nothing to clear.
+func clipboardIndicator() string {
+	left := clipboardTimeLeft()
+	if left <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("\033[33m[clipboard %ds]\033[0m ", (left+time.Second-1)/time.Second)
+}
+
+// prepareState makes sure the root group, and the parents of all nested groups, exist.
+func prepareState(state *State) {
+	state.ensureGroup(rootGroup)
+
+	// older databases had no nested groups
+	for group := range *state {
+		state.ensureGroup(group)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch arg := os.Args[1]; arg {
+		case "-h", "-help", "--help":
+			fmt.Fprint(os.Stderr, cliUsage)
+			return
+		default:
+			if _, isSubcommand := subcommands()[arg]; isSubcommand {
+				os.Exit(runSubcommand(arg, os.Args[2:]))
+			}
+		}
+	}
+
 	var userPass string
 	var state State
+	var meta Meta
+	var key DatabaseKey
 	println("Go-Hash version " + DBVersion)
 	println("")
 
+	config, err := loadConfig(configFilePath())
+	if err != nil {
+		panic("Invalid configuration: " + err.Error())
+	}
+	backend, err := newClipboardBackend(config)
+	if err != nil {
+		panic("Invalid configuration: " + err.Error())
+	}
+	sensitive := config.ClipboardSensitive && canMarkSensitive(backend)
+	if config.ClipboardSensitive && config.ClipboardSensitiveSet && !sensitive {
+		fmt.Fprintf(os.Stderr, "Warning: the %s clipboard cannot mark copied content as sensitive, "+
+			"so clipboard managers may keep it (clipboard-sensitive is ignored).\n", backend.name())
+	}
+	useClipboard(backend, config.ClipboardTimeout, sensitive)
+
 	var dbFilePath string
 
 	switch len(os.Args) {
@@ -205,7 +472,9 @@ func main() {
 			println("A strong password could be a phrase you could remember easily but that is hard to guess.")
 			println("To make it harder to guess, include both upper and lower-case letters, numbers and special characters like ? and @.")
 			println("If you forget this password, there's no way to recover it or your data, so be careful!\n")
-			userPass = createPassword()
+			userPass = createPassword(stdinReader, &meta)
+			key = NewDatabaseKey(userPass)
+			agentPutKey(dbFilePath, key)
 		} else {
 			panic(err)
 		}
@@ -213,13 +482,12 @@ func main() {
 	} else {
 		// the DB exists, check if the user can open it
 		dbFile.Close()
-		state, userPass = openDatabase(dbFilePath)
+		state, meta, key, userPass = openDatabase(dbFilePath)
 	}
 
-	if len(state) == 0 {
-		state["default"] = []LoginInfo{}
-	}
+	prepareState(&state)
 
 	println("\nWelcome, go-hash at your service.\n")
-	runCliLoop(&state, dbFilePath, userPass)
+	warnAboutExpiredPasswords(&state, &meta)
+	runCliLoop(&state, &meta, dbFilePath, key, userPass, config)
 }
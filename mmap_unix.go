@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// mmapFile maps the contents of the file into memory, read-only.
+// Returns the mapped data and a function to unmap it.
+func mmapFile(file *os.File, size int64) ([]byte, func() error, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, nil, errors.New("cannot map file with size " + strconv.FormatInt(size, 10))
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error {
+		return syscall.Munmap(data)
+	}, nil
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is not supported on Windows, where files are read without memory-mapping instead.
+func mmapFile(file *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errors.New("memory-mapping files is not supported on Windows")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/renatoathaydes/go-hash/encryption"
+)
+
+var (
+	wordlistsMutex sync.Mutex
+	wordlists      = make(map[string][]string)
+)
+
+// loadWordlist loads the words from the wordlist file at the given path.
+// If the path is empty, the embedded EFF large wordlist is returned.
+//
+// Wordlist files contain one word per line. Lines may start with dice rolls (as in the EFF wordlists),
+// in which case only the last field of each line is used. Empty lines and lines starting with '#' are ignored.
+func loadWordlist(path string) ([]string, error) {
+	wordlistsMutex.Lock()
+	defer wordlistsMutex.Unlock()
+
+	if words, ok := wordlists[path]; ok {
+		return words, nil
+	}
+
+	var scanner *bufio.Scanner
+	if len(path) == 0 {
+		scanner = bufio.NewScanner(strings.NewReader(effLargeWordlist))
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner = bufio.NewScanner(file)
+	}
+
+	var words []string
+	seen := make(map[string]bool)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		word := fields[len(fields)-1]
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) < 2 {
+		return nil, errors.New("wordlist must contain at least 2 different words: " + path)
+	}
+
+	wordlists[path] = words
+	return words, nil
+}
+
+// passphraseSeparator returns the separator a passphrase profile's 'sep' option refers to.
+func passphraseSeparator(sep string) string {
+	switch sep {
+	case "space":
+		return " "
+	case "none":
+		return ""
+	default:
+		return sep
+	}
+}
+
+// generatePassphrase generates a passphrase by picking random words from the given wordlist.
+//
+// The caps argument determines how words are capitalised: 'none' (or empty), 'first' (first letter of each word),
+// 'all' (all letters), or 'random' (the first letter of each word is capitalised with a 50% chance).
+func generatePassphrase(wordlist []string, count int, separator, caps string) string {
+	words := make([]string, count)
+	for i := range words {
+		word := wordlist[encryption.RandomInt(len(wordlist))]
+		switch caps {
+		case "first":
+			word = capitalise(word)
+		case "all":
+			word = strings.ToUpper(word)
+		case "random":
+			if encryption.RandomInt(2) == 1 {
+				word = capitalise(word)
+			}
+		}
+		words[i] = word
+	}
+	return strings.Join(words, separator)
+}
+
+func capitalise(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+// passphraseEntropyBits calculates the entropy, in bits, of a passphrase made of the given number of words
+// picked from a wordlist with the given size.
+func passphraseEntropyBits(wordlistSize, count int, caps string) float64 {
+	bitsPerWord := math.Log2(float64(wordlistSize))
+	if caps == "random" {
+		bitsPerWord++
+	}
+	return float64(count) * bitsPerWord
+}
+
+// describeEntropy describes the entropy of a password in bits.
+func describeEntropy(bits float64) string {
+	return fmt.Sprintf("%.0f bits", bits)
+}
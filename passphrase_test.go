@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedWordlist(t *testing.T) {
+	words, err := loadWordlist("")
+	require.NoError(t, err)
+	require.Len(t, words, 7776)
+	require.Equal(t, "abacus", words[0])
+	require.Equal(t, "zoom", words[len(words)-1])
+}
+
+func TestCustomWordlist(t *testing.T) {
+	file, err := ioutil.TempFile("", "go-hash-wordlist")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("# my words\n11\tapple\n12\tbanana\n\n13 cherry\ncherry\n")
+	require.NoError(t, err)
+	file.Close()
+
+	words, err := loadWordlist(file.Name())
+	require.NoError(t, err)
+	require.Equal(t, []string{"apple", "banana", "cherry"}, words)
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	wordlist := []string{"apple", "banana", "cherry"}
+	for i := 0; i < 100; i++ {
+		words := strings.Split(generatePassphrase(wordlist, 5, "+", "first"), "+")
+		require.Len(t, words, 5)
+		for _, word := range words {
+			require.Contains(t, []string{"Apple", "Banana", "Cherry"}, word)
+		}
+	}
+	require.Equal(t, "APPLE APPLE", generatePassphrase([]string{"apple"}, 2, " ", "all"))
+}
+
+func TestPassphraseProfile(t *testing.T) {
+	profile, err := parseProfile("passphrase words=7 sep=space caps=random", nil)
+	require.NoError(t, err)
+	require.Equal(t, "words=7 sep=space caps=random", profile.String())
+	require.InDelta(t, 7*(12.925+1), profile.entropyBits(), 0.01)
+	require.Len(t, strings.Split(profile.generate(), " "), 7)
+
+	_, err = parseProfile("passphrase caps=weird", nil)
+	require.Error(t, err)
+	_, err = parseProfile("passphrase wordlist=/does/not/exist", nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,327 @@
+// Package psafe3 reads Password Safe databases in the PWS3 format.
+//
+// The format is described in formatV3.txt, in the Password Safe source code.
+package psafe3
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/crypto/twofish"
+)
+
+const (
+	tag      = "PWS3"
+	eofBlock = "PWS3-EOFPWS3-EOF"
+	// minIterations the minimum number of iterations of the key stretching function allowed by the format.
+	minIterations = 2048
+	// maxIterations the maximum number of iterations accepted, so that a crafted file cannot keep us stretching
+	// the key for hours. Password Safe itself never uses nearly as many.
+	maxIterations = 1 << 24
+	// preambleSize the size of TAG | SALT | ITER | H(P') | B1 | B2 | B3 | B4 | IV.
+	preambleSize = 4 + 32 + 4 + 32 + 4*16 + 16
+)
+
+// record field types
+const (
+	fieldUUID              = 0x01
+	fieldGroup             = 0x02
+	fieldTitle             = 0x03
+	fieldUsername          = 0x04
+	fieldNotes             = 0x05
+	fieldPassword          = 0x06
+	fieldCreationTime      = 0x07
+	fieldPasswordModTime   = 0x08
+	fieldPasswordExpiry    = 0x0a
+	fieldModificationTime  = 0x0c
+	fieldURL               = 0x0d
+	fieldPasswordHistory   = 0x0f
+	fieldPasswordExpiryInt = 0x11
+	fieldEmail             = 0x14
+	fieldEnd               = 0xff
+)
+
+// ErrInvalidPassphrase returned when the passphrase does not match the database.
+var ErrInvalidPassphrase = errors.New("invalid passphrase")
+
+// ErrCorrupt returned when the database is damaged or is not a Password Safe database.
+var ErrCorrupt = errors.New("the file is not a valid Password Safe database, or it is damaged")
+
+// ErrTampered returned when the HMAC of the database does not match its content.
+var ErrTampered = errors.New("the HMAC of the database does not match its content, it may have been tampered with")
+
+// ErrTooManyIterations returned when the database asks for more key stretching iterations than are supported.
+var ErrTooManyIterations = errors.New("unsupported Password Safe database: too many key stretching iterations")
+
+// Record a Password Safe entry.
+type Record struct {
+	UUID string
+	// Group the names of the nested groups of the record, e.g. ["work", "aws"] for the group 'work.aws'.
+	Group    []string
+	Title    string
+	Username string
+	Password string
+	URL      string
+	Notes    string
+	Email    string
+	Created  time.Time
+	Modified time.Time
+	// PasswordModified when the password was last changed.
+	PasswordModified time.Time
+	// PasswordExpiry when the password expires, or the zero time if it does not.
+	PasswordExpiry time.Time
+	// PasswordExpiryDays the number of days after which the password expires, or zero.
+	PasswordExpiryDays int
+	// HistorySize the number of previous passwords kept by Password Safe.
+	HistorySize int
+}
+
+// IsAlias returns true if the password of the record refers to the password of another record, which
+// Password Safe calls an alias ([[uuid]]) or a shortcut ([~uuid~]).
+// Returns the UUID of the other record, in the hexadecimal format used by Record.UUID.
+func (r *Record) IsAlias() (string, bool) {
+	p := r.Password
+	if len(p) == 36 && (strings.HasPrefix(p, "[[") && strings.HasSuffix(p, "]]") ||
+		strings.HasPrefix(p, "[~") && strings.HasSuffix(p, "~]")) {
+		return strings.ToLower(p[2:34]), true
+	}
+	return "", false
+}
+
+// stretchKey computes the stretched key P' from the passphrase, as defined by the PWS3 format.
+func stretchKey(passphrase string, salt []byte, iterations uint32) []byte {
+	h := sha256.New()
+	h.Write([]byte(passphrase))
+	h.Write(salt)
+	key := h.Sum(nil)
+	for i := uint32(0); i < iterations; i++ {
+		next := sha256.Sum256(key)
+		key = next[:]
+	}
+	return key
+}
+
+// Decode decrypts a Password Safe database with the given passphrase, and returns its records.
+func Decode(r io.Reader, passphrase string) ([]Record, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < preambleSize+len(eofBlock)+32 || string(data[:4]) != tag {
+		return nil, ErrCorrupt
+	}
+	salt := data[4:36]
+	iterations := binary.LittleEndian.Uint32(data[36:40])
+	if iterations < minIterations {
+		return nil, ErrCorrupt
+	}
+	if iterations > maxIterations {
+		return nil, ErrTooManyIterations
+	}
+	stretched := stretchKey(passphrase, salt, iterations)
+	expectedHash := sha256.Sum256(stretched)
+	if !hmac.Equal(expectedHash[:], data[40:72]) {
+		return nil, ErrInvalidPassphrase
+	}
+
+	keyCipher, err := twofish.NewCipher(stretched)
+	if err != nil {
+		return nil, err
+	}
+	k, l := make([]byte, 32), make([]byte, 32)
+	keyCipher.Decrypt(k[:16], data[72:88])
+	keyCipher.Decrypt(k[16:], data[88:104])
+	keyCipher.Decrypt(l[:16], data[104:120])
+	keyCipher.Decrypt(l[16:], data[120:136])
+	iv := data[136:152]
+
+	end := bytes.Index(data[preambleSize:], []byte(eofBlock))
+	if end < 0 || end%16 != 0 || len(data) < preambleSize+end+len(eofBlock)+32 {
+		return nil, ErrCorrupt
+	}
+	encrypted := data[preambleSize : preambleSize+end]
+	expectedMAC := data[preambleSize+end+len(eofBlock) : preambleSize+end+len(eofBlock)+32]
+
+	block, err := twofish.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, encrypted)
+
+	mac := hmac.New(sha256.New, l)
+	fields, err := readFields(plain, mac)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac.Sum(nil), expectedMAC) {
+		return nil, ErrTampered
+	}
+	return parseRecords(fields)
+}
+
+// field a field of the header or of a record.
+type field struct {
+	fieldType byte
+	data      []byte
+}
+
+// readFields reads all fields of the decrypted database, adding their data to the HMAC.
+func readFields(plain []byte, mac io.Writer) ([]field, error) {
+	var fields []field
+	for len(plain) > 0 {
+		if len(plain) < 16 {
+			return nil, ErrCorrupt
+		}
+		length := int(binary.LittleEndian.Uint32(plain))
+		// fields are padded to a multiple of the block size, the first block holding the length and type
+		size := 16
+		if length > 11 {
+			size += (length - 11 + 15) / 16 * 16
+		}
+		if length < 0 || len(plain) < size {
+			return nil, ErrCorrupt
+		}
+		data := plain[5 : 5+length]
+		mac.Write(data)
+		fields = append(fields, field{plain[4], data})
+		plain = plain[size:]
+	}
+	return fields, nil
+}
+
+// parseRecords parses the records following the header.
+func parseRecords(fields []field) ([]Record, error) {
+	// skip the header, which ends with an end field like each record
+	headerEnd := -1
+	for i, f := range fields {
+		if f.fieldType == fieldEnd {
+			headerEnd = i
+			break
+		}
+	}
+	if headerEnd < 0 {
+		return nil, ErrCorrupt
+	}
+	fields = fields[headerEnd+1:]
+	var records []Record
+	var current Record
+	inRecord := false
+	for _, f := range fields {
+		inRecord = true
+		value := string(f.data)
+		switch f.fieldType {
+		case fieldUUID:
+			current.UUID = uuidString(f.data)
+		case fieldGroup:
+			current.Group = splitGroup(value)
+		case fieldTitle:
+			current.Title = value
+		case fieldUsername:
+			current.Username = value
+		case fieldNotes:
+			current.Notes = strings.Replace(value, "\r\n", "\n", -1)
+		case fieldPassword:
+			current.Password = value
+		case fieldCreationTime:
+			current.Created = parseTime(f.data)
+		case fieldPasswordModTime:
+			current.PasswordModified = parseTime(f.data)
+		case fieldPasswordExpiry:
+			current.PasswordExpiry = parseTime(f.data)
+		case fieldModificationTime:
+			current.Modified = parseTime(f.data)
+		case fieldURL:
+			current.URL = value
+		case fieldEmail:
+			current.Email = value
+		case fieldPasswordExpiryInt:
+			if len(f.data) == 4 {
+				current.PasswordExpiryDays = int(binary.LittleEndian.Uint32(f.data))
+			}
+		case fieldPasswordHistory:
+			current.HistorySize = passwordHistorySize(value)
+		case fieldEnd:
+			records = append(records, current)
+			current, inRecord = Record{}, false
+		}
+	}
+	if inRecord {
+		return nil, ErrCorrupt
+	}
+	return records, nil
+}
+
+func uuidString(b []byte) string {
+	const hexDigits = "0123456789abcdef"
+	result := make([]byte, 0, 2*len(b))
+	for _, c := range b {
+		result = append(result, hexDigits[c>>4], hexDigits[c&0xf])
+	}
+	return string(result)
+}
+
+// splitGroup splits a group path, in which groups are separated by dots, and dots within group names are
+// escaped with a backslash.
+func splitGroup(group string) []string {
+	if len(group) == 0 {
+		return nil
+	}
+	var result []string
+	var current []rune
+	escaped := false
+	for _, r := range group {
+		switch {
+		case escaped:
+			if r != '.' {
+				current = append(current, '\\')
+			}
+			current = append(current, r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '.':
+			result = append(result, string(current))
+			current = nil
+		default:
+			current = append(current, r)
+		}
+	}
+	if escaped {
+		current = append(current, '\\')
+	}
+	return append(result, string(current))
+}
+
+// parseTime parses a time, stored as a 32 or 64-bit time_t.
+func parseTime(b []byte) time.Time {
+	switch len(b) {
+	case 4:
+		return time.Unix(int64(binary.LittleEndian.Uint32(b)), 0).UTC()
+	case 8:
+		return time.Unix(int64(binary.LittleEndian.Uint64(b)), 0).UTC()
+	}
+	return time.Time{}
+}
+
+// passwordHistorySize returns the number of passwords in a password history field, which starts with
+// 'fmmnn': a flag, the maximum size and the current size, both in hexadecimal.
+func passwordHistorySize(history string) int {
+	if len(history) < 5 {
+		return 0
+	}
+	n, err := strconv.ParseUint(history[3:5], 16, 8)
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
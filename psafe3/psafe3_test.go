@@ -0,0 +1,149 @@
+package psafe3
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/golang/crypto/twofish"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeTestFile writes a Password Safe database with the given fields, following the PWS3 format.
+func encodeTestFile(t *testing.T, passphrase string, fields []field) []byte {
+	salt := bytes.Repeat([]byte{1}, 32)
+	iterations := uint32(minIterations)
+	k, l, iv := bytes.Repeat([]byte{2}, 32), bytes.Repeat([]byte{3}, 32), bytes.Repeat([]byte{4}, 16)
+
+	var file bytes.Buffer
+	file.WriteString(tag)
+	file.Write(salt)
+	binary.Write(&file, binary.LittleEndian, iterations)
+	stretched := stretchKey(passphrase, salt, iterations)
+	hash := sha256.Sum256(stretched)
+	file.Write(hash[:])
+	keyCipher, err := twofish.NewCipher(stretched)
+	require.NoError(t, err)
+	for _, half := range [][]byte{k[:16], k[16:], l[:16], l[16:]} {
+		encrypted := make([]byte, 16)
+		keyCipher.Encrypt(encrypted, half)
+		file.Write(encrypted)
+	}
+	file.Write(iv)
+
+	var plain bytes.Buffer
+	mac := hmac.New(sha256.New, l)
+	for _, f := range fields {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, uint32(len(f.data)))
+		b.WriteByte(f.fieldType)
+		b.Write(f.data)
+		for b.Len()%16 != 0 || b.Len() == 0 {
+			b.WriteByte(0xAA)
+		}
+		plain.Write(b.Bytes())
+		mac.Write(f.data)
+	}
+	block, err := twofish.NewCipher(k)
+	require.NoError(t, err)
+	encrypted := make([]byte, plain.Len())
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain.Bytes())
+	file.Write(encrypted)
+	file.WriteString(eofBlock)
+	file.Write(mac.Sum(nil))
+	return file.Bytes()
+}
+
+func timeField(fieldType byte, t time.Time) field {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(t.Unix()))
+	return field{fieldType, b}
+}
+
+func testFields() []field {
+	modified := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	days := make([]byte, 4)
+	binary.LittleEndian.PutUint32(days, 90)
+	return []field{
+		// header
+		{0x00, []byte{0x0d, 0x03}},
+		{fieldEnd, nil},
+		// records
+		{fieldUUID, bytes.Repeat([]byte{0xab}, 16)},
+		{fieldGroup, []byte(`work.example\.com`)},
+		{fieldTitle, []byte("Mail")},
+		{fieldUsername, []byte("joe")},
+		{fieldPassword, []byte("a password longer than a single block of sixteen bytes")},
+		{fieldURL, []byte("https://mail.example.com")},
+		{fieldNotes, []byte("line 1\r\nline 2")},
+		{fieldEmail, []byte("joe@example.com")},
+		timeField(fieldModificationTime, modified),
+		timeField(fieldPasswordModTime, modified.Add(-time.Hour)),
+		{fieldPasswordExpiryInt, days},
+		{fieldPasswordHistory, []byte("1ff02")},
+		{fieldEnd, nil},
+		{fieldTitle, []byte("Alias")},
+		{fieldPassword, []byte("[[abababababababababababababababab]]")},
+		{fieldEnd, nil},
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data := encodeTestFile(t, "passphrase", testFields())
+	records, err := Decode(bytes.NewReader(data), "passphrase")
+	require.NoError(t, err)
+	modified := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.Equal(t, []Record{{
+		UUID:               "abababababababababababababababab",
+		Group:              []string{"work", "example.com"},
+		Title:              "Mail",
+		Username:           "joe",
+		Password:           "a password longer than a single block of sixteen bytes",
+		URL:                "https://mail.example.com",
+		Notes:              "line 1\nline 2",
+		Email:              "joe@example.com",
+		Modified:           modified,
+		PasswordModified:   modified.Add(-time.Hour),
+		PasswordExpiryDays: 90,
+		HistorySize:        2,
+	}, {
+		Title:    "Alias",
+		Password: "[[abababababababababababababababab]]",
+	}}, records)
+
+	uuid, ok := records[1].IsAlias()
+	require.True(t, ok)
+	require.Equal(t, records[0].UUID, uuid)
+	_, ok = records[0].IsAlias()
+	require.False(t, ok)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data := encodeTestFile(t, "passphrase", testFields())
+	_, err := Decode(bytes.NewReader(data), "wrong")
+	require.Equal(t, ErrInvalidPassphrase, err)
+
+	_, err = Decode(bytes.NewReader([]byte("not a Password Safe database")), "passphrase")
+	require.Equal(t, ErrCorrupt, err)
+
+	tooMany := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(tooMany[36:40], maxIterations+1)
+	_, err = Decode(bytes.NewReader(tooMany), "passphrase")
+	require.Equal(t, ErrTooManyIterations, err)
+
+	// change a byte of the last record's title
+	data[len(data)-len(eofBlock)-32-16*3+5] ^= 1
+	_, err = Decode(bytes.NewReader(data), "passphrase")
+	require.Equal(t, ErrTampered, err)
+}
+
+func TestSplitGroup(t *testing.T) {
+	require.Nil(t, splitGroup(""))
+	require.Equal(t, []string{"a"}, splitGroup("a"))
+	require.Equal(t, []string{"a", "b", "c"}, splitGroup("a.b.c"))
+	require.Equal(t, []string{"a.b", `c\d`}, splitGroup(`a\.b.c\d`))
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// searchFields the fields of an entry which may be selected in a search term, by name and alias.
+var searchFields = map[string]string{
+	"name":        "name",
+	"url":         "url",
+	"user":        "username",
+	"username":    "username",
+	"desc":        "description",
+	"description": "description",
+	"tag":         "tags",
+	"tags":        "tags",
+}
+
+// allSearchFields the fields searched by terms without a field selector.
+var allSearchFields = []string{"name", "url", "username", "description", "tags"}
+
+// searchTerm a single term of a search query, e.g. 'url:github'.
+type searchTerm struct {
+	// fields the fields the term is matched against.
+	fields []string
+	value  string
+	re     *regexp.Regexp
+}
+
+// searchResult an entry matching a search query.
+type searchResult struct {
+	group string
+	entry *LoginInfo
+	score int
+}
+
+// parseSearchQuery parses a search query into its terms.
+//
+// Terms are separated by spaces, unless quoted, and may be prefixed with a field selector such as 'url:'.
+// If useRegex is true, the value of each term is a regular expression.
+func parseSearchQuery(query string, useRegex bool) ([]searchTerm, error) {
+	args, err := splitQuotedArgs(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty query")
+	}
+	terms := make([]searchTerm, 0, len(args))
+	for _, arg := range args {
+		term := searchTerm{fields: allSearchFields, value: arg}
+		if i := strings.Index(arg, ":"); i > 0 {
+			if field, ok := searchFields[strings.ToLower(arg[:i])]; ok {
+				term.fields = []string{field}
+				term.value = arg[i+1:]
+			}
+		}
+		if len(term.value) == 0 {
+			return nil, errors.New("empty search term: " + arg)
+		}
+		if useRegex {
+			re, err := regexp.Compile("(?i)" + term.value)
+			if err != nil {
+				return nil, err
+			}
+			term.re = re
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// searchEntries searches all groups for entries matching all of the given terms.
+// The results are sorted by relevance, then by path.
+func searchEntries(state *State, terms []searchTerm) []searchResult {
+	var results []searchResult
+	for group, entries := range *state {
+		for i := range entries {
+			entry := &entries[i]
+			total := 0
+			for _, term := range terms {
+				score := term.match(entry)
+				if score < 0 {
+					total = -1
+					break
+				}
+				total += score
+			}
+			if total >= 0 {
+				results = append(results, searchResult{group, entry, total})
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score == results[j].score {
+			return entryPath(results[i].group, results[i].entry.Name) < entryPath(results[j].group, results[j].entry.Name)
+		}
+		return results[i].score > results[j].score
+	})
+	return results
+}
+
+// match returns how well the term matches the entry, or -1 if it does not match.
+func (term searchTerm) match(entry *LoginInfo) int {
+	best := -1
+	for _, field := range term.fields {
+		var values []string
+		switch field {
+		case "name":
+			values = []string{entry.Name}
+		case "url":
+			values = []string{entry.URL}
+		case "username":
+			values = []string{entry.Username}
+		case "description":
+			values = []string{entry.Description}
+		case "tags":
+			values = entry.Tags
+		}
+		for _, value := range values {
+			var score int
+			if term.re != nil {
+				score = -1
+				if term.re.MatchString(value) {
+					score = 100
+				}
+			} else {
+				score = fuzzyMatch(value, term.value)
+			}
+			if score > best {
+				best = score
+			}
+		}
+	}
+	return best
+}
+
+// fuzzyMatch returns how well the query matches the value, ignoring case, or -1 if it does not match.
+//
+// Exact matches score highest, followed by prefix and substring matches. Otherwise, the query matches if its
+// characters appear in the value in the same order, e.g. 'gthb' matches 'github', with a lower score
+// the more spread out the characters are.
+func fuzzyMatch(value, query string) int {
+	value, query = strings.ToLower(value), strings.ToLower(query)
+	switch {
+	case value == query:
+		return 100
+	case strings.HasPrefix(value, query):
+		return 80
+	case strings.Contains(value, query):
+		return 60
+	}
+	start, end := -1, 0
+	remaining := query
+	for i, r := range value {
+		q, size := utf8.DecodeRuneInString(remaining)
+		if r == q {
+			if start < 0 {
+				start = i
+			}
+			remaining = remaining[size:]
+			if len(remaining) == 0 {
+				end = i + size
+				break
+			}
+		}
+	}
+	if len(remaining) > 0 {
+		return -1
+	}
+	gaps := utf8.RuneCountInString(value[start:end]) - utf8.RuneCountInString(query)
+	if gaps >= 40 {
+		return 1
+	}
+	return 40 - gaps
+}
+
+// splitQuotedArgs splits a command's arguments by spaces, except within single or double quotes.
+// A backslash escapes the next character.
+func splitQuotedArgs(args string) ([]string, error) {
+	var result []string
+	var current []rune
+	var quote rune
+	inArg, escaped := false, false
+	for _, r := range args {
+		switch {
+		case escaped:
+			current = append(current, r)
+			escaped = false
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current = append(current, r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				result = append(result, string(current))
+				current, inArg = nil, false
+			}
+		default:
+			current = append(current, r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		current = append(current, '\\')
+	}
+	if inArg {
+		result = append(result, string(current))
+	}
+	return result, nil
+}
+
+// splitFirstArg splits the first argument from the others, without removing any quotes.
+func splitFirstArg(args string) (first, rest string) {
+	args = strings.TrimSpace(args)
+	var quote rune
+	escaped := false
+	for i, r := range args {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ' || r == '\t':
+			return args[:i], strings.TrimSpace(args[i:])
+		}
+	}
+	return args, ""
+}
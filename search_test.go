@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func searchPaths(t *testing.T, state *State, query string, useRegex bool) []string {
+	terms, err := parseSearchQuery(query, useRegex)
+	require.NoError(t, err)
+	var paths []string
+	for _, r := range searchEntries(state, terms) {
+		paths = append(paths, entryPath(r.group, r.entry.Name))
+	}
+	return paths
+}
+
+func TestSearchEntries(t *testing.T) {
+	state := State{
+		"default": []LoginInfo{
+			{Name: "github", URL: "https://github.com", Username: "joe"},
+			{Name: "gmail", URL: "https://mail.google.com", Username: "joe@gmail.com", Tags: []string{"email"}},
+		},
+		"work": []LoginInfo{
+			{Name: "github-enterprise", URL: "https://git.corp.com", Username: "jsmith",
+				Description: "old account, do not use"},
+			{Name: "aws-prod", URL: "https://aws.amazon.com", Username: "admin", Tags: []string{"cloud"}},
+		},
+	}
+
+	require.Equal(t, []string{"github", "work/github-enterprise"}, searchPaths(t, &state, "github", false))
+	require.Equal(t, []string{"github", "work/github-enterprise"}, searchPaths(t, &state, "gthb", false))
+	require.Equal(t, []string{"github"}, searchPaths(t, &state, "url:github", false))
+	require.Equal(t, []string{"github"}, searchPaths(t, &state, "name:git user:joe", false))
+	require.Equal(t, []string{"gmail"}, searchPaths(t, &state, "tag:email", false))
+	require.Equal(t, []string{"work/github-enterprise"}, searchPaths(t, &state, `desc:"old account"`, false))
+	require.Equal(t, []string{"work/aws-prod"}, searchPaths(t, &state, "name:^aws-", true))
+	require.Empty(t, searchPaths(t, &state, "url:^git", true))
+	require.Empty(t, searchPaths(t, &state, "nothing", false))
+}
+
+func TestFindCommandAddresses(t *testing.T) {
+	state := State{
+		"default":  []LoginInfo{{Name: "github"}},
+		"work":     []LoginInfo{{Name: "github"}},
+		"work/ci":  []LoginInfo{{Name: "github bot"}},
+		"personal": []LoginInfo{{Name: "github"}},
+	}
+	find := func(group string) string {
+		return captureStdout(t, func() {
+			findCommand{}.run(&state, group, "name:github", nil)
+		})
+	}
+	require.Equal(t, "github\npersonal/github\nwork/github\nwork/ci/\"github bot\"\n", find(rootGroup))
+	// results found from another group resolve to the same entries
+	out := find("work")
+	require.Equal(t, "/github\n/personal/github\ngithub\nci/\"github bot\"\n", out)
+	var groups []string
+	for _, address := range strings.Split(strings.TrimSpace(out), "\n") {
+		group, _, found := state.resolveEntry("work", address)
+		require.True(t, found, address)
+		groups = append(groups, group)
+	}
+	require.Equal(t, []string{rootGroup, "personal", "work", "work/ci"}, groups)
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	for _, query := range []string{"", "  ", "url:", `"unterminated`} {
+		_, err := parseSearchQuery(query, false)
+		require.Error(t, err, "query: %s", query)
+	}
+	_, err := parseSearchQuery("name:[", true)
+	require.Error(t, err)
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	require.Equal(t, 100, fuzzyMatch("GitHub", "github"))
+	require.Equal(t, 80, fuzzyMatch("github", "git"))
+	require.Equal(t, 60, fuzzyMatch("github", "hub"))
+	require.Equal(t, 38, fuzzyMatch("github", "gthb"))
+	require.Equal(t, -1, fuzzyMatch("github", "bg"))
+	require.Equal(t, -1, fuzzyMatch("", "a"))
+}
+
+func TestSplitQuotedArgs(t *testing.T) {
+	for args, expected := range map[string][]string{
+		"":                     nil,
+		"a b  c":               {"a", "b", "c"},
+		`a "b c" d`:            {"a", "b c", "d"},
+		`'it''s' x`:            {"its", "x"},
+		`desc:"old account" x`: {"desc:old account", "x"},
+		`a\ b c`:               {"a b", "c"},
+		`""`:                   {""},
+		`"say \"hi\""`:         {`say "hi"`},
+	} {
+		result, err := splitQuotedArgs(args)
+		require.NoError(t, err)
+		require.Equal(t, expected, result, "args: %s", args)
+	}
+}
+
+func TestSplitFirstArg(t *testing.T) {
+	for args, expected := range map[string][2]string{
+		"":                  {"", ""},
+		"hello":             {"hello", ""},
+		"  hello  a b ":     {"hello", "a b"},
+		`work/"my bank" 3m`: {`work/"my bank"`, "3m"},
+		`'a b' c`:           {`'a b'`, "c"},
+		`a\ b c`:            {`a\ b`, "c"},
+	} {
+		first, rest := splitFirstArg(args)
+		require.Equal(t, expected, [2]string{first, rest}, "args: %s", args)
+	}
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// defaultAPIAddress the address the HTTP API listens on by default.
+const defaultAPIAddress = "127.0.0.1:7878"
+
+// maxAPIRequestSize the maximum size of the body of a request to the HTTP API.
+const maxAPIRequestSize = 64 * 1024
+
+// apiEntry an entry as returned by the HTTP API. Passwords are only returned as fields.
+type apiEntry struct {
+	Path              string    `json:"path"`
+	Group             string    `json:"group"`
+	Name              string    `json:"name"`
+	Username          string    `json:"username"`
+	URL               string    `json:"url"`
+	Description       string    `json:"description"`
+	Tags              []string  `json:"tags"`
+	Expiry            string    `json:"expiry"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	PasswordUpdatedAt time.Time `json:"password_updated_at"`
+}
+
+func newAPIEntry(group string, entry *LoginInfo) apiEntry {
+	tags := entry.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return apiEntry{
+		Path:              entryPath(group, entry.Name),
+		Group:             group,
+		Name:              entry.Name,
+		Username:          entry.Username,
+		URL:               entry.URL,
+		Description:       entry.Description,
+		Tags:              tags,
+		Expiry:            entry.Expiry.String(),
+		UpdatedAt:         entry.UpdatedAt,
+		PasswordUpdatedAt: entry.PasswordUpdatedAt,
+	}
+}
+
+// apiEntryChange the fields of an entry to set when creating or changing it. Absent fields are left unchanged.
+type apiEntryChange struct {
+	Username    *string  `json:"username"`
+	URL         *string  `json:"url"`
+	Description *string  `json:"description"`
+	Tags        []string `json:"tags"`
+	Expiry      *string  `json:"expiry"`
+	Password    *string  `json:"password"`
+	// Generate the profile used to generate the password, e.g. "default" or "passphrase words=6".
+	Generate *string `json:"generate"`
+}
+
+// apply applies the change to the entry, as the 'add' and 'set' subcommands do.
+func (change *apiEntryChange) apply(entry *LoginInfo, meta *Meta) error {
+	now := time.Now()
+	if change.Password != nil && change.Generate != nil {
+		return errors.New("password and generate cannot be used together")
+	}
+	if change.Expiry != nil {
+		expiry, err := parseExpiry(*change.Expiry)
+		if err != nil {
+			return err
+		}
+		entry.Expiry = expiry
+	}
+	if change.Username != nil {
+		entry.Username = *change.Username
+	}
+	if change.URL != nil {
+		entry.URL = *change.URL
+	}
+	if change.Description != nil {
+		entry.Description = *change.Description
+	}
+	if change.Tags != nil {
+		entry.Tags = nil
+		entry.addTags(change.Tags)
+	}
+	if change.Generate != nil {
+		spec := *change.Generate
+		if len(spec) == 0 {
+			spec = defaultProfile
+		}
+		profile, err := parseProfile(spec, meta.Profiles)
+		if err != nil {
+			return err
+		}
+		entry.Password = profile.generate()
+		entry.Generator = profile.String()
+		entry.PasswordUpdatedAt = now
+	} else if change.Password != nil {
+		if len(*change.Password) < 4 {
+			return errors.New("password too short, please use at least 4 characters")
+		}
+		entry.Password = *change.Password
+		entry.Generator = ""
+		entry.PasswordUpdatedAt = now
+	}
+	entry.UpdatedAt = now
+	return nil
+}
+
+// apiPairRequest the request of a client to be paired with the database.
+type apiPairRequest struct {
+	Name     string   `json:"name"`
+	ReadOnly bool     `json:"read_only"`
+	Groups   []string `json:"groups"`
+}
+
+// apiError an error returned by the HTTP API, along with its HTTP status.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e apiError) Error() string {
+	return e.message
+}
+
+// apiServer serves the HTTP API. The database is read with the key for every request, so that changes made
+// by other go-hash processes are seen, and written after requests which change it.
+type apiServer struct {
+	mutex  sync.Mutex
+	dbPath string
+	key    DatabaseKey
+	// localHost whether the Host header must name the local host, to prevent DNS rebinding attacks.
+	localHost bool
+	// approve asks the user whether to pair a client, telling them if it replaces an existing client of the same
+	// name. Pairing is disabled if nil.
+	approve     func(request apiPairRequest, remote string, replaces bool) bool
+	pairingLock sync.Mutex
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var response interface{}
+	var err error
+	switch {
+	case len(r.Header.Get("Origin")) > 0:
+		// web pages must not be able to use the API
+		err = apiError{http.StatusForbidden, "requests from web browsers are not allowed"}
+	case s.localHost && !isLocalHost(r.Host):
+		err = apiError{http.StatusForbidden, "invalid host: " + r.Host}
+	case r.URL.Path == "/v1/pair":
+		response, err = s.pair(r)
+	default:
+		response, err = s.serveWithDatabase(r)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+		if e, ok := err.(apiError); ok {
+			status = e.status
+		}
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		response = map[string]string{"error": err.Error()}
+	} else if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/entries/") {
+		status = http.StatusCreated
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// isLocalHost returns true if the host, with an optional port, is the name or a loopback address of the local host.
+func isLocalHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// serveWithDatabase authenticates the client and serves its request, writing the database if it was changed.
+func (s *apiServer) serveWithDatabase(r *http.Request) (interface{}, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state, meta, err := ReadDatabaseWithKey(s.dbPath, s.key)
+	if err != nil {
+		return nil, apiError{http.StatusServiceUnavailable, "cannot read the database, " +
+			"restart the server if its master password was changed: " + err.Error()}
+	}
+	prepareState(&state)
+	client, ok := authenticateAPIClient(r, &meta)
+	if !ok {
+		return nil, apiError{http.StatusUnauthorized, "missing or invalid token"}
+	}
+	response, modified, err := serveAPIRequest(r, &state, &meta, client)
+	if err == nil && modified {
+		err = WriteDatabaseWithKey(s.dbPath, s.key, &state, &meta)
+	}
+	return response, err
+}
+
+// authenticateAPIClient finds the client whose token is given by the Authorization header.
+func authenticateAPIClient(r *http.Request, meta *Meta) (*APIClient, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, false
+	}
+	hash := sha256.Sum256([]byte(strings.TrimSpace(auth[len("Bearer "):])))
+	var found *APIClient
+	for name := range meta.Clients {
+		client := meta.Clients[name]
+		if subtle.ConstantTimeCompare(client.TokenHash, hash[:]) == 1 {
+			found = &client
+		}
+	}
+	return found, found != nil
+}
+
+// canAccess returns true if the client may access the entries of the given group.
+func (client *APIClient) canAccess(group string) bool {
+	if len(client.Groups) == 0 {
+		return true
+	}
+	for _, allowed := range client.Groups {
+		if isSubgroupOf(group, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccessSubgroupOf returns true if the client may access the entries of some subgroup of the given group.
+func (client *APIClient) canAccessSubgroupOf(group string) bool {
+	for _, allowed := range client.Groups {
+		if isSubgroupOf(allowed, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveAPIRequest serves an authenticated request, returning the response and whether the database was changed.
+func serveAPIRequest(r *http.Request, state *State, meta *Meta, client *APIClient) (interface{}, bool, error) {
+	query := r.URL.Query()
+	switch path := r.URL.Path; {
+	case path == "/v1/entries" && r.Method == http.MethodGet:
+		entries, err := listAPIEntries(state, client, query.Get("group"), query.Get("recursive") == "true")
+		return map[string][]apiEntry{"entries": entries}, false, err
+	case path == "/v1/search" && r.Method == http.MethodGet:
+		terms, err := parseSearchQuery(query.Get("q"), query.Get("regex") == "true")
+		if err != nil {
+			return nil, false, apiError{http.StatusBadRequest, err.Error()}
+		}
+		entries := []apiEntry{}
+		for _, result := range searchEntries(state, terms) {
+			if client.canAccess(result.group) {
+				entries = append(entries, newAPIEntry(result.group, result.entry))
+			}
+		}
+		return map[string][]apiEntry{"entries": entries}, false, nil
+	case path == "/v1/generate" && r.Method == http.MethodGet:
+		spec := query.Get("profile")
+		if len(spec) == 0 {
+			spec = defaultProfile
+		}
+		profile, err := parseProfile(spec, meta.Profiles)
+		if err != nil {
+			return nil, false, apiError{http.StatusBadRequest, err.Error()}
+		}
+		return map[string]string{"password": profile.generate()}, false, nil
+	case strings.HasPrefix(path, "/v1/entries/"):
+		address := strings.TrimPrefix(path, "/v1/entries/")
+		switch r.Method {
+		case http.MethodGet:
+			return getAPIEntry(state, client, address, query.Get("field"))
+		case http.MethodPost:
+			return createAPIEntry(r, state, meta, client, address)
+		case http.MethodPatch:
+			return updateAPIEntry(r, state, meta, client, address)
+		}
+		return nil, false, apiError{http.StatusMethodNotAllowed, "method not allowed: " + r.Method}
+	}
+	return nil, false, apiError{http.StatusNotFound, "not found: " + r.Method + " " + r.URL.Path}
+}
+
+func listAPIEntries(state *State, client *APIClient, groupPath string, recursive bool) ([]apiEntry, error) {
+	group := resolveGroupPath(rootGroup, groupPath)
+	visible := client.canAccess(group) || (recursive && client.canAccessSubgroupOf(group))
+	if _, exists := (*state)[group]; !exists || !visible {
+		// groups the client cannot access are not revealed
+		return nil, apiError{http.StatusNotFound, "group '" + group + "' does not exist"}
+	}
+	groups := []string{group}
+	if recursive {
+		groups = state.subgroups(group)
+	}
+	entries := []apiEntry{}
+	for _, gr := range groups {
+		if !client.canAccess(gr) {
+			continue
+		}
+		groupEntries := (*state)[gr]
+		for i := range groupEntries {
+			entries = append(entries, newAPIEntry(gr, &groupEntries[i]))
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// resolveAPIEntry finds an existing entry the client can access.
+func resolveAPIEntry(state *State, client *APIClient, address string) (*LoginInfo, string, error) {
+	group, index, found := state.resolveEntry(rootGroup, address)
+	if !found || !client.canAccess(group) {
+		// entries the client cannot access are not revealed
+		return nil, "", apiError{http.StatusNotFound, "entry '" + address + "' does not exist"}
+	}
+	return &(*state)[group][index], group, nil
+}
+
+func getAPIEntry(state *State, client *APIClient, address, field string) (interface{}, bool, error) {
+	entry, group, err := resolveAPIEntry(state, client, address)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(field) == 0 {
+		return newAPIEntry(group, entry), false, nil
+	}
+	value, err := entryField(entry, field)
+	if err != nil {
+		return nil, false, apiError{http.StatusBadRequest, err.Error()}
+	}
+	return map[string]string{"value": value}, false, nil
+}
+
+func createAPIEntry(r *http.Request, state *State, meta *Meta, client *APIClient,
+	address string) (interface{}, bool, error) {
+	if client.ReadOnly {
+		return nil, false, apiError{http.StatusForbidden, "the client is read-only"}
+	}
+	var change apiEntryChange
+	if err := decodeAPIRequest(r, &change); err != nil {
+		return nil, false, err
+	}
+	if change.Password == nil && change.Generate == nil {
+		return nil, false, apiError{http.StatusBadRequest, "please provide the password, or generate it"}
+	}
+	groupPath, name, err := parseEntryAddress(address)
+	if err != nil || len(name) == 0 {
+		return nil, false, apiError{http.StatusBadRequest, "invalid entry: " + address}
+	}
+	group := resolveGroupPath(rootGroup, groupPath)
+	if !client.canAccess(group) {
+		return nil, false, apiError{http.StatusForbidden, "access to group '" + group + "' is not allowed"}
+	}
+	entries := (*state)[group]
+	if _, exists := findEntryIndex(&entries, name); exists {
+		return nil, false, apiError{http.StatusConflict, "entry '" + address + "' already exists"}
+	}
+	entry := LoginInfo{Name: name}
+	if err = change.apply(&entry, meta); err != nil {
+		return nil, false, apiError{http.StatusBadRequest, err.Error()}
+	}
+	state.ensureGroup(group)
+	(*state)[group] = append((*state)[group], entry)
+	return newAPIEntry(group, &entry), true, nil
+}
+
+func updateAPIEntry(r *http.Request, state *State, meta *Meta, client *APIClient,
+	address string) (interface{}, bool, error) {
+	if client.ReadOnly {
+		return nil, false, apiError{http.StatusForbidden, "the client is read-only"}
+	}
+	var change apiEntryChange
+	if err := decodeAPIRequest(r, &change); err != nil {
+		return nil, false, err
+	}
+	entry, group, err := resolveAPIEntry(state, client, address)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = change.apply(entry, meta); err != nil {
+		return nil, false, apiError{http.StatusBadRequest, err.Error()}
+	}
+	return newAPIEntry(group, entry), true, nil
+}
+
+func decodeAPIRequest(r *http.Request, value interface{}) error {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxAPIRequestSize)).Decode(value); err != nil {
+		return apiError{http.StatusBadRequest, "invalid request: " + err.Error()}
+	}
+	return nil
+}
+
+// pair asks the user to approve a client, and gives the client a new token if they do.
+func (s *apiServer) pair(r *http.Request) (interface{}, error) {
+	if r.Method != http.MethodPost {
+		return nil, apiError{http.StatusMethodNotAllowed, "method not allowed: " + r.Method}
+	}
+	if s.approve == nil {
+		return nil, apiError{http.StatusForbidden, "pairing is disabled, as the server has no terminal to approve it"}
+	}
+	var request apiPairRequest
+	if err := decodeAPIRequest(r, &request); err != nil {
+		return nil, err
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if len(request.Name) == 0 || len(request.Name) > 64 || strings.IndexFunc(request.Name, isControlRune) >= 0 {
+		return nil, apiError{http.StatusBadRequest, "please provide a name of up to 64 characters"}
+	}
+	for i, group := range request.Groups {
+		request.Groups[i] = resolveGroupPath(rootGroup, group)
+	}
+
+	// only one request is shown to the user at a time
+	s.pairingLock.Lock()
+	defer s.pairingLock.Unlock()
+	meta, err := s.readMeta()
+	if err != nil {
+		return nil, err
+	}
+	_, replaces := meta.Clients[request.Name]
+	if !s.approve(request, r.RemoteAddr, replaces) {
+		return nil, apiError{http.StatusForbidden, "pairing was denied"}
+	}
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	hash := sha256.Sum256([]byte(token))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	state, meta, err := ReadDatabaseWithKey(s.dbPath, s.key)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Clients == nil {
+		meta.Clients = make(map[string]APIClient)
+	}
+	meta.Clients[request.Name] = APIClient{TokenHash: hash[:], ReadOnly: request.ReadOnly, Groups: request.Groups,
+		Created: time.Now()}
+	if err = WriteDatabaseWithKey(s.dbPath, s.key, &state, &meta); err != nil {
+		return nil, err
+	}
+	return map[string]string{"name": request.Name, "token": token}, nil
+}
+
+// readMeta reads the metadata of the database.
+func (s *apiServer) readMeta() (Meta, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, meta, err := ReadDatabaseWithKey(s.dbPath, s.key)
+	return meta, err
+}
+
+func isControlRune(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
+
+// describeAPIScope describes what a client can do, e.g. "read-only access to work, home".
+func describeAPIScope(readOnly bool, groups []string) string {
+	access := "read-write"
+	if readOnly {
+		access = "read-only"
+	}
+	if len(groups) == 0 {
+		return access + " access to all groups"
+	}
+	return access + " access to " + strings.Join(groups, ", ")
+}
+
+// approvePairingInTerminal asks the user in the terminal whether to pair a client.
+func approvePairingInTerminal(request apiPairRequest, remote string, replaces bool) bool {
+	if len(remote) == 0 || remote == "@" {
+		remote = "Unix socket"
+	}
+	fmt.Fprintf(os.Stderr, "\nClient '%s' (%s) asks for %s.\n", request.Name, remote,
+		describeAPIScope(request.ReadOnly, request.Groups))
+	if replaces {
+		fmt.Fprintf(os.Stderr, "It replaces the existing client '%s', whose token will stop working.\n", request.Name)
+	}
+	println("Only approve clients you are setting up right now: anyone holding its token can use the database.")
+	return read(stdinReader, "To approve it, type 'yes': ") == "yes"
+}
+
+func runServeSubcommand(args []string) int {
+	var opts databaseOptions
+	fs := newFlagSet("serve")
+	opts.addFlags(fs)
+	listen := fs.String("listen", defaultAPIAddress, "the local TCP address to listen on")
+	socket := fs.String("socket", "", "the Unix socket to listen on, instead of a TCP address")
+	list := fs.Bool("clients", false, "list the paired clients, and exit")
+	revoke := fs.String("revoke", "", "revoke the token of the given client, and exit")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(positional) > 0 {
+		return exitCodeOf(cliError{exitUsage, "too many arguments"})
+	}
+	state, meta, key, err := opts.open()
+	if err != nil {
+		return exitCodeOf(err)
+	}
+
+	switch {
+	case *list:
+		names := make([]string, 0, len(meta.Clients))
+		for name := range meta.Clients {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			client := meta.Clients[name]
+			fmt.Printf("%s\t%s\tpaired %s\n", name, describeAPIScope(client.ReadOnly, client.Groups),
+				client.Created.Format("2006-01-02 15:04"))
+		}
+		return exitOK
+	case len(*revoke) > 0:
+		if _, exists := meta.Clients[*revoke]; !exists {
+			return exitCodeOf(cliError{exitNotFound, "client '" + *revoke + "' does not exist"})
+		}
+		delete(meta.Clients, *revoke)
+		return exitCodeOf(WriteDatabaseWithKey(opts.path, key, &state, &meta))
+	}
+
+	var listener net.Listener
+	if len(*socket) > 0 {
+		if err = removeStaleSocket(*socket); err == nil {
+			listener, err = listenPrivate(*socket)
+		}
+	} else {
+		host, _, splitErr := net.SplitHostPort(*listen)
+		if splitErr != nil || !isLocalHost(host) {
+			return exitCodeOf(cliError{exitUsage, "the API can only listen on a loopback address, " +
+				"such as " + defaultAPIAddress})
+		}
+		listener, err = net.Listen("tcp", *listen)
+	}
+	if err != nil {
+		return exitCodeOf(err)
+	}
+
+	server := &apiServer{dbPath: opts.path, key: key, localHost: len(*socket) == 0}
+	if terminal.IsTerminal(int(syscall.Stdin)) {
+		server.approve = approvePairingInTerminal
+	} else {
+		println("Warning: stdin is not a terminal, so new clients cannot be paired.")
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "go-hash API listening at %s, with %d paired clients. Hit Ctrl+C to stop it.\n",
+		listener.Addr().String(), len(meta.Clients))
+	http.Serve(listener, server)
+	if len(*socket) > 0 {
+		os.Remove(*socket)
+	}
+	key.Wipe()
+	return exitOK
+}
+
+const serveSubUsage = `
+Usage:
+  go-hash serve [<options>]
+
+Serves a JSON API for other programs on this computer, until it is stopped with Ctrl+C. It listens on the
+loopback address ` + defaultAPIAddress + ` by default.
+
+Clients must be paired before using the API: a client asks for access with 'POST /v1/pair', which must be
+approved in the terminal running the server. Approved clients get a token, which they send in the
+'Authorization: Bearer <token>' header of every request. Clients can be limited to reading entries, and to
+some groups. Pairing a client with the name of an existing client replaces it, revoking its token.
+
+Requests:
+  POST  /v1/pair                 {"name": ..., "read_only": true, "groups": ["work"]}, returns the token.
+  GET   /v1/entries              list entries, with ?group=<group> and ?recursive=true.
+  GET   /v1/search?q=<query>     search entries, as the 'find' command does (?regex=true for regular expressions).
+  GET   /v1/entries/<entry>      get an entry, or a single field with ?field=<field>, e.g. ?field=password.
+  POST  /v1/entries/<entry>      create an entry.
+  PATCH /v1/entries/<entry>      change an entry.
+  GET   /v1/generate             generate a password, with ?profile=<profile>.
+
+Entries are created and changed with {"username", "url", "description", "tags", "expiry", "password"} or
+{"generate": "<profile>"} instead of "password". Fields which are absent are left unchanged. Groups and entries
+which a client cannot access are reported as not existing.
+
+The database is read for every request, so changes made in an interactive session are seen by the API. An
+interactive session open at the same time writes the whole database after each command: if the API changed it
+since, the session reloads it instead, and the change made by its last command is lost and must be repeated.
+
+Options:
+  -listen <address>  the loopback address to listen on (default: ` + defaultAPIAddress + `).
+  -socket <path>     listen on a Unix socket which only the current user can access, instead.
+  -clients           list the paired clients, then exit.
+  -revoke <name>     revoke the token of a client, then exit.
+` + databaseOptionsUsage + `
+Example:
+  go-hash serve -socket ~/.go-hash-api.sock
+`
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/renatoathaydes/go-hash/encryption"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAPIServer creates a server for a new database with a few entries, approving pairing requests as
+// told by approve.
+func newTestAPIServer(t *testing.T, approve *bool) (*apiServer, func()) {
+	file, err := ioutil.TempFile("", "go-hash-serve")
+	require.NoError(t, err)
+	file.Close()
+
+	state := State{
+		"default":  []LoginInfo{{Name: "google", Username: "joe", Password: "secret", URL: "https://google.com"}},
+		"work":     []LoginInfo{{Name: "github", Username: "joe-work", Password: "work secret"}},
+		"work/aws": []LoginInfo{{Name: "root", Password: "aws secret", Tags: []string{"cloud"}}},
+	}
+	key := NewDatabaseKeyWithKDF("master", encryption.KDFParams{Time: 1, Memory: 1024, Threads: 1})
+	require.NoError(t, WriteDatabaseWithKey(file.Name(), key, &state, &Meta{}))
+	server := &apiServer{dbPath: file.Name(), key: key, localHost: true,
+		approve: func(request apiPairRequest, remote string, replaces bool) bool { return *approve }}
+	return server, func() { os.Remove(file.Name()) }
+}
+
+// apiCall sends a request to the server, returning the status and the decoded JSON response.
+func apiCall(server *apiServer, method, path, token, body string) (int, map[string]interface{}) {
+	r := httptest.NewRequest(method, "http://localhost:7878"+path, strings.NewReader(body))
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func pairTestClient(t *testing.T, server *apiServer, request string) string {
+	status, response := apiCall(server, "POST", "/v1/pair", "", request)
+	require.Equal(t, http.StatusOK, status, "%v", response)
+	return response["token"].(string)
+}
+
+func entryPaths(response map[string]interface{}) []string {
+	var paths []string
+	for _, e := range response["entries"].([]interface{}) {
+		paths = append(paths, e.(map[string]interface{})["path"].(string))
+	}
+	return paths
+}
+
+func TestAPIPairing(t *testing.T) {
+	approve := false
+	server, cleanup := newTestAPIServer(t, &approve)
+	defer cleanup()
+
+	status, _ := apiCall(server, "GET", "/v1/entries", "", "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = apiCall(server, "GET", "/v1/entries", "invalid", "")
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	status, response := apiCall(server, "POST", "/v1/pair", "", `{"name": "tool"}`)
+	require.Equal(t, http.StatusForbidden, status)
+	require.Equal(t, "pairing was denied", response["error"])
+
+	status, _ = apiCall(server, "POST", "/v1/pair", "", `{"name": ""}`)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	approve = true
+	token := pairTestClient(t, server, `{"name": "tool"}`)
+	status, _ = apiCall(server, "GET", "/v1/entries", token, "")
+	require.Equal(t, http.StatusOK, status)
+
+	// only the hash of the token is stored
+	_, meta, err := ReadDatabaseWithKey(server.dbPath, server.key)
+	require.NoError(t, err)
+	require.Len(t, meta.Clients, 1)
+	require.NotContains(t, string(meta.Clients["tool"].TokenHash), token)
+
+	// pairing again replaces the token, which the user is told about
+	var replaced bool
+	server.approve = func(request apiPairRequest, remote string, replaces bool) bool {
+		replaced = replaces
+		return true
+	}
+	pairTestClient(t, server, `{"name": "other"}`)
+	require.False(t, replaced)
+	newToken := pairTestClient(t, server, `{"name": "tool"}`)
+	require.True(t, replaced)
+	status, _ = apiCall(server, "GET", "/v1/entries", token, "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = apiCall(server, "GET", "/v1/entries", newToken, "")
+	require.Equal(t, http.StatusOK, status)
+
+	server.approve = nil
+	status, _ = apiCall(server, "POST", "/v1/pair", "", `{"name": "other"}`)
+	require.Equal(t, http.StatusForbidden, status)
+}
+
+func TestAPIRejectsBrowsersAndOtherHosts(t *testing.T) {
+	approve := true
+	server, cleanup := newTestAPIServer(t, &approve)
+	defer cleanup()
+	token := pairTestClient(t, server, `{"name": "tool"}`)
+
+	r := httptest.NewRequest("GET", "http://localhost:7878/v1/entries", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	r = httptest.NewRequest("GET", "http://evil.example.com:7878/v1/entries", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	require.True(t, isLocalHost("127.0.0.1:7878"))
+	require.True(t, isLocalHost("[::1]:7878"))
+	require.True(t, isLocalHost("localhost"))
+	require.False(t, isLocalHost("0.0.0.0:7878"))
+	require.False(t, isLocalHost("192.168.0.2"))
+}
+
+func TestAPIReadEntries(t *testing.T) {
+	approve := true
+	server, cleanup := newTestAPIServer(t, &approve)
+	defer cleanup()
+	token := pairTestClient(t, server, `{"name": "tool", "read_only": true}`)
+
+	status, response := apiCall(server, "GET", "/v1/entries", token, "")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, []string{"google"}, entryPaths(response))
+
+	_, response = apiCall(server, "GET", "/v1/entries?recursive=true", token, "")
+	require.Equal(t, []string{"google", "work/aws/root", "work/github"}, entryPaths(response))
+
+	_, response = apiCall(server, "GET", "/v1/entries?group=work", token, "")
+	require.Equal(t, []string{"work/github"}, entryPaths(response))
+
+	status, _ = apiCall(server, "GET", "/v1/entries?group=missing", token, "")
+	require.Equal(t, http.StatusNotFound, status)
+
+	_, response = apiCall(server, "GET", "/v1/search?q=joe", token, "")
+	require.Equal(t, []string{"google", "work/github"}, entryPaths(response))
+	status, _ = apiCall(server, "GET", "/v1/search", token, "")
+	require.Equal(t, http.StatusBadRequest, status)
+
+	status, response = apiCall(server, "GET", "/v1/entries/work/github", token, "")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "joe-work", response["username"])
+	require.Nil(t, response["password"])
+
+	_, response = apiCall(server, "GET", "/v1/entries/work/aws/root?field=password", token, "")
+	require.Equal(t, "aws secret", response["value"])
+
+	status, _ = apiCall(server, "GET", "/v1/entries/work/missing", token, "")
+	require.Equal(t, http.StatusNotFound, status)
+
+	_, response = apiCall(server, "GET", "/v1/generate?profile=pin", token, "")
+	require.Len(t, response["password"], 6)
+
+	// read-only clients cannot change entries
+	status, _ = apiCall(server, "POST", "/v1/entries/new", token, `{"password": "new secret"}`)
+	require.Equal(t, http.StatusForbidden, status)
+	status, _ = apiCall(server, "PATCH", "/v1/entries/google", token, `{"username": "jane"}`)
+	require.Equal(t, http.StatusForbidden, status)
+}
+
+func TestAPIChangeEntries(t *testing.T) {
+	approve := true
+	server, cleanup := newTestAPIServer(t, &approve)
+	defer cleanup()
+	token := pairTestClient(t, server, `{"name": "tool"}`)
+
+	status, response := apiCall(server, "POST", "/v1/entries/home/router", token,
+		`{"username": "admin", "tags": ["net"], "generate": "pin"}`)
+	require.Equal(t, http.StatusCreated, status, "%v", response)
+	require.Equal(t, "home/router", response["path"])
+
+	status, _ = apiCall(server, "POST", "/v1/entries/home/router", token, `{"password": "other"}`)
+	require.Equal(t, http.StatusConflict, status)
+	status, _ = apiCall(server, "POST", "/v1/entries/home/nas", token, `{"username": "admin"}`)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	status, response = apiCall(server, "PATCH", "/v1/entries/work/github", token,
+		`{"password": "new work secret", "expiry": "2030-01-01"}`)
+	require.Equal(t, http.StatusOK, status, "%v", response)
+	require.Equal(t, "joe-work", response["username"])
+	require.Equal(t, "2030-01-01", response["expiry"])
+
+	status, _ = apiCall(server, "PATCH", "/v1/entries/work/github", token, `{"password": "x"}`)
+	require.Equal(t, http.StatusBadRequest, status)
+
+	state, _, err := ReadDatabaseWithKey(server.dbPath, server.key)
+	require.NoError(t, err)
+	require.Len(t, state["home"], 1)
+	require.Equal(t, "admin", state["home"][0].Username)
+	require.Len(t, state["home"][0].Password, 6)
+	require.Equal(t, "new work secret", state["work"][0].Password)
+}
+
+func TestAPIGroupScope(t *testing.T) {
+	approve := true
+	server, cleanup := newTestAPIServer(t, &approve)
+	defer cleanup()
+	token := pairTestClient(t, server, `{"name": "tool", "groups": ["work/aws"]}`)
+
+	_, response := apiCall(server, "GET", "/v1/entries?recursive=true", token, "")
+	require.Equal(t, []string{"work/aws/root"}, entryPaths(response))
+	_, response = apiCall(server, "GET", "/v1/entries?group=work&recursive=true", token, "")
+	require.Equal(t, []string{"work/aws/root"}, entryPaths(response))
+
+	// groups the client cannot access look the same as missing groups
+	for _, query := range []string{"", "?group=work", "?group=missing", "?group=missing&recursive=true"} {
+		status, response := apiCall(server, "GET", "/v1/entries"+query, token, "")
+		require.Equal(t, http.StatusNotFound, status, query)
+		require.Contains(t, response["error"], "does not exist", query)
+	}
+
+	_, response = apiCall(server, "GET", "/v1/search?q=joe", token, "")
+	require.Empty(t, response["entries"])
+
+	status, _ := apiCall(server, "GET", "/v1/entries/work/github?field=password", token, "")
+	require.Equal(t, http.StatusNotFound, status)
+
+	status, _ = apiCall(server, "POST", "/v1/entries/work/new", token, `{"password": "new secret"}`)
+	require.Equal(t, http.StatusForbidden, status)
+	status, _ = apiCall(server, "POST", "/v1/entries/work/aws/new", token, `{"password": "new secret"}`)
+	require.Equal(t, http.StatusCreated, status)
+}
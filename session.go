@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// sessionLock locks an interactive session after it has been idle for some time.
+//
+// The mutex must be held while the session's secrets are in use, i.e. while a command runs, so that the
+// session is never locked in the middle of a command.
+type sessionLock struct {
+	mutex   sync.Mutex
+	timeout time.Duration
+	timer   *time.Timer
+	locked  bool
+	// lastUsed when the session's secrets were last used.
+	lastUsed time.Time
+	// wipe removes the session's secrets from memory.
+	wipe func()
+	// notify tells the user that the session was locked due to inactivity.
+	notify func()
+}
+
+// newSessionLock creates a sessionLock which locks the session after it has been idle for the given timeout.
+// A zero timeout disables automatic locking.
+func newSessionLock(timeout time.Duration, wipe, notify func()) *sessionLock {
+	l := &sessionLock{timeout: timeout, wipe: wipe, notify: notify, lastUsed: time.Now()}
+	if timeout > 0 {
+		l.timer = time.AfterFunc(timeout, func() {
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+			// the timer may have fired while a command was running
+			if !l.locked && time.Since(l.lastUsed) >= l.timeout {
+				l.lockHeld()
+				l.notify()
+			}
+		})
+	}
+	return l
+}
+
+// begin must be called before using the session's secrets. Returns true if the session is locked.
+func (l *sessionLock) begin() bool {
+	l.mutex.Lock()
+	return l.locked
+}
+
+// end must be called after using the session's secrets. The idle timeout starts again.
+func (l *sessionLock) end() {
+	l.lastUsed = time.Now()
+	if l.timer != nil && !l.locked {
+		l.timer.Reset(l.timeout)
+	}
+	l.mutex.Unlock()
+}
+
+// lockHeld locks the session immediately, wiping its secrets. Must be called while holding the mutex.
+func (l *sessionLock) lockHeld() {
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.wipe()
+	l.locked = true
+}
+
+// unlocked marks the session as unlocked, after its secrets have been restored. Must be called while holding
+// the mutex.
+func (l *sessionLock) unlocked() {
+	l.locked = false
+}
+
+// sessionCompleter auto-completes input while holding the session's mutex, as completions are taken from the
+// session's secrets, which the idle timer may wipe at any moment. Nothing is completed while the session is locked.
+type sessionCompleter struct {
+	completer readline.AutoCompleter
+	session   *sessionLock
+}
+
+func (c sessionCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	defer c.session.end()
+	if c.session.begin() {
+		return nil, 0
+	}
+	return c.completer.Do(line, pos)
+}
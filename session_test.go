@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionLockTimeout(t *testing.T) {
+	wiped, notified := make(chan bool, 1), make(chan bool, 1)
+	session := newSessionLock(100*time.Millisecond, func() { wiped <- true }, func() { notified <- true })
+
+	// using the session resets the timeout
+	time.Sleep(60 * time.Millisecond)
+	require.False(t, session.begin())
+	session.end()
+	time.Sleep(60 * time.Millisecond)
+	require.False(t, session.begin())
+	session.end()
+
+	select {
+	case <-wiped:
+	case <-time.After(time.Second):
+		t.Fatal("session was not locked")
+	}
+	require.True(t, <-notified)
+	require.True(t, session.begin())
+	session.unlocked()
+	session.end()
+	require.False(t, session.begin())
+	session.end()
+}
+
+func TestSessionLockWaitsForCommand(t *testing.T) {
+	wiped := make(chan bool, 1)
+	session := newSessionLock(20*time.Millisecond, func() { wiped <- true }, func() {})
+
+	require.False(t, session.begin())
+	time.Sleep(60 * time.Millisecond)
+	select {
+	case <-wiped:
+		t.Fatal("session should not be locked while a command runs")
+	default:
+	}
+	session.end()
+	select {
+	case <-wiped:
+	case <-time.After(time.Second):
+		t.Fatal("session was not locked")
+	}
+}
+
+func TestSessionLockDisabled(t *testing.T) {
+	session := newSessionLock(0, func() { t.Fatal("should not wipe") }, func() {})
+	require.False(t, session.begin())
+	session.end()
+}
+
+func TestSessionCompleter(t *testing.T) {
+	session := newSessionLock(0, func() {}, func() {})
+	completer := sessionCompleter{completer: readline.NewPrefixCompleter(readline.PcItem("goto")), session: session}
+
+	completions, length := completer.Do([]rune("go"), 2)
+	require.Equal(t, [][]rune{[]rune("to ")}, completions)
+	require.Equal(t, 2, length)
+
+	require.False(t, session.begin())
+	session.lockHeld()
+	session.end()
+	completions, _ = completer.Do([]rune("go"), 2)
+	require.Empty(t, completions)
+}
@@ -0,0 +1,439 @@
+// Package sqlite reads the tables of SQLite 3 database files.
+//
+// Only what is necessary to read the contents of tables is implemented: indexes, WITHOUT ROWID tables
+// and journals are not supported. The file format is described at https://www.sqlite.org/fileformat.html
+package sqlite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+)
+
+const (
+	headerString = "SQLite format 3\x00"
+	headerSize   = 100
+	// page types
+	interiorTablePage = 0x05
+	leafTablePage     = 0x0d
+	// maxDepth the maximum depth of a b-tree, protecting against loops in corrupt files.
+	maxDepth = 64
+)
+
+// ErrCorrupt returned when the file is damaged or is not a SQLite database.
+var ErrCorrupt = errors.New("the file is not a valid SQLite database, or it is damaged")
+
+// Database a SQLite database, read into memory.
+type Database struct {
+	data       []byte
+	pageSize   int
+	usableSize int
+	schema     []Row
+}
+
+// Row the values of a row of a table, each of which is nil, an int64, a float64, a string or a []byte.
+type Row []interface{}
+
+// Table the columns and rows of a table.
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    []Row
+}
+
+// Get returns the value of the given column in a row of the table, or nil if there is no such column.
+func (t *Table) Get(row Row, column string) interface{} {
+	for i, c := range t.Columns {
+		if strings.EqualFold(c, column) {
+			if i < len(row) {
+				return row[i]
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// Read reads a SQLite database.
+func Read(r io.Reader) (*Database, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerSize || string(data[:16]) != headerString {
+		return nil, ErrCorrupt
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 || len(data)%pageSize != 0 {
+		return nil, ErrCorrupt
+	}
+	if encoding := binary.BigEndian.Uint32(data[56:60]); encoding > 1 {
+		return nil, errors.New("only SQLite databases using the UTF-8 encoding are supported")
+	}
+	db := &Database{data: data, pageSize: pageSize, usableSize: pageSize - int(data[20])}
+	if db.usableSize < 480 {
+		return nil, ErrCorrupt
+	}
+	if db.schema, err = db.readTree(1, 0); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Table reads the table with the given name.
+func (db *Database) Table(name string) (*Table, error) {
+	// the schema table has the columns type, name, tbl_name, rootpage and sql
+	for _, entry := range db.schema {
+		// skip the rowid
+		entry = entry[1:]
+		if len(entry) < 5 || entry[0] != "table" {
+			continue
+		}
+		if tableName, ok := entry[1].(string); !ok || !strings.EqualFold(tableName, name) {
+			continue
+		}
+		rootPage, ok := entry[3].(int64)
+		sql, _ := entry[4].(string)
+		if !ok {
+			return nil, ErrCorrupt
+		}
+		if strings.Contains(strings.ToUpper(sql), "WITHOUT ROWID") {
+			return nil, fmt.Errorf("table %s is a WITHOUT ROWID table, which is not supported", name)
+		}
+		columns := parseColumns(sql)
+		rows, err := db.readTree(int(rootPage), 0)
+		if err != nil {
+			return nil, err
+		}
+		table := &Table{Name: name, Rows: rows}
+		for _, c := range columns {
+			table.Columns = append(table.Columns, c.name)
+		}
+		for i, row := range rows {
+			// records lack the columns added to the table after they were written
+			for len(row) < len(columns)+1 {
+				row = append(row, nil)
+			}
+			rowid := row[0]
+			row = row[1:]
+			for j, c := range columns {
+				switch value := row[j].(type) {
+				case nil:
+					if c.rowid {
+						row[j] = rowid
+					}
+				case int64:
+					// real values without a fractional part may be stored as integers
+					if c.real {
+						row[j] = float64(value)
+					}
+				}
+			}
+			table.Rows[i] = row
+		}
+		return table, nil
+	}
+	return nil, fmt.Errorf("no such table: %s", name)
+}
+
+func (db *Database) page(number int) ([]byte, error) {
+	if number < 1 || number*db.pageSize > len(db.data) {
+		return nil, ErrCorrupt
+	}
+	return db.data[(number-1)*db.pageSize : number*db.pageSize], nil
+}
+
+// readTree reads the rows of the table b-tree with the given root page. Each row starts with its rowid.
+func (db *Database) readTree(pageNumber, depth int) ([]Row, error) {
+	if depth > maxDepth {
+		return nil, ErrCorrupt
+	}
+	page, err := db.page(pageNumber)
+	if err != nil {
+		return nil, err
+	}
+	header := page
+	if pageNumber == 1 {
+		header = page[headerSize:]
+	}
+	cellCount := int(binary.BigEndian.Uint16(header[3:5]))
+	headerLength := 8
+	if header[0] == interiorTablePage {
+		headerLength = 12
+	}
+	if len(header) < headerLength+2*cellCount {
+		return nil, ErrCorrupt
+	}
+	var rows []Row
+	for i := 0; i < cellCount; i++ {
+		offset := int(binary.BigEndian.Uint16(header[headerLength+2*i:]))
+		if offset >= len(page) {
+			return nil, ErrCorrupt
+		}
+		cell := page[offset:]
+		switch header[0] {
+		case interiorTablePage:
+			if len(cell) < 4 {
+				return nil, ErrCorrupt
+			}
+			children, err := db.readTree(int(binary.BigEndian.Uint32(cell)), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, children...)
+		case leafTablePage:
+			row, err := db.readCell(cell)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		default:
+			return nil, ErrCorrupt
+		}
+	}
+	if header[0] == interiorTablePage {
+		children, err := db.readTree(int(binary.BigEndian.Uint32(header[8:12])), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, children...)
+	}
+	return rows, nil
+}
+
+// readCell reads a cell of a table leaf page, whose payload may continue in overflow pages.
+func (db *Database) readCell(cell []byte) (Row, error) {
+	payloadSize, n := readVarint(cell)
+	if n == 0 {
+		return nil, ErrCorrupt
+	}
+	cell = cell[n:]
+	rowid, n := readVarint(cell)
+	if n == 0 || payloadSize < 0 || payloadSize > int64(len(db.data)) {
+		return nil, ErrCorrupt
+	}
+	cell = cell[n:]
+
+	size := int(payloadSize)
+	local := size
+	if maxLocal := db.usableSize - 35; size > maxLocal {
+		minLocal := (db.usableSize-12)*32/255 - 23
+		local = minLocal + (size-minLocal)%(db.usableSize-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if len(cell) < local {
+		return nil, ErrCorrupt
+	}
+	payload := cell[:local]
+	if local < size {
+		if len(cell) < local+4 {
+			return nil, ErrCorrupt
+		}
+		payload = append([]byte{}, payload...)
+		next := int(binary.BigEndian.Uint32(cell[local:]))
+		for len(payload) < size {
+			page, err := db.page(next)
+			if err != nil {
+				return nil, err
+			}
+			content := page[4:db.usableSize]
+			if remaining := size - len(payload); len(content) > remaining {
+				content = content[:remaining]
+			}
+			payload = append(payload, content...)
+			next = int(binary.BigEndian.Uint32(page))
+		}
+	}
+	values, err := readRecord(payload)
+	if err != nil {
+		return nil, err
+	}
+	return append(Row{rowid}, values...), nil
+}
+
+// readRecord reads the values of a record.
+func readRecord(record []byte) (Row, error) {
+	headerSize, n := readVarint(record)
+	if n == 0 || headerSize < int64(n) || headerSize > int64(len(record)) {
+		return nil, ErrCorrupt
+	}
+	header := record[n:headerSize]
+	body := record[headerSize:]
+	var row Row
+	for len(header) > 0 {
+		serialType, n := readVarint(header)
+		if n == 0 {
+			return nil, ErrCorrupt
+		}
+		header = header[n:]
+		size := serialTypeSize(serialType)
+		if size < 0 || size > len(body) {
+			return nil, ErrCorrupt
+		}
+		value := body[:size]
+		body = body[size:]
+		switch {
+		case serialType == 0:
+			row = append(row, nil)
+		case serialType <= 6:
+			// big-endian two's complement integers
+			var i int64
+			if value[0]&0x80 != 0 {
+				i = -1
+			}
+			for _, b := range value {
+				i = i<<8 | int64(b)
+			}
+			row = append(row, i)
+		case serialType == 7:
+			row = append(row, math.Float64frombits(binary.BigEndian.Uint64(value)))
+		case serialType == 8 || serialType == 9:
+			row = append(row, serialType-8)
+		case serialType%2 == 0:
+			row = append(row, append([]byte{}, value...))
+		default:
+			row = append(row, string(value))
+		}
+	}
+	return row, nil
+}
+
+// serialTypeSize returns the size of the values of the given serial type, or -1 if the type is invalid.
+func serialTypeSize(serialType int64) int {
+	switch {
+	case serialType < 0, serialType == 10, serialType == 11:
+		return -1
+	case serialType <= 4:
+		return int(serialType)
+	case serialType == 5:
+		return 6
+	case serialType <= 7:
+		return 8
+	case serialType <= 9:
+		return 0
+	}
+	return int((serialType - 12) / 2)
+}
+
+// readVarint reads a variable-length integer, returning it and the number of bytes read, which is zero if the
+// integer is incomplete.
+func readVarint(b []byte) (int64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return int64(v<<8 | uint64(b[i])), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return int64(v), i + 1
+		}
+	}
+	return 0, 0
+}
+
+// column a column of a table.
+type column struct {
+	name string
+	// rowid whether the column is an alias of the rowid.
+	rowid bool
+	// real whether the column has the REAL affinity.
+	real bool
+}
+
+// parseColumns returns the columns of a table from its CREATE TABLE statement.
+func parseColumns(sql string) []column {
+	start, end := strings.Index(sql, "("), strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+	var columns []column
+	for _, definition := range splitDefinitions(sql[start+1 : end]) {
+		name, rest := splitName(strings.TrimSpace(definition))
+		if len(name) == 0 {
+			continue
+		}
+		switch strings.ToUpper(name) {
+		case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+			// table constraints follow the columns
+			return columns
+		}
+		words := strings.Fields(strings.ToUpper(rest))
+		upper := strings.Join(words, " ")
+		// the type of the column is the words before the constraints, if any
+		columnType := upper
+		for _, constraint := range []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT",
+			"COLLATE", "REFERENCES", "GENERATED", "AS"} {
+			if i := strings.Index(" "+columnType+" ", " "+constraint+" "); i >= 0 {
+				columnType = columnType[:i]
+			}
+		}
+		isInteger := len(words) > 0 && words[0] == "INTEGER"
+		columns = append(columns, column{
+			name:  name,
+			rowid: isInteger && strings.Contains(upper, "PRIMARY KEY") && !strings.Contains(upper, "PRIMARY KEY DESC"),
+			real: !strings.Contains(columnType, "INT") && !strings.Contains(columnType, "CHAR") &&
+				!strings.Contains(columnType, "CLOB") && !strings.Contains(columnType, "TEXT") &&
+				(strings.Contains(columnType, "REAL") || strings.Contains(columnType, "FLOA") ||
+					strings.Contains(columnType, "DOUB")),
+		})
+	}
+	return columns
+}
+
+// splitName splits a column definition into the name of the column, unquoted, and the rest of the definition.
+func splitName(definition string) (string, string) {
+	if len(definition) == 0 {
+		return "", ""
+	}
+	closing := map[byte]byte{'"': '"', '`': '`', '\'': '\'', '[': ']'}
+	if c, quoted := closing[definition[0]]; quoted {
+		if end := strings.IndexByte(definition[1:], c); end >= 0 {
+			return definition[1 : end+1], definition[end+2:]
+		}
+	}
+	if end := strings.IndexAny(definition, " \t\r\n("); end >= 0 {
+		return definition[:end], definition[end:]
+	}
+	return definition, ""
+}
+
+// splitDefinitions splits the definitions of a CREATE TABLE statement at the commas which are not within
+// parentheses or quotes.
+func splitDefinitions(s string) []string {
+	var result []string
+	var current bytes.Buffer
+	depth := 0
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '[':
+			quote = ']'
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			result = append(result, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	return append(result, current.String())
+}
@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabase a gzipped database with 512-byte pages, created with Python's sqlite3 module:
+//
+//	CREATE TABLE logins (id INTEGER PRIMARY KEY, "origin_url" VARCHAR NOT NULL, password BLOB, count INTEGER,
+//	                     score REAL, UNIQUE (id, count))
+//	-- for i in 1..60
+//	INSERT INTO logins VALUES (i, 'https://site<i>.example.com', <3 bytes of value i>, i if even else -i*10^9, i/4)
+//	INSERT INTO logins VALUES (500, 'big', <bytes 0 to 255, 6 times>, NULL, NULL)
+//	ALTER TABLE logins ADD COLUMN note TEXT
+//	UPDATE logins SET note='updated' WHERE id=1
+//	CREATE TABLE meta (key LONGVARCHAR NOT NULL UNIQUE PRIMARY KEY, value LONGVARCHAR)
+//	INSERT INTO meta VALUES ('version','35')
+const testDatabase = `
+H4sIAAAAAAACA+1YfXxTVxl+3yRNmrRpaUsaQmh7+xHatEmamzTpp/YW7BijlFEKA50rhWZQaZvSpnzMbfLhUHCijjnmUNmGY1NR
+2cSJc6KboGOTOZxDh4qzTphjDtdvoHB37snhZ85y/fjtP9e+vyZpn98573nOfd7zvCddtLChPRISbg33dLZGBD9oABEkQQAgvwKk
+wb9CS166mL8R/ntowLMSzThGJm4HtOML5GNAdeQqrcFqseBmMdK6oiPUGYq0Kq8ps5vq65rrhea6WQ31goIIRWtCG4WGBY1zltQ1
+zb6+rkloXNAsNC5uaBAWN85duLheuLFp7vy6pmXCvPplLmFda0dfKHa4s1Cnt1ZbENq72kIbetd2kO23tPZFwvTvFmWJFlF5T9vs
+RoPVZsMtAUqpI7yqvas3+q7haEUxoai9TZjb2Fw/p76J55AX7mknI1r6ejryhPeydgndrb2968M9bcKshgWzXMLKcF9X5Foil9C7
+MtwTEshyZGRXmEjVXL+02XVtr2RNNsPpLNHorbW2f7exKMkWMfqpaJmoPPYE8tJjv/JrKl7GEXwH38JzUWAyPiCRVEPeTD7yZihS
+9M5WhJ+qHGeTcsgRh5RRxujHZEyASDToEDEzM9OsVAa4Adz4Mj6Et+MNmAXn4RjsglDcrCAaoDZdZ7CvjkS6e6tKS3uJx4ie0IbW
+zu6OkGdluJMkPRoKQu1L0Ql93W2tkVCby6SHunQ0cNO8sfNMJCTWXLxGPVklgRtdGTvYaDTKV87tPAuSJjqjIFGZgRg7oyJ2RiIJ
+jdcQn7c8dpTBYJCv3nL0Nqgdj+Yt0dO83Ixg7Aw9idoxRjshPn0gdnBCQoJ89ZVLKVDLzlm+jqY3xs4oi52hI+HVxqf1xw7SarWy
+PL/0Yah9g7HWxLP2xc7QkKh9LTo4qr8X8ATux16sx3Si/mHYATcRUCUcU6mU3KP2cVJOJZEgZijDeNYiJ2JGRoZ8eddWDUgZ0cyu
+dJUi4VRMJyGlR0eLaSoLcGqmpaXJ46bD94HELjGOKfHURU7OKSR0YqpKZk7I1NRUeXzz28UgpTDqKSrUOSVTSEjJjLpZZQFOUrPZ
+LI9fzD8CkolRT1ahzmmaTEIrJqlk5s5nUlKSfKV7WRNI+lj9nYr+e7GD6v86PE71d3LCu7Lj9+jnhM8mIWWzPWbFM/Fx+mdlZckX
+a9dng5TF9jhDpbI4/WeQMIh2lcyc8Ha7Xb745IEnQLIz6tPjqfs44aeTkKYz6jaVBTj9bTabfMndfx1INkZ9mgp1Tv9pJPSiVSUz
+J7zVapUvPWI9DZKVUc9Uoc4JTzw8U8pk1C0qC3D6WywW+fKM+V0gWd7n+S+K32oZVwZFJExiYTwTP6d/YWGhPHJ+TRVI+ZuiW52p
+UmCc/jNJSPlsqw6VBbgycDgc8uiKB18EKS+6gKMgnrqfK4MCEkYxXyUzp39+fr48+uqpFSDlMup5KtQ5/fNISLmMeq7KAlwZ5Obm
+ymMLk0bIFzFGXVChzpWBQCJRzFHJzOmfk5Mjjz1XtwOknCgZxWAs6AAcxQvYj6dJHRzDw3gQ9+Ee3InbcCOuxTa8GRfgHKxCHzow
+C6dgIlyGQTgLZ+AkHIen4RA8CnvhHlI3d0AfrIblMSVz7P/+tpSswwRkB8dCb06kx1GQ9bAMCpL2REHWd9IoSFoKBVnLSKUg6QYU
+ZDZvpqBi4QrIHDqJguReREF24zFSkNxmKMiuKwYKkqsIBdklI4GC5AJBQXZF0FKQtP9EnVFnVG5qiv6FRDAcxPN4Bk/hcXwGD+EB
+0g124w7cgn3YictxKc7D2RhED+aiDZNRB6NwAfrhNJwg+h6Gg7AP9sBO2AYbYS1JF3/h1GlAg0M4RBnU1NRQWtXywOxFPVBNwaqq
+KgpWygNPbddDJQUrKiooWC4PikcegHIKBoNBCgbkwceGPBCgYFlZGQX98pDgfBb8FPT5fBQU5aHdLUtApKDX66VgqTyccu+bUEpB
+j8dDQbc8fNfzd4Kbgi6Xi4Il8vAVSIcSChYXF1PQKY9EAvvBSUFiehRkplZIQeJXFGRG5KAg8RgKMg/JpyCxBwqyc59LQXKkKciO
+bA4FSZOlIOueWRQkjZGCrPHZKUh6GgVZs7JRkPQhCrI+Y/3f+78v3uMCnPGTZ+2T2CRRjHeiMs7/RZFpIhUxj/OqdBbO/72KcGKp
+SmbO+EtLmbBSIbNnTzz1Ms74ifgeqZBRd6sswPm/282KRJrJqLtUqHP+TwrJlSSWqGTmjL+khFWa5GDUi1Woc8ZPqrFYcjDqTpUF
+OP93OlnVSgWb3l//r4nfapArA3K2a1LF6ngmAU7/6mp2+CU322qVSoFx+hODqJLcbKuVKgtwZVBZyYxEcjGVKuKpB7gyIGZTkSKW
+q2Tm9C8vZ24klTDqQRXqnP7EsYJSCaMeUFmAK4NAgDmbVMyol6lQ58qAuF+ZWfSrZOb09/uZPUrOTdckNWdl5wi5efkFjpmFRc7i
+EpfbU+oVff6yQLC8orKquuZDH66V6mbN/kj9dXOun3vDvIb5jQtuXNi0qHnxkpuWLvvox27++C0ty1tXrGwL3bpqdfsn1nR0doW7
+1/b0RvrWrd+w8bZP3n7HnZ/atHnL1k/fte0zn92+43N3f37nF774pXt23fvl+3bf/5UH9nz1a1/f++BDD+/7xiP7H33sm9/69oHv
+fPd7Bx9/4vuHfvDkDw//6KkfP/2TIz/92TPP/vzosV/88rnjz7/wqxMv/vqlk795+bevnPrd7189/Yc//unMn1/7S/9fX//b2XNv
+/P3N82/94+0L/3xnYHBoeGR07OKly+NXrsqAGq0uQW9INJqSks0pqVPS0jOmWjKt02zT7TMm8v6J/ikT/RlM5P0rBjB5DibO/t8b
+Zvr//5NAfibjgxB3m7ZGDJBxfzLAivZV/7HelW+2Uf0HAAcmH93EiGTU2tPWhXp628Nd/oCJ6j8M5GcyJkqYtHYjq4B3AQ0/UbIA
+IgAA`
+
+func readTestDatabase(t *testing.T) *Database {
+	compressed, err := base64.StdEncoding.DecodeString(strings.Replace(testDatabase, "\n", "", -1))
+	require.NoError(t, err)
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	db, err := Read(r)
+	require.NoError(t, err)
+	return db
+}
+
+func TestTable(t *testing.T) {
+	db := readTestDatabase(t)
+	logins, err := db.Table("logins")
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "origin_url", "password", "count", "score", "note"}, logins.Columns)
+	require.Len(t, logins.Rows, 61)
+	require.Equal(t, Row{int64(1), "https://site1.example.com", []byte{1, 1, 1}, int64(-1000000000), 0.25, "updated"},
+		logins.Rows[0])
+	for i, row := range logins.Rows[:60] {
+		n := int64(i + 1)
+		count := n
+		if n%2 == 1 {
+			count = -n * 1000000000
+		}
+		require.Equal(t, n, logins.Get(row, "ID"))
+		require.Equal(t, fmt.Sprintf("https://site%d.example.com", n), logins.Get(row, "origin_url"))
+		require.Equal(t, count, logins.Get(row, "count"))
+		require.Equal(t, float64(n)/4, logins.Get(row, "score"))
+	}
+
+	big := logins.Rows[60]
+	require.Equal(t, int64(500), logins.Get(big, "id"))
+	password := logins.Get(big, "password").([]byte)
+	require.Len(t, password, 256*6)
+	for i, b := range password {
+		require.Equal(t, byte(i), b)
+	}
+	require.Nil(t, logins.Get(big, "count"))
+	require.Nil(t, logins.Get(big, "note"))
+	require.Nil(t, logins.Get(big, "no such column"))
+
+	meta, err := db.Table("meta")
+	require.NoError(t, err)
+	require.Equal(t, []Row{{"version", "35"}}, meta.Rows)
+
+	_, err = db.Table("other")
+	require.EqualError(t, err, "no such table: other")
+}
+
+func TestReadInvalid(t *testing.T) {
+	_, err := Read(strings.NewReader("not a database"))
+	require.Equal(t, ErrCorrupt, err)
+}
+
+func TestParseColumns(t *testing.T) {
+	columns := parseColumns(`CREATE TABLE t ([a b] TEXT, "c" INTEGER PRIMARY KEY DESC, ` +
+		"`d` DOUBLE PRECISION DEFAULT 'x,y', e, f FLOATING POINT, CONSTRAINT pk PRIMARY KEY (c))")
+	require.Equal(t, []column{{name: "a b"}, {name: "c"}, {name: "d", real: true}, {name: "e"}, {name: "f"}}, columns)
+
+	columns = parseColumns("CREATE TABLE t (a REAL NOT NULL, id integer primary key autoincrement)")
+	require.Equal(t, []column{{name: "a", real: true}, {name: "id", rowid: true}}, columns)
+}
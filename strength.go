@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// strongPasswordScore the minimum score of a password which is not considered weak.
+const strongPasswordScore = 3
+
+// passwordStrength the estimated strength of a password.
+type passwordStrength struct {
+	// score from 0 (very weak) to 4 (very strong).
+	score int
+	// entropyBits the estimated entropy of the password, i.e. log2 of the number of guesses to find it.
+	entropyBits float64
+	// crackTime human-readable estimate of how long it would take to crack the password.
+	crackTime string
+	// weaknesses patterns found in the password which make it easier to guess.
+	weaknesses []string
+}
+
+// estimateStrength estimates the strength of a password, taking into consideration common passwords,
+// dictionary words, keyboard patterns, dates, repeated characters and sequences.
+// User inputs, such as usernames, are also considered easy to guess if used in the password.
+func estimateStrength(password string, userInputs ...string) passwordStrength {
+	var inputs []string
+	for _, input := range userInputs {
+		if len(input) > 0 {
+			inputs = append(inputs, input)
+		}
+	}
+	result := zxcvbn.PasswordStrength(password, inputs)
+
+	var weaknesses []string
+	seen := make(map[string]bool)
+	for _, match := range result.MatchSequence {
+		var weakness string
+		switch match.Pattern {
+		case "dictionary":
+			if match.DictionaryName == "user_inputs" {
+				weakness = "contains personal information such as the username"
+			} else {
+				weakness = "contains common words or passwords"
+			}
+		case "spatial":
+			weakness = "contains keyboard patterns"
+		case "repeat":
+			weakness = "contains repeated characters"
+		case "sequence":
+			weakness = "contains sequences like 'abc' or '123'"
+		case "date", "year":
+			weakness = "contains dates or years"
+		}
+		if len(weakness) > 0 && !seen[weakness] {
+			seen[weakness] = true
+			weaknesses = append(weaknesses, weakness)
+		}
+	}
+	if len(password) < 8 {
+		weaknesses = append(weaknesses, "is too short")
+	}
+
+	return passwordStrength{
+		score:       result.Score,
+		entropyBits: result.Entropy,
+		crackTime:   result.CrackTimeDisplay,
+		weaknesses:  weaknesses,
+	}
+}
+
+// isWeak returns true if the password should not be used.
+func (s passwordStrength) isWeak() bool {
+	return s.score < strongPasswordScore
+}
+
+// description describes the score in words.
+func (s passwordStrength) description() string {
+	switch s.score {
+	case 0:
+		return "very weak"
+	case 1:
+		return "weak"
+	case 2:
+		return "fair"
+	case 3:
+		return "strong"
+	default:
+		return "very strong"
+	}
+}
+
+// String human-readable representation of passwordStrength.
+func (s passwordStrength) String() string {
+	result := fmt.Sprintf("%s (score %d/4), about 10^%.0f guesses needed, estimated crack time: %s",
+		s.description(), s.score, s.entropyBits*math.Log10(2), s.crackTime)
+	if len(s.weaknesses) > 0 {
+		result += ".\nThe password " + strings.Join(s.weaknesses, ", ")
+	}
+	return result
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateStrength(t *testing.T) {
+	weak := []string{"password", "qwertyuiop", "aaaaaaaaaaaa", "abcdef123456", "joe1980"}
+	for _, password := range weak {
+		strength := estimateStrength(password)
+		require.True(t, strength.isWeak(), "'%s' should be weak: %s", password, strength.String())
+		require.NotEmpty(t, strength.weaknesses, "'%s' should have weaknesses", password)
+	}
+
+	strong := []string{"c7#Vq!2zR@m9Lp$x", "unsaid-crust-blubber-gleeful-zoom-abacus"}
+	for _, password := range strong {
+		strength := estimateStrength(password)
+		require.False(t, strength.isWeak(), "'%s' should be strong: %s", password, strength.String())
+	}
+}
+
+func TestStrengthConsidersUserInputs(t *testing.T) {
+	strength := estimateStrength("johnsmith", "johnsmith")
+	require.True(t, strength.isWeak())
+	require.Contains(t, strength.weaknesses, "contains personal information such as the username")
+}